@@ -13,6 +13,10 @@ const (
 	IntSourceSlice
 	String
 	StringSourceSlice
+
+	// An integer that may also be given without a value (e.g. --wrap or
+	// --wrap=120). The flag is reported in both Booleans and Integers.
+	OptionalInt
 )
 
 type Argument struct {
@@ -43,6 +47,9 @@ func MakeCommandArgumentCollection(index int, args map[string]interface{}, cmd D
 				argsBool[argument.Name] = input.(bool)
 			case Int:
 				argsInt[argument.Name] = input.(int)
+			case OptionalInt:
+				argsBool[argument.Name] = true
+				argsInt[argument.Name] = input.(int)
 			case IntSourceSlice:
 				values := input.([]int)
 				switch {
@@ -0,0 +1,193 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// The number of users and sources shown in each ranking of failures.
+const authTop = 10
+
+// Tallies authentication attempts, ranking the users and client addresses
+// with the most failures. Many failures from a single address within a
+// minute (e.g. a brute-force attempt or an application retrying with the
+// wrong password) are reported as bursts.
+type auth struct {
+	instance map[int]*authInstance
+
+	burst int64
+}
+
+type authInstance struct {
+	summary formatting.Summary
+
+	succeeded int64
+	failed    int64
+
+	// Failures keyed by principal (e.g. "app@admin") and by client address,
+	// and by client address and the minute in which they failed.
+	users   map[string]int64
+	sources map[string]int64
+	minutes map[authMinute]int64
+}
+
+type authMinute struct {
+	Source string
+	Start  time.Time
+}
+
+func init() {
+	args := Definition{
+		Usage: "output authentication successes and failures, ranking the users and clients failing most",
+		Flags: []Argument{
+			{Name: "burst", Type: Int, Usage: "report clients with at least `N` failures within a minute (default: 10)"},
+		},
+	}
+
+	GetFactory().Register("auth", args, func() (Command, error) {
+		return &auth{instance: make(map[int]*authInstance)}, nil
+	})
+}
+
+func (a *auth) Finish(index int, out commandTarget) error {
+	instance := a.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if instance.succeeded == 0 && instance.failed == 0 {
+		writer.WriteString("  no authentication attempts found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "succeeded", instance.succeeded))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "failed", instance.failed))
+
+	if instance.failed > 0 {
+		a.top(writer, "failing user", instance.users)
+		a.top(writer, "failing client", instance.sources)
+	}
+
+	bursts := make([]authMinute, 0)
+	for minute, count := range instance.minutes {
+		if count >= a.burst {
+			bursts = append(bursts, minute)
+		}
+	}
+	if len(bursts) > 0 {
+		sort.Slice(bursts, func(i, j int) bool {
+			if !bursts[i].Start.Equal(bursts[j].Start) {
+				return bursts[i].Start.Before(bursts[j].Start)
+			}
+			return bursts[i].Source < bursts[j].Source
+		})
+
+		writer.WriteString(fmt.Sprintf("\nBURSTS (at least %d failures from a client within a minute)\n", a.burst))
+		for _, burst := range bursts {
+			date := formatting.Timestamp(burst.Start, instance.summary.Start, false, internal.DateFormatCtimenoms)
+			writer.WriteString(fmt.Sprintf("   %s %s: %d failures\n", date, burst.Source, instance.minutes[burst]))
+		}
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (a *auth) Prepare(name string, index int, args ArgumentCollection) error {
+	a.instance[index] = &authInstance{
+		summary: formatting.NewSummary(name),
+		users:   make(map[string]int64),
+		sources: make(map[string]int64),
+		minutes: make(map[authMinute]int64),
+	}
+
+	a.burst = 10
+	if burst, ok := args.Integers["burst"]; ok {
+		if burst < 1 {
+			return fmt.Errorf("burst must be a positive number of failures")
+		}
+		a.burst = int64(burst)
+	}
+
+	return nil
+}
+
+func (a *auth) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := a.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		// Versions before 3.0 do not log a component.
+		msg, ok := entry.Message.(message.Authentication)
+		if !ok || (entry.Component != record.ComponentAccess && entry.Component != record.ComponentNone) {
+			continue
+		} else if !msg.Failed {
+			instance.succeeded += 1
+			continue
+		}
+
+		user := msg.Principal
+		if msg.Database != "" {
+			user += "@" + msg.Database
+		}
+		source := msg.IP
+		if source == "" {
+			source = "(unknown)"
+		}
+
+		instance.failed += 1
+		instance.users[user] += 1
+		instance.sources[source] += 1
+		if !entry.Date.IsZero() {
+			instance.minutes[authMinute{Source: source, Start: entry.Date.Truncate(time.Minute)}] += 1
+		}
+	}
+
+	return nil
+}
+
+func (a *auth) Terminate(commandTarget) error {
+	return nil
+}
+
+// Writes the keys with the most failures, most first and then by name.
+func (auth) top(writer *bytes.Buffer, label string, counts map[string]int64) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > authTop {
+		keys = keys[:authTop]
+	}
+
+	writer.WriteString(fmt.Sprintf("\n%-50s %10s\n", label, "failures"))
+	for _, key := range keys {
+		writer.WriteString(fmt.Sprintf("%-50s %10d\n", key, counts[key]))
+	}
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	failed := `2019-05-01T12:01:%02d.000+0000 I ACCESS   [conn%d] SASL SCRAM-SHA-1 authentication failed for %s on admin from client %s:5%04d ; AuthenticationFailed: SCRAM-SHA-1 authentication failed, storedKey mismatch`
+	lines := []string{
+		`2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9`,
+		`2019-05-01T12:00:01.000+0000 I ACCESS   [conn1] Successfully authenticated as principal app on admin from client 10.0.0.1:50000`,
+		`2019-05-01T12:00:02.000+0000 I ACCESS   [conn2] Successfully authenticated as principal report on admin from client 10.0.0.2:50000`,
+	}
+	// A burst of failures from a single client.
+	for index := 0; index < 12; index++ {
+		lines = append(lines, fmt.Sprintf(failed, index, index+10, "admin", "10.0.0.9", index))
+	}
+	lines = append(lines, fmt.Sprintf(failed, 30, 30, "report", "10.0.0.2", 1))
+
+	cmd := &auth{instance: make(map[int]*authInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{Integers: map[string]int{}}, lines)
+	instance := cmd.instance[0]
+
+	if instance.succeeded != 2 || instance.failed != 13 {
+		t.Errorf("expected 2 successes and 13 failures, got %d and %d", instance.succeeded, instance.failed)
+	} else if instance.users["admin@admin"] != 12 || instance.users["report@admin"] != 1 {
+		t.Errorf("user failures mismatch, got %v", instance.users)
+	} else if instance.sources["10.0.0.9"] != 12 || instance.sources["10.0.0.2"] != 1 {
+		t.Errorf("client failures mismatch, got %v", instance.sources)
+	}
+
+	for _, expected := range []string{
+		"succeeded: 2",
+		"failed: 13",
+		"Wed May  1 12:01:00 10.0.0.9: 12 failures",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output is missing %q:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "10.0.0.2: 1 failures") {
+		t.Errorf("a single failure should not be reported as a burst:\n%s", output)
+	}
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+)
+
+// Maps connection numbers to the client metadata logged when each connection
+// was established. Drivers send their metadata before any other command, so
+// the lookup is populated as entries are read and is complete for a
+// connection by the time the connection runs an operation.
+type clientLookup struct {
+	clients map[int]clientMetadata
+}
+
+type clientMetadata struct {
+	AppName string
+	Driver  string
+}
+
+func newClientLookup() *clientLookup {
+	return &clientLookup{clients: make(map[int]clientMetadata)}
+}
+
+// Records the metadata of a connection. A restart clears every connection
+// since connection numbers start over and would otherwise be attributed to
+// the clients of the previous run.
+func (c *clientLookup) Update(entry record.Entry) {
+	switch msg := entry.Message.(type) {
+	case message.ConnectionMeta:
+		conn := msg.Conn
+		if conn == 0 {
+			conn = entry.Connection
+		}
+		if conn > 0 {
+			c.clients[conn] = clientMetadata{AppName: msg.AppName, Driver: msg.Driver}
+		}
+
+	case message.StartupInfo, message.StartupInfoLegacy, message.Version:
+		if entry.Connection == 0 && len(c.clients) > 0 {
+			c.clients = make(map[int]clientMetadata)
+		}
+	}
+}
+
+// Returns the metadata of the connection an entry was logged by, if the
+// connection logged any.
+func (c *clientLookup) Get(entry record.Entry) (clientMetadata, bool) {
+	if entry.Connection == 0 {
+		return clientMetadata{}, false
+	}
+	client, ok := c.clients[entry.Connection]
+	return client, ok
+}
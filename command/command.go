@@ -121,7 +121,9 @@ func RunCommand(f Command, in []Input, out Output) error {
 	processSync.Wait()
 
 	// Allow the command to finalize any pending actions.
-	f.Terminate(outputChannel)
+	if err := f.Terminate(outputChannel); err != nil {
+		errorChannel <- err
+	}
 
 	// Finalize the output processes by closing the out channel.
 	close(outputChannel)
@@ -0,0 +1,45 @@
+package command
+
+import (
+	"testing"
+
+	_ "mgotools/parser"
+	"mgotools/parser/record"
+	"mgotools/parser/source"
+)
+
+// Runs a command against a single input of log lines and returns everything
+// written to the output channel.
+func runCommand(t *testing.T, cmd Command, args ArgumentCollection, lines []string) string {
+	if err := cmd.Prepare("test", 0, args); err != nil {
+		t.Fatalf("Prepare returned an error (%s)", err)
+	}
+
+	in := make(chan record.Base, len(lines))
+	for index, line := range lines {
+		base, err := source.JSONLog{}.NewBase(line, uint(index+1))
+		if err != nil {
+			t.Fatalf("line %d could not be parsed (%s)", index+1, err)
+		}
+		in <- base
+	}
+	close(in)
+
+	out := make(chan string, 16)
+	errs := make(chan error, len(lines))
+
+	if err := cmd.Run(0, out, in, errs); err != nil {
+		t.Fatalf("Run returned an error (%s)", err)
+	} else if err := cmd.Finish(0, out); err != nil {
+		t.Fatalf("Finish returned an error (%s)", err)
+	} else if err := cmd.Terminate(out); err != nil {
+		t.Fatalf("Terminate returned an error (%s)", err)
+	}
+
+	close(out)
+	output := ""
+	for line := range out {
+		output += line
+	}
+	return output
+}
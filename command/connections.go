@@ -0,0 +1,206 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+type connections struct {
+	instance map[int]*connectionsInstance
+}
+
+type connectionsInstance struct {
+	summary formatting.Summary
+
+	// Connections that are currently open, keyed by the context of the
+	// connection (e.g. "[conn1234]").
+	open map[string]connectionsOpened
+
+	clients map[string]*connectionsClient
+
+	// Connections that logged client metadata, keyed by driver name and
+	// version (e.g. "nodejs 3.6.0").
+	drivers map[string]uint
+
+	accepted uint
+	ended    uint
+	orphaned uint
+
+	peak     int
+	peakDate time.Time
+}
+
+type connectionsOpened struct {
+	Address string
+	Date    time.Time
+}
+
+type connectionsClient struct {
+	Accepted uint
+	Ended    uint
+}
+
+func init() {
+	args := Definition{
+		Usage: "output connection lifetime statistics, including peak concurrent connections",
+	}
+
+	GetFactory().Register("connections", args, func() (Command, error) {
+		return &connections{instance: make(map[int]*connectionsInstance)}, nil
+	})
+}
+
+func (c *connections) Finish(index int, out commandTarget) error {
+	instance := c.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "accepted", instance.accepted))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "ended", instance.ended))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "open at end of log", len(instance.open)))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "ended, not accepted", instance.orphaned))
+
+	if instance.peak > 0 {
+		writer.WriteString(fmt.Sprintf("%20s: %d at %s\n", "peak concurrent", instance.peak, instance.peakDate.Format(string(internal.DateFormatCtimenoms))))
+	}
+
+	if len(instance.clients) > 0 {
+		// Count the connections still open at the end of the log per client.
+		open := make(map[string]uint)
+		for _, conn := range instance.open {
+			open[conn.Address] += 1
+		}
+
+		addresses := make([]string, 0, len(instance.clients))
+		for address := range instance.clients {
+			addresses = append(addresses, address)
+		}
+
+		// Busiest clients first, then by address.
+		sort.Slice(addresses, func(i, j int) bool {
+			a, b := instance.clients[addresses[i]], instance.clients[addresses[j]]
+			if a.Accepted != b.Accepted {
+				return a.Accepted > b.Accepted
+			}
+			return addresses[i] < addresses[j]
+		})
+
+		writer.WriteString(fmt.Sprintf("\n%-39s %10s %10s %10s\n", "client", "accepted", "ended", "open"))
+		for _, address := range addresses {
+			client := instance.clients[address]
+			writer.WriteString(fmt.Sprintf("%-39s %10d %10d %10d\n", address, client.Accepted, client.Ended, open[address]))
+		}
+	}
+
+	if len(instance.drivers) > 0 {
+		drivers := make([]string, 0, len(instance.drivers))
+		for driver := range instance.drivers {
+			drivers = append(drivers, driver)
+		}
+
+		// Most common drivers first, then by name and version.
+		sort.Slice(drivers, func(i, j int) bool {
+			a, b := instance.drivers[drivers[i]], instance.drivers[drivers[j]]
+			if a != b {
+				return a > b
+			}
+			return drivers[i] < drivers[j]
+		})
+
+		writer.WriteString(fmt.Sprintf("\n%-50s %10s\n", "driver", "connections"))
+		for _, driver := range drivers {
+			writer.WriteString(fmt.Sprintf("%-50s %10d\n", driver, instance.drivers[driver]))
+		}
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (c *connections) Prepare(name string, index int, _ ArgumentCollection) error {
+	c.instance[index] = &connectionsInstance{
+		summary: formatting.NewSummary(name),
+		open:    make(map[string]connectionsOpened),
+		clients: make(map[string]*connectionsClient),
+		drivers: make(map[string]uint),
+	}
+
+	return nil
+}
+
+func (c *connections) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := c.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		if meta, ok := entry.Message.(message.ConnectionMeta); ok {
+			driver := meta.Driver
+			if driver == "" {
+				driver = "(unknown)"
+			}
+			instance.drivers[driver] += 1
+			continue
+		}
+
+		conn, ok := entry.Message.(message.Connection)
+		if !ok {
+			continue
+		}
+
+		address := conn.Address.String()
+		client, ok := instance.clients[address]
+		if !ok {
+			client = &connectionsClient{}
+			instance.clients[address] = client
+		}
+
+		if conn.Opened {
+			// The accepting line is logged by the listener, so the context
+			// of the new connection is created from the connection number.
+			instance.accepted += 1
+			client.Accepted += 1
+			instance.open["[conn"+strconv.Itoa(conn.Conn)+"]"] = connectionsOpened{Address: address, Date: entry.Date}
+
+			if len(instance.open) > instance.peak {
+				instance.peak = len(instance.open)
+				instance.peakDate = entry.Date
+			}
+		} else {
+			instance.ended += 1
+			client.Ended += 1
+
+			if _, ok := instance.open[entry.RawContext]; ok {
+				delete(instance.open, entry.RawContext)
+			} else {
+				// The connection was accepted before the log began.
+				instance.orphaned += 1
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *connections) Terminate(commandTarget) error {
+	return nil
+}
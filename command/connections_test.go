@@ -0,0 +1,74 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConnections(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:00:42.000-0800 I NETWORK  [conn7] end connection 10.0.0.9:40000 (0 connections now open)`,
+		`2018-01-16T15:00:43.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50000 #1 (1 connection now open)`,
+		`2018-01-16T15:00:44.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50001 #2 (2 connections now open)`,
+		`2018-01-16T15:00:45.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.2:50000 #3 (3 connections now open)`,
+		`2018-01-16T15:00:46.000-0800 I NETWORK  [conn1] end connection 10.0.0.1:50000 (2 connections now open)`,
+		`2018-01-16T15:00:47.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50002 #4 (3 connections now open)`,
+		`2018-01-16T15:00:48.000-0800 I NETWORK  [conn2] end connection 10.0.0.1:50001 (2 connections now open)`,
+	}
+
+	cmd := &connections{instance: make(map[int]*connectionsInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	instance := cmd.instance[0]
+
+	if instance.accepted != 4 || instance.ended != 3 {
+		t.Errorf("expected 4 accepted and 3 ended, got %d and %d", instance.accepted, instance.ended)
+	}
+	if instance.peak != 3 {
+		t.Errorf("expected a peak of 3 concurrent connections, got %d", instance.peak)
+	}
+	if len(instance.open) != 2 {
+		t.Errorf("expected 2 connections open at the end of the log, got %d", len(instance.open))
+	} else if _, ok := instance.open["[conn3]"]; !ok {
+		t.Errorf("conn3 should still be open, got %v", instance.open)
+	}
+	if instance.orphaned != 1 {
+		t.Errorf("expected 1 connection ended without being accepted, got %d", instance.orphaned)
+	}
+	if client := instance.clients["10.0.0.1"]; client == nil || client.Accepted != 3 || client.Ended != 2 {
+		t.Errorf("unexpected counts for 10.0.0.1: %+v", client)
+	}
+
+	for _, expected := range []string{"peak concurrent: 3", "open at end of log: 2", "10.0.0.1", "10.0.0.2"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output is missing '%s':\n%s", expected, output)
+		}
+	}
+}
+
+func TestConnections_Drivers(t *testing.T) {
+	lines := []string{
+		`2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9`,
+		`2019-05-01T12:00:01.000+0000 I NETWORK  [listener] connection accepted from 10.1.2.3:41822 #1 (1 connection now open)`,
+		`2019-05-01T12:00:01.001+0000 I NETWORK  [conn1] received client metadata from 10.1.2.3:41822 conn1: { driver: { name: "PyMongo", version: "3.7.2" }, os: { type: "Linux", name: "Linux", architecture: "x86_64", version: "4.15.0-45-generic" }, platform: "CPython 3.6.7.final.0" }`,
+		`2019-05-01T12:00:02.000+0000 I NETWORK  [listener] connection accepted from 10.1.2.4:52110 #2 (2 connections now open)`,
+		`2019-05-01T12:00:02.001+0000 I NETWORK  [conn2] received client metadata from 10.1.2.4:52110 conn2: { driver: { name: "nodejs", version: "3.2.7" }, os: { type: "Linux", name: "linux", architecture: "x64", version: "4.15.0-1035-aws" }, platform: "Node.js v10.15.3, LE, mongodb-core: 3.2.7", application: { name: "orders" } }`,
+		`2019-05-01T12:00:03.000+0000 I NETWORK  [listener] connection accepted from 10.1.2.3:41824 #3 (3 connections now open)`,
+		`2019-05-01T12:00:03.001+0000 I NETWORK  [conn3] received client metadata from 10.1.2.3:41824 conn3: { driver: { name: "PyMongo", version: "3.7.2" }, os: { type: "Linux", name: "Linux", architecture: "x86_64", version: "4.15.0-45-generic" }, platform: "CPython 3.6.7.final.0" }`,
+	}
+
+	cmd := &connections{instance: make(map[int]*connectionsInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	instance := cmd.instance[0]
+
+	if instance.accepted != 3 {
+		t.Errorf("metadata should not count as accepted connections, got %d", instance.accepted)
+	} else if len(instance.drivers) != 2 || instance.drivers["PyMongo 3.7.2"] != 2 || instance.drivers["nodejs 3.2.7"] != 1 {
+		t.Errorf("driver counts mismatch, got %v", instance.drivers)
+	}
+
+	pymongo, nodejs := strings.Index(output, "PyMongo 3.7.2"), strings.Index(output, "nodejs 3.2.7")
+	if pymongo < 0 || nodejs < 0 || pymongo > nodejs {
+		t.Errorf("expected drivers ordered by connections, got:\n%s", output)
+	}
+}
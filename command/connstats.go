@@ -25,13 +25,14 @@ func init() {
 		Flags: []Argument{
 			{Name: "conn", Type: Bool, Usage: "per connection"},
 			{Name: "ip", Type: Bool, Usage: "per IP address [default]"},
+			{Name: "relative-time", Type: Bool, Usage: "output timestamps as seconds since the first entry"},
 		},
 	}
 
 	GetFactory().Register("connstats", args, func() (command Command, err error) {
 		c := &connstats{
 			buffer:   bytes.NewBuffer([]byte{}),
-			Instance: make(map[int]connstatsInstance),
+			Instance: make(map[int]*connstatsInstance),
 		}
 
 		return c, nil
@@ -62,12 +63,13 @@ type connstatsDuration struct {
 }
 
 type connstats struct {
-	Instance map[int]connstatsInstance
+	Instance map[int]*connstatsInstance
 
 	buffer *bytes.Buffer
 
-	conn bool
-	ip   bool
+	conn     bool
+	ip       bool
+	relative bool
 }
 
 func (c *connstats) Finish(index int, out commandTarget) error {
@@ -163,7 +165,7 @@ func (c *connstats) Finish(index int, out commandTarget) error {
 
 	if c.conn {
 		// Print each connection and associated statistics.
-		c.printConn(instance.connections)
+		c.printConn(instance.connections, instance.summary.Start)
 		c.buffer.WriteRune('\n')
 	}
 
@@ -177,7 +179,7 @@ func (c *connstats) Finish(index int, out commandTarget) error {
 }
 
 func (c *connstats) Prepare(name string, index int, args ArgumentCollection) error {
-	c.Instance[index] = connstatsInstance{
+	c.Instance[index] = &connstatsInstance{
 		summary:     formatting.NewSummary(name),
 		connections: make(map[int]*connection),
 	}
@@ -191,6 +193,8 @@ func (c *connstats) Prepare(name string, index int, args ArgumentCollection) err
 		c.ip = false
 	}
 
+	c.relative = args.Booleans["relative-time"]
+
 	return nil
 }
 
@@ -289,7 +293,11 @@ func (c connstats) printDurations(total int64, dur, min, max time.Duration) {
 	c.buffer.WriteString(fmt.Sprintf("overall maximum connection duration(s): %.1fms\n", max.Seconds()/1000))
 }
 
-func (c connstats) printConn(connections map[int]*connection) {
+func (c connstats) printConn(connections map[int]*connection, start time.Time) {
+	format := func(date time.Time) string {
+		return formatting.Timestamp(date, start, c.relative, internal.DateFormatIso8602Utc)
+	}
+
 	i := 0
 	keys := make([]int, len(connections))
 	for conn := range connections {
@@ -311,8 +319,8 @@ func (c connstats) printConn(connections map[int]*connection) {
 				"closed: %-18s  "+
 				"dur(s): %8.2f\n",
 				keys[i],
-				conn.Opened.Format(string(internal.DateFormatIso8602Utc)),
-				conn.Closed.Format(string(internal.DateFormatIso8602Utc)),
+				format(conn.Opened),
+				format(conn.Closed),
 				conn.Closed.Sub(conn.Opened).Seconds(),
 			))
 		} else if conn.Opened.IsZero() {
@@ -320,13 +328,13 @@ func (c connstats) printConn(connections map[int]*connection) {
 				"opened: n/a                       "+
 				"closed: %-18s\n",
 				keys[i],
-				conn.Closed.Format(string(internal.DateFormatIso8602Utc))))
+				format(conn.Closed)))
 		} else if conn.Closed.IsZero() {
 			c.buffer.WriteString(fmt.Sprintf("%-14d "+
 				"opened: %-18s  "+
 				"closed: n/a\n",
 				keys[i],
-				conn.Opened.Format(string(internal.DateFormatIso8602Utc))))
+				format(conn.Opened)))
 		}
 	}
 }
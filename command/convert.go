@@ -0,0 +1,228 @@
+package command
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+// Rewrites a log in the structured (JSON) format written by 4.4 and later,
+// one object per line. Operations become "Slow query" lines with the same
+// attributes the server logs, so the output can be read by this tool (or any
+// other tool expecting structured logs) as if it were written by 4.4.
+type convert struct{}
+
+// A line of a structured log. Lines that could not be parsed keep the reason
+// in parseError and the original text in msg rather than being dropped.
+type convertLine struct {
+	Date       *convertDate           `json:"t,omitempty"`
+	Severity   string                 `json:"s"`
+	Component  string                 `json:"c"`
+	Context    string                 `json:"ctx"`
+	Message    string                 `json:"msg"`
+	Attributes map[string]interface{} `json:"attr,omitempty"`
+	ParseError string                 `json:"parseError,omitempty"`
+}
+
+type convertDate struct {
+	Date string `json:"$date"`
+}
+
+// The message of operations in a structured log.
+const convertSlowQuery = "Slow query"
+
+func init() {
+	args := Definition{
+		Usage: "convert a log to the structured (JSON) format of 4.4 and later, one object per line",
+	}
+
+	GetFactory().Register("convert", args, func() (Command, error) {
+		return &convert{}, nil
+	})
+}
+
+func (c *convert) Finish(int, commandTarget) error {
+	return nil
+}
+
+func (c *convert) Prepare(string, int, ArgumentCollection) error {
+	return nil
+}
+
+func (c *convert) Run(_ int, out commandTarget, in commandSource, errs commandError) error {
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err == nil && entry.Message == nil && context.LastError != nil {
+			// Lines without a message are normally skipped, but the reason
+			// every parser gave up still explains why.
+			err = context.LastError
+		}
+
+		line := c.line(base, entry, err)
+		if output, err := json.Marshal(line); err != nil {
+			errs <- err
+		} else {
+			out <- string(output)
+		}
+	}
+
+	return nil
+}
+
+func (c *convert) Terminate(commandTarget) error {
+	return nil
+}
+
+func (c *convert) line(base record.Base, entry record.Entry, err error) convertLine {
+	line := convertLine{
+		Severity:   base.Severity.String(),
+		Component:  base.Component.String(),
+		Context:    strings.TrimSuffix(strings.TrimPrefix(base.RawContext, "["), "]"),
+		Message:    base.RawMessage,
+		Attributes: base.Attributes,
+	}
+	if line.Component == "" {
+		line.Component = "-"
+	}
+
+	if err != nil {
+		// The original line is kept so the conversion loses nothing.
+		line.ParseError, line.Message = err.Error(), base.String()
+	}
+
+	if entry.DateValid {
+		// Dates in a ctime format have no offset and are taken to be local.
+		date := entry.Date
+		switch entry.Format {
+		case internal.DateFormatCtime, internal.DateFormatCtimenoms, internal.DateFormatCtimeyear:
+			date = internal.DateInZone(date, entry.Format, time.Local)
+		}
+		line.Date = &convertDate{date.Format("2006-01-02T15:04:05.000-07:00")}
+	}
+
+	if base.Attributes == nil && err == nil {
+		if attr, ok := c.operation(entry.Message); ok {
+			line.Message, line.Attributes = convertSlowQuery, attr
+		}
+	}
+
+	return line
+}
+
+// The attributes of a slow operation as a structured log writes them, along
+// with the filter, sort, and other parts of a CRUD operation under "crud".
+func (c *convert) operation(msg message.Message) (map[string]interface{}, bool) {
+	var (
+		attr    = make(map[string]interface{})
+		payload message.Payload
+	)
+
+	switch t := msg.(type) {
+	case message.CRUD:
+		attr, ok := c.operation(t.Message)
+		if ok {
+			attr["crud"] = c.crud(t)
+		}
+		return attr, ok
+
+	case message.Command:
+		attr["type"] = "command"
+		payload = t.Payload
+		c.set(attr, "appName", t.Agent)
+		c.set(attr, "protocol", t.Protocol)
+		if len(t.Locks) > 0 {
+			attr["locks"] = mongo.Extended(t.Locks)
+		}
+		if len(t.Storage) > 0 {
+			attr["storage"] = mongo.Extended(t.Storage)
+		}
+
+	case message.CommandLegacy:
+		attr["type"] = "command"
+		payload = t.Payload
+		if len(t.Locks) > 0 {
+			attr["locks"] = t.Locks
+		}
+
+	case message.Operation:
+		attr["type"] = t.Operation
+		payload = t.Payload
+		c.set(attr, "appName", t.Agent)
+		if len(t.Locks) > 0 {
+			attr["locks"] = mongo.Extended(t.Locks)
+		}
+		if len(t.Storage) > 0 {
+			attr["storage"] = mongo.Extended(t.Storage)
+		}
+
+	case message.OperationLegacy:
+		attr["type"] = t.Operation
+		payload = t.Payload
+		if len(t.Locks) > 0 {
+			attr["locks"] = t.Locks
+		}
+
+	default:
+		return nil, false
+	}
+
+	cmd, _ := message.BaseFromMessage(msg)
+	for key, value := range cmd.Counters {
+		attr[key] = value
+	}
+
+	attr["ns"] = cmd.Namespace
+	attr["durationMillis"] = cmd.Duration
+	attr["command"] = mongo.Extended(map[string]interface{}(payload))
+	c.set(attr, "errMsg", cmd.Exception)
+	c.set(attr, "queryHash", cmd.QueryHash)
+	c.set(attr, "planCacheKey", cmd.PlanCacheKey)
+	c.set(attr, "planSummary", planSummary(cmd.PlanSummary))
+
+	return attr, true
+}
+
+func (c *convert) crud(crud message.CRUD) map[string]interface{} {
+	out := make(map[string]interface{})
+	c.set(out, "comment", crud.Comment)
+	c.set(out, "hint", crud.Hint)
+	c.set(out, "origin", crud.Origin)
+
+	for key, value := range map[string]map[string]interface{}{
+		"filter":     crud.Filter,
+		"projection": crud.Project,
+		"sort":       crud.Sort,
+		"update":     crud.Update,
+	} {
+		if len(value) > 0 {
+			out[key] = mongo.Extended(value)
+		}
+	}
+
+	if len(crud.Pipeline) > 0 {
+		out["pipeline"] = crud.Pipeline
+	}
+	if crud.CursorId > 0 {
+		out["cursorid"] = crud.CursorId
+	}
+	if crud.N > 0 {
+		out["n"] = crud.N
+	}
+	return out
+}
+
+// Sets an attribute only when the value is known, as the server does.
+func (convert) set(attr map[string]interface{}, key, value string) {
+	if value != "" {
+		attr[key] = value
+	}
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"mgotools/internal"
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/source"
+	"mgotools/parser/version"
+)
+
+func TestConvert(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:00:01.000-0400 I  NETWORK  [listener] connection accepted from 127.0.0.1:53342 #12 (1 connection now open)`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn12] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1, _id: ObjectId('5d4ed0a86b1ab1e4f1a2b3c4') }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 150ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn12] command test.foo command: find { find: "foo", filter: { a: 1 `,
+	}
+
+	output := runCommand(t, &convert{}, ArgumentCollection{}, lines)
+
+	var converted []string
+	decoder := json.NewDecoder(strings.NewReader(output))
+	for {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("output is not a series of JSON objects (%s):\n%s", err, output)
+		}
+		converted = append(converted, string(raw))
+	}
+	if len(converted) != len(lines) {
+		t.Fatalf("expected %d lines, got %d:\n%s", len(lines), len(converted), output)
+	}
+
+	var first convertLine
+	if err := json.Unmarshal([]byte(converted[1]), &first); err != nil {
+		t.Fatalf("unexpected error reading line 2 (%s)", err)
+	}
+	expected := convertLine{
+		Date:      &convertDate{"2019-08-10T10:00:01.000-04:00"},
+		Severity:  "I",
+		Component: "NETWORK",
+		Context:   "listener",
+		Message:   "connection accepted from 127.0.0.1:53342 #12 (1 connection now open)",
+	}
+	if *first.Date != *expected.Date || first.Severity != expected.Severity || first.Component != expected.Component ||
+		first.Context != expected.Context || first.Message != expected.Message || first.ParseError != "" {
+		t.Errorf("line 2 mismatch, expected %+v, got %+v", expected, first)
+	}
+
+	var broken convertLine
+	if err := json.Unmarshal([]byte(converted[3]), &broken); err != nil {
+		t.Fatalf("unexpected error reading line 4 (%s)", err)
+	} else if broken.ParseError == "" || broken.Message != lines[3] {
+		t.Errorf("line 4 should keep the original line and a parse error, got %+v", broken)
+	}
+
+	// The operation should read back from the structured log as it was
+	// parsed from the text log.
+	base, err := source.JSONLog{}.NewBase(converted[2], 3)
+	if err != nil {
+		t.Fatalf("unexpected error reading line 3 (%s)", err)
+	}
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	entry, err := context.NewEntry(base)
+	if err != nil {
+		t.Fatalf("unexpected error parsing line 3 (%s)", err)
+	}
+	crud, ok := entry.Message.(message.CRUD)
+	if !ok {
+		t.Fatalf("expected a CRUD message, got %T", entry.Message)
+	}
+	cmd, _ := message.BaseFromMessage(crud)
+	oid, _ := mongo.NewObjectId("5d4ed0a86b1ab1e4f1a2b3c4")
+	if cmd.Namespace != "test.foo" || cmd.Duration != 150 || cmd.Counters["docsExamined"] != 1 {
+		t.Errorf("operation mismatch, got %+v", cmd)
+	} else if planSummary(cmd.PlanSummary) != "IXSCAN { a: 1 }" {
+		t.Errorf("expected the plan summary to survive, got %s", planSummary(cmd.PlanSummary))
+	} else if crud.Filter["a"] != 1 || crud.Filter["_id"] != oid {
+		t.Errorf("expected the filter to survive, got %v", crud.Filter)
+	} else if agent := crud.Message.(message.Command).Agent; agent != "MongoDB Shell" {
+		t.Errorf("expected the app name to survive, got '%s'", agent)
+	}
+}
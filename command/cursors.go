@@ -0,0 +1,285 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// Follows each cursor from the operation that opened it (e.g. a find or
+// aggregate that logged a cursorid) through its getMores until it was
+// exhausted or killed. Cursors still open when their connection ended are
+// reported as abandoned since they linger until the server times them out.
+type cursors struct {
+	instance map[int]*cursorsInstance
+
+	limit int
+}
+
+type cursorsInstance struct {
+	summary formatting.Summary
+
+	// Cursors that are currently open, keyed by cursor id, and every cursor
+	// that has been closed (or was still open when the server restarted).
+	open   map[int64]*cursorsCursor
+	closed []*cursorsCursor
+}
+
+type cursorsCursor struct {
+	Id        int64
+	Namespace string
+	Conn      int
+
+	// The number of getMores and the total duration (in microseconds) of
+	// the cursor, including the operation that opened it.
+	GetMores int64
+	Sum      int64
+
+	// Whether the operation that opened the cursor was logged, which is not
+	// the case for cursors opened before the log began.
+	Created bool
+	First   time.Time
+	Last    time.Time
+
+	Disposition string
+}
+
+const (
+	cursorsAbandoned = "abandoned"
+	cursorsExhausted = "exhausted"
+	cursorsKilled    = "killed"
+	cursorsOpen      = "open"
+	cursorsRestarted = "restarted"
+)
+
+func init() {
+	args := Definition{
+		Usage: "output cursor lifetimes, getMore activity, and how each cursor was closed",
+		Flags: []Argument{
+			{Name: "limit", Type: Int, Usage: "only show the `N` longest lived cursors"},
+		},
+	}
+
+	GetFactory().Register("cursors", args, func() (Command, error) {
+		return &cursors{instance: make(map[int]*cursorsInstance)}, nil
+	})
+}
+
+func (c *cursors) Finish(index int, out commandTarget) error {
+	instance := c.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	all := append([]*cursorsCursor{}, instance.closed...)
+	for _, cursor := range instance.open {
+		cursor.Disposition = cursorsOpen
+		all = append(all, cursor)
+	}
+	if len(all) == 0 {
+		writer.WriteString("  no cursors found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, cursor := range all {
+		counts[cursor.Disposition] += 1
+	}
+	for _, disposition := range []string{cursorsExhausted, cursorsKilled, cursorsAbandoned, cursorsRestarted, cursorsOpen} {
+		writer.WriteString(fmt.Sprintf("%20s: %d\n", disposition, counts[disposition]))
+	}
+
+	// Longest lived cursors first, then by cursor id.
+	sort.Slice(all, func(i, j int) bool {
+		a, b := all[i].Last.Sub(all[i].First), all[j].Last.Sub(all[j].First)
+		if a != b {
+			return a > b
+		}
+		return all[i].Id < all[j].Id
+	})
+	if c.limit > 0 && len(all) > c.limit {
+		all = all[:c.limit]
+	}
+
+	writer.WriteString(fmt.Sprintf("\n%-20s %-30s %10s %12s %16s  %s\n", "cursorid", "namespace", "getmores", "total (ms)", "lifetime", "disposition"))
+	for _, cursor := range all {
+		lifetime := cursor.Last.Sub(cursor.First).String()
+		if !cursor.Created {
+			// The cursor was opened before the log began.
+			lifetime = ">" + lifetime
+		}
+
+		writer.WriteString(fmt.Sprintf("%-20d %-30s %10d %12s %16s  %s\n",
+			cursor.Id,
+			cursor.Namespace,
+			cursor.GetMores,
+			strconv.FormatFloat(float64(cursor.Sum)/1000, 'f', 1, 64),
+			lifetime,
+			cursor.Disposition))
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (c *cursors) Prepare(name string, index int, args ArgumentCollection) error {
+	c.instance[index] = &cursorsInstance{
+		summary: formatting.NewSummary(name),
+		open:    make(map[int64]*cursorsCursor),
+	}
+
+	if limit, ok := args.Integers["limit"]; ok {
+		if limit < 1 {
+			return fmt.Errorf("limit must be a positive number of cursors")
+		}
+		c.limit = limit
+	}
+
+	return nil
+}
+
+func (c *cursors) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := c.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		switch msg := entry.Message.(type) {
+		case message.StartupInfo, message.StartupInfoLegacy, message.Version:
+			// Cursors do not survive a restart and their ids may be reused
+			// by the next run.
+			if entry.Connection == 0 {
+				for _, cursor := range instance.open {
+					instance.close(cursor, cursorsRestarted)
+				}
+			}
+
+		case message.Connection:
+			conn := msg.Conn
+			if conn == 0 {
+				conn = entry.Connection
+			}
+			if !msg.Opened && conn > 0 {
+				for _, cursor := range instance.open {
+					if cursor.Conn == conn {
+						instance.close(cursor, cursorsAbandoned)
+					}
+				}
+			}
+
+		case message.CRUD:
+			instance.crud(entry.Connection, entry.Date, msg)
+
+		default:
+			for _, id := range killedCursors(msg) {
+				if cursor, ok := instance.open[id]; ok {
+					cursor.Last = entry.Date
+					instance.close(cursor, cursorsKilled)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *cursors) Terminate(commandTarget) error {
+	return nil
+}
+
+// Opens a cursor for an operation that logged a cursor id, or adds a getMore
+// to the cursor it continues.
+func (c *cursorsInstance) crud(conn int, date time.Time, crud message.CRUD) {
+	if crud.CursorId == 0 {
+		return
+	}
+
+	ns, op, dur, ok := query{}.standardize(crud)
+	if !ok {
+		return
+	}
+
+	cursor, open := c.open[crud.CursorId]
+	getMore := internal.StringToLower(op) == "getmore"
+	if open && !getMore {
+		// The id was reused without the previous cursor being closed.
+		c.close(cursor, cursorsOpen)
+	}
+	if !open || !getMore {
+		// A getMore without an open cursor continues a cursor opened
+		// before the log began.
+		cursor = &cursorsCursor{Id: crud.CursorId, Namespace: ns, Created: !getMore, First: date}
+		c.open[crud.CursorId] = cursor
+	}
+	if getMore {
+		cursor.GetMores += 1
+	}
+
+	cursor.Conn = conn
+	cursor.Last = date
+	cursor.Sum += dur
+
+	if base, ok := message.BaseFromMessage(crud); ok && base.Counters["cursorExhausted"] > 0 {
+		c.close(cursor, cursorsExhausted)
+	}
+}
+
+func (c *cursorsInstance) close(cursor *cursorsCursor, disposition string) {
+	cursor.Disposition = disposition
+	c.closed = append(c.closed, cursor)
+	delete(c.open, cursor.Id)
+}
+
+// Returns the cursor ids of a killCursors command, or of a killcursors
+// operation that logged its command.
+func killedCursors(msg message.Message) []int64 {
+	var payload message.Payload
+	switch t := msg.(type) {
+	case message.Command:
+		if internal.StringToLower(t.Command) == "killcursors" {
+			payload = t.Payload
+		}
+	case message.CommandLegacy:
+		if internal.StringToLower(t.Command) == "killcursors" {
+			payload = t.Payload
+		}
+	case message.Operation:
+		if internal.StringToLower(t.Operation) == "killcursors" {
+			payload = t.Payload
+		}
+	case message.OperationLegacy:
+		if internal.StringToLower(t.Operation) == "killcursors" {
+			payload = t.Payload
+		}
+	}
+
+	list, _ := payload["cursors"].([]interface{})
+	ids := make([]int64, 0, len(list))
+	for _, value := range list {
+		switch id := value.(type) {
+		case int:
+			ids = append(ids, int64(id))
+		case int64:
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
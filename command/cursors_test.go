@@ -0,0 +1,69 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCursors(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, batchSize: 1, $db: "test" } planSummary: COLLSCAN cursorid:101 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: getMore { getMore: 101, collection: "foo", $db: "test" } originatingCommand: { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN cursorid:101 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+		`2018-01-16T15:01:05.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: getMore { getMore: 101, collection: "foo", $db: "test" } originatingCommand: { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN cursorid:101 keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+		`2018-01-16T15:01:06.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { b: 1 }, batchSize: 1, $db: "test" } planSummary: COLLSCAN cursorid:102 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:07.000-0800 I COMMAND  [conn1] command test.$cmd appName: "MongoDB Shell" command: killCursors { killCursors: "foo", cursors: [ 102 ], $db: "test" } numYields:0 reslen:100 locks:{} protocol:op_msg 1ms`,
+		`2018-01-16T15:01:08.000-0800 I COMMAND  [conn2] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { c: 1 }, batchSize: 1, $db: "test" } planSummary: COLLSCAN cursorid:103 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:09.000-0800 I NETWORK  [conn2] end connection 10.0.0.1:50000 (1 connection now open)`,
+		`2018-01-16T15:01:11.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { d: 1 }, batchSize: 1, $db: "test" } planSummary: COLLSCAN cursorid:105 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:02:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:02:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { d: 1 }, batchSize: 1, $db: "test" } planSummary: COLLSCAN cursorid:105 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:02:02.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: getMore { getMore: 104, collection: "foo", $db: "test" } planSummary: COLLSCAN cursorid:104 keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+	}
+
+	cmd := &cursors{instance: make(map[int]*cursorsInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	instance := cmd.instance[0]
+
+	if len(instance.closed) != 4 || len(instance.open) != 2 {
+		t.Fatalf("expected 4 closed and 2 open cursors, got %d and %d:\n%s", len(instance.closed), len(instance.open), output)
+	}
+
+	for _, cursor := range instance.closed {
+		var expected cursorsCursor
+		switch cursor.Id {
+		case 101:
+			expected = cursorsCursor{Namespace: "test.foo", GetMores: 2, Sum: 20000, Created: true, Disposition: cursorsExhausted}
+		case 102:
+			expected = cursorsCursor{Namespace: "test.foo", Sum: 10000, Created: true, Disposition: cursorsKilled}
+		case 103:
+			expected = cursorsCursor{Namespace: "test.bar", Sum: 10000, Created: true, Disposition: cursorsAbandoned}
+		case 105:
+			expected = cursorsCursor{Namespace: "test.foo", Sum: 10000, Created: true, Disposition: cursorsRestarted}
+		default:
+			t.Errorf("unexpected closed cursor %+v", cursor)
+			continue
+		}
+		if cursor.Namespace != expected.Namespace || cursor.GetMores != expected.GetMores || cursor.Sum != expected.Sum || cursor.Created != expected.Created || cursor.Disposition != expected.Disposition {
+			t.Errorf("cursor %d mismatch, got %+v", cursor.Id, cursor)
+		}
+	}
+
+	if cursor := instance.open[104]; cursor == nil || cursor.Created || cursor.GetMores != 1 {
+		t.Errorf("a getMore without its originating operation should open a cursor, got %+v", cursor)
+	}
+	if cursor := instance.open[105]; cursor == nil || !cursor.Created {
+		t.Errorf("a cursor id reused after a restart should open a new cursor, got %+v", cursor)
+	}
+
+	for _, expected := range []string{"exhausted: 1", "killed: 1", "abandoned: 1", "restarted: 1", "open: 2", ">0s"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output is missing '%s':\n%s", expected, output)
+		}
+	}
+
+	// The exhausted cursor lived the longest.
+	if table := output[strings.Index(output, "cursorid"):]; !strings.HasPrefix(strings.SplitN(table, "\n", 3)[1], "101 ") {
+		t.Errorf("cursors should be sorted by lifetime:\n%s", output)
+	}
+}
@@ -0,0 +1,160 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+type exceptions struct {
+	instance map[int]*exceptionsInstance
+}
+
+type exceptionsInstance struct {
+	summary formatting.Summary
+	counts  map[exceptionsKey]uint
+}
+
+type exceptionsKey struct {
+	Component record.Component
+	Severity  record.Severity
+	Message   string
+}
+
+func init() {
+	args := Definition{
+		Usage: "output a ranked list of exceptions, assertions, and errors",
+	}
+
+	GetFactory().Register("exceptions", args, func() (Command, error) {
+		return &exceptions{instance: make(map[int]*exceptionsInstance)}, nil
+	})
+}
+
+func (e *exceptions) Finish(index int, out commandTarget) error {
+	instance := e.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.counts) == 0 {
+		writer.WriteString("  no exceptions found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	keys := make([]exceptionsKey, 0, len(instance.counts))
+	for key := range instance.counts {
+		keys = append(keys, key)
+	}
+
+	// Most frequent first, then ordered by component and message.
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if instance.counts[a] != instance.counts[b] {
+			return instance.counts[a] > instance.counts[b]
+		} else if a.Component != b.Component {
+			return a.Component.String() < b.Component.String()
+		}
+		return a.Message < b.Message
+	})
+
+	writer.WriteString(fmt.Sprintf("%8s  %-14s %-8s %s\n", "count", "component", "severity", "exception"))
+	for _, key := range keys {
+		component := key.Component.String()
+		if component == "" {
+			component = "-"
+		}
+		writer.WriteString(fmt.Sprintf("%8d  %-14s %-8s %s\n", instance.counts[key], component, key.Severity.String(), key.Message))
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (e *exceptions) Prepare(name string, index int, _ ArgumentCollection) error {
+	e.instance[index] = &exceptionsInstance{
+		summary: formatting.NewSummary(name),
+		counts:  make(map[exceptionsKey]uint),
+	}
+
+	return nil
+}
+
+func (e *exceptions) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := e.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		var text string
+		if cmd, ok := message.BaseFromMessage(entry.Message); ok && cmd.Exception != "" {
+			// Operations (including CRUD messages) carry their own exception.
+			text = cmd.Exception
+		} else if entry.Severity == record.SeverityE || entry.Severity == record.SeverityF || strings.Contains(strings.ToLower(entry.RawMessage), "assertion") {
+			text = entry.RawMessage
+		} else {
+			continue
+		}
+
+		key := exceptionsKey{
+			Component: entry.Component,
+			Severity:  entry.Severity,
+			Message:   normalizeException(text),
+		}
+		instance.counts[key] += 1
+	}
+
+	return nil
+}
+
+func (e *exceptions) Terminate(commandTarget) error {
+	return nil
+}
+
+// Numbers (including those within a word, e.g. collection-12.wt) and object
+// ids vary between otherwise identical exceptions.
+var (
+	exceptionNumber   = regexp.MustCompile(`\b[0-9]+(\.[0-9]+)?\b`)
+	exceptionObjectId = regexp.MustCompile(`\b[0-9a-fA-F]{24}\b`)
+)
+
+// Replaces the variable parts of an exception so similar exceptions collapse
+// into a single message. Numbers become N (except assertion and error codes),
+// object ids become ObjectId, and namespaces become "?".
+func normalizeException(text string) string {
+	words := strings.Fields(text)
+	previous := ""
+	for index, word := range words {
+		switch {
+		case previous == "ns":
+			words[index] = "?"
+		case previous == "assertion", previous == "code", previous == "errno", strings.HasPrefix(word, "code:"):
+			// Codes identify the error so they are kept as is.
+		default:
+			word = exceptionObjectId.ReplaceAllString(word, "ObjectId")
+			words[index] = exceptionNumber.ReplaceAllString(word, "N")
+		}
+		previous = strings.ToLower(strings.TrimRight(word, ":="))
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,56 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"mgotools/parser/record"
+)
+
+func TestExceptions(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, maxTimeMS: 10 } planSummary: COLLSCAN exception: operation exceeded time limit code:50 numYields:0 reslen:100 locks:{} protocol:op_msg 12ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, maxTimeMS: 10 } planSummary: COLLSCAN exception: operation exceeded time limit code:50 numYields:0 reslen:100 locks:{} protocol:op_msg 11ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn2] assertion 13435 on ns foo.bar query: { a: 1 }`,
+		`2018-01-16T15:01:03.000-0800 I COMMAND  [conn3] assertion 13435 on ns foo.baz query: { a: 2 }`,
+		`2018-01-16T15:01:04.000-0800 E STORAGE  [conn4] WiredTiger error (12) [1516143664:0], file:collection-2.wt`,
+		`2018-01-16T15:01:05.000-0800 E STORAGE  [conn5] WiredTiger error (12) [1516143665:1], file:collection-2.wt`,
+		`2018-01-16T15:01:06.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50000 #1 (1 connection now open)`,
+	}
+
+	cmd := &exceptions{instance: make(map[int]*exceptionsInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	counts := cmd.instance[0].counts
+
+	for key, expected := range map[exceptionsKey]uint{
+		{record.ComponentCommand, record.SeverityI, "operation exceeded time limit code:50"}:            2,
+		{record.ComponentCommand, record.SeverityI, "assertion 13435 on ns ? query: { a: N }"}:          2,
+		{record.ComponentStorage, record.SeverityE, "WiredTiger error (N) [N:N], file:collection-N.wt"}: 2,
+	} {
+		if counts[key] != expected {
+			t.Errorf("expected %d of %+v, got %d", expected, key, counts[key])
+		}
+	}
+	if len(counts) != 3 {
+		t.Errorf("expected 3 distinct exceptions, got %v", counts)
+	}
+	if !strings.Contains(output, "2  COMMAND") || !strings.Contains(output, "assertion 13435 on ns ?") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
+
+func TestNormalizeException(t *testing.T) {
+	for text, expected := range map[string]string{
+		"assertion 13435 on ns foo":                   "assertion 13435 on ns ?",
+		"document 5a5e8a2f1c9d440000a1b2c3 not found": "document ObjectId not found",
+		"timed out after 30000ms":                     "timed out after 30000ms",
+		"error code: 11000 after 3 retries":           "error code: 11000 after N retries",
+		"- failed":                                    "- failed",
+		"failed with code:11000 on 2 shards":          "failed with code:11000 on N shards",
+	} {
+		if got := normalizeException(text); got != expected {
+			t.Errorf("normalizeException(%q) = %q, expected %q", text, got, expected)
+		}
+	}
+}
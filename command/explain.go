@@ -0,0 +1,113 @@
+// The explain-line command shows how individual log lines are interpreted by
+// the parsers and where each would appear in the query report.
+
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"mgotools/internal"
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+)
+
+type explain struct {
+	// A query command used only to determine the row a line contributes to.
+	query *query
+}
+
+func init() {
+	args := Definition{
+		Usage:         "explain how each log line (or each argument) is parsed and reported",
+		LineArguments: true,
+		Flags: []Argument{
+			{Name: "system", Type: Bool, Usage: "include system collections as the query command would"},
+		},
+	}
+
+	GetFactory().Register("explain-line", args, func() (Command, error) {
+		return &explain{}, nil
+	})
+}
+
+func (e *explain) Finish(int, commandTarget) error {
+	return nil
+}
+
+func (e *explain) Prepare(_ string, _ int, args ArgumentCollection) error {
+	e.query = &query{system: args.Booleans["system"]}
+	return nil
+}
+
+func (e *explain) Run(_ int, out commandTarget, in commandSource, _ commandError) error {
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		writer := bytes.NewBuffer([]byte{})
+		writer.WriteString(fmt.Sprintf("line %d: %s\n", base.LineNumber, base.String()))
+
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			writer.WriteString(fmt.Sprintf("      error: %s\n", err))
+			out <- writer.String()
+			continue
+		}
+
+		writer.WriteString(fmt.Sprintf("    version: %s\n", context.LastWinner.String()))
+		if entry.Message == nil {
+			writer.WriteString("    message: none\n")
+			out <- writer.String()
+			continue
+		}
+
+		writer.WriteString(fmt.Sprintf("    message: %T\n", entry.Message))
+		if cmd, ok := message.BaseFromMessage(entry.Message); ok {
+			writer.WriteString(fmt.Sprintf("  namespace: %s\n", cmd.Namespace))
+			writer.WriteString(fmt.Sprintf("   duration: %dms\n", cmd.Duration))
+			writer.WriteString(fmt.Sprintf("   counters: %s\n", e.counters(cmd.Counters)))
+		}
+
+		crud, ok := entry.Message.(message.CRUD)
+		if !ok {
+			writer.WriteString("        row: none (not a CRUD operation)\n")
+			out <- writer.String()
+			continue
+		}
+
+		writer.WriteString(fmt.Sprintf("    pattern: %s\n", mongo.NewPattern(crud.Filter).StringCompact()))
+		if ns, op, _, ok := e.query.standardize(crud); !ok {
+			writer.WriteString("        row: none (unrecognized operation)\n")
+		} else if ns, op, filter, pipeline, ok := e.query.row(crud, ns, op); !ok {
+			writer.WriteString("        row: none (excluded from the query report)\n")
+		} else {
+			writer.WriteString(fmt.Sprintf("        row: %s %s %s%s\n", ns, op, filter.StringCompact(), pipeline))
+		}
+
+		out <- writer.String()
+	}
+
+	return nil
+}
+
+func (e *explain) Terminate(commandTarget) error {
+	return nil
+}
+
+func (explain) counters(counters map[string]int64) string {
+	keys := make([]string, 0, len(counters))
+	for key := range counters {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for index, key := range keys {
+		keys[index] = fmt.Sprintf("%s:%d", key, counters[key])
+	}
+
+	return strings.Join(keys, " ")
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain_Lines(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #2 (1 connection now open)`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: insert { insert: "foo", ordered: true } ninserted:1 keysInserted:1 numYields:0 reslen:29 locks:{} protocol:op_msg 1ms`,
+	}
+
+	output := runCommand(t, &explain{}, ArgumentCollection{}, lines)
+	for _, expect := range []string{
+		"    version: mongod 3.6",
+		"    message: message.CRUD",
+		"  namespace: test.foo",
+		"   duration: 10ms",
+		"   counters: cursorExhausted:1 docsExamined:1 keysExamined:0 nreturned:1 numYields:0 reslen:100",
+		`    pattern: {"a": 1}`,
+		`        row: test.foo find {"a": 1}`,
+		"    message: message.Connection\n        row: none (not a CRUD operation)",
+		"        row: test.foo insert {}",
+	} {
+		if !strings.Contains(output, expect) {
+			t.Errorf("expected '%s' in the explanation, got:\n%s", expect, output)
+		}
+	}
+}
@@ -6,6 +6,8 @@
 package command
 
 import (
+	"sort"
+
 	"mgotools/internal"
 
 	"github.com/pkg/errors"
@@ -14,6 +16,15 @@ import (
 type Definition struct {
 	Usage string
 	Flags []Argument
+
+	// Positional arguments are raw log lines rather than file names.
+	LineArguments bool
+}
+
+// A registered command name and its definition.
+type Registration struct {
+	Name string
+	Definition
 }
 
 type factory struct {
@@ -65,6 +76,19 @@ func (c *factory) GetDefinition(name string) (Definition, bool) {
 	}
 	return reg.args, ok
 }
+
+// Lists every registered command along with its usage and flags, sorted by
+// name, for tooling that needs to enumerate commands (e.g. help generation).
+func (c *factory) List() []Registration {
+	list := make([]Registration, 0, len(c.registry))
+	for name, reg := range c.registry {
+		list = append(list, Registration{Name: name, Definition: reg.args})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
 func (c *factory) Register(name string, args Definition, create func() (Command, error)) {
 	if name == "" {
 		panic("empty name registered in the command factory")
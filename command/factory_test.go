@@ -0,0 +1,40 @@
+package command
+
+import "testing"
+
+func TestFactory_List(t *testing.T) {
+	list := GetFactory().List()
+
+	names := make(map[string]Definition)
+	for index, reg := range list {
+		if index > 0 && list[index-1].Name >= reg.Name {
+			t.Errorf("commands are not sorted by name (%s, %s)", list[index-1].Name, reg.Name)
+		}
+		if reg.Usage == "" {
+			t.Errorf("%s is missing usage", reg.Name)
+		}
+		names[reg.Name] = reg.Definition
+	}
+
+	for _, name := range []string{"connstats", "explain-line", "filter", "info", "query", "restart", "rsstate"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("%s is not registered", name)
+		}
+	}
+
+	flags := make(map[string]Argument)
+	for _, flag := range names["query"].Flags {
+		flags[flag.Name] = flag
+	}
+
+	for name, kind := range map[string]Flag{"group": String, "sort": String, "system": Bool, "wrap": OptionalInt} {
+		if flag, ok := flags[name]; !ok {
+			t.Errorf("query flag %s is missing", name)
+		} else if flag.Type != kind {
+			t.Errorf("query flag %s has type %d, expected %d", name, flag.Type, kind)
+		}
+	}
+	if flags["sort"].ShortName != "s" {
+		t.Errorf("query flag sort should have the short name s, got '%s'", flags["sort"].ShortName)
+	}
+}
@@ -0,0 +1,198 @@
+package command
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+// Unlike filter, grep only matches structured fields of each entry and every
+// predicate must match (i.e. predicates are combined with AND).
+type grep struct {
+	components []record.Component
+	severities []record.Severity
+	contexts   []string
+	slowerThan int64
+	message    bool
+	timezone   *time.Location
+
+	// A query command used to match namespaces the same way the query report
+	// does.
+	query *query
+}
+
+func init() {
+	args := Definition{
+		Usage: "output the lines matching every given predicate, in their original order",
+		Flags: []Argument{
+			{Name: "component", Type: String, Usage: "only include lines of a `COMPONENT` (e.g. COMMAND), comma separated"},
+			{Name: "context", Type: String, Usage: "only include lines from a `CONTEXT` (e.g. conn12 or conn*), comma separated"},
+			{Name: "message", Type: Bool, Usage: "output only the message of each line"},
+			{Name: "namespace", Type: String, Usage: "only include operations on namespaces matching a `GLOB` (e.g. db.*), comma separated, excluding those prefixed by !"},
+			{Name: "severity", Type: String, Usage: "only include lines of a `SEVERITY` (e.g. W or E), comma separated"},
+			{Name: "slower-than", Type: Int, Usage: "only include operations logged with a duration of at least `MS` milliseconds"},
+			{Name: "timezone", Type: String, Usage: "rewrite the date of each line in time `ZONE` (e.g. UTC, America/New_York, or -0500)"},
+		},
+	}
+
+	GetFactory().Register("grep", args, func() (Command, error) {
+		return &grep{}, nil
+	})
+}
+
+func (g *grep) Finish(int, commandTarget) error {
+	return nil
+}
+
+func (g *grep) Prepare(_ string, _ int, args ArgumentCollection) error {
+	*g = grep{message: args.Booleans["message"]}
+
+	for _, value := range internal.ArgumentSplit(args.Strings["component"]) {
+		component, ok := record.NewComponent(internal.StringToUpper(value))
+		if !ok {
+			return fmt.Errorf("unrecognized component '%s'", value)
+		}
+		g.components = append(g.components, component)
+	}
+
+	for _, value := range internal.ArgumentSplit(args.Strings["severity"]) {
+		severity, ok := record.NewSeverity(internal.StringToUpper(value))
+		if !ok {
+			return fmt.Errorf("unrecognized severity '%s'", value)
+		}
+		g.severities = append(g.severities, severity)
+	}
+
+	for _, value := range internal.ArgumentSplit(args.Strings["context"]) {
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		if _, err := path.Match(value, ""); err != nil {
+			return fmt.Errorf("invalid context '%s'", value)
+		}
+		g.contexts = append(g.contexts, value)
+	}
+
+	if threshold, ok := args.Integers["slower-than"]; ok {
+		if threshold < 0 {
+			return fmt.Errorf("slower-than must be a positive number of milliseconds")
+		}
+		// Thresholds are given in milliseconds but compared to durations in
+		// microseconds.
+		g.slowerThan = int64(threshold) * 1000
+	}
+
+	if value, ok := args.Strings["timezone"]; ok && value != "" {
+		zone, err := internal.ParseTimezone(value)
+		if err != nil {
+			return err
+		}
+		g.timezone = zone
+	}
+
+	g.query = &query{namespaces: internal.ArgumentSplit(args.Strings["namespace"])}
+	for _, glob := range g.query.namespaces {
+		if _, err := path.Match(strings.TrimPrefix(glob, "!"), ""); err != nil {
+			return fmt.Errorf("invalid namespace glob '%s'", glob)
+		}
+	}
+
+	return nil
+}
+
+func (g *grep) Run(_ int, out commandTarget, in commandSource, _ commandError) error {
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			// Lines that cannot be parsed can still match on the fields of
+			// the line itself (e.g. component and context).
+			entry = record.Entry{Base: base}
+		}
+
+		if !g.match(entry) {
+			continue
+		}
+
+		if g.message {
+			out <- base.RawMessage
+		} else if g.timezone != nil && entry.DateValid {
+			out <- g.convert(base.String(), entry)
+		} else {
+			out <- base.String()
+		}
+	}
+
+	return nil
+}
+
+func (g *grep) Terminate(commandTarget) error {
+	return nil
+}
+
+// Replaces the date of a line with the same date in the time zone. ISO-8601
+// dates keep their offset, which ctime dates (2.4 and older) do not have.
+func (g *grep) convert(line string, entry record.Entry) string {
+	format := entry.Format
+	switch format {
+	case internal.DateFormatCtime, internal.DateFormatCtimenoms, internal.DateFormatCtimeyear:
+	default:
+		format = internal.DateFormatIso8602Local
+	}
+
+	date := internal.DateInZone(entry.Date, entry.Format, g.timezone).Format(string(format))
+	return strings.Replace(line, entry.RawDate, date, 1)
+}
+
+func (g *grep) match(entry record.Entry) bool {
+	if len(g.components) > 0 && !g.matchComponent(entry.Component) {
+		return false
+	} else if len(g.severities) > 0 && !g.matchSeverity(entry.Severity) {
+		return false
+	} else if len(g.contexts) > 0 && !g.matchContext(entry.RawContext) {
+		return false
+	} else if g.slowerThan == 0 && len(g.query.namespaces) == 0 {
+		return true
+	}
+
+	// The remaining predicates only apply to operations.
+	cmd, ok := message.BaseFromMessage(entry.Message)
+	if !ok {
+		return false
+	}
+	return cmd.DurationMicros() >= g.slowerThan && g.query.matchNamespace(cmd.Namespace)
+}
+
+func (g *grep) matchComponent(component record.Component) bool {
+	for _, match := range g.components {
+		if match == component {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *grep) matchContext(context string) bool {
+	context = strings.TrimSuffix(strings.TrimPrefix(context, "["), "]")
+	for _, glob := range g.contexts {
+		if match, _ := path.Match(glob, context); match {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *grep) matchSeverity(severity record.Severity) bool {
+	for _, match := range g.severities {
+		if match == severity {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:00:01.000-0400 I  NETWORK  [listener] connection accepted from 127.0.0.1:53342 #12 (1 connection now open)`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn12] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 150ms`,
+		`2019-08-10T10:01:01.000-0400 W  COMMAND  [conn12] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 50ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn13] command other.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { c: 1 }, $db: "other" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 250ms`,
+	}
+
+	for name, test := range map[string]struct {
+		args     ArgumentCollection
+		expected []int
+	}{
+		"none":      {ArgumentCollection{}, []int{0, 1, 2, 3, 4}},
+		"component": {ArgumentCollection{Strings: map[string]string{"component": "command,network"}}, []int{1, 2, 3, 4}},
+		"severity":  {ArgumentCollection{Strings: map[string]string{"severity": "w"}}, []int{3}},
+		"context":   {ArgumentCollection{Strings: map[string]string{"context": "conn1*"}}, []int{2, 3, 4}},
+		"namespace": {ArgumentCollection{Strings: map[string]string{"namespace": "test.*"}}, []int{2, 3}},
+		"slower":    {ArgumentCollection{Integers: map[string]int{"slower-than": 100}}, []int{2, 4}},
+		"combined": {ArgumentCollection{
+			Strings:  map[string]string{"namespace": "test.*", "context": "conn12"},
+			Integers: map[string]int{"slower-than": 100},
+		}, []int{2}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			output := runCommand(t, &grep{}, test.args, lines)
+
+			expected := ""
+			for _, index := range test.expected {
+				expected += lines[index]
+			}
+			if output != expected {
+				t.Errorf("expected lines %v, got:\n%s", test.expected, output)
+			}
+		})
+	}
+
+	output := runCommand(t, &grep{}, ArgumentCollection{Booleans: map[string]bool{"message": true}, Strings: map[string]string{"severity": "W"}}, lines)
+	if !strings.HasPrefix(output, "command test.bar") {
+		t.Errorf("only the message should be output, got: %s", output)
+	}
+
+	for _, args := range []ArgumentCollection{
+		{Strings: map[string]string{"component": "nope"}},
+		{Strings: map[string]string{"severity": "Q"}},
+		{Strings: map[string]string{"namespace": "["}},
+		{Integers: map[string]int{"slower-than": -1}},
+		{Strings: map[string]string{"timezone": "Nowhere/Special"}},
+	} {
+		if err := (&grep{}).Prepare("test", 0, args); err == nil {
+			t.Errorf("arguments %+v should be rejected", args)
+		}
+	}
+}
+
+func TestGrep_Timezone(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T23:30:01.000-0400 I  NETWORK  [listener] connection accepted from 127.0.0.1:53342 #12 (1 connection now open)`,
+	}
+
+	output := runCommand(t, &grep{}, ArgumentCollection{Strings: map[string]string{"timezone": "UTC", "component": "network"}}, lines)
+	if output != strings.Replace(lines[1], "2019-08-10T23:30:01.000-0400", "2019-08-11T03:30:01.000+0000", 1) {
+		t.Errorf("expected the date in UTC, got: %s", output)
+	}
+}
@@ -0,0 +1,206 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// Buckets of operation durations (in microseconds), each ten times wider than
+// the last. The final bucket has no upper bound.
+var histogramBuckets = []struct {
+	Label string
+	Upper int64
+}{
+	{"< 1ms", 1000},
+	{"1-10ms", 10 * 1000},
+	{"10-100ms", 100 * 1000},
+	{"100ms-1s", 1000 * 1000},
+	{"1-10s", 10 * 1000 * 1000},
+	{"> 10s", -1},
+}
+
+// The width of the longest bar.
+const histogramWidth = 50
+
+type histogram struct {
+	instance map[int]*histogramInstance
+
+	byNamespace bool
+
+	// A query command used to standardize CRUD messages and match namespaces
+	// the same way the query report does.
+	query *query
+}
+
+type histogramInstance struct {
+	summary formatting.Summary
+
+	// Counts for each bucket, keyed by namespace (or "" when operations are
+	// not separated by namespace).
+	counts map[string][]int64
+}
+
+func init() {
+	args := Definition{
+		Usage: "output a histogram of operation durations",
+		Flags: []Argument{
+			{Name: "by", Type: String, Usage: "output a histogram per `FIELD` (only namespace is supported)"},
+			{Name: "namespace", Type: String, Usage: "only include namespaces matching a `GLOB` (e.g. db.*), comma separated, excluding those prefixed by !"},
+		},
+	}
+
+	GetFactory().Register("histogram", args, func() (Command, error) {
+		return &histogram{instance: make(map[int]*histogramInstance)}, nil
+	})
+}
+
+func (h *histogram) Finish(index int, out commandTarget) error {
+	instance := h.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.counts) == 0 {
+		writer.WriteString("  no operations found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	namespaces := make([]string, 0, len(instance.counts))
+	for namespace := range instance.counts {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for count, namespace := range namespaces {
+		if count > 0 {
+			writer.WriteRune('\n')
+		}
+		if namespace != "" {
+			writer.WriteString(namespace + "\n")
+		}
+		h.print(writer, instance.counts[namespace])
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (h *histogram) Prepare(name string, index int, args ArgumentCollection) error {
+	h.instance[index] = &histogramInstance{
+		summary: formatting.NewSummary(name),
+		counts:  make(map[string][]int64),
+	}
+
+	switch by := args.Strings["by"]; by {
+	case "":
+	case "namespace", "ns":
+		h.byNamespace = true
+	default:
+		return fmt.Errorf("unrecognized histogram field '%s'", by)
+	}
+
+	h.query = &query{namespaces: internal.ArgumentSplit(args.Strings["namespace"])}
+	for _, glob := range h.query.namespaces {
+		if _, err := path.Match(strings.TrimPrefix(glob, "!"), ""); err != nil {
+			return fmt.Errorf("invalid namespace glob '%s'", glob)
+		}
+	}
+
+	return nil
+}
+
+func (h *histogram) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := h.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		crud, ok := entry.Message.(message.CRUD)
+		if !ok {
+			continue
+		}
+
+		ns, _, dur, ok := h.query.standardize(crud)
+		if !ok || !h.query.matchNamespace(ns) {
+			continue
+		}
+
+		key := ""
+		if h.byNamespace {
+			key = ns
+		}
+
+		counts, ok := instance.counts[key]
+		if !ok {
+			counts = make([]int64, len(histogramBuckets))
+			instance.counts[key] = counts
+		}
+		counts[histogramBucket(dur)] += 1
+	}
+
+	return nil
+}
+
+func (h *histogram) Terminate(commandTarget) error {
+	return nil
+}
+
+func (histogram) print(writer *bytes.Buffer, counts []int64) {
+	var total, max int64
+	for _, count := range counts {
+		total += count
+		if count > max {
+			max = count
+		}
+	}
+
+	for index, bucket := range histogramBuckets {
+		count := counts[index]
+
+		bar := ""
+		if max > 0 {
+			bar = strings.Repeat("#", int(count*histogramWidth/max))
+		}
+		if count > 0 && bar == "" {
+			// Never hide a bucket that has operations.
+			bar = "#"
+		}
+
+		percent := 0.0
+		if total > 0 {
+			percent = float64(count) / float64(total) * 100
+		}
+
+		writer.WriteString(fmt.Sprintf("  %-9s %10d %6.1f%%  %s\n", bucket.Label, count, percent, bar))
+	}
+	writer.WriteString(fmt.Sprintf("  %-9s %10d\n", "total", total))
+}
+
+// Returns the index of the bucket a duration (in microseconds) belongs to.
+func histogramBucket(dur int64) int {
+	for index, bucket := range histogramBuckets {
+		if bucket.Upper < 0 || dur < bucket.Upper {
+			return index
+		}
+	}
+	return len(histogramBuckets) - 1
+}
@@ -0,0 +1,50 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	find := `2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.%s appName: "MongoDB Shell" command: find { find: "%s", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`
+	lines := []string{`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`}
+	for _, dur := range []int{0, 5, 7, 50, 500, 5000, 20000} {
+		lines = append(lines, fmt.Sprintf(find, "foo", "foo", dur))
+	}
+	lines = append(lines, fmt.Sprintf(find, "bar", "bar", 5))
+
+	cmd := &histogram{instance: make(map[int]*histogramInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+
+	if counts := cmd.instance[0].counts[""]; fmt.Sprint(counts) != "[1 3 1 1 1 1]" {
+		t.Errorf("bucket counts mismatch, got %v", counts)
+	}
+	for _, expected := range []string{
+		"  1-10ms             3   37.5%  " + strings.Repeat("#", histogramWidth) + "\n",
+		"  > 10s              1   12.5%  " + strings.Repeat("#", histogramWidth/3) + "\n",
+		"  total              8\n",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	cmd = &histogram{instance: make(map[int]*histogramInstance)}
+	output = runCommand(t, cmd, ArgumentCollection{Strings: map[string]string{"by": "namespace", "namespace": "test.*,!test.baz"}}, lines)
+	if counts := cmd.instance[0].counts; len(counts) != 2 || fmt.Sprint(counts["test.bar"]) != "[0 1 0 0 0 0]" {
+		t.Errorf("namespace counts mismatch, got %v", counts)
+	} else if strings.Index(output, "test.bar\n") > strings.Index(output, "test.foo\n") {
+		t.Errorf("namespaces should be sorted:\n%s", output)
+	}
+
+	cmd = &histogram{instance: make(map[int]*histogramInstance)}
+	runCommand(t, cmd, ArgumentCollection{Strings: map[string]string{"namespace": "test.bar"}}, lines)
+	if counts := cmd.instance[0].counts[""]; fmt.Sprint(counts) != "[0 1 0 0 0 0]" {
+		t.Errorf("namespace filter mismatch, got %v", counts)
+	}
+
+	if err := (&histogram{instance: make(map[int]*histogramInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"by": "op"}}); err == nil {
+		t.Errorf("an unrecognized field should return an error")
+	}
+}
@@ -0,0 +1,176 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+type indexBuilds struct {
+	instance map[int]*indexBuildsInstance
+}
+
+type indexBuildsInstance struct {
+	summary formatting.Summary
+	builds  []*indexBuild
+
+	// Builds that have started but not completed. Versions before 4.2 only
+	// identify a completed build by the thread (context) it ran on, while
+	// later versions identify it by namespace and index name.
+	byContext map[string]*indexBuild
+	byName    map[string]*indexBuild
+}
+
+type indexBuild struct {
+	Namespace string
+	Name      string
+	Method    string
+	Started   time.Time
+
+	Done     bool
+	Duration time.Duration
+	Scanned  int64
+}
+
+func init() {
+	args := Definition{
+		Usage: "output index builds with their build method and duration",
+	}
+
+	GetFactory().Register("index-builds", args, func() (Command, error) {
+		return &indexBuilds{instance: make(map[int]*indexBuildsInstance)}, nil
+	})
+}
+
+func (b *indexBuilds) Finish(index int, out commandTarget) error {
+	instance := b.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.builds) == 0 {
+		writer.WriteString("  no index builds found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	incomplete := 0
+	writer.WriteString(fmt.Sprintf("%-23s %-30s %-20s %-10s %12s %12s\n", "started", "namespace", "index", "method", "duration (s)", "scanned"))
+	for _, build := range instance.builds {
+		duration, scanned := "-", "-"
+		if !build.Done {
+			incomplete += 1
+			duration = "incomplete"
+		} else if build.Duration >= 0 {
+			duration = strconv.FormatFloat(build.Duration.Seconds(), 'f', 1, 64)
+		}
+		if build.Scanned > 0 {
+			scanned = strconv.FormatInt(build.Scanned, 10)
+		}
+
+		method := build.Method
+		if method == "" {
+			method = "-"
+		}
+
+		writer.WriteString(fmt.Sprintf("%-23s %-30s %-20s %-10s %12s %12s\n",
+			build.Started.Format(string(internal.DateFormatCtimenoms)),
+			build.Namespace,
+			build.Name,
+			method,
+			duration,
+			scanned))
+	}
+
+	if incomplete > 0 {
+		writer.WriteString(fmt.Sprintf("\n%d index builds started without a matching completion\n", incomplete))
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (b *indexBuilds) Prepare(name string, index int, _ ArgumentCollection) error {
+	b.instance[index] = &indexBuildsInstance{
+		summary:   formatting.NewSummary(name),
+		byContext: make(map[string]*indexBuild),
+		byName:    make(map[string]*indexBuild),
+	}
+
+	return nil
+}
+
+func (b *indexBuilds) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := b.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+		if entry.Component != record.ComponentIndex {
+			continue
+		}
+
+		switch msg := entry.Message.(type) {
+		case message.IndexBuild:
+			build := &indexBuild{
+				Namespace: msg.Namespace,
+				Name:      msg.Name,
+				Method:    msg.Method,
+				Started:   entry.Date,
+			}
+
+			instance.builds = append(instance.builds, build)
+			instance.byContext[entry.RawContext] = build
+			instance.byName[msg.Namespace+" "+msg.Name] = build
+
+		case message.IndexBuildDone:
+			var build *indexBuild
+			if msg.Namespace != "" {
+				build = instance.byName[msg.Namespace+" "+msg.Name]
+			} else {
+				build = instance.byContext[entry.RawContext]
+			}
+			if build == nil {
+				// The build started before the log began.
+				continue
+			}
+
+			build.Done = true
+			build.Scanned = msg.Scanned
+			if msg.Seconds >= 0 {
+				build.Duration = time.Duration(msg.Seconds) * time.Second
+			} else if entry.DateValid && !build.Started.IsZero() {
+				build.Duration = entry.Date.Sub(build.Started)
+			} else {
+				build.Duration = -1
+			}
+
+			if instance.byContext[entry.RawContext] == build {
+				delete(instance.byContext, entry.RawContext)
+			}
+			delete(instance.byName, build.Namespace+" "+build.Name)
+		}
+	}
+
+	return nil
+}
+
+func (b *indexBuilds) Terminate(commandTarget) error {
+	return nil
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexBuilds(t *testing.T) {
+	for name, test := range map[string]struct {
+		lines    []string
+		expected []indexBuild
+	}{
+		"3.6": {
+			lines: []string{
+				`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+				`2018-01-16T15:01:00.000-0800 I INDEX    [conn1] build index on: test.foo properties: { v: 2, key: { a: 1.0 }, name: "a_1", ns: "test.foo" }`,
+				`2018-01-16T15:01:00.001-0800 I INDEX    [conn1] 	 building index using bulk method; build may temporarily use up to 500 megabytes of RAM`,
+				`2018-01-16T15:01:02.000-0800 I INDEX    [conn1] build index done.  scanned 1000 total records. 2 secs`,
+				`2018-01-16T15:02:00.000-0800 I INDEX    [conn2] build index on: test.bar properties: { v: 2, key: { b: 1.0 }, name: "b_1", ns: "test.bar", background: true }`,
+			},
+			expected: []indexBuild{
+				{Namespace: "test.foo", Name: "a_1", Method: "foreground", Done: true, Duration: 2 * time.Second, Scanned: 1000},
+				{Namespace: "test.bar", Name: "b_1", Method: "background"},
+			},
+		},
+		"4.2": {
+			lines: []string{
+				`2019-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v4.2.1`,
+				`2019-01-16T15:01:00.000-0800 I INDEX    [conn1] index build: starting on test.foo properties: { v: 2, key: { a: 1.0 }, name: "a_1", ns: "test.foo" } using method: Hybrid`,
+				`2019-01-16T15:01:00.500-0800 I INDEX    [conn1] index build: collection scan done. scanned 1000 total records in 0 seconds`,
+				`2019-01-16T15:01:03.000-0800 I INDEX    [conn1] index build: done building index a_1 on ns test.foo`,
+			},
+			expected: []indexBuild{
+				{Namespace: "test.foo", Name: "a_1", Method: "hybrid", Done: true, Duration: 3 * time.Second},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := &indexBuilds{instance: make(map[int]*indexBuildsInstance)}
+			output := runCommand(t, cmd, ArgumentCollection{}, test.lines)
+			builds := cmd.instance[0].builds
+
+			if len(builds) != len(test.expected) {
+				t.Fatalf("expected %d builds, got %d:\n%s", len(test.expected), len(builds), output)
+			}
+			for index, expected := range test.expected {
+				build := *builds[index]
+				build.Started = time.Time{}
+				if build != expected {
+					t.Errorf("build %d mismatch, got %+v expected %+v", index, build, expected)
+				}
+			}
+
+			incomplete := 0
+			for _, build := range test.expected {
+				if !build.Done {
+					incomplete += 1
+				}
+			}
+			if incomplete > 0 && !strings.Contains(output, "1 index builds started without a matching completion") {
+				t.Errorf("incomplete builds should be counted:\n%s", output)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// Follows chunk migrations through the changelog events of the donor (the
+// start, the commit, and its final step) and the recipient (its final step).
+// The events carry no migration id, so they are matched by namespace and the
+// bounds of the chunk being moved.
+type migrations struct {
+	instance map[int]*migrationsInstance
+}
+
+type migrationsInstance struct {
+	summary formatting.Summary
+
+	// Migrations that have started but not logged a final step, keyed by
+	// namespace and chunk bounds, and every migration that has ended.
+	open  map[string]*migrationsMove
+	moves []*migrationsMove
+
+	// Splits per namespace and the totals of every balancer round.
+	splits map[string]int64
+	rounds struct {
+		Count  int64
+		Moved  int64
+		Errors int64
+	}
+}
+
+type migrationsMove struct {
+	Namespace string
+	From      string
+	To        string
+	Date      time.Time
+
+	// The total duration (in milliseconds) of the migration steps, or -1 if
+	// the final step was not logged.
+	Duration int64
+
+	Status string
+	Error  string
+}
+
+const (
+	migrationsCommitted  = "committed"
+	migrationsFailed     = "failed"
+	migrationsIncomplete = "incomplete"
+)
+
+func init() {
+	args := Definition{
+		Usage: "output chunk migrations, splits, and balancer rounds per namespace",
+	}
+
+	GetFactory().Register("migrations", args, func() (Command, error) {
+		return &migrations{instance: make(map[int]*migrationsInstance)}, nil
+	})
+}
+
+func (m *migrations) Finish(index int, out commandTarget) error {
+	instance := m.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	for _, move := range instance.open {
+		instance.end(move)
+	}
+	if len(instance.moves) == 0 && len(instance.splits) == 0 && instance.rounds.Count == 0 {
+		writer.WriteString("  no sharding events found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	type total struct {
+		Count, Committed, Failed, Incomplete, Splits int64
+		Sum, Timed, Max                              int64
+	}
+
+	totals := make(map[string]*total)
+	get := func(ns string) *total {
+		if _, ok := totals[ns]; !ok {
+			totals[ns] = &total{}
+		}
+		return totals[ns]
+	}
+
+	for _, move := range instance.moves {
+		t := get(move.Namespace)
+		t.Count += 1
+
+		switch move.Status {
+		case migrationsCommitted:
+			t.Committed += 1
+		case migrationsFailed:
+			t.Failed += 1
+		case migrationsIncomplete:
+			t.Incomplete += 1
+		}
+
+		if move.Duration >= 0 {
+			t.Sum += move.Duration
+			t.Timed += 1
+			if move.Duration > t.Max {
+				t.Max = move.Duration
+			}
+		}
+	}
+	for ns, count := range instance.splits {
+		get(ns).Splits = count
+	}
+
+	namespaces := make([]string, 0, len(totals))
+	for ns := range totals {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	writer.WriteString(fmt.Sprintf("%-30s %10s %10s %10s %10s %8s %10s %10s\n", "namespace", "migrations", "committed", "failed", "incomplete", "splits", "mean (ms)", "max (ms)"))
+	for _, ns := range namespaces {
+		t := totals[ns]
+
+		mean, max := "-", "-"
+		if t.Timed > 0 {
+			mean = fmt.Sprintf("%d", t.Sum/t.Timed)
+			max = fmt.Sprintf("%d", t.Max)
+		}
+
+		writer.WriteString(fmt.Sprintf("%-30s %10d %10d %10d %10d %8d %10s %10s\n", ns, t.Count, t.Committed, t.Failed, t.Incomplete, t.Splits, mean, max))
+	}
+
+	if instance.rounds.Count > 0 {
+		writer.WriteString(fmt.Sprintf("\nbalancer rounds: %d (chunks moved: %d, errors: %d)\n", instance.rounds.Count, instance.rounds.Moved, instance.rounds.Errors))
+	}
+
+	failed := false
+	for _, move := range instance.moves {
+		if move.Status != migrationsFailed {
+			continue
+		} else if !failed {
+			writer.WriteString("\nFAILED\n")
+			failed = true
+		}
+
+		date := formatting.Timestamp(move.Date, instance.summary.Start, false, internal.DateFormatCtimenoms)
+		writer.WriteString(fmt.Sprintf("   %s %s %s -> %s: %s\n", date, move.Namespace, move.From, move.To, move.Error))
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (m *migrations) Prepare(name string, index int, _ ArgumentCollection) error {
+	m.instance[index] = &migrationsInstance{
+		summary: formatting.NewSummary(name),
+		open:    make(map[string]*migrationsMove),
+		splits:  make(map[string]int64),
+	}
+
+	return nil
+}
+
+func (m *migrations) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := m.instance[index]
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		instance.summary.Update(entry)
+
+		switch msg := entry.Message.(type) {
+		case message.StartupInfo, message.StartupInfoLegacy, message.Version:
+			// A restart aborts any migration in progress.
+			if entry.Connection == 0 {
+				for _, move := range instance.open {
+					instance.end(move)
+				}
+			}
+
+		case message.ShardingEvent:
+			instance.event(entry.Date, msg)
+		}
+	}
+
+	return nil
+}
+
+func (m *migrations) Terminate(commandTarget) error {
+	return nil
+}
+
+func (m *migrationsInstance) event(date time.Time, event message.ShardingEvent) {
+	switch event.What {
+	case "balancer.round":
+		m.rounds.Count += 1
+		switch moved := event.Details["chunksMoved"].(type) {
+		case int:
+			m.rounds.Moved += int64(moved)
+		case int64:
+			m.rounds.Moved += moved
+		}
+		if event.Error != "" {
+			m.rounds.Errors += 1
+		}
+
+	case "split":
+		m.splits[event.Namespace] += 1
+
+	case "multi-split":
+		// A multi-split logs an event for each chunk it creates.
+		if number, ok := event.Details["number"].(int); ok && number == 1 {
+			m.splits[event.Namespace] += 1
+		}
+
+	case "moveChunk.start":
+		key := migrationsKey(event)
+		if move, ok := m.open[key]; ok {
+			m.end(move)
+		}
+		m.open[key] = &migrationsMove{Namespace: event.Namespace, From: event.From, To: event.To, Date: date, Duration: -1}
+
+	case "moveChunk.commit":
+		if move, ok := m.open[migrationsKey(event)]; ok {
+			move.Status = migrationsCommitted
+		}
+
+	case "moveChunk.error":
+		move := m.get(date, event)
+		move.Status = migrationsFailed
+		move.Error = event.Error
+
+	case "moveChunk.from", "moveChunk.to":
+		// The final step of the donor or the recipient ends the migration.
+		move := m.get(date, event)
+		move.Duration = event.Duration
+
+		if event.Note == "aborted" || event.Error != "" {
+			if move.Error == "" {
+				move.Error = event.Error
+			}
+			if move.Error == "" {
+				move.Error = "aborted"
+			}
+			m.close(move, migrationsFailed)
+		} else if move.Status == migrationsFailed {
+			m.close(move, migrationsFailed)
+		} else {
+			m.close(move, migrationsCommitted)
+		}
+	}
+}
+
+// Returns the open migration of an event, or starts one for migrations that
+// began before the log did.
+func (m *migrationsInstance) get(date time.Time, event message.ShardingEvent) *migrationsMove {
+	key := migrationsKey(event)
+	if move, ok := m.open[key]; ok {
+		if move.From == "" {
+			move.From, move.To = event.From, event.To
+		}
+		return move
+	}
+
+	move := &migrationsMove{Namespace: event.Namespace, From: event.From, To: event.To, Date: date, Duration: -1}
+	m.open[key] = move
+	return move
+}
+
+func (m *migrationsInstance) close(move *migrationsMove, status string) {
+	for key, open := range m.open {
+		if open == move {
+			delete(m.open, key)
+		}
+	}
+
+	move.Status = status
+	m.moves = append(m.moves, move)
+}
+
+// Closes a migration whose final step was never logged, which keeps the
+// outcome of a commit or an error if either was logged.
+func (m *migrationsInstance) end(move *migrationsMove) {
+	if move.Status == "" {
+		m.close(move, migrationsIncomplete)
+	} else {
+		m.close(move, move.Status)
+	}
+}
+
+func migrationsKey(event message.ShardingEvent) string {
+	return fmt.Sprintf("%s %v %v", event.Namespace, event.Details["min"], event.Details["max"])
+}
@@ -0,0 +1,66 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	event := func(date, into, what, details string) string {
+		return `2018-05-15T10:00:` + date + `.000+0000 I SHARDING [conn12] about to log metadata event into ` + into + `: { _id: "host-2018-05-15T10:00:` + date + `.000+0000-5afaa3a1", server: "host", clientAddr: "127.0.0.1:5000", time: new Date(1526378400000), what: "` + what + `", ns: "test.foo", details: ` + details + ` }`
+	}
+	chunk := func(min, max string) string {
+		return `min: { a: ` + min + ` }, max: { a: ` + max + ` }`
+	}
+
+	lines := []string{
+		`2018-05-15T10:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9`,
+		// A committed migration.
+		event("01", "changelog", "moveChunk.start", `{ `+chunk("MinKey", "0.0")+`, from: "shard00", to: "shard01" }`),
+		event("02", "changelog", "moveChunk.commit", `{ `+chunk("MinKey", "0.0")+`, from: "shard00", to: "shard01", counts: { cloned: 1, clonedBytes: 30, catchup: 0, steady: 0 } }`),
+		event("03", "changelog", "moveChunk.from", `{ `+chunk("MinKey", "0.0")+`, step 1 of 6: 0, step 2 of 6: 4, step 3 of 6: 12, step 4 of 6: 30, step 5 of 6: 20, step 6 of 6: 4, to: "shard01", from: "shard00", note: "success" }`),
+		// An aborted migration.
+		event("04", "changelog", "moveChunk.start", `{ `+chunk("0.0", "MaxKey")+`, from: "shard00", to: "shard01" }`),
+		event("05", "changelog", "moveChunk.error", `{ `+chunk("0.0", "MaxKey")+`, from: "shard00", to: "shard01", errmsg: "Data transfer error" }`),
+		event("06", "changelog", "moveChunk.from", `{ `+chunk("0.0", "MaxKey")+`, step 1 of 6: 0, step 2 of 6: 2, to: "shard01", from: "shard00", note: "aborted" }`),
+		// A split and a migration that never finished.
+		event("07", "changelog", "split", `{ before: { `+chunk("0.0", "MaxKey")+` }, left: { `+chunk("0.0", "10.0")+` }, right: { `+chunk("10.0", "MaxKey")+` } }`),
+		event("08", "changelog", "moveChunk.start", `{ `+chunk("10.0", "MaxKey")+`, from: "shard00", to: "shard02" }`),
+		event("09", "actionlog", "balancer.round", `{ executionTimeMillis: 45, errorOccured: false, candidateChunks: 1, chunksMoved: 1 }`),
+	}
+
+	cmd := &migrations{instance: make(map[int]*migrationsInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+
+	instance := cmd.instance[0]
+	if len(instance.moves) != 3 {
+		t.Fatalf("expected 3 migrations, got %d", len(instance.moves))
+	}
+	for index, expected := range []migrationsMove{
+		{Namespace: "test.foo", From: "shard00", To: "shard01", Duration: 70, Status: migrationsCommitted},
+		{Namespace: "test.foo", From: "shard00", To: "shard01", Duration: 2, Status: migrationsFailed, Error: "Data transfer error"},
+		{Namespace: "test.foo", From: "shard00", To: "shard02", Duration: -1, Status: migrationsIncomplete},
+	} {
+		move := *instance.moves[index]
+		move.Date = expected.Date
+		if move != expected {
+			t.Errorf("migration %d mismatch, expected %+v, got %+v", index, expected, move)
+		}
+	}
+
+	if instance.splits["test.foo"] != 1 {
+		t.Errorf("expected 1 split, got %d", instance.splits["test.foo"])
+	} else if instance.rounds.Count != 1 || instance.rounds.Moved != 1 || instance.rounds.Errors != 0 {
+		t.Errorf("balancer rounds mismatch, got %+v", instance.rounds)
+	}
+
+	for _, expected := range []string{
+		"test.foo                                3          1          1          1        1         36         70",
+		"balancer rounds: 1 (chunks moved: 1, errors: 0)",
+		"test.foo shard00 -> shard01: Data transfer error",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("output is missing %q, got:\n%s", expected, output)
+		}
+	}
+}
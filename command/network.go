@@ -0,0 +1,185 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// Reports the throughput of logged operations over time, counting each
+// operation and the bytes it returned (reslen). Only operations slow enough
+// to be logged are counted, so the rates are a floor of the actual load.
+type network struct {
+	instance map[int]*networkInstance
+
+	// A query command used to divide the log into intervals the same way
+	// the query report does.
+	query *query
+}
+
+type networkInstance struct {
+	summary formatting.Summary
+
+	// Buckets keyed by the unix time at the start of each interval, and the
+	// time zone of the log used to display them.
+	buckets  map[int64]*networkBucket
+	location *time.Location
+}
+
+type networkBucket struct {
+	Ops   int64
+	Bytes int64
+
+	// Operations that did not log a response length.
+	Missing int64
+}
+
+func init() {
+	args := Definition{
+		Usage: "output operations and bytes returned per second over time",
+		Flags: []Argument{
+			{Name: "interval", Type: String, Usage: "output throughput for each `DURATION` of the log (e.g. 1m, 5m, 1h, default: 1m)"},
+		},
+	}
+
+	GetFactory().Register("network", args, func() (Command, error) {
+		return &network{instance: make(map[int]*networkInstance)}, nil
+	})
+}
+
+func (n *network) Finish(index int, out commandTarget) error {
+	instance := n.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.buckets) == 0 {
+		writer.WriteString("  no operations found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	seconds := n.query.interval.Seconds()
+	total := networkBucket{}
+
+	writer.WriteString(fmt.Sprintf("%-20s %12s %12s %16s %16s\n", "interval", "ops", "ops/sec", "bytes returned", "bytes/sec"))
+	starts := n.starts(instance.buckets)
+	for _, start := range starts {
+		bucket, ok := instance.buckets[start]
+		if !ok {
+			// Intervals without operations are shown so gaps stand out.
+			bucket = &networkBucket{}
+		}
+
+		total.Ops += bucket.Ops
+		total.Bytes += bucket.Bytes
+		total.Missing += bucket.Missing
+
+		date := formatting.Timestamp(time.Unix(start, 0).In(instance.location), instance.summary.Start, false, internal.DateFormatCtimenoms)
+		writer.WriteString(fmt.Sprintf("%-20s %12d %12.2f %16d %16.1f\n", date, bucket.Ops, float64(bucket.Ops)/seconds, bucket.Bytes, float64(bucket.Bytes)/seconds))
+	}
+
+	seconds *= float64(len(starts))
+	writer.WriteString(fmt.Sprintf("%-20s %12d %12.2f %16d %16.1f\n", "total", total.Ops, float64(total.Ops)/seconds, total.Bytes, float64(total.Bytes)/seconds))
+
+	if total.Missing > 0 {
+		writer.WriteString(fmt.Sprintf("\n%d operations did not log a response length (reslen)\n", total.Missing))
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (n *network) Prepare(name string, index int, args ArgumentCollection) error {
+	n.instance[index] = &networkInstance{
+		summary:  formatting.NewSummary(name),
+		buckets:  make(map[int64]*networkBucket),
+		location: time.UTC,
+	}
+
+	n.query = &query{interval: time.Minute}
+	if value, ok := args.Strings["interval"]; ok && value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Second {
+			return fmt.Errorf("invalid interval '%s', expected a duration of at least 1s (e.g. 5m)", value)
+		}
+		n.query.interval = interval
+	}
+
+	return nil
+}
+
+func (n *network) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := n.instance[index]
+	summary := &instance.summary
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		summary.Update(entry)
+
+		cmd, ok := message.BaseFromMessage(entry.Message)
+		if !ok || entry.Date.IsZero() {
+			continue
+		}
+
+		if len(instance.buckets) == 0 {
+			instance.location = entry.Date.Location()
+		}
+
+		start := n.query.truncate(entry.Date, n.query.interval)
+		bucket, ok := instance.buckets[start]
+		if !ok {
+			bucket = &networkBucket{}
+			instance.buckets[start] = bucket
+		}
+
+		bucket.Ops += 1
+		if reslen, ok := cmd.Counters["reslen"]; ok {
+			bucket.Bytes += reslen
+		} else {
+			bucket.Missing += 1
+		}
+	}
+
+	return nil
+}
+
+func (n *network) Terminate(commandTarget) error {
+	return nil
+}
+
+// Returns the start of every interval between the first and last bucket,
+// including intervals without operations.
+func (n *network) starts(buckets map[int64]*networkBucket) []int64 {
+	sorted := make([]int64, 0, len(buckets))
+	for start := range buckets {
+		sorted = append(sorted, start)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	step := int64(n.query.interval.Seconds())
+	starts := make([]int64, 0, len(sorted))
+	for index, start := range sorted {
+		starts = append(starts, start)
+		if index+1 < len(sorted) {
+			for next := start + step; sorted[index+1]-next >= step; next += step {
+				starts = append(starts, next)
+			}
+		}
+	}
+	return starts
+}
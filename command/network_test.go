@@ -0,0 +1,40 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetwork(t *testing.T) {
+	find := `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:%s locks:{} protocol:op_msg 10ms`
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] ` + strings.Replace(find, "%s", "600", 1),
+		`2018-01-16T15:01:30.000-0800 I COMMAND  [conn1] ` + strings.Replace(find, "%s", "300", 1),
+		// No operations between 15:02 and 15:03.
+		`2018-01-16T15:03:10.000-0800 I COMMAND  [conn1] ` + strings.Replace(find, " reslen:%s", "", 1),
+	}
+
+	cmd := &network{instance: make(map[int]*networkInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{Strings: map[string]string{"interval": "1m"}}, lines)
+
+	if buckets := cmd.instance[0].buckets; len(buckets) != 2 {
+		t.Errorf("expected 2 buckets, got %d", len(buckets))
+	}
+	for _, expected := range []string{
+		"Tue Jan 16 15:01:00             2         0.03              900             15.0\n",
+		"Tue Jan 16 15:02:00             0         0.00                0              0.0\n",
+		"Tue Jan 16 15:03:00             1         0.02                0              0.0\n",
+		"total                           3         0.02              900              5.0\n",
+		"1 operations did not log a response length (reslen)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, output)
+		}
+	}
+
+	cmd = &network{instance: make(map[int]*networkInstance)}
+	if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"interval": "10ms"}}); err == nil {
+		t.Errorf("intervals shorter than a second should be rejected")
+	}
+}
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The least amount of time between two progress updates, and the number of
+// lines between checking whether an update is due, so most lines cost only
+// an atomic increment.
+const (
+	progressInterval = 250 * time.Millisecond
+	progressLines    = 1024
+)
+
+// Reports how many lines have been read by rewriting a single line (usually
+// on stderr). Inputs processed concurrently share a single progress line.
+type progress struct {
+	sync.Mutex
+
+	// The number of updates, and how many updates pass between checks.
+	calls uint64
+	every uint64
+
+	writer io.Writer
+	now    func() time.Time
+	last   time.Time
+
+	// The length of the line currently shown, so it can be erased.
+	width int
+}
+
+func newProgress(writer io.Writer) *progress {
+	return &progress{writer: writer, now: time.Now, every: progressLines}
+}
+
+// Shows the number of lines read from an input and the date of the most
+// recent entry, unless the line was updated too recently. Only the first of
+// every few updates is considered at all.
+func (p *progress) Update(label string, lines uint, date time.Time) {
+	if (atomic.AddUint64(&p.calls, 1)-1)%p.every != 0 {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.now()
+	if now.Sub(p.last) < progressInterval {
+		return
+	}
+	p.last = now
+
+	line := fmt.Sprintf("%s: %d lines", label, lines)
+	if !date.IsZero() {
+		line += ", at " + date.Format(time.RFC3339)
+	}
+
+	p.erase()
+	p.width = len(line)
+	fmt.Fprint(p.writer, line)
+}
+
+// Erases the progress line.
+func (p *progress) Clear() {
+	p.Lock()
+	defer p.Unlock()
+
+	p.erase()
+}
+
+// Erases the progress line and prevents updates while the function runs, so
+// other output is never mixed with the progress line.
+func (p *progress) Suspend(f func()) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.erase()
+	f()
+}
+
+func (p *progress) erase() {
+	if p.width > 0 {
+		fmt.Fprint(p.writer, "\r"+strings.Repeat(" ", p.width)+"\r")
+		p.width = 0
+	}
+}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress_Update(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	clock := time.Date(2018, 1, 16, 15, 0, 0, 0, time.UTC)
+
+	p := newProgress(buffer)
+	p.now = func() time.Time { return clock }
+	p.every = 1
+
+	p.Update("test", 1, time.Time{})
+	if buffer.String() != "test: 1 lines" {
+		t.Errorf("unexpected progress: %q", buffer.String())
+	}
+
+	// Updates within the interval are dropped.
+	clock = clock.Add(progressInterval / 2)
+	p.Update("test", 2, time.Time{})
+	if buffer.String() != "test: 1 lines" {
+		t.Errorf("progress should be throttled: %q", buffer.String())
+	}
+
+	clock = clock.Add(progressInterval)
+	buffer.Reset()
+	p.Update("test", 3, clock)
+	if expected := "\r" + strings.Repeat(" ", 13) + "\rtest: 3 lines, at 2018-01-16T15:00:00Z"; buffer.String() != expected {
+		t.Errorf("unexpected progress: %q", buffer.String())
+	}
+
+	buffer.Reset()
+	p.Suspend(func() { buffer.WriteString("summary") })
+	if expected := "\r" + strings.Repeat(" ", 38) + "\rsummary"; buffer.String() != expected {
+		t.Errorf("the progress line should be erased before other output: %q", buffer.String())
+	}
+
+	buffer.Reset()
+	p.Clear()
+	if buffer.Len() != 0 {
+		t.Errorf("an erased line should not be erased again: %q", buffer.String())
+	}
+}
+
+func TestProgress_UpdateEvery(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	clock := time.Date(2018, 1, 16, 15, 0, 0, 0, time.UTC)
+	checks := 0
+
+	p := newProgress(buffer)
+	p.now = func() time.Time { checks += 1; return clock }
+	p.every = 4
+
+	// The clock is only read for the first of every four updates, even once
+	// an update is due.
+	for lines := uint(1); lines <= 8; lines += 1 {
+		clock = clock.Add(progressInterval)
+		p.Update("test", lines, time.Time{})
+	}
+	if checks != 2 {
+		t.Errorf("expected 2 checks of the clock, got %d", checks)
+	} else if expected := "test: 1 lines\r" + strings.Repeat(" ", 13) + "\rtest: 5 lines"; buffer.String() != expected {
+		t.Errorf("unexpected progress: %q", buffer.String())
+	}
+}
@@ -7,16 +7,24 @@ package command
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
 	"os"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
+	"time"
 
 	"mgotools/internal"
 	"mgotools/mongo"
 	"mgotools/parser/message"
+	"mgotools/parser/record"
 	"mgotools/parser/version"
 	"mgotools/target/formatting"
 
@@ -30,50 +38,211 @@ const (
 	sortCount
 	sortMin
 	sortMax
-	sortN95
 	sortSum
+	sortRatio
+
+	// Percentiles are sorted by their position in the list of percentiles,
+	// e.g. sortPercentile+1 is the second percentile requested.
+	sortPercentile
 )
 
+// The most duration samples kept for each pattern. Beyond this, samples are
+// replaced at random (reservoir sampling) so percentiles remain an unbiased
+// estimate without keeping every duration in memory.
 const N95MaxSamples = 16 * 1024 * 1024
 
+// Output formats of the query report.
+const (
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+	formatTable    = "table"
+)
+
 type query struct {
 	Log map[int]*queryInstance
 
+	bySource     bool
+	dedup        bool
+	examined     bool
+	fasterThan   int64
+	maxSamples   int
+	namespaces   []string
+	format       string
+	output       io.Writer
+	outName      string
 	group        []string
+	template     *template.Template
+	interval     time.Duration
+	intervals    bool
+	period       time.Duration
+	limit        int
+	locks        bool
+	minSamples   int
+	markers      bool
+	parallel     bool
+	percentiles  []float64
+	progress     *progress
+	quantiles    int
+	rollup       string
+	queryHash    bool
+	quiet        bool
+	showErrors   bool
+	sinceRestart bool
+	slowerThan   int64
+	stages       bool
+	storage      bool
+	summaryOnly  bool
 	summaryTable *bytes.Buffer
 	system       bool
+	timestamps   bool
+	timezone     *time.Location
+	topGrowth    int
+	trend        int
+	width        int
 	wrap         bool
+
+	// Logical requests already counted, shared by every input so an
+	// operation logged by both a mongos and a shard is counted once.
+	requests *queryRequests
+
+	// Inputs finish concurrently but write to the same summary table.
+	finish *sync.Mutex
+}
+
+type queryRequests struct {
+	sync.Mutex
+	seen map[string]struct{}
 }
 
 type queryInstance struct {
+	label   string
 	summary formatting.Summary
 
 	sort []int8
 
+	Duplicates uint
 	ErrorCount uint
 	LineCount  uint
 
+	// The number of lines that failed to parse for each reason, kept when
+	// errors are shown.
+	errors map[string]uint
+
 	Patterns map[string]queryPattern
+	Segments []querySegment
+}
+
+// A completed run segment, i.e. all patterns seen between two restarts.
+type querySegment struct {
+	Restart time.Time        `json:"restart"`
+	Table   formatting.Table `json:"patterns"`
+	Total   int              `json:"total"`
+}
+
+// The JSON form of the report, written as a single line for each input (or
+// once for all inputs when they are merged).
+type queryReport struct {
+	Summary   *formatting.Summary   `json:"summary,omitempty"`
+	Summaries []*formatting.Summary `json:"summaries,omitempty"`
+	Patterns  formatting.Table      `json:"patterns"`
+	Segments  []querySegment        `json:"segments,omitempty"`
+	Total     int                   `json:"total"`
+
+	// Totals of every pattern (not only those shown) by database.
+	Rollup formatting.RollupTable `json:"rollup,omitempty"`
+
+	// Every line read and the lines that could not be parsed.
+	Lines  uint `json:"lines"`
+	Errors uint `json:"errors"`
+
+	Duplicates uint `json:"duplicates,omitempty"`
 }
 
 type queryPattern struct {
 	formatting.Pattern
 
+	buckets  map[int64]queryBucket
 	cursorId int64
 	p95      []int64
-	sync     sync.Mutex
+
+	// The buckets of --interval, which are kept apart from the buckets of
+	// the trend and growth reports since their length differs.
+	periods map[int64]queryBucket
+
+	// The filter the pattern was created from, which tells apart two filters
+	// with the same hash.
+	filter mongo.Pattern
+
+	// The first query shape hash logged by an operation matching the pattern.
+	queryHash string
+
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// Counts and durations of a pattern within a single interval of time, keyed
+// by the unix time at the start of the interval.
+type queryBucket struct {
+	Count int64
+	Sum   int64
+
+	samples []int64
 }
 
+// The number of spans a log is divided into when calculating a p95 trend, and
+// the number of samples a span requires before its percentile is shown.
+const (
+	trendSpans      = 10
+	trendMinSamples = 3
+)
+
+// The number of patterns (after sorting) whose intervals are shown.
+const intervalPatterns = 10
+
+// The comment of operations without one when grouping by comment.
+const queryNoComment = "(none)"
+
 var _ Command = (*query)(nil)
 
 func init() {
 	args := Definition{
 		Usage: "output statistics about query patterns",
 		Flags: []Argument{
-			{Name: "group", Type: String, Usage: "group by options (default: col,db,op,pattern)"},
-			{Name: "sort", ShortName: "s", Type: String, Usage: "sort by namespace, pattern, count, min, max, 95%, and/or sum (comma separated for multiple)"},
+			{Name: "by-source", Type: Bool, Usage: "group patterns by the input they were found in"},
+			{Name: "dedup", Type: Bool, Usage: "count operations sharing a logical request id (lsid, txnNumber, and stmtId) once"},
+			{Name: "examined", Type: Bool, Usage: "show the mean keys and documents examined per operation"},
+			{Name: "faster-than", Type: Int, Usage: "only include operations logged with a duration of at most `MS` milliseconds"},
+			{Name: "format", Type: String, Usage: "output `FORMAT`, either table, json (one object per line for each input), or markdown (default: table)"},
+			{Name: "group", Type: String, Usage: "group by app, col, comment, db, op, pattern, and/or plan (default: col,db,op,pattern)"},
+			{Name: "interval", Type: String, Usage: "output the count and p95 of the top patterns for each `DURATION` of the log (e.g. 1m, 5m, 1h)"},
+			{Name: "limit", Type: Int, Usage: "only show the first `N` patterns after sorting"},
+			{Name: "locks", Type: Bool, Usage: "show the mean and max time (in microseconds) operations spent acquiring global, database, and collection locks"},
+			{Name: "min-samples", Type: Int, Usage: "only show percentiles for patterns with at least `N` samples"},
+			{Name: "name", Type: StringSourceSlice, Usage: "label each input with `NAME` (default: file name)"},
+			{Name: "p95-trend", Type: Int, Usage: "output the p95 trend over the duration of the log for the first `N` patterns"},
+			{Name: "namespace", Type: String, Usage: "only include namespaces matching a `GLOB` (e.g. db.*), comma separated, excluding those prefixed by !"},
+			{Name: "out", Type: String, Usage: "write the summary and report to `FILE` instead of stdout"},
+			{Name: "output-template", Type: String, Usage: "render each pattern with a Go text/`TEMPLATE` instead of the table, e.g. '{{.Namespace}} {{.Count}}'"},
+			{Name: "parallel-files", Type: Bool, Usage: "merge the patterns of every input file into a single report"},
+			{Name: "percentile", Type: String, Usage: "latency `PERCENTILES` to calculate, e.g. 50,95,99 (default: 95)"},
+			{Name: "predicate-markers", Type: Bool, Usage: "distinguish equality, range, and existence predicates in patterns"},
+			{Name: "progress", Type: Bool, Usage: "periodically write the number of lines read and the date reached to stderr"},
+			{Name: "query-hash", Type: Bool, Usage: "show the query shape hash (queryHash) of each pattern, logged by 4.2 and later"},
+			{Name: "quantile-output", Type: Int, Usage: "output the latency CDF (deciles) of the first `N` patterns"},
+			{Name: "quiet", Type: Bool, Usage: "only output the patterns, without the summary of each input"},
+			{Name: "rollup", Type: String, Usage: "also output the count and duration of operations totaled by `LEVEL`, currently only database"},
+			{Name: "slower-than", Type: Int, Usage: "only include operations logged with a duration of at least `MS` milliseconds"},
+			{Name: "show-errors", Type: Bool, Usage: "write lines that cannot be parsed to stderr, followed by a count of each error"},
+			{Name: "since-restart", Type: Bool, Usage: "report each run segment separately, starting fresh after every restart"},
+			{Name: "sort", ShortName: "s", Type: String, Usage: "sort by namespace, pattern, count, min, max, a percentile (e.g. 95%), ratio (docs examined per document returned), and/or sum (comma separated for multiple)"},
+			{Name: "stages", Type: Bool, Usage: "group aggregations by their sequence of stages as well as the pattern of a leading $match"},
+			{Name: "summary-only", Type: Bool, Usage: "only output the summary of each input (e.g. versions and line counts), without the patterns"},
+			{Name: "storage", Type: Bool, Usage: "show the mean storage statistics (e.g. bytes read) of operations that logged them"},
 			{Name: "system", Type: Bool, Usage: "show system collections in query summary"},
-			{Name: "wrap", Type: Bool, Usage: "line wrapping of query table"},
+			{Name: "timestamps", Type: Bool, Usage: "show when each pattern was first and last seen"},
+			{Name: "timezone", Type: String, Usage: "output dates in time `ZONE` (e.g. UTC, America/New_York, or -0500)"},
+			{Name: "top-growth", Type: Int, Usage: "output the `N` patterns that grew the most between the first and second half of the log"},
+			{Name: "wrap", Type: OptionalInt, Usage: "wrap the query table to a width of `N` columns (default: terminal width)"},
 		},
 	}
 
@@ -85,30 +254,198 @@ func init() {
 }
 
 func (s *query) Finish(index int, out commandTarget) error {
+	s.finish.Lock()
+	defer s.finish.Unlock()
+
 	log := s.Log[index]
 
+	if s.summaryOnly {
+		s.printSummary(log)
+		return nil
+	} else if s.parallel {
+		// Patterns are merged across all files and output during termination.
+		if s.format != formatJSON {
+			s.printSummary(log)
+		}
+		return nil
+	}
+
 	values := s.values(log.Patterns)
 	s.sort(values, log.sort)
 
-	if index > 0 {
+	total := len(values)
+	rollup := s.rollupTable(values)
+	values = s.top(values)
+
+	if s.format == formatJSON {
+		return json.NewEncoder(s.summaryTable).Encode(queryReport{
+			Summary:    &log.summary,
+			Patterns:   values,
+			Segments:   log.Segments,
+			Total:      total,
+			Rollup:     rollup,
+			Lines:      log.LineCount,
+			Errors:     log.ErrorCount,
+			Duplicates: log.Duplicates,
+		})
+	}
+
+	if s.format == formatMarkdown {
+		// Each input is a section of the document rather than a divider.
+		if index > 0 {
+			s.summaryTable.WriteString("\n")
+		}
+		s.summaryTable.WriteString(fmt.Sprintf("## %s\n\n", log.label))
+	} else if index > 0 {
 		s.summaryTable.WriteString("\n------------------------------------------\n")
 	}
 
-	log.summary.Print(os.Stdout)
-	values.Print(s.wrap, s.summaryTable)
+	s.printSummary(log)
+
+	for _, segment := range log.Segments {
+		if err := s.print(segment.Table, segment.Total); err != nil {
+			return err
+		}
+		segment.Table.PrintPlanning(s.summaryTable)
+		segment.Table.PrintStorage(s.summaryTable)
+		segment.Table.PrintSortLargePayload(s.summaryTable)
+		segment.Table.PrintQuantiles(s.quantiles, s.summaryTable)
+		segment.Table.PrintTrend(s.trend, s.summaryTable)
+		segment.Table.PrintIntervals(intervalPatterns, s.period, s.summaryTable)
+		if s.format == formatMarkdown {
+			s.summaryTable.WriteString(fmt.Sprintf("\n### Restart %s\n\n", segment.Restart.Format(string(internal.DateFormatCtimenoms))))
+		} else {
+			s.summaryTable.WriteString(fmt.Sprintf("\nRESTART %s\n\n", segment.Restart.Format(string(internal.DateFormatCtimenoms))))
+		}
+	}
+
+	if err := s.print(values, total); err != nil {
+		return err
+	}
+	s.printRollup(rollup)
+	values.PrintPlanning(s.summaryTable)
+	values.PrintStorage(s.summaryTable)
+	values.PrintSortLargePayload(s.summaryTable)
+	values.PrintQuantiles(s.quantiles, s.summaryTable)
+	values.PrintTrend(s.trend, s.summaryTable)
+	values.PrintIntervals(intervalPatterns, s.period, s.summaryTable)
+	s.growth(log.Patterns, log.summary.Start, log.summary.End).Print(s.topGrowth, s.summaryTable)
+	s.printDuplicates(log.Duplicates)
 	return nil
 }
 
 func (s *query) Prepare(name string, instance int, args ArgumentCollection) error {
+	if label, ok := args.Strings["name"]; ok && label != "" {
+		name = label
+	}
+
 	s.Log[instance] = &queryInstance{
 		Patterns: make(map[string]queryPattern),
 
+		label:   name,
 		sort:    []int8{sortSum, sortNamespace, sortOperation, sortPattern},
 		summary: formatting.NewSummary(name),
 	}
 
 	s.wrap = args.Booleans["wrap"]
+	s.width = args.Integers["wrap"]
 	s.system = args.Booleans["system"]
+	s.bySource = args.Booleans["by-source"]
+	s.dedup = args.Booleans["dedup"]
+	s.examined = args.Booleans["examined"]
+	s.limit = args.Integers["limit"]
+	s.locks = args.Booleans["locks"]
+	s.minSamples = args.Integers["min-samples"]
+	s.markers = args.Booleans["predicate-markers"]
+	s.parallel = args.Booleans["parallel-files"]
+	if args.Booleans["progress"] && s.progress == nil {
+		s.progress = newProgress(os.Stderr)
+	}
+	s.quantiles = args.Integers["quantile-output"]
+	s.queryHash = args.Booleans["query-hash"]
+	s.quiet = args.Booleans["quiet"]
+	s.showErrors = args.Booleans["show-errors"]
+	s.sinceRestart = args.Booleans["since-restart"]
+	s.stages = args.Booleans["stages"]
+	s.storage = args.Booleans["storage"]
+	s.summaryOnly = args.Booleans["summary-only"]
+	s.timestamps = args.Booleans["timestamps"]
+	s.topGrowth = args.Integers["top-growth"]
+	s.trend = args.Integers["p95-trend"]
+	s.interval = time.Minute
+
+	if value, ok := args.Strings["interval"]; ok && value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Second {
+			return fmt.Errorf("invalid interval '%s', expected a duration of at least 1s (e.g. 5m)", value)
+		}
+		s.period, s.intervals = interval, true
+	}
+
+	s.timezone = nil
+	if value, ok := args.Strings["timezone"]; ok && value != "" {
+		zone, err := internal.ParseTimezone(value)
+		if err != nil {
+			return err
+		}
+		s.timezone = zone
+	}
+
+	// Thresholds are given in milliseconds but compared to durations in
+	// microseconds.
+	s.slowerThan, s.fasterThan = 0, math.MaxInt64
+	if threshold, ok := args.Integers["slower-than"]; ok {
+		s.slowerThan = int64(threshold) * 1000
+	}
+	if threshold, ok := args.Integers["faster-than"]; ok {
+		s.fasterThan = int64(threshold) * 1000
+	}
+
+	if s.limit < 0 {
+		return fmt.Errorf("limit must be a positive number of patterns")
+	}
+
+	s.namespaces = internal.ArgumentSplit(args.Strings["namespace"])
+	for _, glob := range s.namespaces {
+		if _, err := path.Match(strings.TrimPrefix(glob, "!"), ""); err != nil {
+			return fmt.Errorf("invalid namespace glob '%s'", glob)
+		}
+	}
+
+	if s.finish == nil {
+		s.finish = &sync.Mutex{}
+	}
+	if s.dedup && s.requests == nil {
+		s.requests = &queryRequests{seen: make(map[string]struct{})}
+	}
+
+	switch s.format = args.Strings["format"]; s.format {
+	case "":
+		s.format = formatTable
+	case formatJSON, formatMarkdown, formatTable:
+	default:
+		return fmt.Errorf("unrecognized format '%s'", s.format)
+	}
+
+	if s.quiet && s.summaryOnly {
+		return fmt.Errorf("quiet and summary-only cannot be combined")
+	} else if s.summaryOnly && s.format == formatJSON {
+		return fmt.Errorf("summary-only cannot be combined with json output, which always includes the summary")
+	} else if s.sinceRestart && s.parallel {
+		return fmt.Errorf("since-restart cannot be combined with parallel-files, which merges every file into a single report")
+	}
+
+	if text, ok := args.Strings["output-template"]; ok && text != "" {
+		if s.format != formatTable {
+			return fmt.Errorf("an output template cannot be combined with %s output", s.format)
+		}
+
+		var err error
+		if s.template, err = formatting.NewPatternTemplate(text); err != nil {
+			return err
+		}
+	}
+
 	s.group = []string{"col", "db", "op", "pattern"}
 
 	if group, ok := args.Strings["group"]; ok {
@@ -116,7 +453,7 @@ func (s *query) Prepare(name string, instance int, args ArgumentCollection) erro
 		for _, item := range strings.Split(group, ",") {
 			item = strings.TrimSpace(item)
 			switch item {
-			case "col", "db", "op", "pattern":
+			case "app", "col", "comment", "db", "op", "pattern", "plan":
 				s.group = append(s.group, item)
 			default:
 				return fmt.Errorf("unrecognized group option '%s'", item)
@@ -126,6 +463,16 @@ func (s *query) Prepare(name string, instance int, args ArgumentCollection) erro
 		sort.Strings(s.group)
 	}
 
+	switch s.rollup = args.Strings["rollup"]; s.rollup {
+	case "":
+	case "database":
+		if !internal.ArrayBinaryMatchString("db", s.group) {
+			return fmt.Errorf("a database rollup requires grouping by db")
+		}
+	default:
+		return fmt.Errorf("unrecognized rollup '%s'", s.rollup)
+	}
+
 	sortOptions := map[string]int8{
 		"namespace": sortNamespace,
 		"operation": sortOperation,
@@ -133,8 +480,23 @@ func (s *query) Prepare(name string, instance int, args ArgumentCollection) erro
 		"count":     sortCount,
 		"min":       sortMin,
 		"max":       sortMax,
-		"95%":       sortN95,
 		"sum":       sortSum,
+		"ratio":     sortRatio,
+	}
+
+	s.percentiles = []float64{95}
+	if value, ok := args.Strings["percentile"]; ok && value != "" {
+		s.percentiles = s.percentiles[:0]
+		for _, item := range internal.ArgumentSplit(value) {
+			percentile, err := strconv.ParseFloat(strings.TrimSuffix(item, "%"), 64)
+			if err != nil || percentile <= 0 || percentile >= 100 {
+				return fmt.Errorf("unrecognized percentile '%s'", item)
+			}
+			s.percentiles = append(s.percentiles, percentile)
+		}
+	}
+	for index, percentile := range s.percentiles {
+		sortOptions[strconv.FormatFloat(percentile, 'f', -1, 64)+"%"] = sortPercentile + int8(index)
 	}
 
 	for _, opt := range internal.ArgumentSplit(args.Strings["sort"]) {
@@ -145,6 +507,12 @@ func (s *query) Prepare(name string, instance int, args ArgumentCollection) erro
 		s.Log[instance].sort = append(s.Log[instance].sort, val)
 	}
 
+	// Every input shares the same output file, which is only created once the
+	// report is complete so a failed run does not leave an empty file behind.
+	if name, ok := args.Strings["out"]; ok && name != "" {
+		s.outName = name
+	}
+
 	return nil
 }
 
@@ -155,34 +523,82 @@ func (s *query) Run(instance int, out commandTarget, in commandSource, errs comm
 	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
 	defer context.Finish()
 
-	makeKey := func(db, col, op, query string) string {
+	// Connections are only attributed to applications when grouping by them.
+	var clients *clientLookup
+	if internal.ArrayBinaryMatchString("app", s.group) {
+		clients = newClientLookup()
+	}
+
+	makeKey := func(app, comment, db, col, op, query, plan, hint string) string {
 		out := make([]string, len(s.group))
 		for index, key := range s.group {
 			switch key {
+			case "app":
+				out[index] = app
 			case "col":
 				out[index] = col
+			case "comment":
+				out[index] = comment
 			case "db":
 				out[index] = db
 			case "op":
 				out[index] = op
 			case "pattern":
 				out[index] = query
+			case "plan":
+				out[index] = plan
 			}
 		}
-		return strings.Join(out, "")
+		// Hinted queries are kept apart so their latency can be compared.
+		return strings.Join(out, "") + hint
+	}
+
+	if s.progress != nil {
+		defer s.progress.Clear()
 	}
 
 	// A function to grab new lines and parse them.
 	for base := range in {
 		log.LineCount += 1
+		if s.progress != nil {
+			s.progress.Update(log.label, log.LineCount, log.summary.End)
+		}
 
 		if base.RawMessage == "" {
 			log.ErrorCount += 1
 		} else if entry, err := context.NewEntry(base); err != nil {
 			log.ErrorCount += 1
+			if s.showErrors {
+				s.parseError(log, base, err, errs)
+			}
 		} else {
+			if s.showErrors && entry.Message == nil && context.LastError != nil {
+				// Lines without a message are normally skipped, but the
+				// reason every parser gave up is still worth showing.
+				s.parseError(log, base, context.LastError, errs)
+			}
+
+			if s.timezone != nil && entry.DateValid {
+				entry.Date = internal.DateInZone(entry.Date, entry.Format, s.timezone)
+			}
+
 			// Update the summary with any information available.
 			log.summary.Update(entry)
+			if clients != nil {
+				clients.Update(entry)
+			}
+
+			if s.sinceRestart {
+				// A startup banner closes the current segment so the next run starts fresh.
+				if _, ok := getVersionFromMessage(entry.Message); ok && len(log.Patterns) > 0 {
+					values := s.values(log.Patterns)
+					s.sort(values, log.sort)
+
+					log.Segments = append(log.Segments, querySegment{Restart: entry.Date, Table: s.top(values), Total: len(values)})
+					log.Patterns = make(map[string]queryPattern)
+					continue
+				}
+			}
 
 			// Ignore any messages that aren't CRUD related.
 			crud, ok := entry.Message.(message.CRUD)
@@ -191,43 +607,65 @@ func (s *query) Run(instance int, out commandTarget, in commandSource, errs comm
 				continue
 			}
 
-			if !s.system {
-				if base, ok := message.BaseFromMessage(entry.Message); ok && strings.HasPrefix(base.Namespace, "system.") {
-					// Ignore system collections.
-					continue
-				}
-			}
-
-			pattern := mongo.NewPattern(crud.Filter)
-			query := pattern.StringCompact()
-
 			ns, op, dur, ok := s.standardize(crud)
 			if !ok {
 				log.ErrorCount += 1
 				continue
+			} else if !s.matchNamespace(ns) {
+				continue
+			} else if dur < s.slowerThan || dur > s.fasterThan {
+				// Thresholds exclude operations before any statistics
+				// (including percentiles) are collected.
+				continue
 			}
 
-			op = internal.StringToLower(op)
-
-			switch op {
-			case "find":
-			case "count":
-			case "update":
-			case "getmore":
-			case "remove":
-			case "findandmodify":
-			case "geonear":
-				// Noop
-
-			default:
+			ns, op, filter, pipeline, ok := s.row(crud, ns, op)
+			if !ok {
 				continue
 			}
 
-			if op != "" && query != "" {
+			if op != "" {
+				base, _ := message.BaseFromMessage(entry.Message)
+				plan := planSummary(base.PlanSummary)
+
+				app := ""
+				if clients != nil {
+					app = s.application(entry, clients)
+				}
+
+				// Operations without a comment are grouped together rather
+				// than with an empty cell.
+				comment := ""
+				if internal.ArrayBinaryMatchString("comment", s.group) {
+					comment = crud.Comment
+					if comment == "" {
+						comment = queryNoComment
+					}
+				}
+
 				db, col, _ := internal.StringDoubleSplit(ns, '.')
-				key := makeKey(db, col, op, query)
+				// Patterns are keyed by their hash so the string form is only
+				// built for the first operation of each pattern.
+				query := strconv.FormatUint(filter.Hash(), 16) + pipeline
+				key := makeKey(app, comment, db, col, op, query, plan, crud.Hint)
+				if s.dedup && s.duplicate(crud, ns+key) {
+					log.Duplicates += 1
+					continue
+				}
+
+				source := ""
+				if s.bySource {
+					source = log.label
+					key = source + key
+				}
 
 				pattern, ok := log.Patterns[key]
+				if ok && !pattern.filter.Equals(filter) {
+					// A different filter with the same hash, so the string
+					// form is needed to keep the two apart.
+					key += ":" + filter.StringCompact()
+					pattern, ok = log.Patterns[key]
+				}
 				if !internal.ArrayBinaryMatchString("col", s.group) {
 					col = ""
 					ns = db
@@ -241,21 +679,55 @@ func (s *query) Run(instance int, out commandTarget, in commandSource, errs comm
 				}
 				if !internal.ArrayBinaryMatchString("pattern", s.group) {
 					query = ""
+				} else if !ok {
+					query = filter.StringCompact() + pipeline
+				}
+				if !internal.ArrayBinaryMatchString("plan", s.group) {
+					plan = ""
 				}
 
 				if !ok {
 					pattern = queryPattern{
 						Pattern: formatting.Pattern{
-							Min:       math.MaxInt64,
+							App:       app,
+							Comment:   comment,
+							Hint:      crud.Hint,
+							Source:    source,
+							Min:       math.MaxFloat64,
 							Namespace: ns,
 							Operation: op,
 							Pattern:   query,
+							Plan:      plan,
 						},
-						p95: make([]int64, 0, N95MaxSamples),
+						filter: filter,
 					}
 				}
 
-				log.Patterns[key] = s.update(pattern, dur)
+				if crud.Origin != "" {
+					pattern = s.getMore(pattern, dur)
+					log.Patterns[key] = pattern
+					continue
+				}
+
+				storage, _ := message.StorageFromMessage(entry.Message)
+				if base.Cut {
+					pattern = s.untimed(pattern, entry.Date)
+				} else {
+					pattern = s.update(pattern, entry.Date, dur, base.Counters, storage)
+				}
+				if locks, ok := message.LocksFromMessage(entry.Message); ok && s.locks {
+					pattern.AddLocks(locks)
+				}
+				if collectionScan(base.PlanSummary) {
+					pattern.CollectionScans += 1
+				}
+				if base.Truncated {
+					pattern.Approximate = true
+				}
+				if pattern.queryHash == "" {
+					pattern.queryHash = base.QueryHash
+				}
+				log.Patterns[key] = pattern
 			}
 		}
 	}
@@ -263,11 +735,58 @@ func (s *query) Run(instance int, out commandTarget, in commandSource, errs comm
 	if len(log.summary.Version) == 0 {
 		log.summary.Guess(context.Versions())
 	}
+	if s.showErrors {
+		s.parseErrors(log, errs)
+	}
 
 	return nil
 }
 
-func (query) sort(values []formatting.Pattern, order []int8) {
+// The number of characters of a line shown with its parse error.
+const parseErrorLength = 80
+
+// Reports a line that could not be parsed and counts the reason.
+func (s *query) parseError(log *queryInstance, base record.Base, err error, errs commandError) {
+	if log.errors == nil {
+		log.errors = make(map[string]uint)
+	}
+	log.errors[err.Error()] += 1
+
+	line := base.RawMessage
+	if internal.StringLength(line) > parseErrorLength {
+		line = string([]rune(line)[:parseErrorLength]) + "..."
+	}
+	errs <- fmt.Errorf("%s:%d: %s: %s", log.label, base.LineNumber, err, line)
+}
+
+// Reports the number of lines that could not be parsed for each reason, most
+// common first, so a gap in the parsers stands out.
+func (s *query) parseErrors(log *queryInstance, errs commandError) {
+	if len(log.errors) == 0 {
+		return
+	}
+
+	var total uint
+	reasons := make([]string, 0, len(log.errors))
+	for reason, count := range log.errors {
+		reasons = append(reasons, reason)
+		total += count
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if a, b := log.errors[reasons[i]], log.errors[reasons[j]]; a != b {
+			return a > b
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	buffer := bytes.NewBufferString(fmt.Sprintf("%s: %d lines could not be parsed", log.label, total))
+	for _, reason := range reasons {
+		buffer.WriteString(fmt.Sprintf("\n%8d  %s", log.errors[reason], reason))
+	}
+	errs <- errors.New(buffer.String())
+}
+
+func (s query) sort(values []formatting.Pattern, order []int8) {
 	sort.Slice(values, func(i, j int) bool {
 		for _, field := range order {
 			switch field {
@@ -291,11 +810,6 @@ func (query) sort(values []formatting.Pattern, order []int8) {
 					continue
 				}
 				return values[i].Sum >= values[j].Sum
-			case sortN95: // Descending
-				if values[i].N95Percentile == values[j].N95Percentile {
-					continue
-				}
-				return values[i].N95Percentile >= values[j].N95Percentile
 			case sortMax: // Descending
 				if values[i].Max == values[j].Max {
 					continue
@@ -311,84 +825,979 @@ func (query) sort(values []formatting.Pattern, order []int8) {
 					continue
 				}
 				return values[i].Count >= values[j].Count
+			case sortRatio: // Descending
+				a, _ := values[i].Ratio()
+				b, _ := values[j].Ratio()
+				if a == b {
+					continue
+				}
+				return a >= b
+			default: // Descending
+				percentile := s.percentiles[field-sortPercentile]
+				if values[i].Percentiles[percentile] == values[j].Percentiles[percentile] {
+					continue
+				}
+				return values[i].Percentiles[percentile] >= values[j].Percentiles[percentile]
 			}
 		}
 		return false
 	})
 }
 
+// The application that ran an operation, preferring the appName logged with
+// the operation over the metadata of the connection it ran on.
+func (query) application(entry record.Entry, clients *clientLookup) string {
+	crud, _ := entry.Message.(message.CRUD)
+	switch msg := crud.Message.(type) {
+	case message.Command:
+		if msg.Agent != "" {
+			return msg.Agent
+		}
+	case message.Operation:
+		if msg.Agent != "" {
+			return msg.Agent
+		}
+	}
+
+	if client, ok := clients.Get(entry); ok {
+		return client.AppName
+	}
+	return ""
+}
+
+// Checks for stages that are specific to window functions and time-series
+// collections.
+func (query) windowed(pipeline []string) bool {
+	for _, stage := range pipeline {
+		switch stage {
+		case "$setWindowFields", "$densify", "$fill":
+			return true
+		}
+	}
+	return false
+}
+
+// Determines the namespace, operation, and pattern of the row a CRUD message
+// contributes to, along with the stages of pipelines that are reported apart
+// from the pattern (e.g. " $setWindowFields"). Messages excluded from the
+// report return false.
+func (s *query) row(crud message.CRUD, ns, op string) (string, string, mongo.Pattern, string, bool) {
+	if !s.system {
+		if base, ok := message.BaseFromMessage(crud); ok && strings.HasPrefix(base.Namespace, "system.") {
+			// Ignore system collections.
+			return "", "", mongo.Pattern{}, "", false
+		}
+	}
+
+	var filter mongo.Pattern
+	if s.markers {
+		// Markers tell an embedded document apart from its fields, so dotted
+		// fields are left as they are.
+		filter = mongo.NewPatternMarked(crud.Filter)
+	} else {
+		// A field is grouped the same whether it is reached by a dotted name
+		// or through nested objects, e.g. {"a.b": 1} and {"a": {"b": 1}}.
+		filter = mongo.NewPatternWithOptions(crud.Filter, mongo.PatternOptions{NestDottedFields: true})
+	}
+	pipeline := ""
+	op = internal.StringToLower(op)
+	if op == "getmore" && crud.Origin != "" {
+		// Cursors are reported against the command that opened them.
+		op = crud.Origin
+	}
+
+	// Time-series collections are maintained through writes to an
+	// internal bucket collection, so those writes are reported
+	// against the time-series collection itself.
+	bucket := false
+	if db, col, _ := internal.StringDoubleSplit(ns, '.'); strings.HasPrefix(col, "system.buckets.") {
+		ns, bucket = db+"."+col[15:], true
+	}
+
+	switch op {
+	case "aggregate":
+		if s.stages || s.windowed(crud.Pipeline) {
+			// Window functions make for very different workloads
+			// than a $match with the same shape.
+			pipeline = " " + strings.Join(crud.Pipeline, ",")
+		}
+
+	case "find":
+	case "insert":
+		// Inserts have no filter so they are reported by namespace alone.
+	case "count":
+	case "update":
+	case "getmore":
+	case "remove":
+	case "findandmodify":
+	case "geonear":
+		// Noop
+
+	default:
+		return "", "", mongo.Pattern{}, "", false
+	}
+
+	if bucket {
+		op = "bucket " + op
+	}
+
+	return ns, op, filter, pipeline, true
+}
+
+// Returns the namespace, operation, and duration (in microseconds) of a CRUD
+// message.
 func (query) standardize(crud message.CRUD) (ns string, op string, dur int64, ok bool) {
+	var payload message.Payload
+
 	ok = true
 	switch cmd := crud.Message.(type) {
 	case message.Command:
-		dur = cmd.Duration
+		dur = cmd.DurationMicros()
 		ns = cmd.Namespace
 		op = cmd.Command
+		payload = cmd.Payload
 
 	case message.CommandLegacy:
-		dur = cmd.Duration
+		dur = cmd.DurationMicros()
 		ns = cmd.Namespace
 		op = cmd.Command
+		payload = cmd.Payload
 
 	case message.Operation:
-		dur = cmd.Duration
+		dur = cmd.DurationMicros()
 		ns = cmd.Namespace
 		op = cmd.Operation
+		payload = cmd.Payload
 
 	case message.OperationLegacy:
-		dur = cmd.Duration
+		dur = cmd.DurationMicros()
 		ns = cmd.Namespace
 		op = cmd.Operation
+		payload = cmd.Payload
 
 	default:
 		// Returned something completely unexpected so ignore the line.
 		ok = false
 	}
 
+	ns = commandNamespace(ns, payload)
 	return
 }
 
+// The fields of a command that name the collection it targets. A getMore
+// names its collection separately from the cursor id.
+var commandCollections = []string{
+	"aggregate",
+	"collection",
+	"count",
+	"delete",
+	"distinct",
+	"find",
+	"findAndModify",
+	"findandmodify",
+	"geoNear",
+	"geonear",
+	"insert",
+	"mapReduce",
+	"mapreduce",
+	"update",
+}
+
+// Resolves the namespace of a command logged against the database (e.g.
+// "test.$cmd") to the collection named in the command, so commands and
+// operations on the same collection are reported together.
+func commandNamespace(ns string, payload message.Payload) string {
+	if !strings.HasSuffix(ns, ".$cmd") {
+		return ns
+	}
+
+	documents := []map[string]interface{}{payload}
+	if query, ok := payload["query"].(map[string]interface{}); ok {
+		// Legacy drivers send commands as a query against $cmd, which wraps
+		// the command itself.
+		documents = append(documents, query)
+	}
+
+	for _, document := range documents {
+		for _, name := range commandCollections {
+			if col, ok := document[name].(string); ok && col != "" {
+				return ns[:len(ns)-len("$cmd")] + col
+			}
+		}
+	}
+	return ns
+}
+
 func (s *query) Terminate(out commandTarget) error {
-	out <- string(s.summaryTable.String())
+	if s.parallel && !s.summaryOnly {
+		patterns := s.merge()
+		values := s.values(patterns)
+		s.sort(values, s.Log[0].sort)
+
+		total := len(values)
+		rollup := s.rollupTable(values)
+		values = s.top(values)
+
+		if s.format == formatJSON {
+			report := queryReport{Patterns: values, Total: total, Rollup: rollup}
+			for index := 0; index < len(s.Log); index += 1 {
+				report.Summaries = append(report.Summaries, &s.Log[index].summary)
+				report.Lines += s.Log[index].LineCount
+				report.Errors += s.Log[index].ErrorCount
+				report.Duplicates += s.Log[index].Duplicates
+			}
+
+			if err := json.NewEncoder(s.summaryTable).Encode(report); err != nil {
+				return err
+			}
+			return s.write(out)
+		}
+
+		if err := s.print(values, total); err != nil {
+			return err
+		}
+		s.printRollup(rollup)
+		values.PrintPlanning(s.summaryTable)
+		values.PrintStorage(s.summaryTable)
+		values.PrintSortLargePayload(s.summaryTable)
+		values.PrintQuantiles(s.quantiles, s.summaryTable)
+		values.PrintTrend(s.trend, s.summaryTable)
+		values.PrintIntervals(intervalPatterns, s.period, s.summaryTable)
+
+		start, end := s.Log[0].summary.Start, s.Log[0].summary.End
+		for _, log := range s.Log {
+			if log.summary.Start.Before(start) {
+				start = log.summary.Start
+			}
+			if log.summary.End.After(end) {
+				end = log.summary.End
+			}
+		}
+		s.growth(patterns, start, end).Print(s.topGrowth, s.summaryTable)
+
+		var duplicates uint
+		for _, log := range s.Log {
+			duplicates += log.Duplicates
+		}
+		s.printDuplicates(duplicates)
+	}
+
+	return s.write(out)
+}
+
+// Prints the summary of an input, first erasing any progress line since both
+// are usually shown on the same terminal.
+func (s *query) printSummary(log *queryInstance) {
+	if s.quiet {
+		return
+	} else if s.progress == nil {
+		log.summary.Print(s.summaryOutput())
+		return
+	}
+	s.progress.Suspend(func() {
+		log.summary.Print(s.summaryOutput())
+	})
+}
+
+// Summaries are printed directly to stdout unless an output file was given,
+// in which case they are kept with the report and both are written to the file.
+func (s *query) summaryOutput() io.Writer {
+	if s.output != nil || s.outName != "" {
+		return s.summaryTable
+	}
+	return os.Stdout
+}
+
+func (s *query) write(out commandTarget) error {
+	if s.output == nil && s.outName == "" {
+		out <- s.summaryTable.String()
+		return nil
+	} else if s.output == nil {
+		file, err := os.Create(s.outName)
+		if err != nil {
+			return fmt.Errorf("unable to open output file '%s' (%s)", s.outName, err)
+		}
+		s.output = file
+	}
+
+	if _, err := s.output.Write(s.summaryTable.Bytes()); err != nil {
+		return err
+	}
+	if closer, ok := s.output.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Checks a namespace against the namespace globs. A namespace matching any
+// negated glob is excluded, otherwise it must match at least one glob (when
+// any are given).
+func (s *query) matchNamespace(ns string) bool {
+	included, globs := false, 0
+	for _, glob := range s.namespaces {
+		if strings.HasPrefix(glob, "!") {
+			if match, _ := path.Match(glob[1:], ns); match {
+				return false
+			}
+			continue
+		}
+
+		globs += 1
+		if match, _ := path.Match(glob, ns); match {
+			included = true
+		}
+	}
+	return included || globs == 0
+}
+
+// Records the logical request of an operation, returning true when it has
+// already been counted. Operations without a transaction number (i.e. neither
+// retryable nor part of a transaction) are never duplicates. The pattern key
+// is included since every statement of a transaction shares a txnNumber.
+func (s *query) duplicate(crud message.CRUD, key string) bool {
+	payload, ok := message.PayloadFromMessage(crud.Message)
+	if !ok {
+		return false
+	}
+
+	lsid, ok := (*payload)["lsid"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	txnNumber, ok := (*payload)["txnNumber"]
+	if !ok {
+		return false
+	}
+
+	id := fmt.Sprintf("%v:%v:%v:%s", lsid["id"], txnNumber, (*payload)["stmtId"], key)
+
+	s.requests.Lock()
+	defer s.requests.Unlock()
+
+	if _, ok := s.requests.seen[id]; ok {
+		return true
+	}
+	s.requests.seen[id] = struct{}{}
+	return false
+}
+
+// Renders the patterns, noting how many were left out by --limit. The total
+// is the number of distinct patterns before the table was truncated.
+func (s *query) print(values formatting.Table, total int) error {
+	if s.template != nil {
+		if err := values.PrintTemplate(s.template, s.summaryTable); err != nil {
+			return err
+		}
+	} else if s.format == formatMarkdown {
+		values.PrintMarkdown(s.summaryTable)
+	} else {
+		values.Print(s.wrap, s.width, s.summaryTable)
+	}
+
+	if total > len(values) {
+		s.summaryTable.WriteString(fmt.Sprintf("\nshowing %d of %d patterns\n", len(values), total))
+	}
 	return nil
 }
 
-func (query) update(s queryPattern, dur int64) queryPattern {
+// Truncates a sorted table to the first --limit patterns.
+func (s *query) top(values formatting.Table) formatting.Table {
+	if s.limit > 0 && len(values) > s.limit {
+		return values[:s.limit]
+	}
+	return values
+}
+
+// Totals the patterns by database when a rollup was requested. The totals
+// include every pattern, so they are calculated before --limit applies.
+func (s *query) rollupTable(values formatting.Table) formatting.RollupTable {
+	if s.rollup == "" {
+		return nil
+	}
+	return formatting.NewDatabaseRollup(values)
+}
+
+func (s *query) printRollup(rollup formatting.RollupTable) {
+	if s.format == formatMarkdown {
+		rollup.PrintMarkdown(s.summaryTable)
+	} else {
+		rollup.Print(s.summaryTable)
+	}
+}
+
+func (s *query) printDuplicates(count uint) {
+	if s.dedup && count > 0 {
+		s.summaryTable.WriteString(fmt.Sprintf("\n%d duplicate operations collapsed\n", count))
+	}
+}
+
+// Combine the patterns found in every file into a single set of patterns.
+func (s *query) merge() map[string]queryPattern {
+	merged := make(map[string]queryPattern)
+
+	for index := 0; index < len(s.Log); index += 1 {
+		for key, pattern := range s.Log[index].Patterns {
+			total, ok := merged[key]
+			if !ok {
+				// Copy the buckets so merging never modifies the original.
+				pattern.buckets = mergeBuckets(nil, pattern.buckets)
+				pattern.periods = mergeBuckets(nil, pattern.periods)
+				if storage := pattern.Storage; storage != nil {
+					pattern.Storage = make(map[string]int64, len(storage))
+					for name, sum := range storage {
+						pattern.Storage[name] = sum
+					}
+				}
+				pattern.p95 = append([]int64(nil), pattern.p95...)
+				if scopes := pattern.LockScopes; scopes != nil {
+					pattern.LockScopes = make(map[string]int64, len(scopes))
+					for scope, sum := range scopes {
+						pattern.LockScopes[scope] = sum
+					}
+				}
+
+				merged[key] = pattern
+				continue
+			}
+
+			total.buckets = mergeBuckets(total.buckets, pattern.buckets)
+			total.periods = mergeBuckets(total.periods, pattern.periods)
+
+			total.p95 = s.mergeSamples(total.p95, total.Timed(), pattern.p95, pattern.Timed())
+			total.Count += pattern.Count
+			total.Untimed += pattern.Untimed
+			total.Sum += pattern.Sum
+
+			total.Planned += pattern.Planned
+			total.PlanningSum += pattern.PlanningSum
+			total.ExecutionSum += pattern.ExecutionSum
+
+			total.Reads += pattern.Reads
+			total.BytesRead += pattern.BytesRead
+			total.ReadingSum += pattern.ReadingSum
+			total.ReadDuration += pattern.ReadDuration
+			for name, sum := range pattern.Storage {
+				if total.Storage == nil {
+					total.Storage = make(map[string]int64, len(pattern.Storage))
+				}
+				total.Storage[name] += sum
+			}
+			total.StorageCount += pattern.StorageCount
+
+			for scope, sum := range pattern.LockScopes {
+				if total.LockScopes == nil {
+					total.LockScopes = make(map[string]int64, len(pattern.LockScopes))
+				}
+				total.LockScopes[scope] += sum
+			}
+			total.Locked += pattern.Locked
+			total.LockSum += pattern.LockSum
+			if pattern.LockMax > total.LockMax {
+				total.LockMax = pattern.LockMax
+			}
+
+			total.Responses += pattern.Responses
+			total.ResponseBytes += pattern.ResponseBytes
+			total.Returned += pattern.Returned
+			total.Sorted += pattern.Sorted
+			total.Inserted += pattern.Inserted
+			total.GetMores += pattern.GetMores
+			total.GetMoreSum += pattern.GetMoreSum
+
+			total.CollectionScans += pattern.CollectionScans
+			total.Approximate = total.Approximate || pattern.Approximate
+			if total.queryHash == "" {
+				total.queryHash = pattern.queryHash
+			}
+
+			if !pattern.firstSeen.IsZero() && (total.firstSeen.IsZero() || pattern.firstSeen.Before(total.firstSeen)) {
+				total.firstSeen = pattern.firstSeen
+			}
+			if pattern.lastSeen.After(total.lastSeen) {
+				total.lastSeen = pattern.lastSeen
+			}
+			total.Examined += pattern.Examined
+			total.DocsExamined += pattern.DocsExamined
+			total.KeysCount += pattern.KeysCount
+			total.KeysExamined += pattern.KeysExamined
+			total.ExaminedReturned += pattern.ExaminedReturned
+
+			if pattern.Max > total.Max {
+				total.Max = pattern.Max
+			}
+			if pattern.Min < total.Min {
+				total.Min = pattern.Min
+			}
+
+			merged[key] = total
+		}
+	}
+
+	return merged
+}
+
+// A plan summary as a single string, e.g. "IXSCAN { a: 1 }, COLLSCAN". Key
+// order is lost when parsing, so the keys of each stage are sorted.
+func planSummary(plans []message.PlanSummary) string {
+	stages := make([]string, 0, len(plans))
+	for _, plan := range plans {
+		key, ok := plan.Key.(map[string]interface{})
+		if !ok || len(key) == 0 {
+			stages = append(stages, plan.Type)
+			continue
+		}
+
+		fields := make([]string, 0, len(key))
+		for field := range key {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for index, field := range fields {
+			fields[index] = fmt.Sprintf("%s: %v", field, key[field])
+		}
+		stages = append(stages, plan.Type+" { "+strings.Join(fields, ", ")+" }")
+	}
+	return strings.Join(stages, ", ")
+}
+
+// Whether any stage of a plan summary scanned the collection.
+func collectionScan(plans []message.PlanSummary) bool {
+	for _, plan := range plans {
+		if plan.Type == "COLLSCAN" {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *query) update(s queryPattern, date time.Time, dur int64, counters map[string]int64, storage map[string]interface{}) queryPattern {
+	// Samples are kept in microseconds but reported in milliseconds.
+	ms := float64(dur) / 1000
+
+	s.Count += 1
+	s.Sum += ms
+	s.p95 = q.sample(s.p95, s.Timed(), dur)
+	s.seen(date)
+
+	if (q.topGrowth > 0 || q.trend > 0) && !date.IsZero() {
+		s.buckets = addBucket(s.buckets, q.truncate(date, q.interval), dur, q.trend > 0)
+	}
+	if q.intervals && !date.IsZero() {
+		s.periods = addBucket(s.periods, q.truncate(date, q.period), dur, true)
+	}
+
+	if planning, ok := counters["planningTimeMicros"]; ok {
+		s.Planned += 1
+		s.PlanningSum += planning
+		s.ExecutionSum += dur - planning
+	}
+
+	if reslen, ok := counters["reslen"]; ok {
+		s.Responses += 1
+		s.ResponseBytes += reslen
+		s.Returned += counters["nreturned"]
+	}
+	if counters["hasSortStage"] > 0 {
+		s.Sorted += 1
+	}
+	s.Inserted += counters["ninserted"]
+	if examined, ok := counters["docsExamined"]; ok {
+		s.Examined += 1
+		s.DocsExamined += examined
+		s.ExaminedReturned += counters["nreturned"]
+	}
+	if keys, ok := counters["keysExamined"]; ok {
+		s.KeysCount += 1
+		s.KeysExamined += keys
+	}
+
+	if bytesRead, reading, ok := storageReads(storage); ok {
+		s.Reads += 1
+		s.BytesRead += bytesRead
+		s.ReadingSum += reading
+		s.ReadDuration += dur
+	}
+	if q.storage && storage != nil {
+		s.AddStorage(storage)
+	}
+
+	if ms > s.Max {
+		s.Max = ms
+	}
+	if ms < s.Min {
+		s.Min = ms
+	}
+
+	return s
+}
+
+// Adds an operation to the bucket starting at start, keeping its duration as
+// a sample when samples are needed.
+func addBucket(buckets map[int64]queryBucket, start int64, dur int64, sample bool) map[int64]queryBucket {
+	if buckets == nil {
+		buckets = make(map[int64]queryBucket)
+	}
+
+	bucket := buckets[start]
+	bucket.Count += 1
+	bucket.Sum += dur
+	if sample {
+		bucket.samples = append(bucket.samples, dur)
+	}
+	buckets[start] = bucket
+	return buckets
+}
+
+// Adds the buckets of another file to a set of buckets, which is created when
+// nil (e.g. to copy the buckets of the first file).
+func mergeBuckets(total, buckets map[int64]queryBucket) map[int64]queryBucket {
+	if total == nil {
+		total = make(map[int64]queryBucket, len(buckets))
+	}
+	for start, bucket := range buckets {
+		sum := total[start]
+		sum.Count += bucket.Count
+		sum.Sum += bucket.Sum
+		sum.samples = append(sum.samples, bucket.samples...)
+		total[start] = sum
+	}
+	return total
+}
+
+// Counts an operation that was cut short before its duration was logged. Its
+// duration is unknown, so it is left out of the durations (and the intervals)
+// rather than counted as instant.
+func (q *query) untimed(s queryPattern, date time.Time) queryPattern {
 	s.Count += 1
-	s.Sum += dur
-	s.p95 = append(s.p95, dur)
+	s.Untimed += 1
+	s.seen(date)
+	return s
+}
 
-	if dur > s.Max {
-		s.Max = dur
+// Widens the dates the pattern was seen between to include an operation.
+// Dates are compared as instants so ctime and ISO-8601 dates (with differing
+// offsets) order correctly.
+func (s *queryPattern) seen(date time.Time) {
+	if date.IsZero() {
+		return
+	}
+	if s.firstSeen.IsZero() || date.Before(s.firstSeen) {
+		s.firstSeen = date
 	}
-	if dur < s.Min {
-		s.Min = dur
+	if date.After(s.lastSeen) {
+		s.lastSeen = date
 	}
+}
 
+// Attributes a getMore to the pattern of the command that opened its cursor.
+// Its duration is kept apart so the count and latencies of the pattern still
+// describe the originating command alone.
+func (query) getMore(s queryPattern, dur int64) queryPattern {
+	s.GetMores += 1
+	s.GetMoreSum += float64(dur) / 1000
 	return s
 }
 
+// Adds a duration to the samples of a pattern that has seen count durations
+// (including this one). Once the reservoir is full, each duration replaces a
+// random sample with probability size/count. The package random source is
+// used since it is safe for concurrent use.
+func (q *query) sample(samples []int64, count int64, dur int64) []int64 {
+	size := q.maxSamples
+	if size <= 0 {
+		size = N95MaxSamples
+	}
+
+	if len(samples) < size {
+		return append(samples, dur)
+	} else if index := rand.Int63n(count); index < int64(size) {
+		samples[index] = dur
+	}
+	return samples
+}
+
+// Merges two reservoirs of samples, drawn from the durations of a and b
+// operations, into a reservoir of at most maxSamples. Each reservoir holds at
+// most maxSamples of its own operations, so samples are drawn from each in
+// proportion to the operations they stand for rather than their number.
+func (q *query) mergeSamples(x []int64, a int64, y []int64, b int64) []int64 {
+	size := q.maxSamples
+	if size <= 0 {
+		size = N95MaxSamples
+	}
+	if len(x)+len(y) <= size {
+		return append(x, y...)
+	}
+
+	// The samples to draw from x, limited by the samples available in each.
+	count := int(math.Round(float64(size) * float64(a) / float64(a+b)))
+	if count > len(x) {
+		count = len(x)
+	} else if count < size-len(y) {
+		count = size - len(y)
+	}
+
+	merged := make([]int64, 0, size)
+	for _, index := range rand.Perm(len(x))[:count] {
+		merged = append(merged, x[index])
+	}
+	for _, index := range rand.Perm(len(y))[:size-count] {
+		merged = append(merged, y[index])
+	}
+	return merged
+}
+
 func (s *query) values(patterns map[string]queryPattern) formatting.Table {
 	values := make([]formatting.Pattern, 0, len(s.Log))
+	first, last := s.span(patterns)
+
+	var starts []int64
+	if s.intervals {
+		starts = s.starts(patterns)
+	}
+
 	for _, pattern := range patterns {
 		sort.Slice(pattern.p95, func(i, j int) bool { return pattern.p95[i] <= pattern.p95[j] })
 
-		if len(pattern.p95) > 1 {
-			// Get the 95th percent position given the total set of data available.
-			index := float64(len(pattern.p95)) * 0.95
+		pattern.Pattern.Percentiles = make(map[float64]float64, len(s.percentiles))
+		for _, p := range s.percentiles {
+			if len(pattern.p95) < s.minSamples {
+				// Too few samples to produce a meaningful percentile.
+				pattern.Pattern.Percentiles[p] = math.NaN()
+			} else if len(pattern.p95) > 1 {
+				pattern.Pattern.Percentiles[p] = percentile(pattern.p95, p) / 1000
+			}
+		}
 
-			if float64(int64(index)) == index {
-				// Check for a whole number (i.e. an exact 95th percentile value).
-				pattern.Pattern.N95Percentile = float64(pattern.p95[int(index)])
-			} else if index > 1 {
-				// Take the average of two values around the 95th percentile.
-				pattern.Pattern.N95Percentile = (float64(pattern.p95[int(index)-1] + pattern.p95[int(index)])) / 2
-			} else {
-				pattern.Pattern.N95Percentile = math.NaN()
+		if s.quantiles > 0 {
+			for _, value := range quantiles(pattern.p95, 10) {
+				pattern.Pattern.Quantiles = append(pattern.Pattern.Quantiles, float64(value)/1000)
 			}
 		}
+		if s.trend > 0 {
+			pattern.Pattern.Trend = s.spans(pattern, first, last)
+		}
+		if s.timestamps {
+			pattern.FirstSeen, pattern.LastSeen = pattern.firstSeen, pattern.lastSeen
+		}
+		if s.intervals {
+			pattern.Pattern.Intervals = s.intervalsOf(pattern, starts)
+		}
+		if s.examined {
+			means := pattern.MeanExamined()
+			pattern.ExaminedMeans = &means
+		}
+		if s.queryHash {
+			pattern.QueryHash = pattern.queryHash
+		}
 
 		values = append(values, pattern.Pattern)
 	}
 	return values
 }
+
+// Returns a percentile (e.g. 95) of a sorted list of at least two samples.
+func percentile(samples []int64, p float64) float64 {
+	// Get the percentile position given the total set of data available.
+	index := float64(len(samples)) * p / 100
+
+	if float64(int64(index)) == index {
+		// Check for a whole number (i.e. an exact percentile value).
+		return float64(samples[int(index)])
+	} else if index > 1 {
+		// Take the average of two values around the percentile.
+		return (float64(samples[int(index)-1] + samples[int(index)])) / 2
+	} else {
+		return math.NaN()
+	}
+}
+
+// Returns the unix time at the start of the interval containing a date. Dates
+// are truncated in their own time zone so that, e.g., hourly intervals of a
+// log with a half hour offset begin on the hour. C-string dates have no time
+// zone and are treated as UTC, which is also how they are displayed.
+func (s *query) truncate(date time.Time, interval time.Duration) int64 {
+	_, offset := date.Zone()
+	shift := time.Duration(offset) * time.Second
+	return date.Add(shift).Truncate(interval).Add(-shift).Unix()
+}
+
+// Returns the start of every interval between the first and last --interval
+// bucket of any pattern, including intervals without operations.
+func (s *query) starts(patterns map[string]queryPattern) []int64 {
+	seen := make(map[int64]bool)
+	for _, pattern := range patterns {
+		for start := range pattern.periods {
+			seen[start] = true
+		}
+	}
+
+	sorted := make([]int64, 0, len(seen))
+	for start := range seen {
+		sorted = append(sorted, start)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	// Fill the gaps between buckets. A change of offset (e.g. daylight
+	// saving time) shifts the buckets that follow it, so gaps are filled
+	// from each bucket rather than from the first.
+	step := int64(s.period.Seconds())
+	starts := make([]int64, 0, len(sorted))
+	for index, start := range sorted {
+		starts = append(starts, start)
+		if index+1 < len(sorted) {
+			for next := start + step; sorted[index+1]-next >= step; next += step {
+				starts = append(starts, next)
+			}
+		}
+	}
+	return starts
+}
+
+// Returns the count and p95 of a pattern within each interval.
+func (s *query) intervalsOf(pattern queryPattern, starts []int64) []formatting.Interval {
+	location := pattern.lastSeen.Location()
+	intervals := make([]formatting.Interval, 0, len(starts))
+
+	for _, start := range starts {
+		bucket := pattern.periods[start]
+		interval := formatting.Interval{Start: time.Unix(start, 0).In(location), Count: bucket.Count, P95: math.NaN()}
+
+		samples := append([]int64(nil), bucket.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		if len(samples) == 0 || len(samples) < s.minSamples {
+			// Too few samples (or none at all) for a percentile.
+		} else if len(samples) == 1 {
+			interval.P95 = float64(samples[0]) / 1000
+		} else {
+			interval.P95 = percentile(samples, 95) / 1000
+		}
+
+		intervals = append(intervals, interval)
+	}
+	return intervals
+}
+
+// Returns the first and last time buckets seen across every pattern.
+func (s *query) span(patterns map[string]queryPattern) (first int64, last int64) {
+	first, last = math.MaxInt64, math.MinInt64
+	for _, pattern := range patterns {
+		for start := range pattern.buckets {
+			if start < first {
+				first = start
+			}
+			if start > last {
+				last = start
+			}
+		}
+	}
+	return
+}
+
+// Divides the time between the first and last bucket into equal spans and
+// calculates the p95 of each. Spans with too few samples are NaN.
+func (s *query) spans(pattern queryPattern, first, last int64) []float64 {
+	if first > last {
+		return nil
+	}
+
+	total := last - first + int64(s.interval.Seconds())
+	samples := make([][]int64, trendSpans)
+	for start, bucket := range pattern.buckets {
+		index := (start - first) * trendSpans / total
+		samples[index] = append(samples[index], bucket.samples...)
+	}
+
+	trend := make([]float64, trendSpans)
+	for index, span := range samples {
+		if len(span) < trendMinSamples || len(span) < s.minSamples {
+			trend[index] = math.NaN()
+			continue
+		}
+
+		sort.Slice(span, func(i, j int) bool { return span[i] < span[j] })
+		trend[index] = percentile(span, 95) / 1000
+	}
+	return trend
+}
+
+// Returns the bytes read and time spent reading (in microseconds) from the
+// "data" section of an operation's storage statistics.
+func storageReads(storage map[string]interface{}) (bytesRead int64, reading int64, ok bool) {
+	data, ok := storage["data"].(map[string]interface{})
+	if !ok {
+		return 0, 0, false
+	}
+
+	integer := func(value interface{}) int64 {
+		switch t := value.(type) {
+		case int:
+			return int64(t)
+		case int64:
+			return t
+		case float64:
+			return int64(t)
+		default:
+			return 0
+		}
+	}
+
+	bytesRead, reading = integer(data["bytesRead"]), integer(data["timeReadingMicros"])
+	return bytesRead, reading, bytesRead > 0 || reading > 0
+}
+
+// Returns the nearest-rank value at each of the n evenly spaced quantiles
+// of a sorted list of samples.
+func quantiles(samples []int64, n int) []int64 {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	out := make([]int64, n)
+	for i := 1; i <= n; i += 1 {
+		rank := int(math.Ceil(float64(i*len(samples))/float64(n))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		out[i-1] = samples[rank]
+	}
+	return out
+}
+
+// Compare the time buckets of every pattern on either side of the temporal
+// midpoint and rank them by how much the count (and then mean latency) grew.
+func (s *query) growth(patterns map[string]queryPattern, start, end time.Time) formatting.GrowthTable {
+	if s.topGrowth <= 0 {
+		return nil
+	}
+
+	midpoint := start.Add(end.Sub(start) / 2).Unix()
+	table := make(formatting.GrowthTable, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		growth := formatting.Growth{Pattern: pattern.Pattern}
+		for start, bucket := range pattern.buckets {
+			if start < midpoint {
+				growth.FirstCount += bucket.Count
+				growth.FirstSum += bucket.Sum
+			} else {
+				growth.SecondCount += bucket.Count
+				growth.SecondSum += bucket.Sum
+			}
+		}
+
+		if growth.CountDelta() > 0 || growth.MeanDelta() > 0 {
+			table = append(table, growth)
+		}
+	}
+
+	sort.Slice(table, func(i, j int) bool {
+		if a, b := table[i].CountDelta(), table[j].CountDelta(); a != b {
+			return a > b
+		}
+		return table[i].MeanDelta() > table[j].MeanDelta()
+	})
+
+	return table
+}
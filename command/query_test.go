@@ -0,0 +1,1686 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/source"
+	"mgotools/target/formatting"
+)
+
+func runQuery(t *testing.T, args ArgumentCollection, lines []string) (*query, string) {
+	cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	return cmd, runCommand(t, cmd, args, lines)
+}
+
+// The output with the padding between table cells collapsed to a single
+// space, since the width of each column depends on every row.
+func columns(output string) string {
+	lines := strings.Split(output, "\n")
+	for index, line := range lines {
+		lines[index] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var queryRestartFixture = []string{
+	`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+	`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+	`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 20ms`,
+	`2018-01-16T16:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+	`2018-01-16T16:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 30ms`,
+}
+
+func TestQuery_SinceRestart(t *testing.T) {
+	cmd, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"since-restart": true}}, queryRestartFixture)
+	log := cmd.Log[0]
+
+	if len(log.Segments) != 1 {
+		t.Fatalf("expected 1 completed segment, got %d", len(log.Segments))
+	} else if len(log.Segments[0].Table) != 1 || log.Segments[0].Table[0].Count != 2 {
+		t.Errorf("first segment should contain one pattern with two queries, got %v", log.Segments[0].Table)
+	} else if len(log.Patterns) != 1 {
+		t.Errorf("second segment should contain one pattern, got %d", len(log.Patterns))
+	}
+	for key := range log.Patterns {
+		if count, sum := log.Patterns[key].Count, log.Patterns[key].Sum; count != 1 || sum != 30 {
+			t.Errorf("second segment pattern should not include the first run, got %d/%v", count, sum)
+		}
+	}
+	if strings.Count(output, "RESTART") != 1 {
+		t.Errorf("expected two reports separated by a restart, got:\n%s", output)
+	}
+
+	cmd, output = runQuery(t, ArgumentCollection{Booleans: map[string]bool{}}, queryRestartFixture)
+	if len(cmd.Log[0].Segments) != 0 || strings.Contains(output, "RESTART") {
+		t.Errorf("restarts should not split the report without --since-restart")
+	}
+
+	// Restarts of separate files cannot be merged into a single report.
+	cmd = &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	if err := cmd.Prepare("test", 0, ArgumentCollection{Booleans: map[string]bool{"since-restart": true, "parallel-files": true}}); err == nil {
+		t.Error("since-restart should be rejected with parallel-files")
+	}
+}
+
+func TestQuery_PlanningDominates(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 fromMultiPlanner:1 planningTimeMicros:1800 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 2ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 fromMultiPlanner:1 planningTimeMicros:1600 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 2ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: IXSCAN { b: 1 } keysExamined:1 docsExamined:1 planningTimeMicros:100 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 5ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+
+	flagged := 0
+	for _, pattern := range values {
+		if pattern.Planned == 0 {
+			t.Errorf("planning time missing for %s", pattern.Namespace)
+		} else if pattern.PlanningDominates() {
+			flagged += 1
+			if pattern.Namespace != "test.foo" {
+				t.Errorf("%s should not be flagged", pattern.Namespace)
+			}
+		}
+	}
+
+	if flagged != 1 {
+		t.Errorf("expected 1 flagged pattern, got %d", flagged)
+	} else if !strings.Contains(output, "test.foo find {\"a\": 1} planning: 1700us execution: 300us") {
+		t.Errorf("report line missing, got:\n%s", output)
+	}
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestQuery_ParallelFiles(t *testing.T) {
+	files := [][]string{
+		{
+			`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+			`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+			`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+		},
+		{
+			`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+			`2018-01-16T15:02:00.000-0800 I COMMAND  [conn2] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 5 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 30ms`,
+		},
+		{
+			`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+			`2018-01-16T15:03:00.000-0800 I COMMAND  [conn3] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 7 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 1ms`,
+		},
+	}
+
+	args := ArgumentCollection{Booleans: map[string]bool{"parallel-files": true}}
+	parallel := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+
+	inputs := make([]Input, len(files))
+	serial := make([]string, 0)
+	for index, lines := range files {
+		reader, err := source.NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+		if err != nil {
+			t.Fatalf("unexpected error creating source (%s)", err)
+		}
+
+		inputs[index] = Input{Arguments: args, Name: "test", Reader: reader}
+		serial = append(serial, lines...)
+	}
+
+	out := nopWriteCloser{bytes.NewBuffer([]byte{})}
+	if err := RunCommand(parallel, inputs, Output{Writer: out, Error: out}); err != nil {
+		t.Fatalf("RunCommand returned an error (%s)", err)
+	}
+
+	expected, _ := runQuery(t, ArgumentCollection{}, serial)
+	merged := parallel.merge()
+
+	if len(merged) != len(expected.Log[0].Patterns) {
+		t.Fatalf("expected %d patterns, got %d", len(expected.Log[0].Patterns), len(merged))
+	}
+	for key := range expected.Log[0].Patterns {
+		a, b := expected.Log[0].Patterns[key].Pattern, merged[key].Pattern
+		if a.Count != b.Count || a.Sum != b.Sum || a.Min != b.Min || a.Max != b.Max {
+			t.Errorf("merged pattern %s differs from a serial run: %+v, %+v", key, a, b)
+		}
+	}
+	if strings.Count(out.String(), "namespace") != 1 {
+		t.Errorf("expected a single merged report, got:\n%s", out.String())
+	}
+}
+
+func TestQuery_Quantiles(t *testing.T) {
+	samples := make([]int64, 0, 100)
+	for i := int64(1); i <= 100; i += 1 {
+		samples = append(samples, i*i)
+	}
+
+	cdf := quantiles(samples, 10)
+	if len(cdf) != 10 {
+		t.Fatalf("expected 10 quantiles, got %d", len(cdf))
+	}
+	for index, value := range cdf {
+		if expected := int64((index + 1) * 10 * (index + 1) * 10); value != expected {
+			t.Errorf("quantile %d should be %d, got %d", index, expected, value)
+		}
+		if index > 0 && value < cdf[index-1] {
+			t.Errorf("quantiles are not monotonic: %v", cdf)
+		}
+	}
+
+	if cdf := quantiles([]int64{5}, 10); cdf[0] != 5 || cdf[9] != 5 {
+		t.Errorf("a single sample should fill every quantile, got %v", cdf)
+	}
+	if cdf := quantiles(nil, 10); cdf != nil {
+		t.Errorf("no samples should return no quantiles, got %v", cdf)
+	}
+
+	_, output := runQuery(t, ArgumentCollection{Integers: map[string]int{"quantile-output": 1}}, queryRestartFixture)
+	if !strings.Contains(output, "latency CDF") || !strings.Contains(output, "100%: 30") {
+		t.Errorf("CDF missing from output, got:\n%s", output)
+	}
+}
+
+func TestQuery_Labels(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+	}
+
+	names := []string{"primary", ""}
+	inputs := make([]Input, len(names))
+	for index, name := range names {
+		reader, err := source.NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+		if err != nil {
+			t.Fatalf("unexpected error creating source (%s)", err)
+		}
+
+		args := ArgumentCollection{Booleans: map[string]bool{"parallel-files": true, "by-source": true}, Strings: map[string]string{}}
+		if name != "" {
+			args.Strings["name"] = name
+		}
+		inputs[index] = Input{Arguments: args, Name: "secondary.log", Reader: reader}
+	}
+
+	cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	out := nopWriteCloser{bytes.NewBuffer([]byte{})}
+	if err := RunCommand(cmd, inputs, Output{Writer: out, Error: out}); err != nil {
+		t.Fatalf("RunCommand returned an error (%s)", err)
+	}
+
+	if cmd.Log[0].label != "primary" || cmd.Log[1].label != "secondary.log" {
+		t.Errorf("labels should default to the file name, got '%s' and '%s'", cmd.Log[0].label, cmd.Log[1].label)
+	}
+
+	merged := cmd.values(cmd.merge())
+	if len(merged) != 2 {
+		t.Fatalf("identical patterns from different sources should remain separate, got %d", len(merged))
+	}
+	for _, pattern := range merged {
+		if pattern.Count != 1 || (pattern.Source != "primary" && pattern.Source != "secondary.log") {
+			t.Errorf("unexpected pattern %+v", pattern)
+		}
+	}
+	if output := out.String(); !strings.Contains(output, "primary") || !strings.Contains(output, "secondary.log") {
+		t.Errorf("labels missing from output:\n%s", output)
+	}
+}
+
+func TestQuery_TimeSeries(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.weather appName: "MongoDB Shell" command: aggregate { aggregate: "weather", pipeline: [ { $match: { sensor: 1 } }, { $setWindowFields: { partitionBy: "$sensor", output: { avg: { $avg: "$temp" } } } } ], cursor: {}, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:10 reslen:100 locks:{} storage:{} protocol:op_msg 15ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.weather appName: "MongoDB Shell" command: aggregate { aggregate: "weather", pipeline: [ { $match: { sensor: 2 } }, { $setWindowFields: { partitionBy: "$sensor", output: { avg: { $avg: "$temp" } } } } ], cursor: {}, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:10 reslen:100 locks:{} storage:{} protocol:op_msg 25ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.weather appName: "MongoDB Shell" command: aggregate { aggregate: "weather", pipeline: [ { $match: { sensor: 3 } } ], cursor: {}, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:10 reslen:100 locks:{} storage:{} protocol:op_msg 5ms`,
+		`2019-08-10T10:01:03.000-0400 I  COMMAND  [conn1] command test.system.buckets.weather appName: "MongoDB Shell" command: insert { insert: "system.buckets.weather", ordered: true, $db: "test" } ninserted:1 keysInserted:1 numYields:0 reslen:45 locks:{} storage:{} protocol:op_msg 3ms`,
+		`2019-08-10T10:01:04.000-0400 I  COMMAND  [conn1] command test.system.buckets.weather appName: "MongoDB Shell" command: insert { insert: "system.buckets.weather", ordered: true, $db: "test" } ninserted:1 keysInserted:1 numYields:0 reslen:45 locks:{} storage:{} protocol:op_msg 4ms`,
+		`2019-08-10T10:01:05.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: insert { insert: "foo", ordered: true, $db: "test" } ninserted:1 keysInserted:1 numYields:0 reslen:45 locks:{} storage:{} protocol:op_msg 3ms`,
+	}
+
+	cmd, _ := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+
+	expected := map[string]int64{
+		"test.weather aggregate {\"sensor\": 1} $match,$setWindowFields": 2,
+		"test.weather aggregate {\"sensor\": 1}":                         1,
+		"test.weather bucket insert {}":                                  2,
+		"test.foo insert {}":                                             1,
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expected %d patterns, got %d: %+v", len(expected), len(values), values)
+	}
+	for _, pattern := range values {
+		key := pattern.Namespace + " " + pattern.Operation + " " + pattern.Pattern
+		if count, ok := expected[key]; !ok {
+			t.Errorf("unexpected pattern '%s'", key)
+		} else if count != pattern.Count {
+			t.Errorf("pattern '%s' expected count %d, got %d", key, count, pattern.Count)
+		}
+	}
+}
+
+func TestQuery_Aggregate(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.orders appName: "MongoDB Shell" command: aggregate { aggregate: "orders", pipeline: [ { $match: { status: "A" } }, { $group: { _id: "$cust", total: { $sum: "$amount" } } } ], cursor: {}, $db: "test" } planSummary: IXSCAN { status: 1 } keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.orders appName: "MongoDB Shell" command: aggregate { aggregate: "orders", pipeline: [ { $match: { status: "B" } }, { $group: { _id: "$cust", total: { $sum: "$amount" } } } ], cursor: {}, $db: "test" } planSummary: IXSCAN { status: 1 } keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} storage:{} protocol:op_msg 20ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.orders appName: "MongoDB Shell" command: aggregate { aggregate: "orders", pipeline: [ { $match: { status: "C" } }, { $lookup: { from: "customers", localField: "cust", foreignField: "_id", as: "customer" } }, { $group: { _id: "$customer.region" } } ], cursor: {}, $db: "test" } planSummary: IXSCAN { status: 1 } keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} storage:{} protocol:op_msg 30ms`,
+		`2019-08-10T10:01:03.000-0400 I  COMMAND  [conn1] command test.orders appName: "MongoDB Shell" command: aggregate { aggregate: "orders", pipeline: [ { $group: { _id: "$cust" } } ], cursor: {}, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:100 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} storage:{} protocol:op_msg 40ms`,
+	}
+
+	patterns := func(args ArgumentCollection) map[string]int64 {
+		cmd, _ := runQuery(t, args, lines)
+		found := make(map[string]int64)
+		for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+			found[pattern.Namespace+" "+pattern.Operation+" "+pattern.Pattern] = pattern.Count
+		}
+		return found
+	}
+
+	for _, test := range []struct {
+		args     ArgumentCollection
+		expected map[string]int64
+	}{
+		{ArgumentCollection{}, map[string]int64{
+			`test.orders aggregate {"status": 1}`: 3,
+			`test.orders aggregate {}`:            1,
+		}},
+		{ArgumentCollection{Booleans: map[string]bool{"stages": true}}, map[string]int64{
+			`test.orders aggregate {"status": 1} $match,$group`:         2,
+			`test.orders aggregate {"status": 1} $match,$lookup,$group`: 1,
+			`test.orders aggregate {} $group`:                           1,
+		}},
+	} {
+		if found := patterns(test.args); !reflect.DeepEqual(found, test.expected) {
+			t.Errorf("pattern mismatch with %v, expected %v, got %v", test.args.Booleans, test.expected, found)
+		}
+	}
+}
+
+func TestQuery_StandardizeNamespace(t *testing.T) {
+	for _, test := range []struct {
+		crud     message.CRUD
+		expected string
+	}{
+		{message.CRUD{Message: message.Command{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Command: "find", Payload: message.Payload{"find": "orders", "filter": map[string]interface{}{"a": 1}}}}, "shop.orders"},
+		{message.CRUD{Message: message.CommandLegacy{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Command: "count", Payload: message.Payload{"count": "orders", "query": map[string]interface{}{"a": 1}}}}, "shop.orders"},
+		{message.CRUD{Message: message.Operation{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Operation: "update", Payload: message.Payload{"update": "orders", "updates": []interface{}{}}}}, "shop.orders"},
+		{message.CRUD{Message: message.Command{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Command: "getMore", Payload: message.Payload{"getMore": int64(123), "collection": "orders"}}}, "shop.orders"},
+		{message.CRUD{Message: message.OperationLegacy{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Operation: "query", Payload: message.Payload{"query": map[string]interface{}{"count": "orders", "query": map[string]interface{}{"a": 1}}}}}, "shop.orders"},
+		{message.CRUD{Message: message.Command{BaseCommand: message.BaseCommand{Namespace: "shop.$cmd"}, Command: "find", Payload: message.Payload{"filter": map[string]interface{}{}}}}, "shop.$cmd"},
+		{message.CRUD{Message: message.Operation{BaseCommand: message.BaseCommand{Namespace: "shop.orders"}, Operation: "update", Payload: message.Payload{"update": "other"}}}, "shop.orders"},
+	} {
+		if ns, _, _, ok := (query{}).standardize(test.crud); !ok || ns != test.expected {
+			t.Errorf("expected namespace %s, got %s (%+v)", test.expected, ns, test.crud.Message)
+		}
+	}
+}
+
+func TestQuery_Insert(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: insert { insert: "foo", ordered: true, $db: "test" } ninserted:100 keysInserted:200 numYields:0 reslen:45 locks:{} protocol:op_msg 30ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: insert { insert: "foo", ordered: true, $db: "test" } ninserted:50 keysInserted:100 numYields:0 reslen:45 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: insert { insert: "bar", ordered: true, $db: "test" } ninserted:1 keysInserted:1 numYields:0 reslen:45 locks:{} protocol:op_msg 5ms`,
+		`2018-01-16T15:01:03.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	if len(values) != 3 {
+		t.Fatalf("expected 3 patterns, got %d: %+v", len(values), values)
+	}
+
+	for _, pattern := range values {
+		switch pattern.Namespace + " " + pattern.Operation {
+		case "test.foo insert":
+			if pattern.Count != 2 || pattern.Inserted != 150 || pattern.Sum != 40 {
+				t.Errorf("batched inserts mismatch: %+v", pattern)
+			}
+		case "test.bar insert":
+			if pattern.Count != 1 || pattern.Inserted != 1 {
+				t.Errorf("insert mismatch: %+v", pattern)
+			}
+		case "test.foo find":
+			if pattern.Inserted != 0 {
+				t.Errorf("finds should not count inserted documents: %+v", pattern)
+			}
+		default:
+			t.Errorf("unexpected pattern %+v", pattern)
+		}
+	}
+
+	if !strings.Contains(output, "inserted") || !strings.Contains(output, "150") {
+		t.Errorf("inserted documents missing from output:\n%s", output)
+	}
+}
+
+func TestQuery_GetMore(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":{"$gt":5}},"batchSize":2,"$db":"test"},"planSummary":"IXSCAN { a: 1 }","cursorid":8251318744,"keysExamined":2,"docsExamined":2,"numYields":0,"nreturned":2,"reslen":250,"locks":{},"protocol":"op_msg","durationMillis":12}}`,
+		`{"t":{"$date":"2020-05-20T20:10:09.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"getMore":8251318744,"collection":"foo","batchSize":2,"$db":"test"},"originatingCommand":{"find":"foo","filter":{"a":{"$gt":1}},"batchSize":2,"$db":"test"},"planSummary":"IXSCAN { a: 1 }","cursorid":8251318744,"keysExamined":2,"docsExamined":2,"numYields":0,"nreturned":2,"reslen":250,"locks":{},"protocol":"op_msg","durationMillis":3}}`,
+		`{"t":{"$date":"2020-05-20T20:10:10.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"getMore":8251318744,"collection":"foo","batchSize":2,"$db":"test"},"originatingCommand":{"find":"foo","filter":{"a":{"$gt":1}},"batchSize":2,"$db":"test"},"planSummary":"IXSCAN { a: 1 }","cursorid":8251318744,"keysExamined":2,"docsExamined":2,"cursorExhausted":true,"numYields":0,"nreturned":2,"reslen":250,"locks":{},"protocol":"op_msg","durationMillis":5}}`,
+		`{"t":{"$date":"2020-05-20T20:10:11.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.bar","command":{"getMore":1234,"collection":"bar","$db":"test"},"originatingCommand":{"aggregate":"bar","pipeline":[{"$match":{"b":1}},{"$group":{"_id":"$c"}}],"cursor":{},"$db":"test"},"cursorid":1234,"numYields":0,"nreturned":10,"reslen":500,"locks":{},"protocol":"op_msg","durationMillis":7}}`,
+		`{"t":{"$date":"2020-05-20T20:10:12.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.baz","command":{"getMore":5678,"collection":"baz","$db":"test"},"cursorid":5678,"numYields":0,"nreturned":10,"reslen":500,"locks":{},"protocol":"op_msg","durationMillis":9}}`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	if len(values) != 3 {
+		t.Fatalf("expected 3 patterns, got %d: %+v", len(values), values)
+	}
+
+	for _, pattern := range values {
+		switch pattern.Namespace + " " + pattern.Operation + " " + pattern.Pattern {
+		case `test.foo find {"a": 1}`:
+			if pattern.Count != 1 || pattern.Sum != 12 || pattern.GetMores != 2 || pattern.GetMoreSum != 8 {
+				t.Errorf("getMores should be attributed to the originating find: %+v", pattern)
+			}
+		case `test.bar aggregate {"b": 1}`:
+			// Only getMores of the aggregation were logged.
+			if pattern.Count != 0 || pattern.GetMores != 1 || pattern.GetMoreSum != 7 {
+				t.Errorf("getMores should be attributed to the originating aggregate: %+v", pattern)
+			}
+		case `test.baz getmore {}`:
+			if pattern.Count != 1 || pattern.Sum != 9 || pattern.GetMores != 0 {
+				t.Errorf("getMores without an originating command mismatch: %+v", pattern)
+			}
+		default:
+			t.Errorf("unexpected pattern %+v", pattern)
+		}
+	}
+
+	if !strings.Contains(output, "getmores") || !strings.Contains(output, "getmore (ms)") {
+		t.Errorf("getmore columns missing from output:\n%s", output)
+	}
+}
+
+func TestQuery_MinSamples(t *testing.T) {
+	lines := append([]string{}, queryRestartFixture...)
+	lines = append(lines, `2018-01-16T16:01:01.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 3 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 30ms`)
+
+	cmd, _ := runQuery(t, ArgumentCollection{Integers: map[string]int{"min-samples": 3}}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		switch pattern.Namespace {
+		case "test.foo":
+			if math.IsNaN(pattern.Percentiles[95]) || pattern.Count != 3 {
+				t.Errorf("test.foo has enough samples for a percentile, got %v (%d)", pattern.Percentiles[95], pattern.Count)
+			}
+		case "test.bar":
+			if !math.IsNaN(pattern.Percentiles[95]) || pattern.Min != 30 || pattern.Max != 30 {
+				t.Errorf("test.bar should not have a percentile, got %v", pattern.Percentiles[95])
+			}
+		}
+	}
+}
+
+func TestQuery_TopGrowth(t *testing.T) {
+	line := func(date, filter string, dur int) string {
+		return fmt.Sprintf(`2018-01-16T%s.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: %s } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`, date, filter, dur)
+	}
+
+	lines := []string{
+		`2018-01-16T15:00:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		line("15:01:00", "{ a: 1 }", 10),
+		line("15:02:00", "{ b: 1 }", 10),
+		line("15:10:00", "{ a: 1 }", 10),
+		line("15:20:00", "{ b: 1 }", 10),
+		line("15:45:00", "{ a: 1 }", 10),
+		line("15:46:00", "{ b: 1 }", 10),
+		line("15:50:00", "{ b: 1 }", 40),
+		line("15:55:00", "{ b: 1 }", 40),
+		line("15:58:00", "{ b: 1 }", 40),
+		line("16:00:00", "{ b: 1 }", 40),
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Integers: map[string]int{"top-growth": 1}}, lines)
+	log := cmd.Log[0]
+	table := cmd.growth(log.Patterns, log.summary.Start, log.summary.End)
+
+	if len(table) == 0 {
+		t.Fatalf("expected at least one growing pattern, got none")
+	} else if top := table[0]; top.Pattern.Pattern != `{"b": 1}` {
+		t.Errorf("ramping pattern should rank first, got %s", top.Pattern.Pattern)
+	} else if top.FirstCount != 2 || top.SecondCount != 5 {
+		t.Errorf("expected counts 2 -> 5, got %d -> %d", top.FirstCount, top.SecondCount)
+	}
+	if !strings.Contains(output, `test.foo find {"b": 1} count: 2 -> 5 (+3)`) {
+		t.Errorf("growth report missing, got:\n%s", output)
+	}
+
+	cmd, output = runQuery(t, ArgumentCollection{}, lines)
+	if strings.Contains(output, "most growth") {
+		t.Errorf("growth should only be reported with --top-growth")
+	}
+}
+
+func TestQuery_StorageReads(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 cursorExhausted:1 numYields:40 nreturned:1 reslen:100 locks:{} storage:{ data: { bytesRead: 104857600, timeReadingMicros: 800000 } } protocol:op_msg 1000ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 cursorExhausted:1 numYields:40 nreturned:1 reslen:100 locks:{} storage:{ data: { bytesRead: 4096, timeReadingMicros: 100 } } protocol:op_msg 1000ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.baz appName: "MongoDB Shell" command: find { find: "baz", filter: { c: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 5ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		switch pattern.Namespace {
+		case "test.foo":
+			if pattern.Reads != 1 || pattern.BytesRead != 104857600 || !pattern.IOBound() {
+				t.Errorf("test.foo should be IO-bound, got %+v", pattern)
+			}
+		case "test.bar":
+			if pattern.Reads != 1 || pattern.IOBound() {
+				t.Errorf("test.bar should be CPU-bound, got %+v", pattern)
+			}
+		case "test.baz":
+			if pattern.Reads != 0 {
+				t.Errorf("test.baz has no disk reads, got %d", pattern.Reads)
+			}
+		}
+	}
+
+	if !strings.Contains(output, `test.foo find {"a": 1} IO-bound read: 104857600B in 800000us (80% of duration)`) {
+		t.Errorf("IO-bound report line missing, got:\n%s", output)
+	} else if strings.Contains(output, `test.baz find {"c": 1} CPU-bound`) {
+		t.Errorf("patterns without disk reads should not be classified, got:\n%s", output)
+	}
+}
+
+func TestQuery_Trend(t *testing.T) {
+	lines := []string{`2018-01-16T15:00:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`}
+	for minute := 0; minute < trendSpans; minute += 1 {
+		for second := 0; second < trendMinSamples; second += 1 {
+			lines = append(lines, fmt.Sprintf(`2018-01-16T15:%02d:%02d.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`, minute, second, (minute+1)*10))
+		}
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:%02d:30.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 1ms`, minute))
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Integers: map[string]int{"p95-trend": 2}}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		slope, ok := pattern.TrendSlope()
+		switch pattern.Namespace {
+		case "test.foo":
+			if len(pattern.Trend) != trendSpans || !ok || slope <= 0 {
+				t.Errorf("test.foo should have a rising trend, got %v", pattern.Trend)
+			}
+		case "test.bar":
+			for _, value := range pattern.Trend {
+				if !math.IsNaN(value) {
+					t.Errorf("test.bar spans have too few samples and should be blank, got %v", pattern.Trend)
+					break
+				}
+			}
+		}
+	}
+
+	if !strings.Contains(output, `test.foo find {"a": 1} (rising)`) {
+		t.Errorf("rising trend missing from the report, got:\n%s", output)
+	} else if !strings.Contains(output, `test.bar find {"b": 1} (too few samples)`) {
+		t.Errorf("blank trend missing from the report, got:\n%s", output)
+	}
+}
+
+func TestQuery_DurationMicros(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 durationMicros:250 reslen:100 locks:{} storage:{} protocol:op_msg 0ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 durationMicros:1750 reslen:100 locks:{} storage:{} protocol:op_msg 1ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: IXSCAN { b: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 3ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	if len(values) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(values))
+	}
+
+	for _, pattern := range values {
+		switch pattern.Namespace {
+		case "test.foo":
+			if pattern.Min != 0.25 || pattern.Max != 1.75 || pattern.Sum != 2 {
+				t.Errorf("sub-millisecond precision was lost, got min %v max %v sum %v", pattern.Min, pattern.Max, pattern.Sum)
+			}
+		case "test.bar":
+			if pattern.Min != 3 || pattern.Sum != 3 {
+				t.Errorf("millisecond durations should be unchanged, got min %v sum %v", pattern.Min, pattern.Sum)
+			}
+		}
+	}
+
+	if !strings.Contains(columns(output), `test.foo find {"a": 1} 2 0.25 1.75 1 1.0 2`) {
+		t.Errorf("sub-millisecond durations missing from the report, got:\n%s", output)
+	}
+}
+
+func TestQuery_StructuredLog(t *testing.T) {
+	lines := []string{
+		`{"t":{"$date":"2020-08-10T10:00:00.000+00:00"},"s":"I","c":"CONTROL","id":23403,"ctx":"initandlisten","msg":"Build Info","attr":{"buildInfo":{"version":"4.4.0"}}}`,
+		`{"t":{"$date":"2020-08-10T10:01:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","appName":"MongoDB Shell","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nreturned":1,"reslen":100,"locks":{},"protocol":"op_msg","durationMillis":10}}`,
+		`{"t":{"$date":"2020-08-10T10:01:01.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","appName":"MongoDB Shell","command":{"find":"foo","filter":{"a":2},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nreturned":1,"reslen":100,"locks":{},"protocol":"op_msg","durationMillis":30}}`,
+		`{"t":{"$date":"2020-08-10T10:01:02.000+00:00"},"s":"I","c":"WRITE","id":51803,"ctx":"conn2","msg":"Slow query","attr":{"type":"update","ns":"test.foo","command":{"q":{"b":1},"u":{"$set":{"c":1}},"multi":false,"upsert":false},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nMatched":1,"nModified":1,"numYields":0,"locks":{},"durationMillis":5}}`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	if len(values) != 2 {
+		t.Fatalf("expected 2 patterns, got %d:\n%s", len(values), output)
+	}
+
+	for _, pattern := range values {
+		switch pattern.Operation {
+		case "find":
+			if pattern.Count != 2 || pattern.Sum != 40 || pattern.Pattern != `{"a": 1}` {
+				t.Errorf("find pattern mismatch: %+v", pattern)
+			}
+		case "update":
+			if pattern.Count != 1 || pattern.Sum != 5 || pattern.Pattern != `{"b": 1}` {
+				t.Errorf("update pattern mismatch: %+v", pattern)
+			}
+		default:
+			t.Errorf("unexpected operation %s", pattern.Operation)
+		}
+	}
+}
+
+func TestQuery_Truncated(t *testing.T) {
+	for name, lines := range map[string][]string{
+		"text": {
+			`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+			`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+			`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, projection: { x: 1, y: "a very long...`,
+		},
+		"json": {
+			`{"t":{"$date":"2020-08-10T10:00:00.000+00:00"},"s":"I","c":"CONTROL","id":23403,"ctx":"initandlisten","msg":"Build Info","attr":{"buildInfo":{"version":"4.4.0"}}}`,
+			`{"t":{"$date":"2020-08-10T10:01:00.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nreturned":1,"reslen":100,"locks":{},"protocol":"op_msg","durationMillis":10}}`,
+			`{"t":{"$date":"2020-08-10T10:01:01.000+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"nreturned":1,"reslen":100,"locks":{},"protocol":"op_msg","durationMillis":30},"truncated":{"command":{"filter":{"b":{"type":"array","size":20000}}}},"size":{"command":20100}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd, output := runQuery(t, ArgumentCollection{}, lines)
+
+			values := cmd.values(cmd.Log[0].Patterns)
+			if cmd.Log[0].ErrorCount != 0 {
+				t.Errorf("the truncated line should not be an error, got %d errors", cmd.Log[0].ErrorCount)
+			} else if len(values) != 1 || values[0].Count != 2 || !values[0].Approximate {
+				t.Fatalf("expected one approximate pattern of both operations, got %+v", values)
+			}
+			// An operation cut short logged no duration, which is left out of
+			// the durations rather than counted as 0ms.
+			if name == "text" && (values[0].Untimed != 1 || values[0].Min != 10 || values[0].Sum != 10) {
+				t.Errorf("expected the cut operation to be untimed, got %+v", values[0])
+			} else if name == "json" && (values[0].Untimed != 0 || values[0].Min != 10 || values[0].Max != 30) {
+				t.Errorf("expected both operations to be timed, got %+v", values[0])
+			}
+			if !strings.Contains(output, `~{"a": 1}`) || !strings.Contains(output, "~ approximate") {
+				t.Errorf("the pattern should be marked approximate, got:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestQuery_FormatJSON(t *testing.T) {
+	args := ArgumentCollection{Strings: map[string]string{"format": "json"}}
+	_, output := runQuery(t, args, queryRestartFixture)
+
+	var report struct {
+		Summary struct {
+			Source  string         `json:"source"`
+			Length  uint           `json:"length"`
+			Binary  string         `json:"binary"`
+			Version string         `json:"version"`
+			Guessed bool           `json:"guessed"`
+			Formats map[string]int `json:"formats"`
+		} `json:"summary"`
+		Lines    uint `json:"lines"`
+		Errors   uint `json:"errors"`
+		Patterns []struct {
+			Namespace   string             `json:"namespace"`
+			Operation   string             `json:"operation"`
+			Pattern     string             `json:"pattern"`
+			Count       int64              `json:"count"`
+			Min         float64            `json:"min"`
+			Max         float64            `json:"max"`
+			Percentiles map[string]float64 `json:"percentiles"`
+			Sum         float64            `json:"sum"`
+		} `json:"patterns"`
+	}
+
+	if strings.Contains(output, "----") || strings.Contains(output, "namespace operation") {
+		t.Errorf("table output found in JSON mode:\n%s", output)
+	} else if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("output is not valid JSON (%s):\n%s", err, output)
+	}
+
+	if report.Summary.Source != "test" || report.Summary.Length != 5 || report.Summary.Version != "mongod 3.6" {
+		t.Errorf("summary mismatch: %+v", report.Summary)
+	} else if report.Summary.Binary != "mongod" || report.Summary.Guessed || report.Summary.Formats["iso8602-local"] != 5 {
+		t.Errorf("summary mismatch: %+v", report.Summary)
+	}
+	if report.Lines != 5 || report.Errors != 0 {
+		t.Errorf("line counts mismatch: %d lines, %d errors", report.Lines, report.Errors)
+	}
+	if len(report.Patterns) != 1 {
+		t.Fatalf("expected 1 pattern, got %d", len(report.Patterns))
+	} else if p := report.Patterns[0]; p.Namespace != "test.foo" || p.Operation != "find" || p.Pattern != `{"a": 1}` ||
+		p.Count != 3 || p.Min != 10 || p.Max != 30 || p.Sum != 60 || p.Percentiles["95"] == 0 {
+		t.Errorf("pattern mismatch: %+v", p)
+	}
+
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"format": "xml"}}); err == nil {
+		t.Errorf("an unrecognized format should return an error")
+	}
+}
+
+func TestQuery_FormatJSONFiles(t *testing.T) {
+	names := []string{"a.log", "b.log"}
+	inputs := make([]Input, len(names))
+	for index, name := range names {
+		reader, err := source.NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(queryRestartFixture[:index+2], "\n"))))
+		if err != nil {
+			t.Fatalf("unexpected error creating source (%s)", err)
+		}
+		inputs[index] = Input{Arguments: ArgumentCollection{Strings: map[string]string{"format": "json"}}, Name: name, Reader: reader}
+	}
+
+	cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	out := nopWriteCloser{bytes.NewBuffer([]byte{})}
+	if err := RunCommand(cmd, inputs, Output{Writer: out, Error: out}); err != nil {
+		t.Fatalf("RunCommand returned an error (%s)", err)
+	}
+
+	// Each input is a complete JSON document on its own line, in the order
+	// the inputs finish.
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(names) {
+		t.Fatalf("expected %d lines, got:\n%s", len(names), out.String())
+	}
+	reported := make(map[string]uint)
+	for index, line := range lines {
+		var report struct {
+			Summary struct {
+				Source string `json:"source"`
+			} `json:"summary"`
+			Lines uint `json:"lines"`
+		}
+		if err := json.Unmarshal([]byte(line), &report); err != nil {
+			t.Fatalf("line %d is not valid JSON (%s): %s", index+1, err, line)
+		}
+		reported[report.Summary.Source] = report.Lines
+	}
+	if expected := map[string]uint{"a.log": 2, "b.log": 3}; !reflect.DeepEqual(reported, expected) {
+		t.Errorf("expected line counts %v, got %v", expected, reported)
+	}
+}
+
+func TestQuery_FormatMarkdown(t *testing.T) {
+	args := ArgumentCollection{Booleans: map[string]bool{"since-restart": true}, Strings: map[string]string{"format": "markdown"}}
+	_, output := runQuery(t, args, queryRestartFixture)
+
+	for _, expected := range []string{
+		"## test\n\n| namespace | operation | pattern |",
+		"| --- | --- | --- |",
+		"| test.foo | find | {\"a\": 1} * | 2 |",
+		"### Restart ",
+		"\\* used a collection scan",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected '%s' in output:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "----") || strings.Contains(output, "RESTART") {
+		t.Errorf("table output found in markdown mode:\n%s", output)
+	}
+
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"format": "markdown", "output-template": "{{.Pattern}}"}}); err == nil {
+		t.Errorf("an output template should not be combined with markdown output")
+	}
+}
+
+func TestQuery_Dedup(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: findAndModify { findAndModify: "foo", query: { a: 1 }, update: { $inc: { b: 1 } }, lsid: { id: UUID("a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6") }, txnNumber: 3, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn2] command test.foo appName: "MongoDB Shell" command: findAndModify { findAndModify: "foo", query: { a: 1 }, update: { $inc: { b: 1 } }, lsid: { id: UUID("a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6") }, txnNumber: 3, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 reslen:100 locks:{} protocol:op_msg 20ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: findAndModify { findAndModify: "foo", query: { a: 1 }, update: { $inc: { b: 1 } }, lsid: { id: UUID("a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6") }, txnNumber: 4, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 reslen:100 locks:{} protocol:op_msg 30ms`,
+		`2018-01-16T15:01:03.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, lsid: { id: UUID("a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6") }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+		`2018-01-16T15:01:04.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, lsid: { id: UUID("a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6") }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`,
+	}
+
+	count := func(cmd *query, op string) int64 {
+		for _, pattern := range cmd.Log[0].Patterns {
+			if pattern.Operation == op {
+				return pattern.Count
+			}
+		}
+		return 0
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	if count(cmd, "findandmodify") != 3 || count(cmd, "find") != 2 {
+		t.Errorf("without dedup every operation should be counted, got:\n%s", output)
+	}
+
+	cmd, output = runQuery(t, ArgumentCollection{Booleans: map[string]bool{"dedup": true}}, lines)
+	if count(cmd, "findandmodify") != 2 {
+		t.Errorf("the retried write should be counted once, got %d", count(cmd, "findandmodify"))
+	} else if count(cmd, "find") != 2 {
+		t.Errorf("reads without a txnNumber should never be collapsed, got %d", count(cmd, "find"))
+	} else if cmd.Log[0].Duplicates != 1 || !strings.Contains(output, "1 duplicate operations collapsed") {
+		t.Errorf("expected one collapsed duplicate, got %d:\n%s", cmd.Log[0].Duplicates, output)
+	}
+}
+
+func TestQuery_OutputTemplate(t *testing.T) {
+	lines := append(queryRestartFixture[:3:3],
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 5ms`)
+
+	args := ArgumentCollection{Strings: map[string]string{"output-template": "{{.Namespace}}|{{.Operation}}|{{.Pattern}}|{{.Count}}|{{.Sum}}"}}
+	_, output := runQuery(t, args, lines)
+
+	expected := "test.foo|find|{\"a\": 1}|2|30\ntest.bar|find|{\"b\": 1}|1|5\n"
+	if output != expected {
+		t.Errorf("unexpected template output:\n%s", output)
+	}
+
+	for _, text := range []string{"{{.Missing}}", "{{.Count"} {
+		cmd := &query{Log: make(map[int]*queryInstance)}
+		if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"output-template": text}}); err == nil {
+			t.Errorf("template %s should be rejected", text)
+		}
+	}
+}
+
+func TestQuery_Percentiles(t *testing.T) {
+	lines := []string{queryRestartFixture[0]}
+	for index, dur := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 100} {
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:01:%02d.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`, index, dur))
+	}
+	lines = append(lines, `2018-01-16T15:02:00.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 40ms`,
+		`2018-01-16T15:02:01.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 40ms`)
+
+	args := ArgumentCollection{Strings: map[string]string{"percentile": "50,99", "sort": "99%"}}
+	cmd, output := runQuery(t, args, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	cmd.sort(values, cmd.Log[0].sort)
+
+	if len(values) != 2 || values[0].Namespace != "test.foo" {
+		t.Fatalf("patterns should be sorted by the 99th percentile, got %+v", values)
+	} else if p50, p99 := values[0].Percentiles[50], values[0].Percentiles[99]; p50 != 6 || p99 != 54.5 {
+		t.Errorf("unexpected percentiles for test.foo, got p50 %v and p99 %v", p50, p99)
+	} else if _, ok := values[0].Percentiles[95]; ok {
+		t.Errorf("only the requested percentiles should be calculated")
+	}
+
+	if !strings.Contains(columns(output), "50%-ile (ms) 99%-ile (ms)") || strings.Contains(output, "95%-ile") {
+		t.Errorf("the table should have a column for each requested percentile, got:\n%s", output)
+	}
+
+	for _, value := range []string{"0", "100", "abc"} {
+		cmd := &query{Log: make(map[int]*queryInstance)}
+		if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"percentile": value}}); err == nil {
+			t.Errorf("percentile %s should be rejected", value)
+		}
+	}
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"sort": "99%"}}); err == nil {
+		t.Errorf("sorting by a percentile that isn't calculated should be rejected")
+	}
+}
+
+func TestQuery_SortLargePayload(t *testing.T) {
+	lines := []string{
+		queryRestartFixture[0],
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, sort: { b: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:1000 docsExamined:1000 hasSortStage:1 cursorExhausted:1 numYields:8 nreturned:1000 reslen:2000000 locks:{} protocol:op_msg 250ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, sort: { b: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:1000 docsExamined:1000 hasSortStage:1 cursorExhausted:1 numYields:8 nreturned:1000 reslen:2000000 locks:{} protocol:op_msg 270ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { a: 1 }, sort: { b: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:10 docsExamined:10 hasSortStage:1 cursorExhausted:1 numYields:0 nreturned:10 reslen:2000 locks:{} protocol:op_msg 5ms`,
+		`2018-01-16T15:01:03.000-0800 I COMMAND  [conn1] command test.baz appName: "MongoDB Shell" command: find { find: "baz", filter: { a: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:1000 docsExamined:1000 cursorExhausted:1 numYields:8 nreturned:1000 reslen:2000000 locks:{} protocol:op_msg 200ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		if flagged := pattern.SortLargePayload(); flagged != (pattern.Namespace == "test.foo") {
+			t.Errorf("%s sort+large-payload should be %v (sorted %d, %dB in %d responses)", pattern.Namespace, !flagged, pattern.Sorted, pattern.ResponseBytes, pattern.Responses)
+		}
+	}
+
+	if !strings.Contains(output, `test.foo find {"a": 1} sort+large-payload sorted: 2/2 reslen: 2000000B per operation (2000B per document)`) {
+		t.Errorf("flagged pattern missing from the report, got:\n%s", output)
+	} else if strings.Count(output, "sort+large-payload") != 1 {
+		t.Errorf("only test.foo should be flagged, got:\n%s", output)
+	}
+}
+
+func TestQuery_Reservoir(t *testing.T) {
+	const size, total = 1000, 200000
+	cmd := &query{maxSamples: size}
+
+	// Uniformly distributed durations from 0 through 99,999 have an exact
+	// 95th percentile of 95,000.
+	pattern := queryPattern{Pattern: formatting.Pattern{Min: math.MaxFloat64}}
+	for index := 0; index < total; index += 1 {
+		pattern = cmd.update(pattern, time.Time{}, int64((index*7919)%100000), nil, nil)
+	}
+
+	if len(pattern.p95) != size || cap(pattern.p95) > 2*size {
+		t.Fatalf("the reservoir should hold %d samples, got %d (capacity %d)", size, len(pattern.p95), cap(pattern.p95))
+	} else if pattern.Count != total {
+		t.Errorf("every duration should be counted, got %d", pattern.Count)
+	}
+
+	sort.Slice(pattern.p95, func(i, j int) bool { return pattern.p95[i] < pattern.p95[j] })
+	if estimate := percentile(pattern.p95, 95); math.Abs(estimate-95000) > 3000 {
+		t.Errorf("the estimated 95th percentile is too far from 95000, got %v", estimate)
+	}
+}
+
+func TestQuery_ReservoirMerge(t *testing.T) {
+	const size = 1000
+	cmd := &query{maxSamples: size, Log: make(map[int]*queryInstance)}
+
+	// The first file has 100 times the operations of the second, so the
+	// slow operations of the second are 1% of the total and the 95th
+	// percentile is that of the first file.
+	for index, file := range []struct {
+		count    int
+		duration int64
+	}{{100000, 10000}, {1000, 900000}} {
+		pattern := queryPattern{Pattern: formatting.Pattern{Min: math.MaxFloat64}}
+		for i := 0; i < file.count; i += 1 {
+			pattern = cmd.update(pattern, time.Time{}, file.duration, nil, nil)
+		}
+		cmd.Log[index] = &queryInstance{Patterns: map[string]queryPattern{"find": pattern}}
+	}
+
+	merged := cmd.merge()["find"]
+	if len(merged.p95) != size {
+		t.Fatalf("the merged reservoir should hold %d samples, got %d", size, len(merged.p95))
+	} else if merged.Count != 101000 {
+		t.Errorf("every duration should be counted, got %d", merged.Count)
+	}
+
+	sort.Slice(merged.p95, func(i, j int) bool { return merged.p95[i] < merged.p95[j] })
+	if estimate := percentile(merged.p95, 95); estimate != 10000 {
+		t.Errorf("the 95th percentile should be that of the first file, got %v", estimate)
+	} else if first := len(cmd.Log[0].Patterns["find"].p95); first != size {
+		t.Errorf("merging should not modify the reservoir of the first file, got %d samples", first)
+	}
+}
+
+func TestQuery_Namespace(t *testing.T) {
+	lines := []string{queryRestartFixture[0]}
+	for index, ns := range []string{"shop.orders", "shop.carts", "shop.users", "admin.users"} {
+		db, col, _ := internal.StringDoubleSplit(ns, '.')
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:01:%02d.000-0800 I COMMAND  [conn1] command %s appName: "MongoDB Shell" command: find { find: "%s", filter: { a: 1 }, $db: "%s" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`, index, ns, col, db))
+	}
+
+	for globs, expected := range map[string]string{
+		"":                         "admin.users shop.carts shop.orders shop.users",
+		"shop.orders":              "shop.orders",
+		"shop.*":                   "shop.carts shop.orders shop.users",
+		"shop.*,!shop.carts":       "shop.orders shop.users",
+		"!*.users":                 "shop.carts shop.orders",
+		"admin.users, shop.orders": "admin.users shop.orders",
+	} {
+		cmd, _ := runQuery(t, ArgumentCollection{Strings: map[string]string{"namespace": globs}}, lines)
+
+		found := make([]string, 0)
+		for _, pattern := range cmd.Log[0].Patterns {
+			found = append(found, pattern.Namespace)
+		}
+		sort.Strings(found)
+
+		if strings.Join(found, " ") != expected {
+			t.Errorf("namespace %q should match %s, got %v", globs, expected, found)
+		} else if cmd.Log[0].summary.Length != uint(len(lines)) {
+			t.Errorf("the summary should include every line, got %d", cmd.Log[0].summary.Length)
+		}
+	}
+
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"namespace": "shop.["}}); err == nil {
+		t.Errorf("an invalid glob should be rejected")
+	}
+}
+
+func TestQuery_Thresholds(t *testing.T) {
+	lines := []string{queryRestartFixture[0]}
+	for index, dur := range []int{1, 5, 10, 50, 100} {
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:01:%02d.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`, index, dur))
+	}
+
+	for _, test := range []struct {
+		args             map[string]int
+		count            int64
+		min, max, sum, p float64
+	}{
+		{map[string]int{}, 5, 1, 100, 166, 75},
+		{map[string]int{"slower-than": 10}, 3, 10, 100, 160, 75},
+		{map[string]int{"faster-than": 10}, 3, 1, 10, 16, 7.5},
+		{map[string]int{"slower-than": 5, "faster-than": 50}, 3, 5, 50, 65, 30},
+	} {
+		cmd, output := runQuery(t, ArgumentCollection{Integers: test.args}, lines)
+		values := cmd.values(cmd.Log[0].Patterns)
+		if len(values) != 1 {
+			t.Errorf("%v should produce one pattern, got:\n%s", test.args, output)
+			continue
+		}
+
+		if p := values[0]; p.Count != test.count || p.Min != test.min || p.Max != test.max || p.Sum != test.sum || p.Percentiles[95] != test.p {
+			t.Errorf("%v statistics mismatch, got %+v", test.args, p)
+		}
+	}
+}
+
+func TestQuery_Limit(t *testing.T) {
+	lines := []string{queryRestartFixture[0]}
+	for index, collection := range []string{"a", "b", "c", "b", "c", "c"} {
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:01:%02d.000-0800 I COMMAND  [conn1] command test.%s appName: "MongoDB Shell" command: find { find: "%s", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`, index, collection, collection))
+	}
+
+	args := ArgumentCollection{
+		Integers: map[string]int{"limit": 2},
+		Strings:  map[string]string{"sort": "sum"},
+	}
+	_, output := runQuery(t, args, lines)
+	if !strings.Contains(output, "test.c") || !strings.Contains(output, "test.b") || strings.Contains(output, "test.a ") {
+		t.Errorf("limit should keep the two largest sums, got:\n%s", output)
+	}
+	if !strings.Contains(output, "showing 2 of 3 patterns") {
+		t.Errorf("limit should report the number of elided patterns, got:\n%s", output)
+	}
+
+	args.Strings["format"] = "json"
+	_, output = runQuery(t, args, lines)
+	var report struct {
+		Patterns []map[string]interface{} `json:"patterns"`
+		Total    int                      `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("invalid json (%s):\n%s", err, output)
+	} else if len(report.Patterns) != 2 || report.Total != 3 {
+		t.Errorf("expected 2 of 3 patterns in json, got %d of %d", len(report.Patterns), report.Total)
+	}
+
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("", 0, ArgumentCollection{Integers: map[string]int{"limit": -1}}); err == nil {
+		t.Error("a negative limit should be rejected")
+	}
+}
+
+func TestQuery_Rollup(t *testing.T) {
+	lines := []string{queryRestartFixture[0]}
+	for index, ns := range []string{"test.a", "test.b", "other.c", "test.b"} {
+		lines = append(lines, fmt.Sprintf(`2018-01-16T15:01:%02d.000-0800 I COMMAND  [conn1] command %s appName: "MongoDB Shell" command: find { find: "%s", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg %dms`, index, ns, ns[strings.IndexByte(ns, '.')+1:], 10*(index+1)))
+	}
+
+	_, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"rollup": "database"}}, lines)
+	if !strings.Contains(output, "totals by database:") {
+		t.Errorf("expected a table of totals by database, got:\n%s", output)
+	}
+
+	// The totals include patterns beyond the limit.
+	args := ArgumentCollection{
+		Integers: map[string]int{"limit": 1},
+		Strings:  map[string]string{"rollup": "database", "format": "json"},
+	}
+	_, output = runQuery(t, args, lines)
+	var report struct {
+		Rollup []struct {
+			Database string  `json:"database"`
+			Patterns int     `json:"patterns"`
+			Count    int64   `json:"count"`
+			Sum      float64 `json:"sum"`
+		} `json:"rollup"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("invalid json (%s):\n%s", err, output)
+	} else if len(report.Rollup) != 2 {
+		t.Fatalf("expected 2 databases, got %v", report.Rollup)
+	} else if test := report.Rollup[0]; test.Database != "test" || test.Patterns != 2 || test.Count != 3 || test.Sum != 70 {
+		t.Errorf("both collections of the test database should roll up together, got %+v", test)
+	} else if other := report.Rollup[1]; other.Database != "other" || other.Patterns != 1 || other.Count != 1 || other.Sum != 30 {
+		t.Errorf("the other database should be totaled separately, got %+v", other)
+	}
+
+	for _, options := range []map[string]string{
+		{"rollup": "collection"},
+		{"rollup": "database", "group": "col,op,pattern"},
+	} {
+		if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("", 0, ArgumentCollection{Strings: options}); err == nil {
+			t.Errorf("expected an error for %v", options)
+		}
+	}
+}
+
+func TestQuery_Ratio(t *testing.T) {
+	lines := []string{
+		queryRestartFixture[0],
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:10 docsExamined:10 cursorExhausted:1 numYields:0 nreturned:10 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:400 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 2 } } planSummary: COLLSCAN keysExamined:0 docsExamined:400 cursorExhausted:1 numYields:0 nreturned:2 reslen:100 locks:{} protocol:op_msg 10ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"sort": "ratio"}}, lines)
+	values := cmd.values(cmd.Log[0].Patterns)
+	cmd.sort(values, cmd.Log[0].sort)
+
+	if len(values) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(values))
+	} else if values[0].Namespace != "test.bar" {
+		t.Errorf("the least efficient pattern should sort first, got %s", values[0].Namespace)
+	}
+	if ratio, ok := values[0].Ratio(); !ok || ratio != 200 {
+		t.Errorf("expected a ratio of 200, got %v", ratio)
+	} else if ratio, ok := values[1].Ratio(); !ok || ratio != 1 {
+		t.Errorf("expected a ratio of 1, got %v", ratio)
+	}
+	if !strings.Contains(output, "examined/returned") || !strings.Contains(output, " 200.0") {
+		t.Errorf("ratio column missing from the table:\n%s", output)
+	}
+}
+
+func TestQuery_CollectionScan(t *testing.T) {
+	lines := []string{
+		queryRestartFixture[0],
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 } } planSummary: COLLSCAN keysExamined:0 docsExamined:100 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 } } planSummary: IXSCAN { b: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		expected := int64(0)
+		if pattern.Namespace == "test.foo" {
+			expected = 1
+		}
+		if pattern.CollectionScans != expected {
+			t.Errorf("%s should have %d collection scans, got %d", pattern.Namespace, expected, pattern.CollectionScans)
+		}
+	}
+
+	if !strings.Contains(output, `{"a": 1} *`) || strings.Contains(output, `{"b": 1} *`) {
+		t.Errorf("only the pattern that scanned the collection should be marked:\n%s", output)
+	}
+}
+
+func TestQuery_GroupByPlan(t *testing.T) {
+	lines := []string{
+		queryRestartFixture[0],
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1, b: 1 } } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2, b: 2 } } planSummary: IXSCAN { b: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 20ms`,
+		`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3, b: 3 } } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 30ms`,
+	}
+
+	cmd, _ := runQuery(t, ArgumentCollection{}, lines)
+	if count := len(cmd.Log[0].Patterns); count != 1 {
+		t.Errorf("without grouping by plan the filters should share a pattern, got %d", count)
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"group": "col,db,op,pattern,plan"}}, lines)
+	counts := make(map[string]int64)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		counts[pattern.Plan] = pattern.Count
+	}
+	if len(counts) != 2 || counts["IXSCAN { a: 1 }"] != 2 || counts["IXSCAN { b: 1 }"] != 1 {
+		t.Errorf("each plan should be a separate pattern, got %v", counts)
+	}
+	if !strings.Contains(output, " plan ") || !strings.Contains(output, "IXSCAN { b: 1 }") {
+		t.Errorf("the table should include a plan column:\n%s", output)
+	}
+
+	if got := planSummary([]message.PlanSummary{{Type: "IXSCAN", Key: map[string]interface{}{"b": -1, "a": 1}}, {Type: "COLLSCAN"}}); got != "IXSCAN { a: 1, b: -1 }, COLLSCAN" {
+		t.Errorf("unexpected plan summary %s", got)
+	}
+}
+
+func TestQuery_Out(t *testing.T) {
+	var buffer bytes.Buffer
+	cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{}), output: &buffer}
+	if output := runCommand(t, cmd, ArgumentCollection{}, queryRestartFixture); output != "" {
+		t.Errorf("nothing should be sent to the output channel, got:\n%s", output)
+	}
+	if report := buffer.String(); !strings.Contains(report, "version: mongod 3.6") || !strings.Contains(columns(report), "test.foo find") {
+		t.Errorf("the summary and table should both be written to the output, got:\n%s", report)
+	}
+
+	dir, err := ioutil.TempDir("", "query")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "report.txt")
+	if err := ioutil.WriteFile(name, []byte("stale contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"out": name}}, queryRestartFixture)
+	if output != "" {
+		t.Errorf("nothing should be sent to the output channel, got:\n%s", output)
+	}
+	if report, err := ioutil.ReadFile(name); err != nil {
+		t.Errorf("unable to read the output file (%s)", err)
+	} else if strings.Contains(string(report), "stale contents") || !strings.Contains(columns(string(report)), "test.foo find") {
+		t.Errorf("the output file should be truncated and contain the report, got:\n%s", report)
+	}
+
+	// The file is only created once the report is written.
+	name = filepath.Join(dir, "failed.txt")
+	cmd = &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"out": name}}); err != nil {
+		t.Fatalf("Prepare returned an error (%s)", err)
+	} else if err := cmd.Prepare("test", 1, ArgumentCollection{Strings: map[string]string{"out": name, "sort": "nonsense"}}); err == nil {
+		t.Errorf("an invalid sort option should be rejected")
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("a failed run should not create the output file (%v)", err)
+	}
+
+	cmd = &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"out": filepath.Join(dir, "missing", "report.txt")}}); err != nil {
+		t.Fatalf("Prepare returned an error (%s)", err)
+	} else if err := cmd.Terminate(make(commandTarget, 1)); err == nil {
+		t.Errorf("writing to a missing directory should return an error")
+	}
+}
+
+func TestQuery_Quiet(t *testing.T) {
+	for _, test := range []struct {
+		Option  string
+		Summary bool
+		Table   bool
+	}{
+		{"", true, true},
+		{"quiet", false, true},
+		{"summary-only", true, false},
+	} {
+		for _, parallel := range []bool{false, true} {
+			var buffer bytes.Buffer
+			cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{}), output: &buffer}
+			runCommand(t, cmd, ArgumentCollection{Booleans: map[string]bool{test.Option: true, "parallel-files": parallel}}, queryRestartFixture)
+
+			report := buffer.String()
+			if summary := strings.Contains(report, "version: mongod 3.6"); summary != test.Summary {
+				t.Errorf("expected summary %v with '%s' (parallel %v), got:\n%s", test.Summary, test.Option, parallel, report)
+			}
+			if table := strings.Contains(columns(report), "test.foo find"); table != test.Table {
+				t.Errorf("expected table %v with '%s' (parallel %v), got:\n%s", test.Table, test.Option, parallel, report)
+			}
+		}
+	}
+
+	for _, args := range []ArgumentCollection{
+		{Booleans: map[string]bool{"quiet": true, "summary-only": true}},
+		{Booleans: map[string]bool{"summary-only": true}, Strings: map[string]string{"format": "json"}},
+	} {
+		if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("", 0, args); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestQuery_Timestamps(t *testing.T) {
+	for name, test := range map[string]struct {
+		lines       []string
+		first, last string
+	}{
+		"ISO8601": {
+			lines: queryRestartFixture[:3],
+			first: "2018 Jan 16 15:01:00.000",
+			last:  "2018 Jan 16 15:01:01.000",
+		},
+		"CString": {
+			lines: []string{
+				`Tue Jan 16 15:00:40.105 [initandlisten] db version v2.4.14`,
+				`Tue Jan 16 15:01:02.000 [conn1] query test.foo query: { a: 2 } ntoreturn:0 ntoskip:0 nscanned:1 keyUpdates:0 locks(micros) r:100 nreturned:1 reslen:100 20ms`,
+				`Tue Jan 16 15:01:01.000 [conn1] query test.foo query: { a: 1 } ntoreturn:0 ntoskip:0 nscanned:1 keyUpdates:0 locks(micros) r:100 nreturned:1 reslen:100 10ms`,
+			},
+			first: "Jan 16 15:01:01.000",
+			last:  "Jan 16 15:01:02.000",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd, output := runQuery(t, ArgumentCollection{}, test.lines)
+			if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 || !values[0].FirstSeen.IsZero() {
+				t.Errorf("timestamps should only be reported when requested, got %v", values)
+			} else if strings.Contains(output, "first seen") {
+				t.Errorf("timestamps should only be shown when requested:\n%s", output)
+			}
+
+			cmd, output = runQuery(t, ArgumentCollection{Booleans: map[string]bool{"timestamps": true}}, test.lines)
+			values := cmd.values(cmd.Log[0].Patterns)
+			if len(values) != 1 {
+				t.Fatalf("expected 1 pattern, got %d:\n%s", len(values), output)
+			} else if !values[0].FirstSeen.Before(values[0].LastSeen) {
+				t.Errorf("first seen (%s) should precede last seen (%s)", values[0].FirstSeen, values[0].LastSeen)
+			}
+			if table := columns(output); !strings.Contains(table, "first seen last seen") || !strings.Contains(table, test.first) || !strings.Contains(table, test.last) {
+				t.Errorf("expected first and last seen columns (%s, %s):\n%s", test.first, test.last, output)
+			}
+		})
+	}
+}
+
+func TestQuery_Timezone(t *testing.T) {
+	args := ArgumentCollection{Booleans: map[string]bool{"timestamps": true}, Strings: map[string]string{"timezone": "-0500"}}
+	cmd, output := runQuery(t, args, queryRestartFixture[:3])
+
+	// 15:01 at -0800 is 18:01 at -0500.
+	if !strings.Contains(output, "2018 Jan 16 18:01:00.000") || !strings.Contains(output, "2018 Jan 16 18:01:01.000") {
+		t.Errorf("expected first and last seen at -0500:\n%s", output)
+	}
+	if start := cmd.Log[0].summary.Start; start.Location().String() != "-0500" || start.Hour() != 18 {
+		t.Errorf("expected the summary to start at 18:00 at -0500, got %s", start)
+	}
+
+	if err := (&query{Log: make(map[int]*queryInstance)}).Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"timezone": "+25:00"}}); err == nil {
+		t.Errorf("an invalid time zone should return an error")
+	}
+}
+
+func TestQuery_QueryHash(t *testing.T) {
+	lines := []string{
+		`2019-08-01T15:00:41.759-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-01T15:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 queryHash:4B53BE76 planCacheKey:0FF3F3F6 reslen:229 locks:{} storage:{} protocol:op_msg 120ms`,
+	}
+
+	_, output := runQuery(t, ArgumentCollection{}, lines)
+	if !strings.Contains(output, "test.foo") {
+		t.Fatalf("the 4.2 query should be reported:\n%s", output)
+	} else if strings.Contains(output, "4B53BE76") {
+		t.Errorf("the query hash should only be shown when requested:\n%s", output)
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"query-hash": true}}, lines)
+	if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 || values[0].QueryHash != "4B53BE76" {
+		t.Errorf("expected one pattern with a query hash, got %v", values)
+	} else if !strings.Contains(output, "query hash") || !strings.Contains(output, "4B53BE76") {
+		t.Errorf("expected a query hash column:\n%s", output)
+	}
+}
+
+func TestQuery_Storage(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 cursorExhausted:1 numYields:40 nreturned:1 reslen:100 locks:{} storage:{ data: { bytesRead: 3000, timeReadingMicros: 600 }, timeWaitingMicros: { cache: 20 } } protocol:op_msg 100ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:5000 cursorExhausted:1 numYields:40 nreturned:1 reslen:100 locks:{} storage:{ data: { bytesRead: 1000, timeReadingMicros: 200 } } protocol:op_msg 100ms`,
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 5ms`,
+		`2019-08-10T10:01:03.000-0400 I  COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 5ms`,
+	}
+
+	_, output := runQuery(t, ArgumentCollection{}, lines)
+	if strings.Contains(output, "bytes read") {
+		t.Errorf("storage columns should only be shown when requested:\n%s", output)
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"storage": true}}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		switch pattern.Namespace {
+		case "test.foo":
+			// The operation without storage statistics is not part of the mean.
+			if pattern.StorageCount != 2 || pattern.Storage["data.bytesRead"] != 4000 || pattern.Storage["timeWaitingMicros.cache"] != 20 {
+				t.Errorf("test.foo storage mismatch, got %d %v", pattern.StorageCount, pattern.Storage)
+			} else if mean, _ := pattern.StorageMean(formatting.StorageMetrics[0]); mean != 2000 {
+				t.Errorf("test.foo mean bytes read should be 2000, got %d", mean)
+			}
+		case "test.bar":
+			if pattern.StorageCount != 0 || pattern.Storage != nil {
+				t.Errorf("test.bar has no storage statistics, got %d %v", pattern.StorageCount, pattern.Storage)
+			}
+		}
+	}
+	if !strings.Contains(output, "bytes read") || !strings.Contains(output, "cache wait (us)") {
+		t.Errorf("expected storage columns:\n%s", output)
+	}
+
+	_, output = runQuery(t, ArgumentCollection{Booleans: map[string]bool{"storage": true}, Strings: map[string]string{"format": "json"}}, lines)
+	if !strings.Contains(output, `"storage":{"data.bytesRead":2000`) {
+		t.Errorf("expected storage means in the json report:\n%s", output)
+	}
+}
+
+func TestQuery_Locks(t *testing.T) {
+	// Each log contains an operation that waited for locks, one that acquired
+	// them without waiting, and one that logged no locks at all.
+	for name, test := range map[string]struct {
+		lines []string
+		sum   int64
+	}{
+		"3.6": {
+			lines: []string{
+				`2018-01-16T15:00:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+				`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{ Global: { acquireCount: { r: 2 }, acquireWaitCount: { r: 1 }, timeAcquiringMicros: { r: 300 } }, MMAPV1Journal: { acquireCount: { r: 1 }, acquireWaitCount: { r: 1 }, timeAcquiringMicros: { r: 5000 } }, Database: { acquireCount: { r: 1 }, acquireWaitCount: { r: 1 }, timeAcquiringMicros: { r: 100 } }, Collection: { acquireCount: { R: 1 }, acquireWaitCount: { R: 1 }, timeAcquiringMicros: { R: 200 } } } protocol:op_msg 10ms`,
+				`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{ Global: { acquireCount: { r: 2 } }, Database: { acquireCount: { r: 1 } }, Collection: { acquireCount: { r: 1 } } } protocol:op_msg 10ms`,
+				`2018-01-16T15:01:02.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+			},
+			sum: 600,
+		},
+		"4.0": {
+			lines: []string{
+				`2019-08-10T10:00:00.000-0400 I CONTROL  [initandlisten] db version v4.0.12`,
+				`2019-08-10T10:01:00.000-0400 I WRITE    [conn1] update test.foo command: { q: { a: 1 }, u: { $set: { b: 1 } }, multi: false, upsert: false } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 locks:{ Global: { acquireCount: { r: 1, w: 1 }, acquireWaitCount: { w: 1 }, timeAcquiringMicros: { w: 400 } }, Database: { acquireCount: { w: 1 }, acquireWaitCount: { w: 1 }, timeAcquiringMicros: { w: 600 } }, Collection: { acquireCount: { w: 1 } } }storage:{} 20ms`,
+				`2019-08-10T10:01:01.000-0400 I WRITE    [conn1] update test.foo command: { q: { a: 2 }, u: { $set: { b: 1 } }, multi: false, upsert: false } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 locks:{ Global: { acquireCount: { r: 1, w: 1 } }, Database: { acquireCount: { w: 1 } }, Collection: { acquireCount: { w: 1 } } }storage:{} 20ms`,
+				`2019-08-10T10:01:02.000-0400 I WRITE    [conn1] update test.foo command: { q: { a: 3 }, u: { $set: { b: 1 } }, multi: false, upsert: false } planSummary: COLLSCAN keysExamined:0 docsExamined:1 nMatched:1 nModified:1 numYields:0 locks:{}storage:{} 20ms`,
+			},
+			sum: 1000,
+		},
+		"4.4": {
+			lines: []string{
+				`{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"numYields":0,"nreturned":1,"reslen":100,"locks":{"ReplicationStateTransition":{"acquireCount":{"w":1},"acquireWaitCount":{"w":1},"timeAcquiringMicros":{"w":9000}},"Global":{"acquireCount":{"r":1},"acquireWaitCount":{"r":1},"timeAcquiringMicros":{"r":700}},"Database":{"acquireCount":{"r":1}},"Collection":{"acquireCount":{"r":1}}},"protocol":"op_msg","durationMillis":12}}`,
+				`{"t":{"$date":"2020-05-20T20:10:09.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":2},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"numYields":0,"nreturned":1,"reslen":100,"locks":{"Global":{"acquireCount":{"r":1}},"Database":{"acquireCount":{"r":1}},"Collection":{"acquireCount":{"r":1}}},"protocol":"op_msg","durationMillis":12}}`,
+				`{"t":{"$date":"2020-05-20T20:10:10.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":3},"$db":"test"},"planSummary":"COLLSCAN","keysExamined":0,"docsExamined":1,"numYields":0,"nreturned":1,"reslen":100,"locks":{},"protocol":"op_msg","durationMillis":12}}`,
+			},
+			sum: 700,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, output := runQuery(t, ArgumentCollection{}, test.lines)
+			if strings.Contains(output, "lock mean") {
+				t.Errorf("lock columns should only be shown when requested:\n%s", output)
+			}
+
+			cmd, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"locks": true}}, test.lines)
+			values := cmd.values(cmd.Log[0].Patterns)
+			if len(values) != 1 {
+				t.Fatalf("expected a single pattern, got %d", len(values))
+			}
+
+			// The operation without locks is not part of the mean.
+			pattern := values[0]
+			if pattern.Count != 3 || pattern.Locked != 2 || pattern.LockSum != test.sum || pattern.LockMax != test.sum {
+				t.Errorf("lock times mismatch, got %d of %d with a sum of %d and max of %d", pattern.Locked, pattern.Count, pattern.LockSum, pattern.LockMax)
+			} else if mean, ok := pattern.LockMean(); !ok || mean != test.sum/2 {
+				t.Errorf("mean lock time should be %d, got %d", test.sum/2, mean)
+			} else if len(pattern.LockScopes) != len(formatting.LockScopes) {
+				t.Errorf("expected a sum for each scope, got %v", pattern.LockScopes)
+			}
+			if !strings.Contains(output, "lock mean (us)") || !strings.Contains(output, "lock max (us)") {
+				t.Errorf("expected lock columns:\n%s", output)
+			}
+		})
+	}
+
+	t.Run("None", func(t *testing.T) {
+		cmd, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"locks": true}}, queryRestartFixture[:3])
+		for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+			if pattern.Locked != 0 || pattern.LockScopes != nil {
+				t.Errorf("operations without locks should not be counted, got %d %v", pattern.Locked, pattern.LockScopes)
+			}
+		}
+		if strings.Contains(output, "lock mean") {
+			t.Errorf("lock columns should be omitted when no operation logged locks:\n%s", output)
+		}
+	})
+
+	_, output := runQuery(t, ArgumentCollection{Booleans: map[string]bool{"locks": true}, Strings: map[string]string{"format": "json"}}, []string{
+		`2018-01-16T15:00:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{ Global: { acquireCount: { r: 2 }, timeAcquiringMicros: { r: 300 } }, Database: { acquireCount: { r: 1 } }, Collection: { acquireCount: { r: 1 } } } protocol:op_msg 10ms`,
+	})
+	if !strings.Contains(output, `"lock_mean":300,"lock_max":300,"lock_scopes":{"Collection":0,"Database":0,"Global":300}`) {
+		t.Errorf("expected lock times in the json report:\n%s", output)
+	}
+}
+
+func TestQuery_GroupByApp(t *testing.T) {
+	find := `2019-08-10T10:01:0%d.000-0400 I  COMMAND  [conn%d] command test.foo command: find { find: "foo", filter: { a: %d }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:00:01.000-0400 I  NETWORK  [conn1] received client metadata from 127.0.0.1:53342 conn1: { application: { name: "reporting" }, driver: { name: "nodejs", version: "3.6.0" } }`,
+		fmt.Sprintf(find, 1, 1, 1),
+		// A connection without metadata.
+		fmt.Sprintf(find, 2, 2, 2),
+		// Connection numbers are reused after a restart.
+		`2019-08-10T10:02:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		strings.Replace(fmt.Sprintf(find, 3, 1, 3), "10:01:", "10:03:", 1),
+		strings.Replace(fmt.Sprintf(find, 4, 3, 4), `command: find`, `appName: "MongoDB Shell" command: find`, 1),
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"group": "app,col,db,op,pattern"}}, lines)
+	counts := make(map[string]int64)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		counts[pattern.App] += pattern.Count
+	}
+	if len(counts) != 3 || counts["reporting"] != 1 || counts[""] != 2 || counts["MongoDB Shell"] != 1 {
+		t.Errorf("app counts mismatch, got %v:\n%s", counts, output)
+	} else if !strings.Contains(output, "reporting") {
+		t.Errorf("expected an app column:\n%s", output)
+	}
+
+	cmd, _ = runQuery(t, ArgumentCollection{}, lines)
+	if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 || values[0].App != "" || values[0].Count != 4 {
+		t.Errorf("patterns should only be grouped by app when requested, got %v", values)
+	}
+}
+
+func TestQuery_GroupByComment(t *testing.T) {
+	find := `2019-08-10T10:01:0%d.000-0400 I  COMMAND  [conn1] command test.foo command: find { find: "foo", filter: { a: %d }, %s$db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		fmt.Sprintf(find, 1, 1, `comment: "report", `),
+		fmt.Sprintf(find, 2, 2, `comment: "report", `),
+		fmt.Sprintf(find, 3, 3, `comment: { trace: "abc", user: "x" }, `),
+		fmt.Sprintf(find, 4, 4, ``),
+		fmt.Sprintf(find, 5, 5, `comment: "report", `),
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{Strings: map[string]string{"group": "comment,col,db,op,pattern"}}, lines)
+	counts := make(map[string]int64)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		counts[pattern.Comment] += pattern.Count
+	}
+	if len(counts) != 3 || counts["report"] != 3 || counts[`{"trace":"abc","user":"x"}`] != 1 || counts["(none)"] != 1 {
+		t.Errorf("comment counts mismatch, got %v:\n%s", counts, output)
+	} else if !strings.Contains(columns(output), "comment namespace") || !strings.Contains(output, "(none)") {
+		t.Errorf("expected a comment column:\n%s", output)
+	}
+
+	cmd, output = runQuery(t, ArgumentCollection{}, lines)
+	if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 || values[0].Comment != "" || values[0].Count != 5 {
+		t.Errorf("patterns should only be grouped by comment when requested, got %v", values)
+	} else if strings.Contains(output, "comment") {
+		t.Errorf("unexpected comment column:\n%s", output)
+	}
+}
+
+func TestQuery_Interval(t *testing.T) {
+	for name, test := range map[string]struct {
+		lines []string
+		start string
+	}{
+		"ISO8601": {
+			lines: []string{
+				`2018-01-16T15:00:41.759+0530 I CONTROL  [initandlisten] db version v3.6.8`,
+				`2018-01-16T15:01:00.000+0530 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+				`2018-01-16T15:04:59.000+0530 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 20ms`,
+				`2018-01-16T15:11:00.000+0530 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 30ms`,
+			},
+			start: "2018 Jan 16 15:00:00.000",
+		},
+		"CString": {
+			lines: []string{
+				`Tue Jan 16 15:00:40.105 [initandlisten] db version v2.4.14`,
+				`Tue Jan 16 15:01:00.000 [conn1] query test.foo query: { a: 1 } ntoreturn:0 ntoskip:0 nscanned:1 keyUpdates:0 locks(micros) r:100 nreturned:1 reslen:100 10ms`,
+				`Tue Jan 16 15:04:59.000 [conn1] query test.foo query: { a: 2 } ntoreturn:0 ntoskip:0 nscanned:1 keyUpdates:0 locks(micros) r:100 nreturned:1 reslen:100 20ms`,
+				`Tue Jan 16 15:11:00.000 [conn1] query test.foo query: { a: 3 } ntoreturn:0 ntoskip:0 nscanned:1 keyUpdates:0 locks(micros) r:100 nreturned:1 reslen:100 30ms`,
+			},
+			start: "Jan 16 15:00:00.000",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd, output := runQuery(t, ArgumentCollection{}, test.lines)
+			if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 || values[0].Intervals != nil {
+				t.Errorf("intervals should only be calculated when requested, got %v", values)
+			} else if strings.Contains(output, "p95 (ms) per") {
+				t.Errorf("intervals should only be shown when requested:\n%s", output)
+			}
+
+			cmd, output = runQuery(t, ArgumentCollection{Strings: map[string]string{"interval": "5m"}}, test.lines)
+			values := cmd.values(cmd.Log[0].Patterns)
+			if len(values) != 1 {
+				t.Fatalf("expected 1 pattern, got %d:\n%s", len(values), output)
+			}
+
+			intervals := values[0].Intervals
+			if len(intervals) != 3 {
+				t.Fatalf("expected 3 intervals (including an empty one), got %v", intervals)
+			} else if intervals[0].Count != 2 || intervals[0].P95 != 15 {
+				t.Errorf("first interval mismatch, got %+v", intervals[0])
+			} else if intervals[1].Count != 0 || !math.IsNaN(intervals[1].P95) {
+				t.Errorf("the empty interval should have no p95, got %+v", intervals[1])
+			} else if intervals[2].Count != 1 || intervals[2].P95 != 30 {
+				t.Errorf("last interval mismatch, got %+v", intervals[2])
+			} else if intervals[1].Start.Sub(intervals[0].Start) != 5*time.Minute {
+				t.Errorf("intervals should be five minutes apart, got %s and %s", intervals[0].Start, intervals[1].Start)
+			}
+
+			if !strings.Contains(output, "count and p95 (ms) per 5m0s:") || !strings.Contains(output, test.start) {
+				t.Errorf("expected intervals starting at %s:\n%s", test.start, output)
+			}
+
+			// The growth and trend reports keep their minute buckets.
+			cmd, _ = runQuery(t, ArgumentCollection{Integers: map[string]int{"top-growth": 1}, Strings: map[string]string{"interval": "5m"}}, test.lines)
+			for _, pattern := range cmd.Log[0].Patterns {
+				if len(pattern.buckets) != 3 || len(pattern.periods) != 2 {
+					t.Errorf("expected 3 minute buckets and 2 intervals, got %d and %d", len(pattern.buckets), len(pattern.periods))
+				}
+			}
+		})
+	}
+
+	for _, value := range []string{"5", "0s", "-1m", "soon"} {
+		cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+		if err := cmd.Prepare("test", 0, ArgumentCollection{Strings: map[string]string{"interval": value}}); err == nil {
+			t.Errorf("interval '%s' should be rejected", value)
+		}
+	}
+}
+
+func TestQuery_Examined(t *testing.T) {
+	lines := []string{
+		`2019-08-10T10:00:00.000-0400 I  CONTROL  [initandlisten] db version v4.2.0`,
+		`2019-08-10T10:01:00.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1000 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+		`2019-08-10T10:01:01.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 2 }, $db: "test" } planSummary: COLLSCAN keysExamined:10 docsExamined:3000 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+		// A line without either counter is not part of the means.
+		`2019-08-10T10:01:02.000-0400 I  COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 3 }, $db: "test" } planSummary: COLLSCAN cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+		`2019-08-10T10:01:03.000-0400 I  COMMAND  [conn1] command test.bar appName: "MongoDB Shell" command: find { find: "bar", filter: { b: 1 }, $db: "test" } planSummary: COLLSCAN cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	if strings.Contains(output, "keys examined") {
+		t.Errorf("examined columns should only be shown when requested:\n%s", output)
+	}
+
+	cmd, output = runQuery(t, ArgumentCollection{Booleans: map[string]bool{"examined": true}}, lines)
+	for _, pattern := range cmd.values(cmd.Log[0].Patterns) {
+		means := pattern.ExaminedMeans
+		switch pattern.Namespace {
+		case "test.foo":
+			if pattern.Count != 3 || means == nil || means.Keys != 5 || means.Docs != 2000 {
+				t.Errorf("test.foo means mismatch, got %+v", means)
+			}
+		case "test.bar":
+			if means == nil || !math.IsNaN(means.Keys) || !math.IsNaN(means.Docs) {
+				t.Errorf("test.bar never logged the counters, got %+v", means)
+			}
+		}
+	}
+	if !strings.Contains(output, "keys examined") || !strings.Contains(output, "2000.0") {
+		t.Errorf("expected examined columns:\n%s", output)
+	}
+}
+
+func TestQuery_ShowErrors(t *testing.T) {
+	lines := append([]string{
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo command: find { find: "foo", filter: { a: `,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo command: find { find: "foo", filter: { b: `,
+		`2018-01-16T15:01:02.000-0800 I NETWORK  [conn1] an unrecognized message`,
+	}, queryRestartFixture...)
+
+	// The version is known before the malformed lines are read.
+	lines[0], lines[3] = lines[3], lines[0]
+
+	reader, err := source.NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+	if err != nil {
+		t.Fatalf("unexpected error creating source (%s)", err)
+	}
+
+	cmd := &query{Log: make(map[int]*queryInstance), summaryTable: bytes.NewBuffer([]byte{})}
+	out, errs := nopWriteCloser{bytes.NewBuffer([]byte{})}, nopWriteCloser{bytes.NewBuffer([]byte{})}
+	args := ArgumentCollection{Booleans: map[string]bool{"show-errors": true}}
+	if err := RunCommand(cmd, []Input{{Arguments: args, Name: "test.log", Reader: reader}}, Output{Writer: out, Error: errs}); err != nil {
+		t.Fatalf("RunCommand returned an error (%s)", err)
+	}
+
+	output := errs.String()
+	if !strings.Contains(output, "test.log:2: ") || !strings.Contains(output, "test.log:4: ") || !strings.Contains(output, "filter: { b:") {
+		t.Errorf("each malformed line should be shown, got:\n%s", output)
+	} else if strings.Contains(output, "an unrecognized message") {
+		t.Errorf("unrecognized messages should not be shown, got:\n%s", output)
+	} else if !strings.Contains(output, "test.log: 2 lines could not be parsed\n       2  ") {
+		t.Errorf("errors should be counted, got:\n%s", output)
+	}
+	if strings.Contains(out.String(), "filter: { b:") {
+		t.Errorf("errors should not be written with the report, got:\n%s", out.String())
+	}
+}
+
+func TestQuery_HashCollision(t *testing.T) {
+	cmd, _ := runQuery(t, ArgumentCollection{}, queryRestartFixture[:2])
+	for key, pattern := range cmd.Log[0].Patterns {
+		// Stand in for a different filter that happens to share the hash.
+		pattern.filter = mongo.NewPattern(map[string]interface{}{"b": 1})
+		cmd.Log[0].Patterns[key] = pattern
+	}
+
+	base, err := source.JSONLog{}.NewBase(queryRestartFixture[2], 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := make(chan record.Base, 1)
+	in <- base
+	close(in)
+
+	if err := cmd.Run(0, make(chan string, 16), in, make(chan error, 1)); err != nil {
+		t.Fatalf("Run returned an error (%s)", err)
+	} else if len(cmd.Log[0].Patterns) != 2 {
+		t.Errorf("filters with the same hash should be kept apart, got %d patterns", len(cmd.Log[0].Patterns))
+	}
+	for _, pattern := range cmd.Log[0].Patterns {
+		if pattern.Count != 1 || pattern.Pattern.Pattern != `{"a": 1}` {
+			t.Errorf("unexpected pattern %+v", pattern.Pattern)
+		}
+	}
+}
+
+func TestQuery_NestDottedFields(t *testing.T) {
+	lines := []string{
+		queryRestartFixture[0],
+		`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a.b: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+		`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: { b: 2 } } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 20ms`,
+	}
+
+	cmd, output := runQuery(t, ArgumentCollection{}, lines)
+	if values := cmd.values(cmd.Log[0].Patterns); len(values) != 1 {
+		t.Fatalf("a dotted field and the same nested field should be one pattern, got:\n%s", output)
+	} else if values[0].Count != 2 || values[0].Pattern != `{"a": {"b": 1}}` {
+		t.Errorf("unexpected pattern %s with count %d", values[0].Pattern, values[0].Count)
+	}
+}
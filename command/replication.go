@@ -0,0 +1,181 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+// Follows the replica set state of the node writing the log, and the states
+// it reports for other members, along with the elections and stepdowns that
+// caused each change.
+type replication struct {
+	instance map[int]*replicationInstance
+}
+
+type replicationInstance struct {
+	summary     formatting.Summary
+	transitions []replicationTransition
+
+	// The last known state of each member (keyed by host, where the node
+	// writing the log is an empty host) and the reason given for the next
+	// change of state of this node.
+	states  map[string]string
+	pending string
+
+	elections int64
+	won       int64
+	stepdowns int64
+}
+
+type replicationTransition struct {
+	Date   time.Time
+	Host   string
+	From   string
+	To     string
+	Reason string
+}
+
+func init() {
+	args := Definition{
+		Usage: "output a timeline of replica set state transitions, elections, and stepdowns",
+	}
+
+	GetFactory().Register("replication", args, func() (Command, error) {
+		return &replication{instance: make(map[int]*replicationInstance)}, nil
+	})
+}
+
+func (r *replication) Finish(index int, out commandTarget) error {
+	instance := r.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.transitions) == 0 && instance.elections == 0 && instance.won == 0 && instance.stepdowns == 0 {
+		writer.WriteString("  no replica set state changes found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "elections started", instance.elections))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "elections won", instance.won))
+	writer.WriteString(fmt.Sprintf("%20s: %d\n", "stepdowns", instance.stepdowns))
+
+	if len(instance.transitions) == 0 {
+		out <- writer.String()
+		return nil
+	}
+
+	local := "(this node)"
+	if instance.summary.Host != "" && instance.summary.Port > 0 {
+		local = fmt.Sprintf("%s:%d (this node)", instance.summary.Host, instance.summary.Port)
+	}
+
+	writer.WriteString("\nTRANSITIONS\n")
+	for _, transition := range instance.transitions {
+		date := formatting.Timestamp(transition.Date, instance.summary.Start, false, internal.DateFormatCtimenoms)
+
+		host := transition.Host
+		if host == "" {
+			host = local
+		}
+
+		line := fmt.Sprintf("   %s %s %s -> %s", date, host, transition.From, transition.To)
+		if transition.Reason != "" {
+			line += " (" + transition.Reason + ")"
+		}
+		writer.WriteString(line + "\n")
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (r *replication) Prepare(name string, index int, _ ArgumentCollection) error {
+	r.instance[index] = &replicationInstance{
+		summary: formatting.NewSummary(name),
+		states:  make(map[string]string),
+	}
+
+	return nil
+}
+
+func (r *replication) Run(index int, _ commandTarget, in commandSource, _ commandError) error {
+	instance := r.instance[index]
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		instance.summary.Update(entry)
+
+		switch msg := entry.Message.(type) {
+		case message.StartupInfo, message.StartupInfoLegacy, message.Version:
+			// The state of every member is unknown after a restart.
+			if entry.Connection == 0 {
+				instance.states = make(map[string]string)
+				instance.pending = ""
+			}
+
+		case message.Election:
+			instance.elections += 1
+
+		case message.ElectionWon:
+			instance.won += 1
+			instance.pending = "election won"
+			if msg.Term >= 0 {
+				instance.pending = fmt.Sprintf("election won in term %d", msg.Term)
+			}
+
+		case message.Stepdown:
+			instance.stepdowns += 1
+			instance.pending = "stepped down"
+			if msg.Reason != "" {
+				instance.pending += ": " + msg.Reason
+			}
+
+		case message.StateTransition:
+			instance.transition(entry.Date, msg)
+		}
+	}
+
+	return nil
+}
+
+func (r *replication) Terminate(commandTarget) error {
+	return nil
+}
+
+func (r *replicationInstance) transition(date time.Time, msg message.StateTransition) {
+	from := msg.From
+	if from == "" {
+		from = r.states[msg.Host]
+	}
+	if from == "" {
+		from = "UNKNOWN"
+	} else if from == msg.To {
+		// Members repeat their state, e.g. after a heartbeat reconnects.
+		return
+	}
+	r.states[msg.Host] = msg.To
+
+	transition := replicationTransition{Date: date, Host: msg.Host, From: from, To: msg.To}
+	if msg.Host == "" {
+		// Elections and stepdowns only explain changes to this node.
+		transition.Reason = r.pending
+		r.pending = ""
+	}
+	r.transitions = append(r.transitions, transition)
+}
@@ -0,0 +1,46 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplication(t *testing.T) {
+	lines := []string{
+		`2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] MongoDB starting : pid=1 port=27017 dbpath=/data/db 64-bit host=host1`,
+		`2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9`,
+		`2019-05-01T12:00:01.000+0000 I REPL     [replexec-0] transition to RECOVERING from STARTUP2`,
+		`2019-05-01T12:00:02.000+0000 I REPL     [replexec-0] transition to SECONDARY from RECOVERING`,
+		`2019-05-01T12:00:02.000+0000 I REPL     [replexec-1] Member host2:27017 is now in state PRIMARY`,
+		`2019-05-01T12:01:00.000+0000 I REPL     [replexec-6] Starting an election, since we've seen no PRIMARY in the past 10000ms`,
+		`2019-05-01T12:01:00.000+0000 I REPL     [replexec-7] election succeeded, assuming primary role in term 5`,
+		`2019-05-01T12:01:00.000+0000 I REPL     [replexec-7] transition to PRIMARY from SECONDARY`,
+		`2019-05-01T12:01:01.000+0000 I REPL     [rsSync-0] transition to primary complete; database writes are now permitted`,
+		`2019-05-01T12:01:02.000+0000 I REPL     [replexec-9] Member host2:27017 is now in state SECONDARY`,
+		`2019-05-01T12:01:03.000+0000 I REPL     [replexec-9] Member host2:27017 is now in state SECONDARY`,
+		`2019-05-01T12:05:00.000+0000 I REPL     [replexec-3] stepping down from primary, because a new term has begun: 6`,
+		`2019-05-01T12:05:00.000+0000 I REPL     [replexec-3] transition to SECONDARY from PRIMARY`,
+	}
+
+	cmd := &replication{instance: make(map[int]*replicationInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	instance := cmd.instance[0]
+
+	if instance.elections != 1 || instance.won != 1 || instance.stepdowns != 1 {
+		t.Errorf("expected an election, a win, and a stepdown, got %d/%d/%d", instance.elections, instance.won, instance.stepdowns)
+	}
+	if len(instance.transitions) != 6 {
+		t.Fatalf("expected 6 transitions, got %d:\n%s", len(instance.transitions), output)
+	}
+
+	for _, expected := range []string{
+		"(this node) SECONDARY -> PRIMARY (election won in term 5)",
+		"(this node) PRIMARY -> SECONDARY (stepped down: a new term has begun: 6)",
+		"host2:27017 UNKNOWN -> PRIMARY",
+		"host2:27017 PRIMARY -> SECONDARY",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected '%s' in output:\n%s", expected, output)
+		}
+	}
+}
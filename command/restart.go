@@ -3,6 +3,8 @@ package command
 import (
 	"bytes"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"mgotools/internal"
@@ -13,19 +15,65 @@ import (
 
 type restart struct {
 	instance map[int]*restartInstance
+
+	relative bool
+
+	// Set by the restarts command to also output uptime windows.
+	uptime bool
 }
 
 type restartInstance struct {
 	summary  formatting.Summary
-	restarts []struct {
-		Date    time.Time
-		Startup message.Version
-	}
+	restarts []restartStartup
+	windows  []*restartWindow
+}
+
+// A startup banner and how the shutdown before it ended.
+type restartStartup struct {
+	Date     time.Time
+	Startup  message.Version
+	Previous string
+}
+
+// A period of time the server was running. A window without a startup began
+// before the log did, and a window without a shutdown either ended abruptly
+// or was still running at the end of the log.
+type restartWindow struct {
+	Start time.Time
+	End   time.Time
+
+	Started  bool
+	Shutdown bool
+	Clean    bool
 }
 
+const (
+	restartClean   = "clean"
+	restartUnclean = "unclean"
+	restartUnknown = "unknown"
+)
+
 func init() {
-	GetFactory().Register("restart", Definition{}, func() (Command, error) {
-		return &restart{make(map[int]*restartInstance)}, nil
+	args := Definition{
+		Usage: "output a list of server restarts",
+		Flags: []Argument{
+			{Name: "relative-time", Type: Bool, Usage: "output timestamps as seconds since the first entry"},
+		},
+	}
+
+	GetFactory().Register("restart", args, func() (Command, error) {
+		return &restart{instance: make(map[int]*restartInstance)}, nil
+	})
+
+	args = Definition{
+		Usage: "output each server restart, whether the preceding shutdown was clean, uptime windows, and slowms changes",
+		Flags: []Argument{
+			{Name: "relative-time", Type: Bool, Usage: "output timestamps as seconds since the first entry"},
+		},
+	}
+
+	GetFactory().Register("restarts", args, func() (Command, error) {
+		return &restart{instance: make(map[int]*restartInstance), uptime: true}, nil
 	})
 }
 
@@ -35,16 +83,32 @@ func (r *restart) Finish(index int, out commandTarget) error {
 
 	instance.summary.Print(writer)
 
-	if len(instance.restarts) == 0 {
+	if len(instance.restarts) == 0 && !r.uptime {
 		out <- "  no restarts found"
 		return nil
 	}
 
+	format := func(date time.Time) string {
+		return formatting.Timestamp(date, instance.summary.Start, r.relative, internal.DateFormatCtimenoms)
+	}
+
 	writer.WriteRune('\n')
-	writer.WriteString("RESTARTS\n")
+	if len(instance.restarts) == 0 {
+		writer.WriteString("  no restarts found\n")
+	} else {
+		writer.WriteString("RESTARTS\n")
+	}
 
-	for _, restart := range r.instance[index].restarts {
-		writer.WriteString(fmt.Sprintf("   %s %s\n", restart.Date.Format(string(internal.DateFormatCtimenoms)), restart.Startup.String()))
+	for _, restart := range instance.restarts {
+		if r.uptime {
+			writer.WriteString(fmt.Sprintf("   %s %s (previous shutdown: %s)\n", format(restart.Date), restart.Startup.String(), restart.Previous))
+		} else {
+			writer.WriteString(fmt.Sprintf("   %s %s\n", format(restart.Date), restart.Startup.String()))
+		}
+	}
+
+	if r.uptime {
+		instance.printUptime(format, writer)
 	}
 
 	out <- writer.String()
@@ -52,8 +116,42 @@ func (r *restart) Finish(index int, out commandTarget) error {
 	return nil
 }
 
-func (r *restart) Prepare(name string, index int, _ ArgumentCollection) error {
+// Outputs the windows the server was running and the changes to the slow
+// operation threshold.
+func (instance *restartInstance) printUptime(format func(time.Time) string, writer *bytes.Buffer) {
+	if len(instance.windows) > 0 {
+		writer.WriteString("\nUPTIME\n")
+		for _, window := range instance.windows {
+			var notes []string
+			if !window.Started {
+				notes = append(notes, "started before the log")
+			}
+			if !window.Shutdown {
+				notes = append(notes, "no shutdown logged")
+			} else if !window.Clean {
+				notes = append(notes, "unclean shutdown")
+			}
+
+			line := fmt.Sprintf("   %s - %s %s", format(window.Start), format(window.End), window.End.Sub(window.Start).String())
+			if len(notes) > 0 {
+				line += " (" + strings.Join(notes, ", ") + ")"
+			}
+			writer.WriteString(line + "\n")
+		}
+	}
+
+	if len(instance.summary.Slowms) > 0 {
+		// Operations faster than the threshold in effect were not logged.
+		writer.WriteString("\nSLOWMS\n")
+		for _, threshold := range instance.summary.Slowms {
+			writer.WriteString(fmt.Sprintf("   %s %dms (%s)\n", format(threshold.Date), threshold.Slowms, threshold.Source))
+		}
+	}
+}
+
+func (r *restart) Prepare(name string, index int, args ArgumentCollection) error {
 	r.instance[index] = &restartInstance{summary: formatting.NewSummary(name)}
+	r.relative = args.Booleans["relative-time"]
 
 	return nil
 }
@@ -66,6 +164,9 @@ func (r *restart) Run(index int, out commandTarget, in commandSource, errors com
 	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
 	defer context.Finish()
 
+	// The window the server is currently running in, if any.
+	var current *restartWindow
+
 	for base := range in {
 		entry, err := context.NewEntry(base)
 		if err != nil {
@@ -73,15 +174,48 @@ func (r *restart) Run(index int, out commandTarget, in commandSource, errors com
 		}
 
 		summary.Update(entry)
-		if entry.Message == nil {
+		if startup, ok := getVersionFromMessage(entry.Message); ok {
+			previous := restartUnknown
+			if current != nil {
+				// The server started again without logging a shutdown.
+				previous = restartUnclean
+			} else if count := len(instance.windows); count > 0 && instance.windows[count-1].Clean {
+				previous = restartClean
+			} else if count > 0 {
+				previous = restartUnclean
+			}
+
+			instance.restarts = append(instance.restarts, restartStartup{Date: entry.Date, Startup: startup, Previous: previous})
+			if entry.DateValid {
+				current = &restartWindow{Start: entry.Date, End: entry.Date, Started: true}
+				instance.windows = append(instance.windows, current)
+			}
 			continue
-		} else if restart, ok := getVersionFromMessage(entry.Message); !ok {
+		} else if err != nil || !entry.DateValid {
 			continue
-		} else {
-			instance.restarts = append(instance.restarts, struct {
-				Date    time.Time
-				Startup message.Version
-			}{Date: entry.Date, Startup: restart})
+		}
+
+		if _, ok := entry.Message.(message.StartupInfo); ok {
+			// The first line of a startup banner precedes the version.
+			continue
+		}
+
+		if current == nil {
+			if len(instance.windows) > 0 {
+				// Lines between a shutdown and the next startup banner.
+				continue
+			}
+
+			// The log began while the server was already running.
+			current = &restartWindow{Start: entry.Date}
+			instance.windows = append(instance.windows, current)
+		}
+
+		current.End = entry.Date
+		if shutdown, ok := entry.Message.(message.Shutdown); ok {
+			current.Shutdown = true
+			current.Clean = shutdownCode(shutdown.String) == 0
+			current = nil
 		}
 	}
 
@@ -101,3 +235,17 @@ func getVersionFromMessage(msg message.Message) (message.Version, bool) {
 		return message.Version{}, false
 	}
 }
+
+// Returns the exit code of a shutdown message, e.g. "dbexit:  rc: 0", or -1
+// when no exit code is present.
+func shutdownCode(text string) int {
+	words := strings.Fields(text)
+	for index := 0; index < len(words)-1; index += 1 {
+		if words[index] == "rc:" {
+			if code, err := strconv.Atoi(words[index+1]); err == nil {
+				return code
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRestart_RelativeTime(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:00:42.000-0800 I NETWORK  [initandlisten] waiting for connections on port 27017`,
+		`2018-01-16T15:02:11.759-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+	}
+
+	output := runCommand(t, &restart{instance: make(map[int]*restartInstance)}, ArgumentCollection{Booleans: map[string]bool{"relative-time": true}}, lines)
+	if !strings.Contains(output, "   0.000 ") {
+		t.Errorf("first restart should be at 0.000, got:\n%s", output)
+	}
+	if !strings.Contains(output, "   90.000 ") {
+		t.Errorf("second restart should be at 90.000, got:\n%s", output)
+	}
+
+	output = runCommand(t, &restart{instance: make(map[int]*restartInstance)}, ArgumentCollection{Booleans: map[string]bool{}}, lines)
+	if strings.Contains(output, "   0.000 ") {
+		t.Errorf("timestamps should not be relative by default, got:\n%s", output)
+	} else if strings.Contains(output, "UPTIME") {
+		t.Errorf("uptime windows are only output by restarts, got:\n%s", output)
+	}
+}
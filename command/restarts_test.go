@@ -0,0 +1,86 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+// Creates the restarts command the same way the command line does.
+func newRestarts(t *testing.T) *restart {
+	cmd, err := GetFactory().Get("restarts")
+	if err != nil {
+		t.Fatalf("the restarts command should be registered (%s)", err)
+	}
+	return cmd.(*restart)
+}
+
+func TestRestarts_Uptime(t *testing.T) {
+	lines := []string{
+		`2018-01-16T15:00:00.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50000 #1 (1 connection now open)`,
+		`2018-01-16T15:01:00.000-0800 I CONTROL  [signalProcessingThread] dbexit:  rc: 0`,
+		`2018-01-16T15:02:00.000-0800 I CONTROL  [initandlisten] MongoDB starting : pid=1 port=27017 dbpath=/data/db 64-bit host=localhost`,
+		`2018-01-16T15:02:00.000-0800 I CONTROL  [initandlisten] db version v3.6.8`,
+		`2018-01-16T15:03:00.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50001 #1 (1 connection now open)`,
+		`2018-01-16T15:04:00.000-0800 I CONTROL  [initandlisten] db version v3.6.9`,
+		`2018-01-16T15:05:00.000-0800 I NETWORK  [listener] connection accepted from 10.0.0.1:50002 #1 (1 connection now open)`,
+	}
+
+	cmd := newRestarts(t)
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+	instance := cmd.instance[0]
+
+	if len(instance.restarts) != 2 {
+		t.Fatalf("expected 2 restarts, got %d:\n%s", len(instance.restarts), output)
+	} else if instance.restarts[0].Previous != restartClean || instance.restarts[1].Previous != restartUnclean {
+		t.Errorf("expected a clean then unclean shutdown, got %+v", instance.restarts)
+	} else if instance.restarts[1].Startup.Revision != 9 {
+		t.Errorf("expected the second restart to be 3.6.9, got %s", instance.restarts[1].Startup.String())
+	}
+
+	if len(instance.windows) != 3 {
+		t.Fatalf("expected 3 uptime windows, got %d", len(instance.windows))
+	}
+	for index, expected := range []restartWindow{
+		{Started: false, Shutdown: true, Clean: true},
+		{Started: true, Shutdown: false},
+		{Started: true, Shutdown: false},
+	} {
+		window := instance.windows[index]
+		if window.Started != expected.Started || window.Shutdown != expected.Shutdown || window.Clean != expected.Clean {
+			t.Errorf("window %d mismatch, got %+v", index, window)
+		}
+	}
+	if duration := instance.windows[1].End.Sub(instance.windows[1].Start); duration.Minutes() != 1 {
+		t.Errorf("the second window should last a minute, got %s", duration)
+	}
+
+	if !strings.Contains(output, "(started before the log)") || !strings.Contains(output, "previous shutdown: unclean") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+	if got := shutdownCode("dbexit:  rc: 14"); got != 14 {
+		t.Errorf("expected exit code 14, got %d", got)
+	}
+}
+
+func TestRestarts_Slowms(t *testing.T) {
+	lines := []string{
+		`2020-05-20T20:00:00.000+0000 I CONTROL  [initandlisten] MongoDB starting : pid=1 port=27017 dbpath=/data/db 64-bit host=localhost`,
+		`2020-05-20T20:00:00.000+0000 I CONTROL  [initandlisten] db version v4.2.6`,
+		`2020-05-20T20:00:00.000+0000 I CONTROL  [initandlisten] options: { net: { bindIp: "127.0.0.1" }, operationProfiling: { slowOpThresholdMs: 200 } }`,
+		`2020-05-20T20:01:00.000+0000 I COMMAND  [conn1] successfully set parameter logLevel to 1 (was 0)`,
+		`2020-05-20T20:02:00.000+0000 I CONTROL  [initandlisten] MongoDB starting : pid=2 port=27017 dbpath=/data/db 64-bit host=localhost`,
+		`2020-05-20T20:02:00.000+0000 I CONTROL  [initandlisten] db version v4.2.6`,
+		`2020-05-20T20:02:00.000+0000 I CONTROL  [initandlisten] options: { net: { bindIp: "127.0.0.1" } }`,
+	}
+
+	cmd := newRestarts(t)
+	output := runCommand(t, cmd, ArgumentCollection{}, lines)
+
+	thresholds := cmd.instance[0].summary.Slowms
+	if len(thresholds) != 2 || thresholds[0].Slowms != 200 || thresholds[1].Slowms != 100 {
+		t.Fatalf("expected slowms 200 then the default of 100, got %+v:\n%s", thresholds, output)
+	}
+	if !strings.Contains(output, "slowms: 200 -> 100") || !strings.Contains(output, "100ms (startup)") {
+		t.Errorf("unexpected output:\n%s", output)
+	}
+}
@@ -0,0 +1,105 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/version"
+	"mgotools/target/formatting"
+)
+
+type rsstate struct {
+	instance map[int]*rsstateInstance
+
+	relative bool
+}
+
+type rsstateInstance struct {
+	summary formatting.Summary
+	events  []rsstateEvent
+}
+
+type rsstateEvent struct {
+	Date    time.Time
+	Message message.Message
+}
+
+func init() {
+	args := Definition{
+		Usage: "output a timeline of replica set heartbeat failures and elections",
+		Flags: []Argument{
+			{Name: "relative-time", Type: Bool, Usage: "output timestamps as seconds since the first entry"},
+		},
+	}
+
+	GetFactory().Register("rsstate", args, func() (Command, error) {
+		return &rsstate{instance: make(map[int]*rsstateInstance)}, nil
+	})
+}
+
+func (r *rsstate) Finish(index int, out commandTarget) error {
+	instance := r.instance[index]
+	writer := bytes.NewBuffer([]byte{})
+
+	instance.summary.Print(writer)
+	writer.WriteRune('\n')
+
+	if len(instance.events) == 0 {
+		writer.WriteString("  no replica set events found\n")
+		out <- writer.String()
+		return nil
+	}
+
+	writer.WriteString("TIMELINE\n")
+
+	for _, event := range instance.events {
+		date := formatting.Timestamp(event.Date, instance.summary.Start, r.relative, internal.DateFormatCtimenoms)
+
+		switch t := event.Message.(type) {
+		case message.HeartbeatFailure:
+			writer.WriteString(fmt.Sprintf("   %s HEARTBEAT FAILED %s: %s\n", date, t.Host, t.Reason))
+		case message.Election:
+			writer.WriteString(fmt.Sprintf("   %s ELECTION %s\n", date, t.Reason))
+		}
+	}
+
+	out <- writer.String()
+	return nil
+}
+
+func (r *rsstate) Prepare(name string, index int, args ArgumentCollection) error {
+	r.instance[index] = &rsstateInstance{summary: formatting.NewSummary(name)}
+	r.relative = args.Booleans["relative-time"]
+
+	return nil
+}
+
+func (r *rsstate) Run(index int, _ commandTarget, in commandSource, errors commandError) error {
+	instance := r.instance[index]
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for base := range in {
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			continue
+		}
+
+		instance.summary.Update(entry)
+
+		switch entry.Message.(type) {
+		case message.HeartbeatFailure, message.Election:
+			instance.events = append(instance.events, rsstateEvent{Date: entry.Date, Message: entry.Message})
+		}
+	}
+
+	return nil
+}
+
+func (r *rsstate) Terminate(commandTarget) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRsstate_HeartbeatFailures(t *testing.T) {
+	lines := []string{
+		`2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9`,
+		`2019-05-01T12:00:05.000+0000 I REPL_HB  [replexec-5] Error in heartbeat (requestId: 45) to host2:27017, response status: NetworkInterfaceExceededTimeLimit: Couldn't get a connection within the time limit`,
+		`2019-05-01T12:00:07.000+0000 I REPL_HB  [replexec-4] Heartbeat to host2:27017 failed after 2 retries, response status: ExceededTimeLimit: Operation timed out`,
+		`2019-05-01T12:00:10.000+0000 I REPL     [replexec-6] Starting an election, since we've seen no PRIMARY in the past 10000ms`,
+	}
+
+	cmd := &rsstate{instance: make(map[int]*rsstateInstance)}
+	output := runCommand(t, cmd, ArgumentCollection{Booleans: map[string]bool{}}, lines)
+
+	if events := cmd.instance[0].events; len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	heartbeat := strings.Index(output, "HEARTBEAT FAILED host2:27017: NetworkInterfaceExceededTimeLimit: Couldn't get a connection within the time limit")
+	retries := strings.Index(output, "HEARTBEAT FAILED host2:27017: ExceededTimeLimit: Operation timed out")
+	election := strings.Index(output, "ELECTION we've seen no PRIMARY in the past 10000ms")
+
+	if heartbeat < 0 || retries < 0 || election < 0 {
+		t.Errorf("timeline is missing events, got:\n%s", output)
+	} else if heartbeat > election || retries > election {
+		t.Errorf("heartbeat failures should precede the election, got:\n%s", output)
+	}
+}
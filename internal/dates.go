@@ -1,6 +1,9 @@
 package internal
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 	"unicode"
@@ -160,3 +163,86 @@ func IsTime(match string) bool {
 		return false
 	}
 }
+
+// Parses a time zone given as a name (e.g. UTC, Local, or America/New_York)
+// or as a fixed offset from UTC (e.g. -0500, +05:30, or +5).
+func ParseTimezone(value string) (*time.Location, error) {
+	offset, err := GetRegexRegistry().Compile(`^([+-])(\d{1,2})(?::?(\d{2}))?$`)
+	if err != nil {
+		return nil, err
+	}
+
+	if match := offset.FindStringSubmatch(value); match != nil {
+		hours, _ := strconv.Atoi(match[2])
+		minutes := 0
+		if match[3] != "" {
+			minutes, _ = strconv.Atoi(match[3])
+		}
+		if hours > 14 || minutes > 59 {
+			return nil, fmt.Errorf("invalid time zone offset '%s'", value)
+		}
+
+		seconds := hours*3600 + minutes*60
+		if match[1] == "-" {
+			seconds = -seconds
+		}
+		return time.FixedZone(value, seconds), nil
+	}
+
+	zone, err := time.LoadLocation(value)
+	if err != nil || value == "" {
+		return nil, fmt.Errorf("unrecognized time zone '%s'", value)
+	}
+	return zone, nil
+}
+
+// Converts a date to a time zone for display. Dates in a ctime format (2.4
+// and older) are parsed without a time zone, so they are taken to be in local
+// time before being converted.
+func DateInZone(date time.Time, format DateFormat, zone *time.Location) time.Time {
+	switch format {
+	case DateFormatCtime, DateFormatCtimenoms, DateFormatCtimeyear:
+		date = time.Date(date.Year(), date.Month(), date.Day(), date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), time.Local)
+	}
+	return date.In(zone)
+}
+
+// Date layouts accepted as a bound of a date range, from most to least
+// precise. Layouts without an offset are taken to be in local time.
+var dateBoundLayouts = []string{
+	string(DateFormatIso8602Utc),
+	string(DateFormatIso8602Local),
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Parses a bound of a date range given either as an ISO8601 date (e.g.
+// 2019-01-01T12:00:00Z or 2019-01-01) or as a duration relative to now (e.g.
+// -2h, -90m, or -1d).
+func ParseDateBound(value string, now time.Time) (time.Time, error) {
+	if len(value) > 1 && (value[0] == '-' || value[0] == '+') {
+		duration, err := time.ParseDuration(value[1:])
+		if days, dayErr := strconv.Atoi(strings.TrimSuffix(value[1:], "d")); err != nil && dayErr == nil {
+			// Durations do not accept days, which are convenient for logs.
+			duration, err = time.Duration(days)*24*time.Hour, nil
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unrecognized relative date '%s'", value)
+		} else if value[0] == '-' {
+			duration = -duration
+		}
+		return now.Add(duration), nil
+	}
+
+	for _, layout := range dateBoundLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date '%s'", value)
+}
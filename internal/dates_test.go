@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimezone(t *testing.T) {
+	for value, offset := range map[string]int{
+		"UTC":    0,
+		"-0500":  -5 * 3600,
+		"+05:30": 5*3600 + 30*60,
+		"+5":     5 * 3600,
+	} {
+		zone, err := ParseTimezone(value)
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", value, err)
+			continue
+		}
+		if _, got := time.Date(2018, 1, 16, 0, 0, 0, 0, zone).Zone(); got != offset {
+			t.Errorf("'%s' should be %d seconds from UTC, got %d", value, offset, got)
+		}
+	}
+
+	for _, value := range []string{"", "+25", "-05:75", "Mars/Olympus_Mons"} {
+		if _, err := ParseTimezone(value); err == nil {
+			t.Errorf("expected an error parsing '%s'", value)
+		}
+	}
+}
+
+func TestDateInZone(t *testing.T) {
+	date, format, err := DefaultDateParser.Clone().Parse("2018-01-16T15:00:41.759-0800")
+	if err != nil {
+		t.Fatalf("unexpected error parsing date (%s)", err)
+	}
+
+	zone, _ := ParseTimezone("+05:30")
+	if got := DateInZone(date, format, zone).Format(string(DateFormatIso8602Local)); got != "2018-01-17T04:30:41.759+0530" {
+		t.Errorf("expected the date at +05:30, got %s", got)
+	}
+	if got := DateInZone(date, format, time.UTC).Format(string(DateFormatIso8602Utc)); got != "2018-01-16T23:00:41.759Z" {
+		t.Errorf("expected the date in UTC, got %s", got)
+	}
+
+	// Ctime dates have no time zone and are taken to be local time.
+	date, format, _ = DefaultDateParser.Clone().Parse("Tue Jan 16 15:00:41.759")
+	local := time.Date(date.Year(), time.January, 16, 15, 0, 41, 759000000, time.Local)
+	if got := DateInZone(date, format, time.UTC); !got.Equal(local) || got.Location() != time.UTC {
+		t.Errorf("expected %s in UTC, got %s", local.UTC(), got)
+	}
+}
+
+func TestParseDateBound(t *testing.T) {
+	now := time.Date(2018, 1, 16, 15, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"-2h":                          now.Add(-2 * time.Hour),
+		"-90m":                         now.Add(-90 * time.Minute),
+		"+30s":                         now.Add(30 * time.Second),
+		"-1d":                          now.Add(-24 * time.Hour),
+		"2018-01-16T12:00:00Z":         time.Date(2018, 1, 16, 12, 0, 0, 0, time.UTC),
+		"2018-01-16T12:00:00.500-0800": time.Date(2018, 1, 16, 20, 0, 0, 500000000, time.UTC),
+		"2018-01-16T12:00:00+05:30":    time.Date(2018, 1, 16, 6, 30, 0, 0, time.UTC),
+		"2018-01-16T12:00":             time.Date(2018, 1, 16, 12, 0, 0, 0, time.Local),
+		"2018-01-16":                   time.Date(2018, 1, 16, 0, 0, 0, 0, time.Local),
+	} {
+		date, err := ParseDateBound(value, now)
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", value, err)
+		} else if !date.Equal(expected) {
+			t.Errorf("'%s' should be %s, got %s", value, expected, date)
+		}
+	}
+
+	for _, value := range []string{"", "-", "-2x", "yesterday", "2018-13-01"} {
+		if _, err := ParseDateBound(value, now); err == nil {
+			t.Errorf("expected an error parsing '%s'", value)
+		}
+	}
+}
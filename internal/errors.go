@@ -5,11 +5,13 @@ import "errors"
 /*
  * General purpose formatting errors.
  */
+var AccessUnrecognized = VersionUnmatched{"unrecognized access message"}
 var CommandNotFound = errors.New("command not found")
 var CommandStructure = errors.New("command structure unexpected")
 var ComponentUnmatched = errors.New("component unmatched")
 var ControlUnrecognized = VersionUnmatched{Message: "unrecognized control message"}
 var CounterUnrecognized = VersionUnmatched{Message: "unrecognized counter"}
+var IndexUnrecognized = VersionUnmatched{"unrecognized index message"}
 var MetadataUnmatched = VersionUnmatched{"unexpected connection meta format"}
 var MisplacedWordException = VersionUnmatched{"unexpected or misplaced word"}
 var NetworkUnrecognized = VersionUnmatched{"unrecognized network message"}
@@ -18,6 +20,8 @@ var NoPlanSummaryFound = errors.New("no plan summary found")
 var NoStartupArgumentsFound = errors.New("no startup arguments found")
 var OperationStructure = errors.New("operation structure unexpected")
 var Overflow = errors.New("type overflow")
+var ReplicationUnrecognized = VersionUnmatched{"unrecognized replication message"}
+var ShardingUnrecognized = VersionUnmatched{"unrecognized sharding message"}
 var StorageUnmatched = VersionUnmatched{"unrecognized storage option"}
 var UnexpectedExceptionFormat = errors.New("error parsing exception")
 var UnexpectedEOL = errors.New("unexpected end of line")
@@ -97,7 +97,8 @@ func (r *RuneReader) EnclosedString(which rune, snip bool) (string, error) {
 	for end := start + 1; end < length; end++ {
 		switch r.runes[end] {
 		case '\\':
-			escaped = true
+			// An escaped backslash does not escape the character after it.
+			escaped = !escaped
 			continue
 		case which:
 			if !escaped {
@@ -191,6 +192,25 @@ func (r *RuneReader) Peek(length int) string {
 	return string(r.runes[r.next : r.next+length])
 }
 
+// PeekWord() returns the next word exactly as SlurpWord would, but without
+// moving the _start_ or _end_ pointers. It saves slurping a word only to
+// rewind it when the word belongs to whatever parses next.
+func (r *RuneReader) PeekWord() (string, bool) {
+	start, next := r.start, r.next
+	word, ok := r.SlurpWord()
+	r.start, r.next = start, next
+	return word, ok
+}
+
+// PeekWordN(_count_) returns up to _count_ words exactly as MultiSlurpWord
+// would, but without moving the _start_ or _end_ pointers.
+func (r *RuneReader) PeekWordN(count int) []string {
+	start, next := r.start, r.next
+	words := r.MultiSlurpWord(count)
+	r.start, r.next = start, next
+	return words
+}
+
 // Pos() returns the current position of the _end_ pointer in the rune set.
 func (r *RuneReader) Pos() int {
 	return r.next
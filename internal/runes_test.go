@@ -258,6 +258,39 @@ func TestRuneReader_Peek(t *testing.T) {
 	}
 }
 
+func TestRuneReader_PeekWord(t *testing.T) {
+	r := internal.NewRuneReader("abc  def ghi")
+	if word, ok := r.PeekWord(); !ok || word != "abc" {
+		t.Errorf("Expected 'abc', got '%s'", word)
+	} else if word, ok := r.PeekWord(); !ok || word != "abc" {
+		t.Errorf("PeekWord advanced the reader, got '%s'", word)
+	}
+	r.SlurpWord()
+	if word, ok := r.PeekWord(); !ok || word != "def" {
+		t.Errorf("Expected 'def', got '%s'", word)
+	} else if word, _ := r.SlurpWord(); word != "def" {
+		t.Errorf("Expected SlurpWord to return the peeked word, got '%s'", word)
+	}
+	if words := r.PeekWordN(3); len(words) != 1 || words[0] != "ghi" {
+		t.Errorf("Expected [ghi], got %v", words)
+	}
+	r.SlurpWord()
+	if pos := r.Pos(); pos < r.Length() {
+		t.Errorf("Expected the end, got position %d", pos)
+	} else if word, ok := r.PeekWord(); ok || word != "" {
+		t.Errorf("Expected nothing at the end, got '%s'", word)
+	} else if r.Pos() != pos {
+		t.Error("PeekWord at the end moved the reader")
+	}
+
+	r = internal.NewRuneReader("a { x: 1 } b")
+	if words := r.PeekWordN(4); strings.Join(words, " ") != "a { x: 1" {
+		t.Errorf("Expected [a { x: 1], got %v", words)
+	} else if r.Pos() != 0 {
+		t.Errorf("PeekWordN advanced the reader to %d", r.Pos())
+	}
+}
+
 func TestRuneReader_Prefix(t *testing.T) {
 	r := internal.NewRuneReader("abcd")
 	if r.Prefix(1) != "a" {
@@ -297,6 +330,7 @@ func TestRuneReader_QuotedString(t *testing.T) {
 		"'quoted string'":                  "quoted string",
 		"\"quoted string\"":                "quoted string",
 		"\"quotes \\\"within\\\" quotes\"": "quotes \\\"within\\\" quotes",
+		"\"backslash\\\\\" suffix":         "backslash\\\\",
 	}
 	for d := range s {
 		r := internal.NewRuneReader(d)
@@ -9,13 +9,17 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
-
-	_ "mgotools/parser"
+	"strconv"
+	"strings"
+	"time"
 
 	"mgotools/command"
 	"mgotools/internal"
+	"mgotools/parser"
 	"mgotools/parser/source"
 
 	"github.com/urfave/cli"
@@ -32,6 +36,12 @@ func main() {
 
 	app.Flags = []cli.Flag{
 		//cli.BoolFlag{Name: "linear, e", Usage: "parse input files linearly in order they are supplied (disable concurrency)"},
+		cli.BoolFlag{Name: "follow, f", Usage: "keep reading log files as they grow until interrupted (like tail -f)"},
+		cli.BoolFlag{Name: "lenient", Usage: "accept unrecognized numeric fields instead of skipping the line"},
+		cli.BoolFlag{Name: "merge, m", Usage: "merge all log files into a single log ordered by date (e.g. rotated logs)"},
+		cli.BoolFlag{Name: "mmap", Usage: "read uncompressed log files mapped into memory (ignored with --follow)"},
+		cli.StringFlag{Name: "since", Usage: "ignore entries before `DATE` (ISO8601 or relative to now, e.g. -2h)"},
+		cli.StringFlag{Name: "until", Usage: "ignore entries at or after `DATE` (ISO8601 or relative to now, e.g. -30m)"},
 		cli.BoolFlag{Name: "verbose, v", Usage: "outputs additional information about the parser"},
 	}
 	cli.VersionFlag = cli.BoolFlag{Name: "version, V"}
@@ -58,10 +68,8 @@ func checkClientCommands(context *cli.Context, count int, def command.Definition
 
 func makeClientFlags() []cli.Command {
 	var c []cli.Command
-	commandFactory := command.GetFactory()
-	for _, commandName := range commandFactory.GetNames() {
-		cmd, _ := commandFactory.GetDefinition(commandName)
-		clientCommand := cli.Command{Name: commandName, Action: runCommand, Usage: cmd.Usage}
+	for _, cmd := range command.GetFactory().List() {
+		clientCommand := cli.Command{Name: cmd.Name, Action: runCommand, Usage: cmd.Usage}
 		for _, argument := range cmd.Flags {
 			if argument.ShortName != "" {
 				argument.Name = fmt.Sprintf("%s, %s", argument.Name, argument.ShortName)
@@ -71,6 +79,8 @@ func makeClientFlags() []cli.Command {
 				clientCommand.Flags = append(clientCommand.Flags, cli.BoolFlag{Name: argument.Name, Usage: argument.Usage})
 			case command.Int:
 				clientCommand.Flags = append(clientCommand.Flags, cli.IntFlag{Name: argument.Name, Usage: argument.Usage})
+			case command.OptionalInt:
+				clientCommand.Flags = append(clientCommand.Flags, cli.GenericFlag{Name: argument.Name, Usage: argument.Usage, Value: &optionalInt{}})
 			case command.IntSourceSlice:
 				clientCommand.Flags = append(clientCommand.Flags, cli.IntSliceFlag{Name: argument.Name, Usage: argument.Usage})
 			case command.StringSourceSlice, command.String:
@@ -101,6 +111,8 @@ func runCommand(c *cli.Context) error {
 			return err
 		}
 
+		parser.Lenient = c.GlobalBool("lenient")
+
 		// Get argument count.
 		argc := c.NArg()
 		fileCount := 0
@@ -124,7 +136,7 @@ func runCommand(c *cli.Context) error {
 			}
 
 			fileCount = 1
-			stdio, err := source.NewLog(os.Stdin)
+			stdio, err := source.NewJSONLog(os.Stdin)
 
 			input = append(input, command.Input{
 				Arguments: args,
@@ -134,11 +146,55 @@ func runCommand(c *cli.Context) error {
 			})
 		}
 
+		if cmdDefinition.LineArguments && argc > 0 {
+			// Treat every argument as a line of a single log.
+			args, err := command.MakeCommandArgumentCollection(0, getArgumentMap(cmdDefinition, c), cmdDefinition)
+			if err != nil {
+				return err
+			}
+
+			lines, err := source.NewJSONLog(ioutil.NopCloser(strings.NewReader(strings.Join(clientContext, "\n"))))
+			if err != nil {
+				return err
+			}
+
+			fileCount, argc = 1, 0
+			input = append(input, command.Input{
+				Arguments: args,
+				Name:      "arguments",
+				Length:    int64(0),
+				Reader:    source.NewAccumulator(lines),
+			})
+		}
+
 		// Loop through each argument and add files to the command.
 		for index := 0; index < argc; index += 1 {
 			path := clientContext.Get(index)
 			size := int64(0)
 
+			if _, err := os.Stat(path); os.IsNotExist(err) && strings.ContainsAny(path, "*?[") {
+				// A glob the shell left alone (e.g. quoted) names a log and
+				// its rotated files, which are read as a single input.
+				if c.GlobalBool("follow") {
+					return fmt.Errorf("%s cannot be followed", path)
+				}
+
+				args, err := command.MakeCommandArgumentCollection(index, getArgumentMap(cmdDefinition, c), cmdDefinition)
+				if err != nil {
+					return err
+				}
+
+				rotation, err := globInput(path)
+				if err != nil {
+					return err
+				}
+
+				rotation.Arguments = args
+				fileCount += 1
+				input = append(input, rotation)
+				continue
+			}
+
 			if s, err := os.Stat(path); os.IsNotExist(err) {
 				internal.Debug("%s skipped (%s)", path, err)
 				continue
@@ -157,9 +213,20 @@ func runCommand(c *cli.Context) error {
 				return err
 			}
 
-			logfile, err := source.NewLog(file)
-			if err != nil {
+			var reader source.Factory
+			if c.GlobalBool("mmap") && !c.GlobalBool("follow") {
+				// Mapped logs join multi-line entries themselves, so the
+				// accumulator would only copy the file a second time.
+				if reader, err = source.NewMappedJSONLog(file); err != nil {
+					return err
+				}
+			} else if logfile, err := source.NewJSONLog(file); err != nil {
 				return err
+			} else {
+				if c.GlobalBool("follow") {
+					logfile.Follow(followInterval)
+				}
+				reader = source.NewAccumulator(logfile)
 			}
 
 			fileCount += 1
@@ -167,15 +234,29 @@ func runCommand(c *cli.Context) error {
 				Arguments: args,
 				Name:      filepath.Base(path),
 				Length:    size,
-				Reader:    source.NewAccumulator(logfile),
+				Reader:    reader,
 			})
 		}
 
+		if c.GlobalBool("merge") && len(input) > 1 {
+			input, fileCount = []command.Input{mergeInputs(input)}, 1
+		}
+
+		if since, until := c.GlobalString("since"), c.GlobalString("until"); since != "" || until != "" {
+			if err := windowInputs(input, since, until); err != nil {
+				return err
+			}
+		}
+
 		// Check for basic command sanity.
 		if err := checkClientCommands(c, fileCount, cmdDefinition); err != nil {
 			return err
 		}
 
+		if c.GlobalBool("follow") {
+			closeOnInterrupt(input)
+		}
+
 		// Run the actual command.
 		if err := command.RunCommand(cmd, input, output); err != nil {
 			return err
@@ -186,6 +267,104 @@ func runCommand(c *cli.Context) error {
 	}
 }
 
+// Reads every file matching a glob in rotation order as a single input. Files
+// that cannot be read are skipped with a warning.
+func globInput(pattern string) (command.Input, error) {
+	paths, err := source.RotationGlob(pattern)
+	if err != nil {
+		return command.Input{}, fmt.Errorf("invalid glob %s (%s)", pattern, err)
+	} else if len(paths) == 0 {
+		return command.Input{}, fmt.Errorf("no files match %s", pattern)
+	}
+
+	length := int64(0)
+	for _, path := range paths {
+		if s, err := os.Stat(path); err == nil {
+			length += s.Size()
+		}
+	}
+
+	warn := func(path string, err error) {
+		fmt.Fprintf(os.Stderr, "%s skipped (%s)\n", path, err)
+	}
+
+	return command.Input{
+		Name:   filepath.Base(pattern),
+		Length: length,
+		Reader: source.NewRotation(paths, warn),
+	}, nil
+}
+
+// Combines several inputs into one that reads every log in date order. The
+// arguments of the first input apply to the merged log.
+func mergeInputs(input []command.Input) command.Input {
+	var (
+		names   = make([]string, len(input))
+		readers = make([]source.Factory, len(input))
+		length  = int64(0)
+	)
+	for index, in := range input {
+		names[index] = in.Name
+		readers[index] = in.Reader
+		length += in.Length
+	}
+
+	return command.Input{
+		Arguments: input[0].Arguments,
+		Name:      strings.Join(names, ", "),
+		Length:    length,
+		Reader:    source.NewMerge(readers...),
+	}
+}
+
+// Limits every input to the entries dated within a window. Either end of the
+// window may be empty to leave it open.
+func windowInputs(input []command.Input, since, until string) error {
+	var (
+		now   = time.Now()
+		start time.Time
+		end   time.Time
+		err   error
+	)
+	if since != "" {
+		if start, err = internal.ParseDateBound(since, now); err != nil {
+			return fmt.Errorf("--since: %s", err)
+		}
+	}
+	if until != "" {
+		if end, err = internal.ParseDateBound(until, now); err != nil {
+			return fmt.Errorf("--until: %s", err)
+		}
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return errors.New("--since must be before --until")
+	}
+
+	for index := range input {
+		input[index].Reader = source.NewWindow(input[index].Reader, start, end)
+	}
+	return nil
+}
+
+// How often a followed log is checked for new lines.
+const followInterval = 250 * time.Millisecond
+
+// Followed logs never end on their own, so an interrupt closes every input
+// instead of exiting. Each command then finishes and outputs its results.
+func closeOnInterrupt(input []command.Input) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	go func() {
+		<-signals
+		signal.Stop(signals)
+
+		for _, in := range input {
+			in.Reader.Close()
+		}
+	}()
+}
+
 func getArgumentMap(commandDefinition command.Definition, c *cli.Context) map[string]interface{} {
 	out := make(map[string]interface{})
 	for _, arg := range commandDefinition.Flags {
@@ -195,6 +374,10 @@ func getArgumentMap(commandDefinition command.Definition, c *cli.Context) map[st
 				out[arg.Name] = c.Bool(arg.Name)
 			case command.Int:
 				out[arg.Name] = c.Int(arg.Name)
+			case command.OptionalInt:
+				if value, ok := c.Generic(arg.Name).(*optionalInt); ok && value.enabled {
+					out[arg.Name] = value.value
+				}
 			case command.IntSourceSlice:
 				out[arg.Name] = c.IntSlice(arg.Name)
 			case command.String, command.StringSourceSlice:
@@ -204,3 +387,37 @@ func getArgumentMap(commandDefinition command.Definition, c *cli.Context) map[st
 	}
 	return out
 }
+
+// An integer flag that may be given without a value. Implementing
+// IsBoolFlag allows the flag package to accept a bare "--flag".
+type optionalInt struct {
+	enabled bool
+	value   int
+}
+
+func (o *optionalInt) IsBoolFlag() bool {
+	return true
+}
+
+func (o *optionalInt) Set(value string) error {
+	switch value {
+	case "true":
+		o.enabled, o.value = true, 0
+	case "false":
+		o.enabled, o.value = false, 0
+	default:
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return fmt.Errorf("expected a positive integer, got '%s'", value)
+		}
+		o.enabled, o.value = true, number
+	}
+	return nil
+}
+
+func (o *optionalInt) String() string {
+	if !o.enabled {
+		return ""
+	}
+	return strconv.Itoa(o.value)
+}
@@ -0,0 +1,64 @@
+package mongo
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Extended converts a value parsed from a log into one that encoding/json
+// writes as the relaxed extended JSON of structured (4.4+) logs, e.g. an
+// ObjectId as {"$oid": "..."}. ParseJson reads every form back.
+func Extended(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(t))
+		for key, item := range t {
+			object[key] = Extended(item)
+		}
+		return object
+	case OrderedObject:
+		return Extended(t.Map())
+	case []interface{}:
+		array := make([]interface{}, len(t))
+		for index, item := range t {
+			array[index] = Extended(item)
+		}
+		return array
+	case float64:
+		// JSON has no literal for these.
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return Object{"$numberDouble": strconv.FormatFloat(t, 'g', -1, 64)}
+		}
+		return t
+	case time.Time:
+		return Object{"$date": t.Format("2006-01-02T15:04:05.000Z07:00")}
+	case ObjectId:
+		return Object{"$oid": hex.EncodeToString(t[:])}
+	case Binary:
+		return Object{"$binary": Object{"base64": base64.StdEncoding.EncodeToString(t.Data), "subType": fmt.Sprintf("%02x", t.Subtype)}}
+	case Decimal128:
+		return Object{"$numberDecimal": t.String()}
+	case Regex:
+		return Object{"$regex": t.Regex, "$options": t.Options}
+	case Timestamp:
+		return Object{"$timestamp": Object{"t": t.T, "i": t.I}}
+	case DBRef:
+		ref := Object{"$ref": t.Collection, "$id": Extended(t.Id)}
+		if t.Database != "" {
+			ref["$db"] = t.Database
+		}
+		return ref
+	case MinKey:
+		return Object{"$minKey": 1}
+	case MaxKey:
+		return Object{"$maxKey": 1}
+	case Undefined:
+		return Object{"$undefined": true}
+	default:
+		return value
+	}
+}
@@ -7,6 +7,7 @@
 package mongo
 
 import (
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"math"
@@ -14,6 +15,7 @@ import (
 	"strings"
 	"time"
 	"unicode"
+	"unicode/utf16"
 
 	"mgotools/internal"
 )
@@ -24,11 +26,99 @@ func ParseJson(json string, strict bool) (map[string]interface{}, error) {
 	return ParseJsonRunes(internal.NewRuneReader(json), strict)
 }
 
+// Parses an object the same way as ParseJson but keeps the order of keys in
+// the object and each object nested within it.
+func ParseJsonOrdered(json string, strict bool) (OrderedObject, error) {
+	r := internal.NewRuneReader(json)
+	if r.Length() < 2 {
+		return nil, fmt.Errorf("json must contain at least two characters")
+	}
+	v, keys, e := parseJson(r.ChompWS(), strict, true)
+	if e != nil {
+		return nil, e
+	} else if strict && !r.EOL() {
+		return nil, fmt.Errorf("unexpected character '%c' at %d", r.NextRune(), r.Pos())
+	}
+	return newOrderedObject(keys, v), nil
+}
+
+// The most cuts ParseJsonTruncated tries, since each attempt parses the object
+// again and a long line that cannot be parsed would otherwise take quadratic
+// time.
+const truncatedAttempts = 16
+
+// Parses the beginning of an object that was cut short, e.g. a payload the
+// server truncated because it was too large to log. The object is closed
+// after the last complete value, dropping any value that was cut in half, so
+// the result holds only what was logged in full.
+func ParseJsonTruncated(json string) (map[string]interface{}, error) {
+	var (
+		runes  = []rune(json)
+		stack  []rune
+		quote  rune
+		escape bool
+
+		// Offsets the object can be cut at and the brackets left open at each.
+		cuts    []int
+		closers []string
+	)
+
+	cut := func(offset int) {
+		closing := make([]rune, len(stack))
+		for index, open := range stack {
+			if open == '{' {
+				closing[len(stack)-index-1] = '}'
+			} else {
+				closing[len(stack)-index-1] = ']'
+			}
+		}
+		cuts, closers = append(cuts, offset), append(closers, string(closing))
+	}
+
+	for offset, c := range runes {
+		switch {
+		case escape:
+			escape = false
+		case quote != 0:
+			if c == '\\' {
+				escape = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{' || c == '[':
+			stack = append(stack, c)
+			cut(offset + 1)
+		case (c == '}' || c == ']') && len(stack) > 0:
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				cut(offset + 1)
+			}
+		case c == ',' && len(stack) > 0:
+			cut(offset)
+		}
+	}
+
+	if len(cuts) == 0 || runes[0] != '{' {
+		return nil, fmt.Errorf("expected a truncated object")
+	}
+
+	// Values that only look complete (e.g. a bracket within a regex) fail to
+	// parse, so earlier cuts are tried until one succeeds (or too many fail).
+	for index := len(cuts) - 1; index >= 0 && index >= len(cuts)-truncatedAttempts; index -= 1 {
+		if value, err := ParseJson(string(runes[:cuts[index]])+closers[index], false); err == nil {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("no complete values in truncated object")
+}
+
 func ParseJsonRunes(r *internal.RuneReader, strict bool) (map[string]interface{}, error) {
 	if r.Length() < 2 {
 		return nil, fmt.Errorf("json must contain at least two characters")
 	}
-	v, e := parseJson(r.ChompWS(), strict)
+	v, _, e := parseJson(r.ChompWS(), strict, false)
 	if strict && !r.EOL() {
 		return nil, fmt.Errorf("unexpected character '%c' at %d", r.NextRune(), r.Pos())
 	}
@@ -36,10 +126,15 @@ func ParseJsonRunes(r *internal.RuneReader, strict bool) (map[string]interface{}
 	return v, e
 }
 
-func parseJson(r *internal.RuneReader, strict bool) (map[string]interface{}, error) {
-	var data = make(map[string]interface{})
+// Parses an object into a map. The order of the keys is only kept (and
+// nested objects are only returned as an OrderedObject) if ordered is set.
+func parseJson(r *internal.RuneReader, strict, ordered bool) (map[string]interface{}, []string, error) {
+	var (
+		data = make(map[string]interface{})
+		keys []string
+	)
 	if current := r.NextRune(); current != '{' {
-		return nil, fmt.Errorf("expected '{' but found '%c'", current)
+		return nil, nil, fmt.Errorf("expected '{' but found '%c'", current)
 	} else {
 		r.Skip(1)
 	}
@@ -47,7 +142,7 @@ func parseJson(r *internal.RuneReader, strict bool) (map[string]interface{}, err
 		// Skip empty whitespaces.
 		if r.ChompWS().EOL() {
 			// End parsing when end of string reached.
-			return nil, fmt.Errorf("unexpected end of string")
+			return nil, nil, fmt.Errorf("unexpected end of string")
 		}
 		keyOffset := r.Pos()
 		current := r.NextRune()
@@ -55,15 +150,15 @@ func parseJson(r *internal.RuneReader, strict bool) (map[string]interface{}, err
 			// End parsing and return data when closing character found.
 			r.Skip(1)
 			r.ChompWS()
-			return data, nil
+			return data, keys, nil
 		} else if key, err := parseKey(r, strict); err != nil {
-			return nil, err
+			return nil, nil, err
 		} else if size := len(key); unicode.IsPunct(rune(key[size-1])) {
-			return nil, fmt.Errorf("unexpected character '%c' at %d", key[size-1], size)
+			return nil, nil, fmt.Errorf("unexpected character '%c' at %d", key[size-1], size)
 		} else {
 			// Skip empty white spaces before the colon.
 			if r.ChompWS().NextRune() != ':' {
-				return nil, fmt.Errorf("unexpected character '%c' at %d", r.NextRune(), r.Pos())
+				return nil, nil, fmt.Errorf("unexpected character '%c' at %d", r.NextRune(), r.Pos())
 			} else {
 				r.Next()
 				r.ChompWS()
@@ -72,8 +167,11 @@ func parseJson(r *internal.RuneReader, strict bool) (map[string]interface{}, err
 			// Keep the value offset in case changes must be made to the value
 			// (like in cases where there's an unescaped string).
 			valueOffset := r.Pos()
-			if data[key], err = parseValue(r, strict); err != nil {
-				return nil, err
+			if _, ok := data[key]; ordered && !ok {
+				keys = append(keys, key)
+			}
+			if data[key], err = parseValue(r, strict, ordered); err != nil {
+				return nil, nil, err
 			}
 			if r.ChompWS().NextRune() == ',' {
 				r.Skip(1)
@@ -81,19 +179,21 @@ func parseJson(r *internal.RuneReader, strict bool) (map[string]interface{}, err
 			} else if r.NextRune() == '}' {
 				r.Skip(1)
 				r.ChompWS()
-				return data, nil
+				return data, keys, nil
 			} else if !strict && !r.EOL() {
 				// This section exists to handle unquoted string characters.
 				if _, ok := data[key].(string); ok {
 					r.Seek(valueOffset, 0)
-					if s, err := r.QuotedString(); err == nil && s == data[key] {
-						r.Insert('\\', valueOffset+len(s)+1)
-						r.Seek(keyOffset, 0)
-						continue
+					if s, err := r.QuotedString(); err == nil {
+						if value, err := unescapeString(s); err == nil && value == data[key] {
+							r.Insert('\\', valueOffset+len(s)+1)
+							r.Seek(keyOffset, 0)
+							continue
+						}
 					}
 				}
 			}
-			return nil, fmt.Errorf("unexpected character '%c' after value at %d", r.NextRune(), r.Pos())
+			return nil, nil, fmt.Errorf("unexpected character '%c' after value at %d", r.NextRune(), r.Pos())
 		}
 	}
 }
@@ -125,7 +225,7 @@ func checkRune(r rune, a ...interface{}) bool {
 	return false
 }
 
-func parseArray(r *internal.RuneReader, strict bool) ([]interface{}, error) {
+func parseArray(r *internal.RuneReader, strict, ordered bool) ([]interface{}, error) {
 	var (
 		c      rune
 		ok     bool = true
@@ -140,7 +240,7 @@ func parseArray(r *internal.RuneReader, strict bool) ([]interface{}, error) {
 		return values, nil
 	}
 	for c = ','; ok && c == ','; c, ok = r.Next() {
-		if next, err := parseValue(r.ChompWS(), strict); err != nil {
+		if next, err := parseValue(r.ChompWS(), strict, ordered); err != nil {
 			return nil, err
 		} else {
 			values = append(values, next)
@@ -162,7 +262,7 @@ func parseKey(r *internal.RuneReader, strict bool) (string, error) {
 	case ',':
 		return "", fmt.Errorf("unexpected character ',' at %d", r.Pos())
 	case '"':
-		if key, err = r.QuotedString(); err != nil {
+		if key, err = parseString(r); err != nil {
 			return "", err
 		}
 		if strict {
@@ -205,25 +305,38 @@ func parseKey(r *internal.RuneReader, strict bool) (string, error) {
 
 // https://docs.mongodb.com/manual/reference/limits/
 // https://github.com/mongodb/mongo/blob/master/src/mongo/bson/json.cpp
-func parseValue(r *internal.RuneReader, strict bool) (interface{}, error) {
+func parseValue(r *internal.RuneReader, strict, ordered bool) (interface{}, error) {
 	var (
 		err   error
 		value interface{}
 	)
 	switch c := r.NextRune(); {
 	case c == '{': // Object
-		if value, err = parseJson(r, strict); err != nil {
-			value = parseDataType(value.(map[string]interface{}))
+		var (
+			object map[string]interface{}
+			keys   []string
+		)
+		if object, keys, err = parseJson(r, strict, ordered); err != nil {
+			return nil, err
+		} else if !ordered {
+			value, err = parseDataType(object)
+		} else if value = newOrderedObject(keys, object); len(keys) > 0 && len(keys) < 4 && strings.HasPrefix(keys[0], "$") {
+			// Extended data types expect nested objects as maps.
+			if converted, err := parseDataType(value.(OrderedObject).Map()); err != nil {
+				return nil, err
+			} else if _, ok := converted.(map[string]interface{}); !ok {
+				value = converted
+			}
 		}
 	case c == '[': // Array
-		value, err = parseArray(r, strict)
+		value, err = parseArray(r, strict, ordered)
 	case c == '\'': // Single quoted string
 		if strict {
 			return nil, fmt.Errorf("unexpected character '%c' not allowed in strict mode at %d", c, r.Pos())
 		}
 		fallthrough
 	case c == '"': // Double quoted string
-		value, err = r.QuotedString()
+		value, err = parseString(r)
 	case c == '/': // Regular expression
 		if value, err = r.EnclosedString('/', true); err != nil {
 			return "", err
@@ -254,20 +367,38 @@ func parseValue(r *internal.RuneReader, strict bool) (interface{}, error) {
 			value = Undefined{}
 		default:
 			length := internal.StringLength(word)
-			if length == 5 && word[:5] == "dbref" {
-				r.Prev()
+			if length > 6 && word[:6] == "dbref(" {
+				if strict {
+					return nil, fmt.Errorf("unexpected DBRef() not allowed in strict mode at %d", r.Pos())
+				}
+				r.RewindSlurpWord()
 				value, err = parseDbRef(r)
 			} else if length == 3 && word == "new" {
 				value, err = parseDate(r)
 			} else if length == 36 && word[:8] == "objectid" {
 				value, err = parseObjectId(word, strict)
+			} else if length > 11 && word[:11] == "numberlong(" {
+				if strict {
+					return nil, fmt.Errorf("unexpected NumberLong() not allowed in strict mode at %d", r.Pos())
+				}
+				r.RewindSlurpWord()
+				value, err = parseNumberLong(r)
+			} else if length > 8 && word[:8] == "isodate(" {
+				if strict {
+					return nil, fmt.Errorf("unexpected ISODate() not allowed in strict mode at %d", r.Pos())
+				}
+				r.RewindSlurpWord()
+				value, err = parseDate(r)
 			} else if length > 4 && word[:4] == "uuid" {
 				r.RewindSlurpWord()
 				value, err = parseUuid(r)
 			} else if length > 7 && word[:7] == "bindata" {
 				r.RewindSlurpWord()
 				value, err = parseBinData(r)
-			} else if length > 11 && word[:9] == "timestamp" {
+			} else if length > 10 && word[:10] == "timestamp(" {
+				if strict {
+					return nil, fmt.Errorf("unexpected Timestamp() not allowed in strict mode at %d", r.Pos())
+				}
 				r.RewindSlurpWord()
 				value, err = parseTimestamp(r)
 			} else {
@@ -284,10 +415,91 @@ func parseValue(r *internal.RuneReader, strict bool) (interface{}, error) {
 	return value, err
 }
 
-func parseBinData(r *internal.RuneReader) (BinData, error) {
+func parseString(r *internal.RuneReader) (string, error) {
+	if s, err := r.QuotedString(); err != nil {
+		return "", err
+	} else {
+		return unescapeString(s)
+	}
+}
+
+// Decodes the escape sequences of a quoted string, including \uXXXX escapes
+// and UTF-16 surrogate pairs for characters outside the BMP. Unpaired
+// surrogates become the replacement character and unknown escapes are kept
+// as they are.
+func unescapeString(s string) (string, error) {
+	if !strings.ContainsRune(s, '\\') {
+		return s, nil
+	}
+
+	var (
+		out   = strings.Builder{}
+		runes = []rune(s)
+	)
+	for index := 0; index < len(runes); index += 1 {
+		if runes[index] != '\\' || index+1 == len(runes) {
+			out.WriteRune(runes[index])
+			continue
+		}
+
+		index += 1
+		switch runes[index] {
+		case '"', '\'', '\\', '/':
+			out.WriteRune(runes[index])
+		case 'b':
+			out.WriteRune('\b')
+		case 'f':
+			out.WriteRune('\f')
+		case 'n':
+			out.WriteRune('\n')
+		case 'r':
+			out.WriteRune('\r')
+		case 't':
+			out.WriteRune('\t')
+		case 'u':
+			code, ok := parseUnicodeEscape(runes, index+1)
+			if !ok {
+				return "", fmt.Errorf("invalid unicode escape sequence at %d", index-1)
+			}
+			index += 4
+
+			if utf16.IsSurrogate(code) {
+				// A surrogate must be followed by its pair, e.g. \ud83d\ude00.
+				if index+2 < len(runes) && runes[index+1] == '\\' && runes[index+2] == 'u' {
+					if low, ok := parseUnicodeEscape(runes, index+3); ok {
+						if decoded := utf16.DecodeRune(code, low); decoded != unicode.ReplacementChar {
+							code = decoded
+							index += 6
+						}
+					}
+				}
+				if utf16.IsSurrogate(code) {
+					code = unicode.ReplacementChar
+				}
+			}
+			out.WriteRune(code)
+		default:
+			out.WriteRune('\\')
+			out.WriteRune(runes[index])
+		}
+	}
+	return out.String(), nil
+}
+
+func parseUnicodeEscape(runes []rune, offset int) (rune, bool) {
+	if offset+4 > len(runes) {
+		return 0, false
+	} else if code, err := strconv.ParseUint(string(runes[offset:offset+4]), 16, 16); err != nil {
+		return 0, false
+	} else {
+		return rune(code), true
+	}
+}
+
+func parseBinData(r *internal.RuneReader) (Binary, error) {
 	// BinData(3, 7B41B8989CD93C2E80E3AA19F4732581)
 	// The RuneReader should be pointing to the beginning of the word.
-	var b BinData
+	var b Binary
 
 	// Skip "BinData("
 	r.Skip(8)
@@ -297,67 +509,199 @@ func parseBinData(r *internal.RuneReader) (BinData, error) {
 	if !ok || len(t) < 2 {
 		return b, internal.UnexpectedEOL
 	} else if num, err := strconv.ParseInt(t[:len(t)-1], 10, 8); err != nil {
-		return BinData{}, err
+		return Binary{}, err
 	} else {
-		b.Type = byte(num)
+		b.Subtype = byte(num)
 	}
 
 	// Get the data itself.
 	c, ok := r.ScanFor(')')
 	if !ok || len(c) < 2 {
-		return BinData{}, internal.UnexpectedEOL
+		return Binary{}, internal.UnexpectedEOL
 	} else if hex, err := hex.DecodeString(c[:len(c)-1]); err != nil {
 		// Decode the string into hex and set the output.
-		return BinData{}, err
+		return Binary{}, err
 	} else {
-		b.BinData = hex
+		b.Data = hex
 	}
 
 	return b, nil
 }
 
-func parseDataType(m map[string]interface{}) interface{} {
+func parseDataType(m map[string]interface{}) (interface{}, error) {
 	switch len(m) {
 	case 1:
 		if _, ok := m["$date"].(time.Time); ok {
-			return m["$date"]
-		} else if _, ok := m["$timestamp"].(time.Time); ok {
-			return Timestamp(m["$timestamp"].(time.Time))
+			return m["$date"], nil
+		} else if date, ok := m["$timestamp"].(time.Time); ok {
+			return Timestamp{uint32(date.Unix()), uint32(date.Nanosecond())}, nil
+		} else if value, ok := m["$timestamp"].(map[string]interface{}); ok {
+			// Extended JSON, e.g. {"$timestamp": {"t": 1609459200, "i": 1}}
+			if seconds, ok := parseExtendedInteger(value["t"], 64); ok && seconds >= 0 && seconds <= math.MaxUint32 {
+				if increment, ok := parseExtendedInteger(value["i"], 64); ok && increment >= 0 && increment <= math.MaxUint32 {
+					return Timestamp{uint32(seconds), uint32(increment)}, nil
+				}
+			}
 		} else if _, ok := m["$oid"].(string); ok {
 			oid, _ := NewObjectId(m["$oid"].(string))
-			return oid
+			return oid, nil
 		} else if _, ok := m["$undefined"].(bool); ok && m["$undefined"].(bool) {
-			return Undefined{}
+			return Undefined{}, nil
 		} else if _, ok := m["$minKey"].(int); ok && m["$minKey"] == 1 {
-			return MinKey{}
+			return MinKey{}, nil
 		} else if _, ok := m["$maxKey"]; ok && m["$maxKey"] == 1 {
-			return MaxKey{}
-		} else if _, ok := m["$numberLong"].(int64); ok {
-			return m["$numberLong"]
-		} else if _, ok := m["$numberDecimal"].(float64); ok {
-			return m["$numberDecimal"]
+			return MaxKey{}, nil
+		} else if value, ok := m["$numberInt"]; ok {
+			if number, ok := parseExtendedInteger(value, 32); ok {
+				return int(number), nil
+			}
+		} else if value, ok := m["$numberLong"]; ok {
+			if number, ok := parseExtendedInteger(value, 64); ok {
+				return number, nil
+			}
+		} else if value, ok := m["$numberDouble"]; ok {
+			if number, ok := parseExtendedDouble(value); ok {
+				return number, nil
+			}
+		} else if binary, ok := m["$binary"].(map[string]interface{}); ok {
+			// Extended JSON v2, e.g. {"$binary": {"base64": "...", "subType": "04"}}
+			return parseExtendedBinary(binary["base64"], binary["subType"])
+		} else if value, ok := m["$numberDecimal"]; ok {
+			if number, ok := parseExtendedDecimal(value); ok {
+				return number, nil
+			}
 		} else if _, ok := m["$regex"].(string); ok {
-			return Regex{m["$regex"].(string), ""}
+			return Regex{m["$regex"].(string), ""}, nil
 		}
 	case 2:
-		if _, ok := m["$binary"].([]byte); ok {
-			if t, ok := m["$type"].(string); ok {
-				if h, err := hex.DecodeString(t); err == nil && len(h) == 1 {
-					return BinData{m["$binary"].([]byte), h[0]}
-				}
+		if _, ok := m["$binary"]; ok {
+			if _, ok := m["$type"]; ok {
+				return parseExtendedBinary(m["$binary"], m["$type"])
 			}
 		} else if _, ok := m["$regex"]; ok {
-			if _, ok := m["$options"].(string); ok {
-				return Regex{m["$regex"].(string), m["$options"].(string)}
+			if options, ok := m["$options"].(string); ok {
+				switch rx := m["$regex"].(type) {
+				case string:
+					return Regex{rx, options}, nil
+				case Regex:
+					// A regex literal with separate options, e.g.
+					// { $regex: /foo/, $options: "i" }.
+					for _, option := range options {
+						if !strings.ContainsRune(rx.Options, option) {
+							rx.Options += string(option)
+						}
+					}
+					return rx, nil
+				}
+			}
+		} else if collection, ok := m["$ref"].(string); ok {
+			if id, ok := m["$id"]; ok {
+				return DBRef{collection, id, ""}, nil
 			}
-		} else if _, ok := m["$ref"].(string); ok {
-			if _, ok := m["$id"].(string); ok {
-				oid, _ := NewObjectId(m["$id"].(string))
-				return Ref{m["$ref"].(string), oid}
+		}
+	case 3:
+		if collection, ok := m["$ref"].(string); ok {
+			if id, ok := m["$id"]; ok {
+				if database, ok := m["$db"].(string); ok {
+					return DBRef{collection, id, database}, nil
+				}
 			}
 		}
 	}
-	return m
+	return m, nil
+}
+
+// Binary data is base64 encoded with a hexadecimal subtype in both the legacy
+// ($binary and $type) and v2 forms.
+func parseExtendedBinary(data interface{}, subtype interface{}) (Binary, error) {
+	var value Binary
+
+	if t, ok := subtype.(string); !ok {
+		return Binary{}, fmt.Errorf("unexpected binary subtype %v", subtype)
+	} else if number, err := strconv.ParseUint(t, 16, 8); err != nil {
+		return Binary{}, fmt.Errorf("unexpected binary subtype '%s'", t)
+	} else {
+		value.Subtype = byte(number)
+	}
+
+	switch t := data.(type) {
+	case []byte:
+		value.Data = t
+	case string:
+		decoded, err := base64.StdEncoding.DecodeString(t)
+		if err != nil {
+			return Binary{}, fmt.Errorf("unexpected binary data: %s", err)
+		}
+		value.Data = decoded
+	default:
+		return Binary{}, fmt.Errorf("unexpected binary data %v", data)
+	}
+
+	if (value.Subtype == BinaryUuid || value.Subtype == BinaryUuidLegacy) && len(value.Data) != 16 {
+		return Binary{}, internal.UnexpectedLength
+	}
+
+	return value, nil
+}
+
+// Canonical extended JSON (v2) quotes numbers, e.g. {"$numberLong": "1"},
+// while relaxed and legacy output does not.
+func parseExtendedInteger(value interface{}, bits int) (int64, bool) {
+	switch t := value.(type) {
+	case int:
+		return parseExtendedInteger(int64(t), bits)
+	case int64:
+		if bits == 32 && (t < math.MinInt32 || t > math.MaxInt32) {
+			return 0, false
+		}
+		return t, true
+	case string:
+		number, err := strconv.ParseInt(t, 10, bits)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseExtendedDouble(value interface{}) (float64, bool) {
+	switch t := value.(type) {
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case string:
+		switch t {
+		case "Infinity":
+			return math.Inf(1), true
+		case "-Infinity":
+			return math.Inf(-1), true
+		case "NaN":
+			return math.NaN(), true
+		}
+		number, err := strconv.ParseFloat(t, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func parseExtendedDecimal(value interface{}) (Decimal128, bool) {
+	switch t := value.(type) {
+	case string:
+		return NewDecimal128(t)
+	case int:
+		return Decimal128{strconv.Itoa(t)}, true
+	case int64:
+		return Decimal128{strconv.FormatInt(t, 10)}, true
+	case float64:
+		// Older logs print the decimal as a bare number, which is kept in the
+		// shortest form that represents it.
+		return Decimal128{strconv.FormatFloat(t, 'g', -1, 64)}, true
+	default:
+		return Decimal128{}, false
+	}
 }
 
 func parseDate(r *internal.RuneReader) (time.Time, error) {
@@ -375,7 +719,10 @@ func parseDate(r *internal.RuneReader) (time.Time, error) {
 		return time.Time{}, internal.UnexpectedEOL
 	}
 	r.Skip(offset)
-	if date := r.Peek(13); len(date) != 13 {
+	if offset == 8 && unicode.Is(unicode.Quotation_Mark, r.NextRune()) {
+		// ISODate("2020-01-01T00:00:00Z")
+		return parseIsoDate(r)
+	} else if date := r.Peek(13); len(date) != 13 {
 		return time.Time{}, fmt.Errorf("unrecognized date string (%s)", date)
 	} else if t, err := strconv.ParseInt(date, 10, 64); err != nil {
 		return time.Time{}, err
@@ -388,32 +735,69 @@ func parseDate(r *internal.RuneReader) (time.Time, error) {
 	}
 }
 
-func parseDbRef(r *internal.RuneReader) (Ref, error) {
-	if !r.ExpectString("DBRef(") {
-		return Ref{}, fmt.Errorf("unexpected word at %d", r.Pos())
+func parseDbRef(r *internal.RuneReader) (DBRef, error) {
+	// DBRef("collection", ObjectId("...")), DBRef('collection', 0123...) or
+	// DBRef("collection", id, "database")
+	if !internal.StringInsensitiveMatch(r.Peek(6), "dbref(") {
+		return DBRef{}, fmt.Errorf("unexpected word at %d", r.Pos())
 	}
 
-	ref := Ref{}
+	ref := DBRef{}
 	r.Skip(6)
-	if id, err := r.QuotedString(); err != nil {
-		return Ref{}, err
+	if collection, err := r.ChompWS().QuotedString(); err != nil {
+		return DBRef{}, err
 	} else {
-		ref.Name = id
+		ref.Collection = collection
 	}
 
-	// Skip ", "
-	r.Skip(2)
-	if oid, ok := r.ScanFor(')'); !ok {
-		return Ref{}, fmt.Errorf("unexpected end of string")
-	} else if l := len(oid); l != 25 {
-		return Ref{}, fmt.Errorf("unexpected OID format")
-	} else {
-		ref.Id, ok = NewObjectId(oid[:24])
+	if !r.ChompWS().ExpectRune(',') {
+		return DBRef{}, fmt.Errorf("unexpected character '%c' in DBRef at %d", r.NextRune(), r.Pos())
+	}
+	r.Skip(1).ChompWS()
+
+	offset := r.Pos()
+	if internal.StringInsensitiveMatch(r.Peek(9), "objectid(") {
+		term, ok := r.ScanFor(')')
 		if !ok {
-			return Ref{}, fmt.Errorf("cannot translate from hex to objectid")
+			return DBRef{}, fmt.Errorf("unexpected end of string")
+		}
+		oid, err := parseObjectId(term, false)
+		if err != nil {
+			return DBRef{}, err
+		}
+		ref.Id = oid
+	} else if term, ok := r.ScanFor(')', ','); !ok {
+		return DBRef{}, fmt.Errorf("unexpected end of string")
+	} else if term = strings.TrimSpace(term[:len(term)-1]); len(term) >= 24 && strings.Trim(term, "0123456789abcdefABCDEF") == "" {
+		// Older versions print an ObjectId as bare hex.
+		if ref.Id, ok = NewObjectId(term); !ok {
+			return DBRef{}, fmt.Errorf("unexpected OID format")
+		}
+		r.Prev()
+	} else {
+		r.Seek(offset, 0)
+		id, err := parseValue(r, false, false)
+		if err != nil {
+			return DBRef{}, err
+		}
+		ref.Id = id
+	}
+
+	if r.ChompWS().ExpectRune(',') {
+		r.Skip(1).ChompWS()
+		if database, err := r.QuotedString(); err != nil {
+			return DBRef{}, err
+		} else {
+			ref.Database = database
 		}
-		return ref, nil
 	}
+
+	if end, ok := r.ChompWS().Next(); !ok {
+		return DBRef{}, fmt.Errorf("unexpected end of string")
+	} else if end != ')' {
+		return DBRef{}, fmt.Errorf("unexpected character '%c' in DBRef at %d", end, r.Pos())
+	}
+	return ref, nil
 }
 
 func parseNumber(r *internal.RuneReader) (interface{}, error) {
@@ -447,6 +831,47 @@ func parseNumber(r *internal.RuneReader) (interface{}, error) {
 	}
 }
 
+func parseIsoDate(r *internal.RuneReader) (time.Time, error) {
+	s, err := r.QuotedString()
+	if err != nil {
+		return time.Time{}, err
+	} else if end, _ := r.Next(); end != ')' {
+		return time.Time{}, fmt.Errorf("unexpected character '%c' in date string at %d", end, r.Pos())
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, string(internal.DateFormatIso8602Local)} {
+		if date, err := time.Parse(layout, s); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date string (%s)", s)
+}
+
+func parseNumberLong(r *internal.RuneReader) (int64, error) {
+	// NumberLong(123) or NumberLong("123")
+	if !internal.StringInsensitiveMatch(r.Peek(11), "numberlong(") {
+		return 0, internal.UnexpectedValue
+	}
+	r.Skip(11)
+
+	var term string
+	if unicode.Is(unicode.Quotation_Mark, r.NextRune()) {
+		s, err := r.QuotedString()
+		if err != nil {
+			return 0, err
+		} else if end, _ := r.Next(); end != ')' {
+			return 0, internal.UnexpectedValue
+		}
+		term = s
+	} else if s, ok := r.ScanFor(')'); !ok {
+		return 0, internal.UnexpectedEOL
+	} else {
+		term = strings.TrimSpace(s[:len(s)-1])
+	}
+
+	return strconv.ParseInt(term, 10, 64)
+}
+
 func parseObjectId(oid string, strict bool) (value ObjectId, err error) {
 	// ObjectId('59e3fdf682f5ead28303a9cb')
 	if internal.StringLength(oid) != 36 {
@@ -464,47 +889,46 @@ func parseObjectId(oid string, strict bool) (value ObjectId, err error) {
 	return
 }
 
-func parseTimestamp(r *internal.RuneReader) (time.Time, error) {
+func parseTimestamp(r *internal.RuneReader) (Timestamp, error) {
 	// The timestamp data type is represented as Timestamp(0, 0). The RuneReader
 	// pointer should be at Timestamp.
 	if internal.StringToLower(r.Peek(10)) != "timestamp(" {
-		return time.Time{}, internal.UnexpectedValue
+		return Timestamp{}, internal.UnexpectedValue
 	}
 
-	var wall int64
-	var ext int64
+	var value Timestamp
 
 	r.Skip(10)
 	if term, ok := r.ChompWS().ScanFor(","); !ok {
-		return time.Time{}, internal.UnexpectedEOL
+		return Timestamp{}, internal.UnexpectedEOL
 	} else if len(term) == 1 {
-		return time.Time{}, internal.UnexpectedValue
+		return Timestamp{}, internal.UnexpectedValue
 	} else {
-		value, err := strconv.ParseInt(term[:len(term)-1], 10, 64)
+		seconds, err := strconv.ParseUint(strings.TrimSpace(term[:len(term)-1]), 10, 32)
 		if err != nil {
-			return time.Time{}, err
+			return Timestamp{}, err
 		}
-		wall = value
+		value.T = uint32(seconds)
 	}
 
 	if !r.ScanUntilRune(')') {
-		return time.Time{}, internal.UnexpectedEOL
+		return Timestamp{}, internal.UnexpectedEOL
 	} else if term := strings.Trim(r.CurrentWord(), " "); term == "" {
-		return time.Time{}, internal.UnexpectedValue
+		return Timestamp{}, internal.UnexpectedValue
 	} else {
-		value, err := strconv.ParseInt(term, 10, 64)
+		increment, err := strconv.ParseUint(term, 10, 32)
 		if err != nil {
-			return time.Time{}, err
+			return Timestamp{}, err
 		}
-		ext = value
+		value.I = uint32(increment)
 	}
 
 	if r, ok := r.ChompWS().Next(); !ok {
-		return time.Time{}, internal.UnexpectedEOL
+		return Timestamp{}, internal.UnexpectedEOL
 	} else if r != ')' {
-		return time.Time{}, internal.UnexpectedValue
+		return Timestamp{}, internal.UnexpectedValue
 	}
-	return time.Unix(wall, ext), nil
+	return value, nil
 }
 
 func parseTimestampLegacy(r *internal.RuneReader) (time.Time, error) {
@@ -533,17 +957,17 @@ func parseTimestampLegacy(r *internal.RuneReader) (time.Time, error) {
 }
 
 // Data type introduced in version 4.0
-func parseUuid(r *internal.RuneReader) (value BinData, err error) {
+func parseUuid(r *internal.RuneReader) (value Binary, err error) {
 	term, ok := r.ScanFor(')')
 	if !ok {
-		return BinData{}, internal.UnexpectedEOL
+		return Binary{}, internal.UnexpectedEOL
 	} else if len(term) < 9 {
-		return BinData{}, internal.UnexpectedLength
+		return Binary{}, internal.UnexpectedLength
 	}
 
 	term = internal.StringToLower(term)
 	if term[0:5] != "uuid(" || term[len(term)-1] != ')' {
-		return BinData{}, internal.UnexpectedValue
+		return Binary{}, internal.UnexpectedValue
 	} else {
 		data := strings.Trim(term[6:len(term)-2], "\"")
 		data = strings.Replace(data, "-", "", -1)
@@ -551,10 +975,8 @@ func parseUuid(r *internal.RuneReader) (value BinData, err error) {
 			data = "0" + data
 		}
 
-		value.BinData = make([]byte, len(data)/2, len(data)/2)
-		value.Type = 4 // UUID
-
-		value.BinData, err = hex.DecodeString(data)
+		value.Subtype = BinaryUuid
+		value.Data, err = hex.DecodeString(data)
 		return
 	}
 }
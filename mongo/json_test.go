@@ -2,7 +2,10 @@ package mongo
 
 import (
 	"bytes"
+	"encoding/json"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,9 +36,16 @@ func TestParseJson(t *testing.T) {
 		`{"key": /(?:)/i }`:                      {"key": Regex{"(?:)", "i"}},
 		`{"key": Timestamp 492000|16}`:           {"key": time.Unix(492000, 16)},
 		`{"key":Timestamp 0|0}`:                  {"key": time.Unix(0, 0)},
-		`{"key": Timestamp(341000, 8)}`:          {"key": time.Unix(341000, 8)},
-		`{"key": UUID("00000000-0000-0000-0000-000000000001")}`: {"key": BinData{[]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 4}},
-		`{"object":{"key1":"value1" , "key2" : "value2" } }`:    {"object": map[string]interface{}{"key1": "value1", "key2": "value2"}},
+		`{"key": UUID("00000000-0000-0000-0000-000000000001")}`:                               {"key": Binary{4, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}}},
+		`{"key": { "$timestamp": { "t": 1609459200, "i": 1 } }}`:                              {"key": Timestamp{1609459200, 1}},
+		`{"key": {"$ref": "coll", "$id": {"$oid": "0123456789abcdef01234567"}, "$db": "db"}}`: {"key": DBRef{"coll", ObjectId{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67}, "db"}},
+		`{"key": {"$ref": "coll", "$id": 5}}`:                                                 {"key": DBRef{"coll", 5, ""}},
+		`{"name":"caf\u00e9"}`:                                                                {"name": "café"},
+		`{"name":"\ud83d\ude00!"}`:                                                            {"name": "😀!"},
+		`{"name":"\ud83d"}`:                                                                   {"name": "\ufffd"},
+		`{"a\u0062c":"\"quoted\"\n\ttab\\"}`:                                                  {"abc": "\"quoted\"\n\ttab\\"},
+		`{"name":"a\/b"}`:                                                                     {"name": "a/b"},
+		`{"object":{"key1":"value1" , "key2" : "value2" } }`:                                  {"object": map[string]interface{}{"key1": "value1", "key2": "value2"}},
 	}
 
 	for source, target := range s1 {
@@ -61,8 +71,17 @@ func TestParseJson(t *testing.T) {
 		`{key:{$op:"value"}}`:    {"key": map[string]interface{}{"$op": "value"}},
 		`{key:"value"}`:          {"key": "value"},
 		`{"key":''}`:             {"key": ""},
-		`{"key": objectid(00000000000000000000000000)}`: {"key": ObjectId{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
-		`{"key": "this " is " incorrectly " quoted"}`:   {"key": `this \" is \" incorrectly \" quoted`},
+		`{"key": objectid(00000000000000000000000000)}`:                {"key": ObjectId{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		`{"key": "this " is " incorrectly " quoted"}`:                  {"key": `this " is " incorrectly " quoted`},
+		`{"key": NumberLong(123)}`:                                     {"key": int64(123)},
+		`{"key": NumberLong("-9223372036854775808")}`:                  {"key": int64(-9223372036854775808)},
+		`{"key": ISODate("2020-01-01T00:00:00Z")}`:                     {"key": time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		`{"key": ISODate("2020-01-01T00:00:00.123Z")}`:                 {"key": time.Date(2020, 1, 1, 0, 0, 0, 123000000, time.UTC)},
+		`{"key": DBRef("coll", ObjectId("0123456789abcdef01234567"))}`: {"key": DBRef{"coll", ObjectId{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef, 0x01, 0x23, 0x45, 0x67}, ""}},
+		`{"key": DBRef("coll", 5, "db")}`:                              {"key": DBRef{"coll", 5, "db"}},
+		`{"key": Timestamp(341000, 8)}`:                                {"key": Timestamp{341000, 8}},
+		`{"key":Timestamp(1,2)}`:                                       {"key": Timestamp{1, 2}},
+		`{ts: Timestamp(1609459200, 1), t: 1}`:                         {"ts": Timestamp{1609459200, 1}, "t": 1},
 	}
 
 	for source, target := range s2 {
@@ -98,6 +117,17 @@ func TestParseJson(t *testing.T) {
 		`{key: Timestamp 0|-1}`,
 		`{key: Timestamp 0}`,
 		`{key: 4294967296|4294967296}`,
+		`{key: Timestamp(-1, 0)}`,
+		`{key: Timestamp(4294967296, 0)}`,
+		`{key: Timestamp(0, 0}`,
+		`{"key": "\u00"}`,
+		`{"key": "\u00zz"}`,
+		`{"key": "caf\u00e"}`,
+		`{key: NumberLong(1.5)}`,
+		`{key: NumberLong("abc")}`,
+		`{key: NumberLong(9223372036854775808)}`,
+		`{key: ISODate("2020-01-01")}`,
+		`{key: ISODate("2020-01-01T00:00:00Z"}`,
 	}
 
 	for _, str := range n1 {
@@ -119,25 +149,128 @@ func TestParseDataType(t *testing.T) {
 		{"$minKey": 1},
 		{"$maxKey": 1},
 		{"$numberLong": int64(1)},
-		{"$numberDecimal": float64(1.0)},
+		{"$numberDecimal": "1.0"},
 		{"$regex": "/abc/"},
 		{"$binary": []byte{0xde, 0xad, 0xbe, 0xef}, "$type": "00"},
 		{"$regex": "/abc/", "$options": "i"},
 		{"$ref": "abc", "$id": "_id"},
 	}
 	for index, v := range m {
-		c := parseDataType(v)
-		if reflect.DeepEqual(c, v) {
+		if c, err := parseDataType(v); err != nil || reflect.DeepEqual(c, v) {
 			t.Errorf("Extended type conversion at %d failed (%T %v, %T %v)", index, v, v, c, c)
 		}
 	}
+
+	for index, test := range []struct {
+		value    map[string]interface{}
+		expected interface{}
+	}{
+		{map[string]interface{}{"$numberInt": "5"}, 5},
+		{map[string]interface{}{"$numberInt": 5}, 5},
+		{map[string]interface{}{"$numberLong": "9223372036854775807"}, int64(math.MaxInt64)},
+		{map[string]interface{}{"$numberLong": 1}, int64(1)},
+		{map[string]interface{}{"$numberLong": int64(1)}, int64(1)},
+		{map[string]interface{}{"$numberDouble": "Infinity"}, math.Inf(1)},
+		{map[string]interface{}{"$numberDouble": "-Infinity"}, math.Inf(-1)},
+		{map[string]interface{}{"$numberDouble": "1.5"}, 1.5},
+		{map[string]interface{}{"$numberDouble": 2}, float64(2)},
+		{map[string]interface{}{"$numberDecimal": "1.10"}, Decimal128{"1.10"}},
+		{map[string]interface{}{"$numberDecimal": "-9.999999999999999999999999999999999E+6144"}, Decimal128{"-9.999999999999999999999999999999999E+6144"}},
+		{map[string]interface{}{"$numberDecimal": "NaN"}, Decimal128{"NaN"}},
+		{map[string]interface{}{"$numberDecimal": 5}, Decimal128{"5"}},
+		{map[string]interface{}{"$numberDecimal": 1.5}, Decimal128{"1.5"}},
+	} {
+		if c, err := parseDataType(test.value); err != nil || c != test.expected {
+			t.Errorf("Extended number conversion at %d failed, expected %T %v, got %T %v", index, test.expected, test.expected, c, c)
+		}
+	}
+
+	if c, _ := parseDataType(map[string]interface{}{"$numberDouble": "NaN"}); !isNaN(c) {
+		t.Errorf("Expected NaN, got %v", c)
+	}
+	for _, invalid := range []map[string]interface{}{
+		{"$numberInt": "2147483648"},
+		{"$numberInt": math.MaxInt32 + 1},
+		{"$numberInt": math.MinInt32 - 1},
+		{"$numberInt": int64(math.MaxInt32 + 1)},
+		{"$numberLong": "1.5"},
+		{"$numberDouble": "abc"},
+		{"$numberDecimal": "1.2.3"},
+		{"$numberDecimal": "1e"},
+		{"$numberDecimal": true},
+	} {
+		if c, err := parseDataType(invalid); err != nil || !reflect.DeepEqual(c, invalid) {
+			t.Errorf("Invalid extended number %v should not be converted, got %T %v", invalid, c, c)
+		}
+	}
+	// A regex literal may still be given options separately.
+	if doc, err := ParseJson(`{ a: { $regex: /foo/i, $options: "mi" } }`, false); err != nil {
+		t.Errorf("Unexpected error parsing a regex literal with options (%s)", err)
+	} else if doc["a"] != (Regex{"foo", "im"}) {
+		t.Errorf("Expected the options to be merged into the regex, got %T %v", doc["a"], doc["a"])
+	}
+	if c, err := parseDataType(map[string]interface{}{"$regex": 5, "$options": "i"}); err != nil || !reflect.DeepEqual(c, map[string]interface{}{"$regex": 5, "$options": "i"}) {
+		t.Errorf("A $regex that is not a pattern should not be converted, got %T %v", c, c)
+	}
+	// Nested documents are converted while parsing.
+	if doc, err := ParseJson(`{ "a": { "$numberLong": "5" }, "b": { "$numberDouble": "-Infinity" } }`, false); err != nil {
+		t.Errorf("Unexpected error parsing extended numbers (%s)", err)
+	} else if doc["a"] != int64(5) || doc["b"] != math.Inf(-1) {
+		t.Errorf("Expected nested extended numbers to be converted, got %T %v and %T %v", doc["a"], doc["a"], doc["b"], doc["b"])
+	}
+	// Decimals keep the literal exactly as it was logged.
+	if doc, err := ParseJson(`{ "a": { "$numberDecimal": "0.1000000000000000000000000000000001" } }`, true); err != nil {
+		t.Errorf("Unexpected error parsing a decimal (%s)", err)
+	} else if d, ok := doc["a"].(Decimal128); !ok || d.String() != "0.1000000000000000000000000000000001" {
+		t.Errorf("Expected the decimal literal to round trip, got %T %v", doc["a"], doc["a"])
+	}
+}
+
+func isNaN(value interface{}) bool {
+	number, ok := value.(float64)
+	return ok && math.IsNaN(number)
+}
+
+func TestParseDataType_Binary(t *testing.T) {
+	uuid := []byte{0x7f, 0xff, 0xff, 0xff, 0, 0, 0x11, 0x11, 0x22, 0x22, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12}
+	for source, expected := range map[string]Binary{
+		`{"key": {"$binary": "f////wAAEREiIhI0VniQEg==", "$type": "04"}}`:               {BinaryUuid, uuid},
+		`{"key": {"$binary": {"base64": "f////wAAEREiIhI0VniQEg==", "subType": "04"}}}`: {BinaryUuid, uuid},
+		`{"key": {"$binary": {"base64": "f////wAAEREiIhI0VniQEg==", "subType": "3"}}}`:  {BinaryUuidLegacy, uuid},
+		`{"key": {"$binary": {"base64": "3q2+7w==", "subType": "00"}}}`:                 {BinaryGeneric, []byte{0xde, 0xad, 0xbe, 0xef}},
+		`{"key": {"$type": "80", "$binary": "3q2+7w=="}}`:                               {0x80, []byte{0xde, 0xad, 0xbe, 0xef}},
+	} {
+		if value, err := ParseJson(source, true); err != nil {
+			t.Errorf("Binary failed (%s): %s", source, err)
+		} else if !reflect.DeepEqual(value["key"], expected) {
+			t.Errorf("Binary mismatch (%s), expected %#v, got %#v", source, expected, value["key"])
+		}
+	}
+
+	for _, source := range []string{
+		`{"key": {"$binary": "not base64!", "$type": "00"}}`,
+		`{"key": {"$binary": {"base64": "3q2+7w=", "subType": "00"}}}`,
+		`{"key": {"$binary": {"base64": "3q2+7w==", "subType": "zz"}}}`,
+		`{"key": {"$binary": {"base64": "3q2+7w==", "subType": "04"}}}`, // A UUID must be 16 bytes.
+		`{"key": {"$binary": "3q2+7w==", "$type": "03"}}`,
+	} {
+		if value, err := ParseJson(source, false); err == nil {
+			t.Errorf("Binary succeeded (%s), expected an error but got %#v", source, value)
+		}
+	}
+
+	if s := (Binary{BinaryUuid, uuid}).String(); s != "7fffffff-0000-1111-2222-123456789012" {
+		t.Errorf("Expected a canonical UUID, got %s", s)
+	} else if s := (Binary{BinaryGeneric, []byte{0xde, 0xad, 0xbe, 0xef}}).String(); s != `BinData(0, "3q2+7w==")` {
+		t.Errorf("Expected binary data, got %s", s)
+	}
 }
 
 func TestBinData(t *testing.T) {
 	bin, err := parseBinData(internal.NewRuneReader("BinData(0, 0123456789ABCDEF)"))
-	check := BinData{[]byte{0x1, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}, 0x0}
-	if err != nil || !bytes.Equal(bin.BinData, check.BinData) || bin.Type != check.Type {
-		t.Errorf("Expected (%x, %x), got (%x, %x)", check.BinData, check.Type, bin.BinData, bin.Type)
+	check := Binary{0x0, []byte{0x1, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF}}
+	if err != nil || !bytes.Equal(bin.Data, check.Data) || bin.Subtype != check.Subtype {
+		t.Errorf("Expected (%x, %x), got (%x, %x)", check.Data, check.Subtype, bin.Data, bin.Subtype)
 	}
 	bin, err = parseBinData(internal.NewRuneReader("BinData(, 0123456789ABCDEF)"))
 	if err == nil {
@@ -164,8 +297,21 @@ func TestParseDbRef(t *testing.T) {
 	ref, err := parseDbRef(internal.NewRuneReader("DBRef('test', 0123456789abcdef01234567)"))
 	tid, _ := NewObjectId("0123456789abcdef01234567")
 
-	if err != nil || ref.Name != "test" || !ref.Id.Equals(tid) {
-		t.Errorf("Expected (test, 012345678901234567890123), got (%s, %s) %s", ref.Name, ref.Id, err)
+	if err != nil || ref.Collection != "test" || ref.Id != tid {
+		t.Errorf("Expected (test, 012345678901234567890123), got (%s, %v) %s", ref.Collection, ref.Id, err)
+	}
+
+	for source, expected := range map[string]DBRef{
+		`DBRef("test", ObjectId("0123456789abcdef01234567"))`:       {"test", tid, ""},
+		`DBRef("test", ObjectId("0123456789abcdef01234567"), "db")`: {"test", tid, "db"},
+		`DBRef("test", 5)`:            {"test", 5, ""},
+		`DBRef('test', "name", 'db')`: {"test", "name", "db"},
+	} {
+		if ref, err := parseDbRef(internal.NewRuneReader(source)); err != nil {
+			t.Errorf("Parsing DBRef '%s' failed: %s", source, err)
+		} else if !reflect.DeepEqual(ref, expected) {
+			t.Errorf("Parsing DBRef '%s' mismatch, expected %#v, got %#v", source, expected, ref)
+		}
 	}
 
 	_, err = parseDbRef(internal.NewRuneReader("ObjectId()"))
@@ -218,11 +364,11 @@ func TestParseNumber(t *testing.T) {
 }
 
 func TestParseTimestamp(t *testing.T) {
-	success := map[string]time.Time{
-		`Timestamp(1,2)`:          time.Unix(1, 2),
-		`timestamp(1, 2)`:         time.Unix(1, 2),
-		`Timestamp(6420000, 780)`: time.Unix(6420000, 780),
-		`Timestamp( 1, 0 )`:       time.Unix(1, 0),
+	success := map[string]Timestamp{
+		`Timestamp(1,2)`:          {1, 2},
+		`timestamp(1, 2)`:         {1, 2},
+		`Timestamp(6420000, 780)`: {6420000, 780},
+		`Timestamp( 1, 0 )`:       {1, 0},
 	}
 
 	fail := []string{
@@ -238,8 +384,8 @@ func TestParseTimestamp(t *testing.T) {
 		r := internal.NewRuneReader(s)
 		if c, err := parseTimestamp(r); err != nil {
 			t.Errorf("Parsing timestamp '%s' failed: %s", s, err)
-		} else if !c.Equal(v) {
-			t.Errorf("Parsing timestamps not equal: expected %s, got %s", v, c)
+		} else if c != v {
+			t.Errorf("Parsing timestamps not equal: expected %v, got %v", v, c)
 		}
 	}
 
@@ -252,13 +398,13 @@ func TestParseTimestamp(t *testing.T) {
 }
 
 func TestParseUuid(t *testing.T) {
-	success := map[string]BinData{
-		`UUID("00")`:   {[]byte{0}, 4},
-		`uuid("ff")`:   {[]byte{0xff}, 4},
-		`UUID("88ff")`: {[]byte{0x88, 0xff}, 4},
-		`UUID("7fffffff-0000-1111-2222-123456789012")`: {[]byte{0x7f, 0xff, 0xff, 0xff, 0, 0, 0x11, 0x11, 0x22, 0x22, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12}, 4},
-		`UUID("01-0000-0000-0000-000000000001")`:       {[]byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, 4},
-		`uuid("0")`:                                    {[]byte{0}, 4},
+	success := map[string]Binary{
+		`UUID("00")`:   {4, []byte{0}},
+		`uuid("ff")`:   {4, []byte{0xff}},
+		`UUID("88ff")`: {4, []byte{0x88, 0xff}},
+		`UUID("7fffffff-0000-1111-2222-123456789012")`: {4, []byte{0x7f, 0xff, 0xff, 0xff, 0, 0, 0x11, 0x11, 0x22, 0x22, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12}},
+		`UUID("01-0000-0000-0000-000000000001")`:       {4, []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		`uuid("0")`:                                    {4, []byte{0}},
 	}
 
 	fail := []string{
@@ -274,10 +420,10 @@ func TestParseUuid(t *testing.T) {
 		s, err := parseUuid(r)
 		if err != nil {
 			t.Errorf("Parsing UUID '%s' failed: %s", v, err)
-		} else if c.Type != s.Type {
-			t.Errorf("Parsing UUID '%s' has type mismatch: expected %d, got %d", v, c.Type, s.Type)
-		} else if !bytes.Equal(c.BinData, s.BinData) {
-			t.Errorf("Parsing UUID '%s' failed: expected %x, got %x", v, c.BinData, s.BinData)
+		} else if c.Subtype != s.Subtype {
+			t.Errorf("Parsing UUID '%s' has type mismatch: expected %d, got %d", v, c.Subtype, s.Subtype)
+		} else if !bytes.Equal(c.Data, s.Data) {
+			t.Errorf("Parsing UUID '%s' failed: expected %x, got %x", v, c.Data, s.Data)
 		}
 	}
 
@@ -290,6 +436,45 @@ func TestParseUuid(t *testing.T) {
 	}
 }
 
+func TestParseJsonOrdered(t *testing.T) {
+	a, err := ParseJsonOrdered(`{ a: 1, b: { d: 1, c: [ { f: 1, e: 1 } ] } }`, false)
+	if err != nil {
+		t.Fatalf("Ordered parsing failed: %s", err)
+	}
+	b, err := ParseJsonOrdered(`{ b: { c: [ { e: 1, f: 1 } ], d: 1 }, a: 1 }`, false)
+	if err != nil {
+		t.Fatalf("Ordered parsing failed: %s", err)
+	}
+
+	expected := OrderedObject{
+		{"a", 1},
+		{"b", OrderedObject{{"d", 1}, {"c", []interface{}{OrderedObject{{"f", 1}, {"e", 1}}}}}},
+	}
+	if !reflect.DeepEqual(a, expected) {
+		t.Errorf("Ordered mismatch, expected %#v, got %#v", expected, a)
+	}
+	if reflect.DeepEqual(a, b) {
+		t.Errorf("Objects with swapped keys should differ when ordered: %#v", a)
+	}
+	if !reflect.DeepEqual(a.Map(), b.Map()) {
+		t.Errorf("Objects with swapped keys should be equal when unordered (%#v, %#v)", a.Map(), b.Map())
+	}
+	if unordered, err := ParseJson(`{ a: 1, b: { d: 1, c: [ { f: 1, e: 1 } ] } }`, false); err != nil || !reflect.DeepEqual(unordered, b.Map()) {
+		t.Errorf("Ordered and unordered parsing mismatch (%#v, %#v)", unordered, b.Map())
+	}
+
+	// Extended data types are converted regardless of order.
+	if c, err := ParseJsonOrdered(`{"b": {"$binary": {"subType": "00", "base64": "3q2+7w=="}}, "a": {"$numberLong": "5"}}`, true); err != nil {
+		t.Errorf("Ordered parsing failed: %s", err)
+	} else if !reflect.DeepEqual(c, OrderedObject{{"b", Binary{0, []byte{0xde, 0xad, 0xbe, 0xef}}}, {"a", int64(5)}}) {
+		t.Errorf("Ordered data types mismatch, got %#v", c)
+	}
+
+	if _, err := ParseJsonOrdered(`{"a": 1} x`, true); err == nil {
+		t.Errorf("Expected an error for trailing characters in strict mode")
+	}
+}
+
 func TestParseJsonRunes(t *testing.T) {
 	r := internal.NewRuneReader("{a:1}")
 	if s, err := ParseJsonRunes(r, false); err != nil || !reflect.DeepEqual(s, map[string]interface{}{"a": 1}) {
@@ -318,3 +503,60 @@ func TestCheckRune(t *testing.T) {
 		t.Errorf("unexpected character mismatch")
 	}
 }
+
+func TestExtended(t *testing.T) {
+	oid, _ := NewObjectId("0123456789abcdef01234567")
+	decimal, _ := NewDecimal128("1.50")
+	values := map[string]interface{}{
+		"oid":       oid,
+		"regex":     Regex{"^a", "i"},
+		"binary":    Binary{BinaryUuid, []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		"decimal":   decimal,
+		"timestamp": Timestamp{1609459200, 1},
+		"ref":       DBRef{"coll", oid, "db"},
+		"min":       MinKey{},
+		"max":       MaxKey{},
+		"undefined": Undefined{},
+		"infinity":  math.Inf(1),
+		"nested":    map[string]interface{}{"array": []interface{}{oid, 1, "a"}},
+	}
+
+	out, err := json.Marshal(Extended(values))
+	if err != nil {
+		t.Fatalf("unexpected error writing extended JSON (%s)", err)
+	}
+
+	parsed, err := ParseJson(string(out), false)
+	if err != nil {
+		t.Fatalf("unexpected error reading extended JSON (%s)", err)
+	}
+	for key, expected := range values {
+		if !reflect.DeepEqual(parsed[key], expected) {
+			t.Errorf("%s mismatch, expected [%T] %+v, got [%T] %+v", key, expected, expected, parsed[key], parsed[key])
+		}
+	}
+}
+
+func TestParseJsonTruncated(t *testing.T) {
+	for source, target := range map[string]map[string]interface{}{
+		`{ insert: "foo", documents: [ { a: 1 }, { a: 2, b: "long`: {"insert": "foo", "documents": []interface{}{map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}}},
+		`{ find: "foo", filter: { a: { $in: [ 1, 2, 3`:             {"find": "foo", "filter": map[string]interface{}{"a": map[string]interface{}{"$in": []interface{}{1, 2}}}},
+		`{ find: "foo", filter: { a: "x, {y"`:                      {"find": "foo", "filter": map[string]interface{}{}},
+		`{ find: "foo", filter: { a: 1 } }`:                        {"find": "foo", "filter": map[string]interface{}{"a": 1}},
+		`{ find: "foo", filter: { name: /^a[b/, c: 1`:              {"find": "foo", "filter": map[string]interface{}{}},
+	} {
+		if value, err := ParseJsonTruncated(source); err != nil {
+			t.Errorf("truncated JSON failed (%s): %s", source, err)
+		} else if !reflect.DeepEqual(value, target) {
+			t.Errorf("truncated JSON mismatch (%s), expected %+v, got %+v", source, target, value)
+		}
+	}
+
+	// Only the last cuts are tried, even though an earlier cut would parse.
+	broken := `{ find: "foo", filter: { a: 1 }, b: ` + strings.Repeat("/[/, ", truncatedAttempts+1)
+	for _, source := range []string{"", "[ 1, 2", `find: "foo"`, broken} {
+		if _, err := ParseJsonTruncated(source); err == nil {
+			t.Errorf("expected an error parsing '%s'", source)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package mongo
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"sort"
+	"strings"
 
 	"mgotools/internal"
 	"mgotools/mongo/sorter"
@@ -13,13 +17,104 @@ import (
 type Pattern struct {
 	pattern     map[string]interface{}
 	initialized bool
+
+	// The order of keys in each object of patterns created from an ordered
+	// object, keyed by the path to the object. Objects within arrays are not
+	// included since logical operators sort their contents.
+	order map[string][]string
+}
+
+// A placeholder for values. Patterns created with NewPatternMarked also
+// record whether the value belongs to an equality, range, or existence check,
+// and patterns created with InCardinality record the size of $in arrays.
+type V struct {
+	marker      string
+	cardinality string
+}
+
+const (
+	markerEquality  = "eq"
+	markerExistence = "exists"
+	markerRange     = "range"
+)
+
+// The buckets $in arrays are sorted into when their cardinality is kept.
+const (
+	cardinalityEmpty  = "0"
+	cardinalitySingle = "1"
+	cardinalitySmall  = "2-10"
+	cardinalityLarge  = ">10"
+)
+
+func (v V) String() string {
+	if v.cardinality != "" {
+		return "[" + v.cardinality + "]"
+	} else if v.marker == "" {
+		return "1"
+	}
+	return "V" + v.marker + "{}"
+}
+
+// Options that change how values are replaced when creating a pattern.
+type PatternOptions struct {
+	// Keep the number of values of $in arrays as a bucket (0, 1, 2-10, or
+	// >10) instead of collapsing them, e.g. {a: {$in: [5]}} becomes
+	// { "a": { "$in": [1] } } since a single value is often planned
+	// differently than many.
+	InCardinality bool
+
+	// Expand dotted field names into nested objects so a field is rendered
+	// the same however it is reached, e.g. {"a.b": 1, "a": {"c": 1}} becomes
+	// { "a": { "b": 1, "c": 1 } }.
+	NestDottedFields bool
 }
 
-type V struct{}
+// The deepest level of nesting kept when creating a pattern. Objects and
+// arrays nested any deeper collapse to a single value, so a pathological
+// filter (e.g. thousands of nested $and operators) cannot exhaust the stack.
+var MaxPatternDepth = 100
 
 func NewPattern(s map[string]interface{}) Pattern {
-	return Pattern{createPattern(s, false), true}
+	return Pattern{pattern: createPattern(limit(s), false), initialized: true}
+}
+
+func NewPatternWithOptions(s map[string]interface{}, options PatternOptions) Pattern {
+	s = limit(s)
+	if options.NestDottedFields {
+		s = nest(s)
+	}
+	if options.InCardinality {
+		s = cardinality(s).(map[string]interface{})
+	}
+	return Pattern{pattern: createPattern(s, false), initialized: true}
+}
+
+// Creates a pattern that renders keys in the order they appear in the object
+// instead of sorting them, e.g. {b: 1, a: 1} becomes { "b": 1, "a": 1 }.
+func NewPatternOrdered(o OrderedObject) Pattern {
+	order := make(map[string][]string)
+
+	var record func(string, OrderedObject, int)
+	record = func(path string, object OrderedObject, depth int) {
+		order[path] = object.Keys()
+		for _, field := range object {
+			if child, ok := field.Value.(OrderedObject); ok && depth < MaxPatternDepth {
+				record(path+"\x00"+field.Key, child, depth+1)
+			}
+		}
+	}
+	record("", o, 1)
+
+	return Pattern{pattern: createPattern(limit(o.Map()), false), initialized: true, order: order}
 }
+
+// Creates a pattern where each predicate is rendered as Veq{}, Vrange{}, or
+// Vexists{} instead of a single placeholder, e.g. {a: 5} and {a: {$gt: 5}}
+// become {"a": Veq{}} and {"a": Vrange{}}.
+func NewPatternMarked(s map[string]interface{}) Pattern {
+	return Pattern{pattern: createPattern(mark(limit(s)), false), initialized: true}
+}
+
 func (p Pattern) IsEmpty() bool {
 	return !p.initialized
 }
@@ -39,12 +134,46 @@ func (p Pattern) StringCompact() string {
 	return createString(p, true)
 }
 
+// A hash of the pattern that is equal for any two patterns that are Equal,
+// which is much cheaper to compute than a string form when patterns only need
+// to be told apart. Keys are always hashed in sorted order.
+func (p Pattern) Hash() uint64 {
+	h := fnv.New64a()
+	if p.initialized {
+		hashValue(h, p.pattern)
+	}
+	return h.Sum64()
+}
+
+// The pattern as a JSON document, e.g. {"a":1,"b":{"$elemMatch":{"c":1}}}.
+// Values are rendered as 1 (or as the name of their marker, e.g. "range", for
+// marked patterns) and arrays of values are collapsed to a single value the
+// same way the string forms are.
+func (p Pattern) JSON() string {
+	out, _ := p.MarshalJSON()
+	return string(out)
+}
+
+func (p Pattern) MarshalJSON() ([]byte, error) {
+	if !p.initialized {
+		return []byte("null"), nil
+	}
+
+	buffer := bytes.NewBuffer([]byte{})
+	if err := createJSON(buffer, p, p.pattern, "", p.order != nil); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
 func compress(c interface{}) interface{} {
 	switch t := c.(type) {
 	case map[string]interface{}:
-		for key := range t {
+		for key, value := range t {
 			if !internal.ArrayInsensitiveMatchString(record.OPERATORS_COMPARISON, key) {
 				return t
+			} else if v, ok := value.(V); ok && v.cardinality != "" {
+				return t
 			}
 		}
 
@@ -66,7 +195,10 @@ func createPattern(s map[string]interface{}, expr bool) map[string]interface{} {
 	for key := range s {
 		switch t := s[key].(type) {
 		case map[string]interface{}:
-			if !expr || internal.ArrayInsensitiveMatchString(record.OPERATORS_COMPARISON, key) {
+			if isRegex(t) {
+				// The same as a regular expression literal (e.g. /^a/).
+				s[key] = V{}
+			} else if !expr || internal.ArrayInsensitiveMatchString(record.OPERATORS_COMPARISON, key) {
 				s[key] = compress(createPattern(t, true))
 			} else if internal.ArrayInsensitiveMatchString(record.OPERATORS_EXPRESSION, key) {
 				s[key] = createPattern(t, false)
@@ -92,6 +224,12 @@ func createPattern(s map[string]interface{}, expr bool) map[string]interface{} {
 				s[key] = V{}
 			}
 
+		case nested:
+			s[key] = createPattern(t, false)
+
+		case V:
+			// Already replaced by a marker.
+
 		default:
 			s[key] = V{}
 		}
@@ -99,12 +237,230 @@ func createPattern(s map[string]interface{}, expr bool) map[string]interface{} {
 	return s
 }
 
+// Replaces objects and arrays nested deeper than MaxPatternDepth with V{}.
+func limit(s map[string]interface{}) map[string]interface{} {
+	var collapse func(interface{}, int) interface{}
+	collapse = func(value interface{}, depth int) interface{} {
+		switch t := value.(type) {
+		case map[string]interface{}:
+			if depth > MaxPatternDepth {
+				return V{}
+			}
+			for key, item := range t {
+				t[key] = collapse(item, depth+1)
+			}
+		case []interface{}:
+			if depth > MaxPatternDepth {
+				return V{}
+			}
+			for index, item := range t {
+				t[index] = collapse(item, depth+1)
+			}
+		}
+		return value
+	}
+
+	for key, value := range s {
+		s[key] = collapse(value, 2)
+	}
+	return s
+}
+
+// Expands dotted field names into nested objects, merging them with any
+// objects already found at the same path. A dotted name is kept as-is when
+// part of its path already holds a value, e.g. {"a": 5, "a.b": 5}.
+func nest(s map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(s))
+
+	// Fields that are not dotted are added first (and dotted fields in sorted
+	// order) so the result never depends on the order of the map.
+	keys := make([]string, 0, len(s))
+	dotted := make(sorter.Key, 0)
+	for key := range s {
+		if strings.HasPrefix(key, "$") || !strings.Contains(key, ".") {
+			keys = append(keys, key)
+		} else {
+			dotted = append(dotted, key)
+		}
+	}
+	sort.Sort(dotted)
+
+	for _, key := range append(keys, dotted...) {
+		value := s[key]
+		switch t := value.(type) {
+		case map[string]interface{}:
+			value = nest(t)
+
+		case []interface{}:
+			if internal.ArrayInsensitiveMatchString(record.OPERATORS_LOGICAL, key) {
+				for index, item := range t {
+					if object, ok := item.(map[string]interface{}); ok {
+						t[index] = nest(object)
+					}
+				}
+			}
+		}
+
+		if strings.HasPrefix(key, "$") || !strings.Contains(key, ".") {
+			nestInsert(out, key, value)
+			continue
+		}
+
+		parts := strings.Split(key, ".")
+		parent := out
+		for index, part := range parts[:len(parts)-1] {
+			child, ok := parent[part]
+			if !ok {
+				child = nested{}
+				parent[part] = child
+			}
+			if object, ok := asObject(child); !ok {
+				// A value is in the way so the rest of the path stays dotted.
+				parts = append(parts[:index], strings.Join(parts[index:], "."))
+				break
+			} else {
+				parent = object
+			}
+		}
+		nestInsert(parent, parts[len(parts)-1], value)
+	}
+
+	return out
+}
+
+// An object created by expanding a dotted field name. Unlike other objects
+// (which match embedded documents exactly) its fields are patterns of their
+// own, so they are replaced the same way the fields of a filter are.
+type nested map[string]interface{}
+
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		return t, true
+	case nested:
+		return t, true
+	default:
+		return nil, false
+	}
+}
+
+// Adds a value to an object, merging the fields of both when the object
+// already holds an object under the same key.
+func nestInsert(object map[string]interface{}, key string, value interface{}) {
+	current, ok := asObject(object[key])
+	if !ok {
+		object[key] = value
+		return
+	}
+	if add, ok := asObject(value); ok {
+		for field, v := range add {
+			nestInsert(current, field, v)
+		}
+	} else {
+		object[key] = value
+	}
+}
+
+// Replaces the array of every $in operator with a value recording the number
+// of elements in the array.
+func cardinality(c interface{}) interface{} {
+	switch t := c.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			if array, ok := value.([]interface{}); ok && key == "$in" {
+				switch size := len(array); {
+				case size == 0:
+					t[key] = V{cardinality: cardinalityEmpty}
+				case size == 1:
+					t[key] = V{cardinality: cardinalitySingle}
+				case size <= 10:
+					t[key] = V{cardinality: cardinalitySmall}
+				default:
+					t[key] = V{cardinality: cardinalityLarge}
+				}
+			} else {
+				t[key] = cardinality(value)
+			}
+		}
+
+	case nested:
+		cardinality(map[string]interface{}(t))
+
+	case []interface{}:
+		for index, value := range t {
+			t[index] = cardinality(value)
+		}
+	}
+	return c
+}
+
+// Replaces the value of each field predicate with a marker describing the
+// kind of predicate. Predicates using other operators are left as-is.
+func mark(s map[string]interface{}) map[string]interface{} {
+	for key, value := range s {
+		if internal.ArrayInsensitiveMatchString(record.OPERATORS_LOGICAL, key) {
+			if array, ok := value.([]interface{}); ok {
+				for _, item := range array {
+					if object, ok := item.(map[string]interface{}); ok {
+						mark(object)
+					}
+				}
+			}
+			continue
+		} else if strings.HasPrefix(key, "$") {
+			continue
+		}
+
+		if _, ok := value.(Regex); ok || isRegex(value) {
+			// Both forms of a regular expression are kept apart from equality
+			// (and any options are ignored).
+			s[key] = map[string]interface{}{"$regex": V{}}
+		} else if object, ok := value.(map[string]interface{}); !ok {
+			s[key] = V{marker: markerEquality}
+		} else if marker := predicate(object); marker != "" {
+			s[key] = V{marker: marker}
+		}
+	}
+	return s
+}
+
+func predicate(object map[string]interface{}) string {
+	var equality, existence, comparison bool
+	for operator := range object {
+		switch operator {
+		case "$eq", "$in":
+			equality = true
+		case "$exists":
+			existence = true
+		case "$gt", "$gte", "$lt", "$lte":
+			comparison = true
+		default:
+			if strings.HasPrefix(operator, "$") {
+				return ""
+			}
+			// An embedded document is matched exactly.
+			equality = true
+		}
+	}
+
+	switch {
+	case comparison:
+		return markerRange
+	case equality:
+		return markerEquality
+	case existence:
+		return markerExistence
+	default:
+		return markerEquality
+	}
+}
+
 func createString(p Pattern, compact bool) string {
 	if !p.initialized {
 		return ""
 	}
 	var arr func([]interface{}) string
-	var obj func(map[string]interface{}) string
+	var obj func(map[string]interface{}, string, bool) string
 	arr = func(array []interface{}) string {
 		var buffer = bytes.NewBufferString("[")
 		total := len(array)
@@ -126,10 +482,10 @@ func createString(p Pattern, compact bool) string {
 				buffer.WriteString(r)
 
 			case map[string]interface{}:
-				buffer.WriteString(obj(t))
+				buffer.WriteString(obj(t, "", false))
 
 			case V:
-				buffer.WriteRune('1')
+				buffer.WriteString(t.String())
 				v += 1
 
 			default:
@@ -147,7 +503,7 @@ func createString(p Pattern, compact bool) string {
 		buffer.WriteRune(']')
 		return buffer.String()
 	}
-	obj = func(object map[string]interface{}) string {
+	obj = func(object map[string]interface{}, path string, ordered bool) string {
 		var buffer = bytes.NewBuffer([]byte{'{'})
 		total := len(object)
 		count := 0
@@ -159,11 +515,15 @@ func createString(p Pattern, compact bool) string {
 		// Iterating over a map will happen in a randomized order. Keys must
 		// be sorted and iterated in a specific order:
 		// https://codereview.appspot.com/5285042/patch/9001/10003
-		keys := make(sorter.Key, 0)
-		for key := range object {
-			keys = append(keys, key)
+		keys, ok := p.order[path]
+		if !ordered || !ok || len(keys) != total {
+			sorted := make(sorter.Key, 0)
+			for key := range object {
+				sorted = append(sorted, key)
+			}
+			sort.Sort(sorted)
+			keys = sorted
 		}
-		sort.Sort(keys)
 
 		for _, key := range keys {
 			count += 1
@@ -177,10 +537,10 @@ func createString(p Pattern, compact bool) string {
 				buffer.WriteString(arr(t))
 
 			case map[string]interface{}:
-				buffer.WriteString(obj(t))
+				buffer.WriteString(obj(t, path+"\x00"+key, ordered))
 
 			case V:
-				buffer.WriteRune('1')
+				buffer.WriteString(t.String())
 			}
 
 			if count < total {
@@ -194,7 +554,71 @@ func createString(p Pattern, compact bool) string {
 		return buffer.String()
 	}
 
-	return obj(p.pattern)
+	return obj(p.pattern, "", p.order != nil)
+}
+
+func createJSON(buffer *bytes.Buffer, p Pattern, value interface{}, path string, ordered bool) error {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		keys, ok := p.order[path]
+		if !ordered || !ok || len(keys) != len(t) {
+			sorted := make(sorter.Key, 0, len(t))
+			for key := range t {
+				sorted = append(sorted, key)
+			}
+			sort.Sort(sorted)
+			keys = sorted
+		}
+
+		buffer.WriteRune('{')
+		for index, key := range keys {
+			if index > 0 {
+				buffer.WriteRune(',')
+			}
+			name, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			buffer.Write(name)
+			buffer.WriteRune(':')
+			if err := createJSON(buffer, p, t[key], path+"\x00"+key, ordered); err != nil {
+				return err
+			}
+		}
+		buffer.WriteRune('}')
+
+	case []interface{}:
+		if isCollapsedArray(t) {
+			buffer.WriteRune('1')
+			return nil
+		}
+
+		// Objects within arrays are always sorted (see Pattern.order).
+		buffer.WriteRune('[')
+		for index, item := range t {
+			if index > 0 {
+				buffer.WriteRune(',')
+			}
+			if err := createJSON(buffer, p, item, "", false); err != nil {
+				return err
+			}
+		}
+		buffer.WriteRune(']')
+
+	case V:
+		if t.cardinality != "" {
+			buffer.WriteString(`"` + t.String() + `"`)
+		} else if t.marker == "" {
+			buffer.WriteRune('1')
+		} else {
+			buffer.WriteString(`"` + t.marker + `"`)
+		}
+
+	default:
+		return fmt.Errorf("unexpected type %T in pattern", value)
+	}
+
+	return nil
 }
 
 func createArray(t []interface{}, expr bool) []interface{} {
@@ -246,7 +670,7 @@ func deepEqual(ax, bx map[string]interface{}) bool {
 			}
 			return true
 		case V:
-			if _, ok := b.(V); !ok {
+			if s, ok := b.(V); !ok || s != t {
 				return false
 			}
 			return true
@@ -262,6 +686,88 @@ func deepEqual(ax, bx map[string]interface{}) bool {
 	return true // len(a) == len(b) == 0
 }
 
+// Writes a value to a hash. Each type is prefixed by a distinct byte (and
+// keys terminated by a zero byte) so different structures never produce the
+// same sequence of bytes.
+func hashValue(h hash.Hash64, value interface{}) {
+	switch t := value.(type) {
+	case map[string]interface{}:
+		keys := make(sorter.Key, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Sort(keys)
+
+		h.Write([]byte{'{'})
+		for _, key := range keys {
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+			hashValue(h, t[key])
+		}
+		h.Write([]byte{'}'})
+
+	case []interface{}:
+		if isCollapsedArray(t) {
+			// Hashed the same as the value it is rendered as.
+			hashValue(h, V{})
+			return
+		}
+
+		h.Write([]byte{'['})
+		for _, item := range t {
+			hashValue(h, item)
+		}
+		h.Write([]byte{']'})
+
+	case V:
+		h.Write([]byte{'V'})
+		h.Write([]byte(t.marker))
+		h.Write([]byte{0})
+		h.Write([]byte(t.cardinality))
+		h.Write([]byte{0})
+	}
+}
+
+// Whether a value is a regular expression in its operator form, e.g.
+// {$regex: "^a", $options: "i"}, as opposed to an object that uses $regex
+// alongside other operators.
+func isRegex(value interface{}) bool {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, v := range object {
+		switch key {
+		case "$regex":
+			if _, ok := v.(V); ok {
+				return false
+			}
+		case "$options":
+		default:
+			return false
+		}
+	}
+	_, ok = object["$regex"]
+	return ok
+}
+
+// Whether an array is rendered as a single value, i.e. it contains only values
+// and arrays that are themselves rendered as a single value.
+func isCollapsedArray(a []interface{}) bool {
+	for _, v := range a {
+		switch t := v.(type) {
+		case V:
+		case []interface{}:
+			if !isCollapsedArray(t) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func isValueArray(a []interface{}) bool {
 	for _, v := range a {
 		if _, ok := v.(V); !ok {
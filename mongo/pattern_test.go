@@ -56,6 +56,329 @@ func TestPattern_NewPattern(t *testing.T) {
 	}
 }
 
+func TestPattern_JSON(t *testing.T) {
+	s := []O{
+		{"a": 5},
+		{"a": 5, "b": "y"},
+		{"a": O{"$in": "y"}},
+		{"a": O{"$gt": 5}},
+		{"a": O{"$exists": true}},
+		{"a.b": "y"},
+		{"$or": A{O{"a": 5}, O{"b": 5}}},
+		{"$or": A{O{"b": 5}, O{"a": 5}}},
+		{"$or": A{O{"b": 5, "a": 5}, O{"a": 5}}},
+		{"$and": A{O{"$or": A{O{"a": 5}, O{"b": 5}}}, O{"$or": A{O{"c": 5}, O{"d": 5}}}}},
+		{"_id": ObjectId{}},
+		{"a": O{"$in": A{5, 5, 5}}},
+		{"a": O{"$elemMatch": O{"b": 5, "c": O{"$gte": 5}}}},
+		{"a": O{"$geoWithin": O{"$center": A{A{5, 5}, 5}}}},
+		{"a": O{"$geoWithin": O{"$geometry": O{"a": "y", "b": A{5, 5}}}}},
+		{"a\"b": 5},
+	}
+	d := []string{
+		`{"a":1}`,
+		`{"a":1,"b":1}`,
+		`{"a":1}`,
+		`{"a":1}`,
+		`{"a":1}`,
+		`{"a.b":1}`,
+		`{"$or":[{"a":1},{"b":1}]}`,
+		`{"$or":[{"a":1},{"b":1}]}`,
+		`{"$or":[{"a":1},{"a":1,"b":1}]}`,
+		`{"$and":[{"$or":[{"a":1},{"b":1}]},{"$or":[{"c":1},{"d":1}]}]}`,
+		`{"_id":1}`,
+		`{"a":1}`,
+		`{"a":{"$elemMatch":{"b":1,"c":1}}}`,
+		`{"a":{"$geoWithin":{"$center":1}}}`,
+		`{"a":{"$geoWithin":{"$geometry":{"a":1,"b":1}}}}`,
+		`{"a\"b":1}`,
+	}
+	if len(s) != len(d) {
+		t.Fatalf("mismatch between array sizes, %d and %d", len(s), len(d))
+	}
+
+	for i := range s {
+		if p := NewPattern(s[i]).JSON(); p != d[i] {
+			t.Errorf("json mismatch at %d, expected '%s', got '%s'", i+1, d[i], p)
+		}
+	}
+
+	if p := (Pattern{pattern: O{"a": A{O{"b": V{}}, A{V{}}}}, initialized: true}).JSON(); p != `{"a":[{"b":1},1]}` {
+		t.Errorf("unexpected nested array json: %s", p)
+	}
+	if p := NewPatternMarked(O{"a": 5, "b": O{"$gt": 5}, "c": O{"$exists": true}}).JSON(); p != `{"a":"eq","b":"range","c":"exists"}` {
+		t.Errorf("unexpected marked json: %s", p)
+	}
+	if p := NewPatternOrdered(OrderedObject{{"b", 5}, {"a", 5}}).JSON(); p != `{"b":1,"a":1}` {
+		t.Errorf("unexpected ordered json: %s", p)
+	}
+	if p := (Pattern{}).JSON(); p != "null" {
+		t.Errorf("unexpected uninitialized json: %s", p)
+	}
+}
+
+func TestPattern_Hash(t *testing.T) {
+	corpus := append([]Pattern{
+		NewPattern(O{}),
+		NewPattern(O{"a": 5}),
+		NewPattern(O{"b": 5}),
+		NewPattern(O{"a": 5, "b": 5}),
+		NewPattern(O{"ab": 5}),
+		NewPattern(O{"a": O{"b": 5}}),
+		NewPattern(O{"a.b": 5}),
+		NewPattern(O{"$or": A{O{"a": 5}, O{"b": 5}}}),
+		NewPattern(O{"$or": A{O{"a": 5, "b": 5}}}),
+		NewPattern(O{"a": O{"$elemMatch": O{"b": 5}}}),
+		NewPatternMarked(O{"a": 5}),
+		NewPatternMarked(O{"a": O{"$gt": 5}}),
+		NewPatternMarked(O{"a": O{"$exists": true}}),
+	}, patterns...)
+
+	seen := make(map[uint64]string)
+	for _, p := range corpus {
+		hash, s := p.Hash(), p.StringCompact()
+		if other, ok := seen[hash]; ok && other != s {
+			t.Errorf("hash collision between %s and %s", other, s)
+		}
+		seen[hash] = s
+	}
+
+	equal := [][2]Pattern{
+		{NewPattern(O{"a": 5, "b": "y"}), NewPattern(O{"b": 1, "a": "z"})},
+		{NewPattern(O{"a": O{"$in": A{5, 5, 5}}}), NewPattern(O{"a": 5})},
+		{NewPattern(O{"$or": A{O{"b": 5}, O{"a": 5}}}), NewPattern(O{"$or": A{O{"a": 5}, O{"b": 5}}})},
+		{NewPatternOrdered(OrderedObject{{"b", 5}, {"a", 5}}), NewPattern(O{"a": 5, "b": 5})},
+	}
+	for _, pair := range equal {
+		if !pair[0].Equals(pair[1]) {
+			t.Errorf("expected %s and %s to be equal", pair[0].String(), pair[1].String())
+		} else if pair[0].Hash() != pair[1].Hash() {
+			t.Errorf("equal patterns %s and %s hash differently", pair[0].String(), pair[1].String())
+		}
+	}
+}
+
+func TestPattern_HashCorpus(t *testing.T) {
+	fields := []string{"a", "b", "c", "a.b", "_id", "status", "createdAt"}
+	values := []func() interface{}{
+		func() interface{} { return 5 },
+		func() interface{} { return O{"$gt": 5} },
+		func() interface{} { return O{"$gte": 5, "$lt": 10} },
+		func() interface{} { return O{"$in": A{5, 6}} },
+		func() interface{} { return O{"$exists": true} },
+		func() interface{} { return O{"$elemMatch": O{"x": 5}} },
+		func() interface{} { return O{"$ne": nil} },
+	}
+
+	// Every filter of up to three fields, both on its own and within an $or.
+	var filters []func() O
+	for i := range fields {
+		for _, x := range values {
+			i, x := i, x
+			filters = append(filters, func() O { return O{fields[i]: x()} })
+			for j := i + 1; j < len(fields); j += 1 {
+				for _, y := range values {
+					j, y := j, y
+					filters = append(filters, func() O { return O{fields[i]: x(), fields[j]: y()} })
+					for k := j + 1; k < len(fields); k += 1 {
+						for _, z := range values {
+							k, z := k, z
+							filters = append(filters, func() O { return O{fields[i]: x(), fields[j]: y(), fields[k]: z()} })
+						}
+					}
+				}
+			}
+		}
+	}
+	for index := 0; index+1 < len(filters); index += 97 {
+		a, b := filters[index], filters[index+1]
+		filters = append(filters, func() O { return O{"$or": A{a(), b()}} })
+	}
+
+	seen := make(map[uint64]string)
+	hashes := make(map[string]uint64)
+	for _, filter := range filters {
+		// Patterns are built from a new filter each time since creating a
+		// pattern modifies the filter.
+		for _, p := range []Pattern{NewPattern(filter()), NewPatternMarked(filter())} {
+			hash, s := p.Hash(), p.StringCompact()
+			if other, ok := seen[hash]; ok && other != s {
+				t.Errorf("hash collision between %s and %s", other, s)
+			} else if other, ok := hashes[s]; ok && other != hash {
+				t.Errorf("%s hashes to both %x and %x", s, other, hash)
+			}
+			seen[hash], hashes[s] = s, hash
+		}
+	}
+	if len(seen) < 1000 {
+		t.Errorf("the corpus should produce at least 1000 distinct patterns, got %d", len(seen))
+	}
+}
+
+func TestPattern_NewPatternWithOptions(t *testing.T) {
+	many := make(A, 11)
+	for i := range many {
+		many[i] = 5
+	}
+
+	s := []O{
+		{"a": O{"$in": A{}}},
+		{"a": O{"$in": A{5}}},
+		{"a": O{"$in": A{5, 5}}},
+		{"a": O{"$in": A{5, 5, 5, 5, 5, 5, 5, 5, 5, 5}}},
+		{"a": O{"$in": many}},
+		{"a": O{"$in": A{5}, "$gt": 5}},
+		{"a": O{"$elemMatch": O{"b": O{"$in": A{5, 5}}}}},
+		{"$or": A{O{"a": O{"$in": A{5}}}, O{"b": 5}}}, // Predicates in logical operators are always collapsed.
+		{"a": O{"$nin": A{5}}},
+	}
+	d := []string{
+		`{"a": {"$in": [0]}}`,
+		`{"a": {"$in": [1]}}`,
+		`{"a": {"$in": [2-10]}}`,
+		`{"a": {"$in": [2-10]}}`,
+		`{"a": {"$in": [>10]}}`,
+		`{"a": {"$gt": 1, "$in": [1]}}`,
+		`{"a": {"$elemMatch": {"b": {"$in": [2-10]}}}}`,
+		`{"$or": [{"a": 1}, {"b": 1}]}`,
+		`{"a": {"$nin": 1}}`,
+	}
+	if len(s) != len(d) {
+		t.Fatalf("mismatch between array sizes, %d and %d", len(s), len(d))
+	}
+
+	for i := range s {
+		if p := NewPatternWithOptions(s[i], PatternOptions{InCardinality: true}).StringCompact(); p != d[i] {
+			t.Errorf("pattern mismatch at %d, expected '%s', got '%s'", i+1, d[i], p)
+		}
+	}
+
+	in := func(values ...interface{}) Pattern {
+		return NewPatternWithOptions(O{"a": O{"$in": A(values)}}, PatternOptions{InCardinality: true})
+	}
+	if a, b := in(5, 5), in(5, 5, 5); !a.Equals(b) || a.Hash() != b.Hash() {
+		t.Errorf("patterns in the same bucket should be equal: %s, %s", a.String(), b.String())
+	}
+	if a, b := in(5), in(5, 5); a.Equals(b) || a.Hash() == b.Hash() {
+		t.Errorf("patterns in different buckets should differ: %s, %s", a.String(), b.String())
+	}
+	if a, b := in(5), NewPattern(O{"a": O{"$in": A{5}}}); a.Equals(b) {
+		t.Errorf("patterns with and without cardinality should differ: %s, %s", a.String(), b.String())
+	}
+	if a, b := NewPatternWithOptions(O{"a": O{"$in": A{5}}}, PatternOptions{}), NewPattern(O{"a": O{"$in": A{5, 5}}}); !a.Equals(b) || a.String() != `{ "a": 1 }` {
+		t.Errorf("default options should collapse $in: %s, %s", a.String(), b.String())
+	}
+}
+
+func TestPattern_NestDottedFields(t *testing.T) {
+	s := []O{
+		{"a.b": 5},
+		{"a.b": 5, "a": O{"c": 5}},
+		{"a.b.c": 5, "a.b": O{"d": 5}, "a.e": 5, "f": 5},
+		{"a.b": O{"$gt": 5}, "a.c": O{"$in": A{5, 5}}},
+		{"a": O{"$elemMatch": O{"b.c": 5, "b.d": O{"$lt": 5}}}},
+		{"a": 5, "a.b": 5},
+		{"$or": A{O{"a.b": 5}, O{"c": 5}}},
+	}
+	d := []O{
+		{"a": O{"b": V{}}},
+		{"a": O{"b": V{}, "c": V{}}},
+		{"a": O{"b": O{"c": V{}, "d": V{}}, "e": V{}}, "f": V{}},
+		{"a": O{"b": V{}, "c": V{}}},
+		{"a": O{"$elemMatch": O{"b": O{"c": V{}, "d": V{}}}}},
+		{"a": V{}, "a.b": V{}},
+		{"$or": A{O{"a": O{"b": V{}}}, O{"c": V{}}}},
+	}
+	if len(s) != len(d) {
+		t.Fatalf("mismatch between array sizes, %d and %d", len(s), len(d))
+	}
+
+	for i := range s {
+		if p := NewPatternWithOptions(s[i], PatternOptions{NestDottedFields: true}); !deepEqual(p.pattern, d[i]) {
+			t.Errorf("pattern mismatch at %d:\n\t\t%#v\n\t\t%#v", i+1, d[i], p.pattern)
+		}
+	}
+
+	nested := NewPatternWithOptions(O{"a": O{"b": 5}}, PatternOptions{NestDottedFields: true})
+	if dotted := NewPatternWithOptions(O{"a.b": 5}, PatternOptions{NestDottedFields: true}); !nested.Equals(dotted) {
+		t.Errorf("dotted and nested fields should be equal: %s, %s", dotted.String(), nested.String())
+	}
+	if dotted := NewPattern(O{"a.b": 5}); nested.Equals(dotted) {
+		t.Errorf("dotted fields should only be nested when requested: %s", dotted.String())
+	}
+}
+
+func TestPattern_Regex(t *testing.T) {
+	// Patterns replace values in place, so each is created from a new filter.
+	s := func() []O {
+		return []O{
+			{"name": Regex{"^foo", ""}},
+			{"name": Regex{"^bar", "i"}},
+			{"name": O{"$regex": "^foo"}},
+			{"name": O{"$regex": "^bar", "$options": "i"}},
+			{"name": O{"$regex": Regex{"^foo", ""}, "$options": "i"}},
+		}
+	}
+	for i, filter := range s() {
+		if p := NewPattern(filter); !deepEqual(p.pattern, O{"name": V{}}) {
+			t.Errorf("pattern mismatch at %d: %#v", i+1, p.pattern)
+		}
+	}
+	for i, filter := range s() {
+		if p := NewPatternMarked(filter); !deepEqual(p.pattern, O{"name": O{"$regex": V{}}}) {
+			t.Errorf("marked pattern mismatch at %d: %#v", i+1, p.pattern)
+		}
+	}
+
+	if p := NewPattern(O{"a": O{"$in": A{Regex{"^foo", ""}, Regex{"^bar", ""}}}}); !deepEqual(p.pattern, O{"a": V{}}) {
+		t.Errorf("unexpected $in pattern: %#v", p.pattern)
+	}
+	if p := NewPattern(O{"a": O{"$regex": "^foo", "$ne": "foo"}}); !deepEqual(p.pattern, O{"a": O{"$regex": V{}, "$ne": V{}}}) {
+		t.Errorf("unexpected combined pattern: %#v", p.pattern)
+	}
+}
+
+func TestPattern_NewPatternMarked(t *testing.T) {
+	s := []O{
+		{"a": 5},
+		{"a": O{"$gt": 5}},
+		{"a": O{"$gte": 5, "$lt": 10}},
+		{"a": O{"$exists": true}},
+		{"a": O{"$in": A{5, 5}}},
+		{"a": O{"b": 5}},
+		{"a": O{"$regex": "y"}},
+		{"$or": A{O{"a": 5}, O{"b": O{"$lt": 5}}}},
+	}
+	d := []O{
+		{"a": V{marker: markerEquality}},
+		{"a": V{marker: markerRange}},
+		{"a": V{marker: markerRange}},
+		{"a": V{marker: markerExistence}},
+		{"a": V{marker: markerEquality}},
+		{"a": V{marker: markerEquality}},
+		{"a": O{"$regex": V{}}},
+		{"$or": A{O{"a": V{marker: markerEquality}}, O{"b": V{marker: markerRange}}}},
+	}
+	if len(s) != len(d) {
+		t.Fatalf("mismatch between array sizes, %d and %d", len(s), len(d))
+	}
+
+	for i := range s {
+		if p := NewPatternMarked(s[i]); !deepEqual(p.pattern, d[i]) {
+			t.Errorf("pattern mismatch at %d:\n\t\t%#v\n\t\t%#v", i+1, d[i], p.pattern)
+		}
+	}
+
+	if a, b := NewPatternMarked(O{"a": O{"$gt": 5}}), NewPatternMarked(O{"a": 5}); a.Equals(b) {
+		t.Errorf("range and equality patterns should differ: %s, %s", a.String(), b.String())
+	} else if a.String() != `{ "a": Vrange{} }` || b.String() != `{ "a": Veq{} }` {
+		t.Errorf("unexpected marked patterns: %s, %s", a.String(), b.String())
+	}
+	if a, b := NewPattern(O{"a": O{"$gt": 5}}), NewPattern(O{"a": 5}); !a.Equals(b) {
+		t.Errorf("unmarked patterns should be equal: %s, %s", a.String(), b.String())
+	}
+}
+
 func TestPattern_Equals(t *testing.T) {
 	s := []O{
 		{},
@@ -85,14 +408,14 @@ func TestPattern_Equals(t *testing.T) {
 	}
 
 	for i := range s {
-		p := Pattern{s[i], true}
-		if !p.Equals(Pattern{s[i], true}) {
+		p := Pattern{pattern: s[i], initialized: true}
+		if !p.Equals(Pattern{pattern: s[i], initialized: true}) {
 			t.Errorf("equality mismatch at %d: %#v", i, s[i])
 		}
 	}
 	for i := range s {
-		p := Pattern{s[i], true}
-		r := Pattern{d[i], true}
+		p := Pattern{pattern: s[i], initialized: true}
+		r := Pattern{pattern: d[i], initialized: true}
 		if p.Equals(r) {
 			t.Errorf("equality match at %d:\n%#v\n%v", i, s[i], d[i])
 		}
@@ -116,13 +439,13 @@ func TestPattern_Pattern(t *testing.T) {
 }
 func TestPattern_String(t *testing.T) {
 	s := []Pattern{
-		{O{"a": V{}}, true},
-		{O{"a": V{}, "b": V{}}, true},
-		{O{"a": A{V{}, V{}}}, true},
-		{O{}, true},
-		{O{"a": A{}}, true},
-		{O{"a": A{O{"b": V{}}}}, true},
-		{O{"a": A{A{V{}}}}, true},
+		{pattern: O{"a": V{}}, initialized: true},
+		{pattern: O{"a": V{}, "b": V{}}, initialized: true},
+		{pattern: O{"a": A{V{}, V{}}}, initialized: true},
+		{pattern: O{}, initialized: true},
+		{pattern: O{"a": A{}}, initialized: true},
+		{pattern: O{"a": A{O{"b": V{}}}}, initialized: true},
+		{pattern: O{"a": A{A{V{}}}}, initialized: true},
 	}
 	d := []string{
 		`{ "a": 1 }`,
@@ -143,6 +466,118 @@ func TestPattern_String(t *testing.T) {
 	}
 }
 
+func TestPattern_Decimal128(t *testing.T) {
+	doc, err := ParseJson(`{ "a": { "$numberDecimal": "1.10" }, "b": { "$gt": { "$numberDecimal": "99999999999999999999.5" } } }`, false)
+	if err != nil {
+		t.Fatalf("unexpected error parsing decimals (%s)", err)
+	} else if _, ok := doc["a"].(Decimal128); !ok {
+		t.Fatalf("expected a Decimal128, got %T", doc["a"])
+	}
+
+	p := NewPattern(doc)
+	if !deepEqual(p.pattern, O{"a": V{}, "b": V{}}) {
+		t.Errorf("decimal values should be replaced by placeholders, got %#v", p.pattern)
+	} else if p.String() != `{ "a": 1, "b": 1 }` {
+		t.Errorf("pattern mismatch, got '%s'", p.String())
+	}
+}
+
+func TestPattern_DBRef(t *testing.T) {
+	for _, source := range []string{
+		`{ "a": { "$ref": "coll", "$id": { "$oid": "0123456789abcdef01234567" } }, "b": 1 }`,
+		`{ "a": DBRef("coll", ObjectId("0123456789abcdef01234567")), "b": 1 }`,
+	} {
+		doc, err := ParseJson(source, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%s' (%s)", source, err)
+		} else if _, ok := doc["a"].(DBRef); !ok {
+			t.Fatalf("expected a DBRef, got %T", doc["a"])
+		}
+
+		if p := NewPattern(doc); !deepEqual(p.pattern, O{"a": V{}, "b": V{}}) {
+			t.Errorf("references should be replaced by placeholders, got %#v", p.pattern)
+		}
+	}
+}
+
+func TestPattern_NewPatternOrdered(t *testing.T) {
+	s := map[string]string{
+		`{ b: 5, a: 5 }`:                          `{"b": 1, "a": 1}`,
+		`{ a: 5, b: 5 }`:                          `{"a": 1, "b": 1}`,
+		`{ z: { y: 1, x: 1 }, a: { $gt: 5 } }`:    `{"z": {"y": 1, "x": 1}, "a": 1}`,
+		`{ $or: [ { b: 1, a: 1 }, { a: 1 } ] }`:   `{"$or": [{"a": 1}, {"a": 1, "b": 1}]}`,
+		`{ c: 1, a: { $in: [ 1, 2 ] }, b: null }`: `{"c": 1, "a": 1, "b": 1}`,
+	}
+	for source, expected := range s {
+		doc, err := ParseJsonOrdered(source, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing '%s' (%s)", source, err)
+		}
+
+		p := NewPatternOrdered(doc)
+		if p.StringCompact() != expected {
+			t.Errorf("ordered pattern mismatch for '%s', expected '%s', got '%s'", source, expected, p.StringCompact())
+		} else if !p.Equals(NewPattern(doc.Map())) {
+			t.Errorf("ordered pattern should equal the unordered pattern for '%s'", source)
+		}
+	}
+}
+
+func TestPattern_MaxDepth(t *testing.T) {
+	deep := func(levels int) O {
+		filter := O{"a": 5}
+		for i := 0; i < levels; i += 1 {
+			filter = O{"$and": A{filter}}
+		}
+		return filter
+	}
+
+	// Measures the nesting of a pattern, where the top level is one.
+	var depth func(interface{}) int
+	depth = func(value interface{}) int {
+		max := 0
+		switch t := value.(type) {
+		case map[string]interface{}:
+			for _, item := range t {
+				if d := depth(item); d > max {
+					max = d
+				}
+			}
+		case []interface{}:
+			for _, item := range t {
+				if d := depth(item); d > max {
+					max = d
+				}
+			}
+		default:
+			return 0
+		}
+		return max + 1
+	}
+
+	p := NewPattern(deep(10000))
+	if d := depth(p.pattern); d > MaxPatternDepth {
+		t.Errorf("expected a pattern at most %d levels deep, got %d", MaxPatternDepth, d)
+	} else if p.String() == "" || p.JSON() == "" || !p.Equals(NewPattern(deep(20000))) {
+		t.Error("patterns beyond the maximum depth should collapse to the same pattern")
+	}
+	if p := NewPatternMarked(deep(10000)); depth(p.pattern) > MaxPatternDepth {
+		t.Error("marked patterns should be limited to the maximum depth")
+	}
+	if p := NewPatternWithOptions(deep(10000), PatternOptions{InCardinality: true, NestDottedFields: true}); depth(p.pattern) > MaxPatternDepth {
+		t.Error("patterns with options should be limited to the maximum depth")
+	}
+
+	defer func(depth int) { MaxPatternDepth = depth }(MaxPatternDepth)
+	MaxPatternDepth = 3
+
+	if p := NewPattern(deep(1)); !deepEqual(p.pattern, O{"$and": A{O{"a": V{}}}}) {
+		t.Errorf("patterns within the maximum depth should be unchanged, got %#v", p.pattern)
+	} else if p := NewPattern(deep(2)); !deepEqual(p.pattern, O{"$and": A{O{"$and": V{}}}}) {
+		t.Errorf("values past the maximum depth should collapse, got %#v", p.pattern)
+	}
+}
+
 func TestPattern_mtools(t *testing.T) {
 	oid1, _ := NewObjectId("1234564863acd10e5cbf5f6e")
 	oid2, _ := NewObjectId("1234564863acd10e5cbf5f7e")
@@ -249,6 +684,13 @@ func BenchmarkPattern_MatchString(b *testing.B) {
 		}
 	}
 }
+func BenchmarkPattern_Hash(b *testing.B) {
+	for i := 0; i < b.N; i += 1 {
+		for _, s := range patterns {
+			s.Hash()
+		}
+	}
+}
 func BenchmarkReflection_DeepEqual(b *testing.B) {
 	for i := 0; i < b.N; i += 1 {
 		for _, s := range patterns {
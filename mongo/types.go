@@ -1,22 +1,96 @@
 package mongo
 
 import (
+	"encoding/base64"
 	"encoding/hex"
-	"time"
+	"fmt"
+	"strings"
 )
 
 // Use type aliases (instead of type definitions)
 type Object = map[string]interface{}
 type Array = []interface{}
 
+// An object that keeps the order of its keys, see ParseJsonOrdered.
+type OrderedObject []Field
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func newOrderedObject(keys []string, m map[string]interface{}) OrderedObject {
+	object := make(OrderedObject, len(keys))
+	for index, key := range keys {
+		object[index] = Field{key, m[key]}
+	}
+	return object
+}
+
+func (o OrderedObject) Keys() []string {
+	keys := make([]string, len(o))
+	for index, field := range o {
+		keys[index] = field.Key
+	}
+	return keys
+}
+
+// Map converts the object, and any ordered object nested within it, to an
+// unordered map.
+func (o OrderedObject) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(o))
+	for _, field := range o {
+		m[field.Key] = unordered(field.Value)
+	}
+	return m
+}
+
+func unordered(value interface{}) interface{} {
+	switch t := value.(type) {
+	case OrderedObject:
+		return t.Map()
+	case []interface{}:
+		array := make([]interface{}, len(t))
+		for index, item := range t {
+			array[index] = unordered(item)
+		}
+		return array
+	default:
+		return value
+	}
+}
+
 type MaxKey struct{}
 type MinKey struct{}
-type Timestamp time.Time
 type Undefined struct{}
 
-type BinData struct {
-	BinData []byte
-	Type    byte
+// An internal timestamp (used by replication and sharding) is a pair of
+// seconds since the epoch and an ordinal within the second.
+type Timestamp struct {
+	T uint32
+	I uint32
+}
+
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+// Binary subtypes with special meaning, see the BSON specification.
+const (
+	BinaryGeneric    byte = 0x00
+	BinaryUuidLegacy byte = 0x03
+	BinaryUuid       byte = 0x04
+)
+
+// UUIDs are rendered in their canonical hyphenated form and everything else
+// as the shell would print it.
+func (b Binary) String() string {
+	if (b.Subtype == BinaryUuid || b.Subtype == BinaryUuidLegacy) && len(b.Data) == 16 {
+		h := hex.EncodeToString(b.Data)
+		return fmt.Sprintf("%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32])
+	}
+	return fmt.Sprintf("BinData(%d, \"%s\")", b.Subtype, base64.StdEncoding.EncodeToString(b.Data))
 }
 
 type Regex struct {
@@ -24,13 +98,49 @@ type Regex struct {
 	Options string
 }
 
-type Ref struct {
-	Name string
-	Id   ObjectId
+// A reference to a document in another collection (and optionally another
+// database). The id is usually, but not necessarily, an ObjectId.
+type DBRef struct {
+	Collection string
+	Id         interface{}
+	Database   string
 }
 
 type ObjectId [12]byte
 
+// A 128-bit decimal is kept as its original literal since neither a float64
+// nor any other native type can hold one without losing precision.
+type Decimal128 struct {
+	literal string
+}
+
+func NewDecimal128(s string) (Decimal128, bool) {
+	switch s {
+	case "Infinity", "-Infinity", "NaN":
+		return Decimal128{s}, true
+	}
+
+	number := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	if e := strings.IndexAny(number, "eE"); e >= 0 {
+		exponent := strings.TrimPrefix(strings.TrimPrefix(number[e+1:], "-"), "+")
+		if exponent == "" || strings.Trim(exponent, "0123456789") != "" {
+			return Decimal128{}, false
+		}
+		number = number[:e]
+	}
+
+	digits := strings.Replace(number, ".", "", 1)
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return Decimal128{}, false
+	}
+
+	return Decimal128{s}, true
+}
+
+func (d Decimal128) String() string {
+	return d.literal
+}
+
 func NewObjectId(s string) (ObjectId, bool) {
 	var d = make([]byte, 12, 12)
 	if len(s) != 24 {
@@ -12,6 +12,7 @@ import (
 	"mgotools/parser/record"
 )
 
+// Successfully authenticated as principal app on admin from client 10.0.0.5:51236
 func commonParseAuthenticatedPrincipal(r *internal.RuneReader) (message.Message, error) {
 	// Ignore the first four words and retrieve principal user
 	r.SkipWords(4)
@@ -20,15 +21,120 @@ func commonParseAuthenticatedPrincipal(r *internal.RuneReader) (message.Message,
 		return nil, internal.UnexpectedEOL
 	}
 
-	// SERVER-39820
-	ip, _ := r.SlurpWord()
-	return message.Authentication{Principal: user, IP: ip}, nil
+	// The client address was added by SERVER-39820.
+	auth := message.Authentication{Principal: user}
+	authentication(r, &auth)
+	return auth, nil
+}
+
+// SCRAM-SHA-1 authentication failed for app on admin from client 10.0.0.5:51234 ; AuthenticationFailed: ...
+// SASL SCRAM-SHA-256 authentication failed for app on admin from client 10.0.0.5:51242 ; AuthenticationFailed: ...
+func commonParseAuthenticationFailed(r *internal.RuneReader) (message.Message, error) {
+	if r.ExpectString("SASL ") {
+		r.SkipWords(1)
+	}
+
+	mechanism, _ := r.SlurpWord()
+	if !r.ExpectString("authentication failed for ") {
+		return nil, internal.AccessUnrecognized
+	}
+
+	user, ok := r.SkipWords(3).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+
+	auth := message.Authentication{Principal: user, Mechanism: mechanism, Failed: true}
+	authentication(r, &auth)
+	return auth, nil
+}
+
+// Failed to authenticate app@admin from client 10.0.0.5:51234 with mechanism MONGODB-CR: AuthenticationFailed: ...
+func commonParseFailedToAuthenticate(r *internal.RuneReader) (message.Message, error) {
+	user, ok := r.SkipWords(3).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+
+	auth := message.Authentication{Principal: user, Failed: true}
+	if index := strings.LastIndex(user, "@"); index > 0 {
+		auth.Principal, auth.Database = user[:index], user[index+1:]
+	}
+
+	authentication(r, &auth)
+	return auth, nil
 }
 
 func commonParseBuildInfo(r *internal.RuneReader) (message.Message, error) {
 	return message.BuildInfo{BuildInfo: r.SkipWords(2).Remainder()}, nil
 }
 
+// build index on: test.foo properties: { v: 2, key: { a: 1.0 }, name: "a_1", ns: "test.foo", background: true }
+func commonParseBuildIndex(r *internal.RuneReader) (message.Message, error) {
+	ns, ok := r.SkipWords(3).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+
+	build, err := indexBuild(ns, r)
+	if err != nil {
+		return nil, err
+	}
+
+	build.Method = "foreground"
+	if background, _ := build.Properties["background"].(bool); background {
+		build.Method = "background"
+	}
+	return build, nil
+}
+
+// build index done.  scanned 1000 total records. 0 secs
+func commonParseBuildIndexDone(r *internal.RuneReader) (message.Message, error) {
+	words := strings.Fields(r.SkipWords(3).Remainder())
+	if len(words) < 6 || words[0] != "scanned" {
+		return nil, internal.IndexUnrecognized
+	}
+
+	scanned, err := strconv.ParseInt(words[1], 10, 64)
+	if err != nil {
+		return nil, internal.IndexUnrecognized
+	}
+	seconds, err := strconv.ParseInt(words[4], 10, 64)
+	if err != nil {
+		return nil, internal.IndexUnrecognized
+	}
+
+	return message.IndexBuildDone{Scanned: scanned, Seconds: seconds}, nil
+}
+
+// index build: starting on test.foo properties: { v: 2, key: { a: 1.0 }, name: "a_1" } using method: Hybrid
+func commonParseIndexBuildStarting(r *internal.RuneReader) (message.Message, error) {
+	ns, ok := r.SkipWords(4).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+
+	build, err := indexBuild(ns, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if words := strings.Fields(r.Remainder()); len(words) == 3 && words[0] == "using" && words[1] == "method:" {
+		build.Method = strings.ToLower(words[2])
+	}
+	return build, nil
+}
+
+// index build: done building index a_1 on ns test.foo
+func commonParseIndexBuildDone(r *internal.RuneReader) (message.Message, error) {
+	words := strings.Fields(r.SkipWords(5).Remainder())
+	if len(words) != 4 || words[1] != "on" || words[2] != "ns" {
+		return nil, internal.IndexUnrecognized
+	}
+
+	return message.IndexBuildDone{Namespace: words[3], Name: words[0], Seconds: -1}, nil
+}
+
 func commonParseConnectionAccepted(r *internal.RuneReader) (message.Message, error) {
 	if addr, port, conn, ok := connectionInit(r.SkipWords(3)); ok {
 		return message.Connection{Address: addr, Port: port, Conn: conn, Opened: true}, nil
@@ -44,17 +150,11 @@ func commonParseClientMetadata(r *internal.RuneReader) (message.Message, error)
 	}
 
 	meta, err := mongo.ParseJsonRunes(r, false)
-	if err == nil {
+	if err != nil {
 		return nil, err
 	}
 
-	return message.ConnectionMeta{
-		Connection: message.Connection{
-			Address: addr,
-			Conn:    conn,
-			Port:    port,
-			Opened:  true},
-		Meta: meta}, nil
+	return clientMetadata(message.Connection{Address: addr, Conn: conn, Port: port, Opened: true}, meta), nil
 }
 
 func commonParseConnectionEnded(entry record.Entry, r *internal.RuneReader) (message.Message, error) {
@@ -64,6 +164,145 @@ func commonParseConnectionEnded(entry record.Entry, r *internal.RuneReader) (mes
 	return nil, internal.UnexpectedValue
 }
 
+// Starting an election, since we've seen no PRIMARY in the past 10000ms
+func commonParseElection(r *internal.RuneReader) (message.Message, error) {
+	reason := strings.TrimLeft(r.SkipWords(3).Remainder(), ", ")
+	if strings.HasPrefix(reason, "since ") {
+		reason = reason[6:]
+	}
+
+	return message.Election{Reason: reason}, nil
+}
+
+// election succeeded, assuming primary role in term 2
+// replSet election succeeded, assuming primary role
+func commonParseElectionSucceeded(r *internal.RuneReader) (message.Message, error) {
+	words := strings.Fields(r.Remainder())
+	for index := 0; index < len(words)-1; index += 1 {
+		if words[index] == "term" {
+			if term, err := strconv.ParseInt(words[index+1], 10, 64); err == nil {
+				return message.ElectionWon{Term: term}, nil
+			}
+		}
+	}
+
+	return message.ElectionWon{Term: -1}, nil
+}
+
+// Member host2:27017 is now in state SECONDARY
+func commonParseMemberState(r *internal.RuneReader) (message.Message, error) {
+	host, ok := r.SkipWords(1).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	} else if !r.ExpectString("is now in state ") {
+		return nil, internal.ReplicationUnrecognized
+	}
+
+	state, ok := r.SkipWords(4).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+	return message.StateTransition{Host: host, To: state}, nil
+}
+
+// transition to PRIMARY from CATCHUP
+// transition to PRIMARY
+func commonParseStateTransition(r *internal.RuneReader) (message.Message, error) {
+	state, ok := r.SkipWords(2).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	} else if state != strings.ToUpper(state) {
+		// e.g. "transition to primary complete; database writes are now
+		// permitted" follows the transition itself.
+		return nil, internal.ReplicationUnrecognized
+	}
+
+	transition := message.StateTransition{To: state}
+	if r.ExpectString("from ") {
+		transition.From, _ = r.SkipWords(1).SlurpWord()
+	}
+	return transition, nil
+}
+
+// stepping down from primary, because a new term has begun: 5
+// Stepping down from primary in response to replSetStepDown
+func commonParseStepdown(r *internal.RuneReader) (message.Message, error) {
+	reason := strings.TrimLeft(r.SkipWords(3).Remainder(), ", ")
+	if strings.HasPrefix(reason, "primary") {
+		reason = strings.TrimLeft(reason[7:], ", ")
+	}
+	if strings.HasPrefix(reason, "because ") {
+		reason = reason[8:]
+	}
+
+	return message.Stepdown{Reason: reason}, nil
+}
+
+// Error in heartbeat (requestId: 45) to host2:27017, response status: ExceededTimeLimit: Operation timed out
+func commonParseHeartbeatError(r *internal.RuneReader) (message.Message, error) {
+	remainder := r.Remainder()
+
+	index := strings.Index(remainder, ") to ")
+	if index < 0 {
+		return nil, internal.ReplicationUnrecognized
+	}
+
+	return heartbeatFailure(remainder[index+5:])
+}
+
+// Heartbeat to host2:27017 failed after 2 retries, response status: ExceededTimeLimit: Operation timed out
+func commonParseHeartbeatFailed(r *internal.RuneReader) (message.Message, error) {
+	return heartbeatFailure(r.SkipWords(2).Remainder())
+}
+
+// about to log metadata event into changelog: { _id: "host-2018-05-15T10:00:00.000+0000-5afaa3a1", server: "host", what: "moveChunk.start", ns: "test.foo", details: { ... } }
+func commonParseMetadataEvent(entry record.Entry, r *internal.RuneReader) (message.Message, error) {
+	if entry.Component != record.ComponentSharding {
+		return nil, internal.ShardingUnrecognized
+	}
+
+	// Versions before 3.4 omit the collection ("into changelog") the event
+	// is logged into.
+	for word, ok := r.SlurpWord(); !strings.HasSuffix(word, ":"); word, ok = r.SlurpWord() {
+		if !ok {
+			return nil, internal.UnexpectedEOL
+		}
+	}
+
+	// Migrations log the duration of each step with an unquoted key that
+	// contains spaces, e.g. "step 1 of 6: 12", which must be quoted to parse.
+	steps, err := internal.GetRegexRegistry().Compile(`step (\d+) of (\d+):`)
+	if err != nil {
+		return nil, err
+	}
+
+	event, err := mongo.ParseJson(steps.ReplaceAllString(r.Remainder(), `"step $1 of $2":`), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return shardingEvent(event), nil
+}
+
+// successfully set parameter logLevel to 1 (was 0)
+func commonParseSetParameter(r *internal.RuneReader) (message.Message, error) {
+	name, ok := r.SkipWords(3).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	} else if !r.ExpectString("to ") {
+		return nil, internal.UnexpectedValue
+	}
+
+	// Values may be documents that contain spaces, so the previous value is
+	// found from the end of the line.
+	change := message.ParameterChange{Name: name, Value: r.SkipWords(1).Remainder()}
+	if index := strings.LastIndex(change.Value, " (was "); index >= 0 && strings.HasSuffix(change.Value, ")") {
+		change.Previous = change.Value[index+6 : len(change.Value)-1]
+		change.Value = change.Value[:index]
+	}
+	return change, nil
+}
+
 func commonParseSignalProcessing(r *internal.RuneReader) (message.Message, error) {
 	return message.Signal{String: r.String()}, nil
 }
@@ -76,6 +315,111 @@ func commonParseWiredtigerOpen(r *internal.RuneReader) (message.Message, error)
 	return message.WiredTigerConfig{String: r.SkipWords(2).Remainder()}, nil
 }
 
+// Both heartbeat failure messages end with the host followed by the status
+// of the failed heartbeat.
+func heartbeatFailure(remainder string) (message.Message, error) {
+	fields := strings.Fields(remainder)
+	if len(fields) == 0 {
+		return nil, internal.UnexpectedEOL
+	}
+
+	failure := message.HeartbeatFailure{Host: strings.TrimRight(fields[0], ",")}
+	if index := strings.Index(remainder, "response status: "); index >= 0 {
+		failure.Reason = remainder[index+17:]
+	}
+
+	return failure, nil
+}
+
+func indexBuild(ns string, r *internal.RuneReader) (message.IndexBuild, error) {
+	if word, ok := r.SlurpWord(); !ok || word != "properties:" {
+		return message.IndexBuild{}, internal.IndexUnrecognized
+	}
+
+	properties, err := mongo.ParseJsonRunes(r, false)
+	if err != nil {
+		return message.IndexBuild{}, err
+	}
+
+	name, _ := properties["name"].(string)
+	return message.IndexBuild{Namespace: ns, Name: name, Properties: properties}, nil
+}
+
+func shardingEvent(event map[string]interface{}) message.ShardingEvent {
+	out := message.ShardingEvent{Duration: -1}
+	out.What, _ = event["what"].(string)
+	out.Namespace, _ = event["ns"].(string)
+	out.Details, _ = event["details"].(map[string]interface{})
+
+	details := out.Details
+	out.From, _ = details["from"].(string)
+	out.To, _ = details["to"].(string)
+	out.Note, _ = details["note"].(string)
+	out.Error, _ = details["errmsg"].(string)
+
+	switch out.What {
+	case "balancer.round":
+		if dur, ok := structuredInteger(details["executionTimeMillis"]); ok {
+			out.Duration = dur
+		}
+		if failed, _ := details["errorOccured"].(bool); failed && out.Error == "" {
+			out.Error = "error occurred"
+		}
+
+	case "moveChunk.from", "moveChunk.to":
+		// Each step of the migration logs its own duration, e.g.
+		// "step 1 of 6: 12".
+		for key, value := range details {
+			if !strings.HasPrefix(key, "step ") {
+				continue
+			} else if dur, ok := structuredInteger(value); ok {
+				if out.Duration < 0 {
+					out.Duration = 0
+				}
+				out.Duration += dur
+			}
+		}
+	}
+
+	return out
+}
+
+// Reads the database, client address, mechanism, and error that follow the
+// principal of an authentication message, each of which is optional.
+func authentication(r *internal.RuneReader, auth *message.Authentication) {
+	for word, ok := r.SlurpWord(); ok; word, ok = r.SlurpWord() {
+		switch word {
+		case "on":
+			auth.Database, _ = r.SlurpWord()
+
+		case "from":
+			if r.ExpectString("client ") {
+				address, _ := r.SkipWords(1).SlurpWord()
+				if host, _, err := net.SplitHostPort(address); err == nil {
+					address = host
+				}
+				auth.IP = address
+			}
+
+		case "with":
+			// The error follows the mechanism, e.g. "with mechanism
+			// MONGODB-CR: AuthenticationFailed: ...".
+			if r.ExpectString("mechanism ") {
+				mechanism, _ := r.SkipWords(1).SlurpWord()
+				auth.Mechanism = strings.TrimSuffix(mechanism, ":")
+				if strings.HasSuffix(mechanism, ":") {
+					auth.Error = strings.TrimSpace(r.Remainder())
+					return
+				}
+			}
+
+		case ";":
+			auth.Error = strings.TrimSpace(r.Remainder())
+			return
+		}
+	}
+}
+
 func connectionInit(msg *internal.RuneReader) (ip net.IP, port uint16, conn int, success bool) {
 	ip, port, success = parseAddress(msg)
 	if !success {
@@ -96,6 +440,27 @@ func connectionInit(msg *internal.RuneReader) (ip net.IP, port uint16, conn int,
 	return
 }
 
+// received client metadata from 127.0.0.1:53342 conn1: { application: { name: "MongoDB Shell" }, driver: { name: "MongoDB Internal Client", version: "4.2.0" }, ... }
+func clientMetadata(conn message.Connection, meta map[string]interface{}) message.ConnectionMeta {
+	out := message.ConnectionMeta{Connection: conn, Meta: meta}
+
+	if application, ok := meta["application"].(map[string]interface{}); ok {
+		out.AppName, _ = application["name"].(string)
+	}
+	if driver, ok := meta["driver"].(map[string]interface{}); ok {
+		out.DriverName, _ = driver["name"].(string)
+		out.DriverVersion, _ = driver["version"].(string)
+		out.Driver = strings.TrimSpace(out.DriverName + " " + out.DriverVersion)
+	}
+	if os, ok := meta["os"].(map[string]interface{}); ok {
+		out.OS, _ = os["type"].(string)
+		out.Architecture, _ = os["architecture"].(string)
+	}
+	out.Platform, _ = meta["platform"].(string)
+
+	return out
+}
+
 func connectionTerminate(msg *internal.RuneReader) (ip net.IP, port uint16, success bool) {
 	ip, port, success = parseAddress(msg)
 	return
@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+)
+
+func TestCommonParseAuthentication(t *testing.T) {
+	for line, expected := range map[string]message.Authentication{
+		// 3.0 through 3.6
+		`Successfully authenticated as principal app on admin`: {Principal: "app", Database: "admin"},
+		// 4.0 and 4.2
+		`Successfully authenticated as principal app on admin from client 10.0.0.5:51236`: {Principal: "app", Database: "admin", IP: "10.0.0.5"},
+		`SCRAM-SHA-1 authentication failed for app on admin from client 10.0.0.5 ; AuthenticationFailed: SCRAM-SHA-1 authentication failed, storedKey mismatch`: {
+			Principal: "app", Database: "admin", IP: "10.0.0.5", Mechanism: "SCRAM-SHA-1", Failed: true, Error: "AuthenticationFailed: SCRAM-SHA-1 authentication failed, storedKey mismatch",
+		},
+		`SASL SCRAM-SHA-256 authentication failed for app on admin from client 10.0.0.5:51242 ; UserNotFound: Could not find user app@admin`: {
+			Principal: "app", Database: "admin", IP: "10.0.0.5", Mechanism: "SCRAM-SHA-256", Failed: true, Error: "UserNotFound: Could not find user app@admin",
+		},
+		`Failed to authenticate app@admin from client [::1]:51244 with mechanism MONGODB-CR: AuthenticationFailed: MONGODB-CR credentials missing in the user document`: {
+			Principal: "app", Database: "admin", IP: "::1", Mechanism: "MONGODB-CR", Failed: true, Error: "AuthenticationFailed: MONGODB-CR credentials missing in the user document",
+		},
+		`Failed to authenticate app@admin with mechanism MONGODB-CR: AuthenticationFailed: UserNotFound Could not find user app@admin`: {
+			Principal: "app", Database: "admin", Mechanism: "MONGODB-CR", Failed: true, Error: "AuthenticationFailed: UserNotFound Could not find user app@admin",
+		},
+	} {
+		var parse func(*internal.RuneReader) (message.Message, error)
+		switch {
+		case strings.HasPrefix(line, "Successfully"):
+			parse = commonParseAuthenticatedPrincipal
+		case strings.HasPrefix(line, "Failed"):
+			parse = commonParseFailedToAuthenticate
+		default:
+			parse = commonParseAuthenticationFailed
+		}
+
+		msg, err := parse(internal.NewRuneReader(line))
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", line, err)
+		} else if msg != expected {
+			t.Errorf("authentication mismatch for '%s', got %+v", line, msg)
+		}
+	}
+
+	if _, err := commonParseAuthenticationFailed(internal.NewRuneReader(`SASL server message: invalid nonce`)); err == nil {
+		t.Errorf("unrelated SASL messages should not be parsed")
+	}
+}
+
+func TestCommonParseMetadataEvent(t *testing.T) {
+	for name, test := range map[string]struct {
+		line     string
+		expected message.ShardingEvent
+	}{
+		"3.2": {
+			line:     `about to log metadata event: { _id: "host-2016-01-01T10:00:00-5686", server: "host", clientAddr: "127.0.0.1:5000", time: new Date(1451642400000), what: "moveChunk.start", ns: "test.foo", details: { min: { a: MinKey }, max: { a: 0.0 }, from: "shard0000", to: "shard0001" } }`,
+			expected: message.ShardingEvent{What: "moveChunk.start", Namespace: "test.foo", From: "shard0000", To: "shard0001", Duration: -1},
+		},
+		"aborted": {
+			line:     `about to log metadata event into changelog: { _id: "host-2018-05-15T10:00:00.000+0000-5afaa3a1", server: "host", clientAddr: "127.0.0.1:5000", time: new Date(1526378400000), what: "moveChunk.from", ns: "test.foo", details: { min: { a: 0.0 }, max: { a: MaxKey }, step 1 of 6: 0, step 2 of 6: 4, step 3 of 6: 12, to: "shard01", from: "shard00", note: "aborted", errmsg: "Data transfer error" } }`,
+			expected: message.ShardingEvent{What: "moveChunk.from", Namespace: "test.foo", From: "shard00", To: "shard01", Duration: 16, Note: "aborted", Error: "Data transfer error"},
+		},
+		"balancer": {
+			line:     `about to log metadata event into actionlog: { _id: "host-2018-05-15T10:00:00.000+0000-5afaa3a2", server: "host", clientAddr: "", time: new Date(1526378400000), what: "balancer.round", ns: "", details: { executionTimeMillis: 45, errorOccured: true, candidateChunks: 1, chunksMoved: 0 } }`,
+			expected: message.ShardingEvent{What: "balancer.round", Duration: 45, Error: "error occurred"},
+		},
+	} {
+		entry := record.Entry{Base: record.Base{RawMessage: test.line, Component: record.ComponentSharding}}
+		msg, err := commonParseMetadataEvent(entry, internal.NewRuneReader(test.line))
+		if err != nil {
+			t.Errorf("%s: unexpected error (%s)", name, err)
+			continue
+		}
+
+		event, ok := msg.(message.ShardingEvent)
+		if !ok {
+			t.Errorf("%s: expected a sharding event, got %T", name, msg)
+			continue
+		}
+
+		event.Details = nil
+		if !reflect.DeepEqual(event, test.expected) {
+			t.Errorf("%s: mismatch, got %+v", name, event)
+		}
+	}
+
+	line := `about to log metadata event: { what: "split", ns: "test.foo" }`
+	if _, err := commonParseMetadataEvent(record.Entry{Base: record.Base{RawMessage: line, Component: record.ComponentCommand}}, internal.NewRuneReader(line)); err == nil {
+		t.Errorf("events outside of the SHARDING component should not be parsed")
+	}
+}
+
+func TestCommonParseSetParameter(t *testing.T) {
+	for line, expected := range map[string]message.ParameterChange{
+		`successfully set parameter logLevel to 1 (was 0)`:                                    {Name: "logLevel", Value: "1", Previous: "0"},
+		`successfully set parameter cursorTimeoutMillis to 600000 (was 300000)`:               {Name: "cursorTimeoutMillis", Value: "600000", Previous: "300000"},
+		`successfully set parameter logComponentVerbosity to { query: 2 } (was { query: 0 })`: {Name: "logComponentVerbosity", Value: "{ query: 2 }", Previous: "{ query: 0 }"},
+		`successfully set parameter notablescan to true`:                                      {Name: "notablescan", Value: "true"},
+	} {
+		msg, err := commonParseSetParameter(internal.NewRuneReader(line))
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", line, err)
+		} else if msg != expected {
+			t.Errorf("parameter mismatch for '%s', got %+v", line, msg)
+		}
+	}
+
+	if _, err := commonParseSetParameter(internal.NewRuneReader(`successfully set parameter logLevel`)); err == nil {
+		t.Errorf("expected an error for a line without a value")
+	}
+}
+
+func TestCommonParseReplication(t *testing.T) {
+	for line, expected := range map[string]message.Message{
+		`election succeeded, assuming primary role in term 5`:         message.ElectionWon{Term: 5},
+		`replSet election succeeded, assuming primary role`:           message.ElectionWon{Term: -1},
+		`stepping down from primary, because a new term has begun: 6`: message.Stepdown{Reason: "a new term has begun: 6"},
+		`Stepping down from primary in response to replSetStepDown`:   message.Stepdown{Reason: "in response to replSetStepDown"},
+		`transition to PRIMARY from CATCHUP`:                          message.StateTransition{From: "CATCHUP", To: "PRIMARY"},
+		`transition to SECONDARY`:                                     message.StateTransition{To: "SECONDARY"},
+		`Member host2:27017 is now in state ROLLBACK`:                 message.StateTransition{Host: "host2:27017", To: "ROLLBACK"},
+	} {
+		var parse func(*internal.RuneReader) (message.Message, error)
+		switch {
+		case strings.Contains(line, "election succeeded"):
+			parse = commonParseElectionSucceeded
+		case strings.Contains(line, "tepping down"):
+			parse = commonParseStepdown
+		case strings.HasPrefix(line, "Member"):
+			parse = commonParseMemberState
+		default:
+			parse = commonParseStateTransition
+		}
+
+		msg, err := parse(internal.NewRuneReader(line))
+		if err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", line, err)
+		} else if msg != expected {
+			t.Errorf("mismatch for '%s', got %+v", line, msg)
+		}
+	}
+
+	if _, err := commonParseStateTransition(internal.NewRuneReader(`transition to primary complete; database writes are now permitted`)); err == nil {
+		t.Errorf("the end of a transition should not be parsed as a transition")
+	}
+}
@@ -34,6 +34,30 @@ func init() {
 		ex.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 		ex.RegisterForEntry("end connection", commonParseConnectionEnded)
 
+		// ACCESS component
+		ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+		ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+		ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+		ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+		// COMMAND component
+		ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+		// REPL component
+		ex.RegisterForReader("Member ", commonParseMemberState)
+		ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+		ex.RegisterForReader("replSet election succeeded", commonParseElectionSucceeded)
+		ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("transition to", commonParseStateTransition)
+
+		// INDEX component
+		ex.RegisterForReader("build index done", commonParseBuildIndexDone)
+		ex.RegisterForReader("build index on:", commonParseBuildIndex)
+
+		// SHARDING component
+		ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 		return &Version30Parser{
 			executor: ex,
 
@@ -75,6 +99,11 @@ func (v *Version30Parser) NewLogMessage(entry record.Entry) (message.Message, er
 	// specially parse preamble (query, remove, command, etc).
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, r, errorVersion30Unmatched)
+		}
+
 		c := r.PreviewWord(1)
 		if c == "query" || c == "getmore" {
 			return v.crud(false, r)
@@ -106,6 +135,8 @@ func (v *Version30Parser) command(r *internal.RuneReader) (message.Command, erro
 	cmd, err := CommandPreamble(r)
 	if err != nil {
 		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	err = MidLoop(r, "locks:", &cmd.BaseCommand, cmd.Counters, cmd.Payload, v.counters)
@@ -34,6 +34,29 @@ func init() {
 		ex.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 		ex.RegisterForEntry("end connection", commonParseConnectionEnded)
 
+		// ACCESS component
+		ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+		ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+		ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+		ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+		// COMMAND component
+		ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+		// REPL component
+		ex.RegisterForReader("Member ", commonParseMemberState)
+		ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+		ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("transition to", commonParseStateTransition)
+
+		// INDEX component
+		ex.RegisterForReader("build index done", commonParseBuildIndexDone)
+		ex.RegisterForReader("build index on:", commonParseBuildIndex)
+
+		// SHARDING component
+		ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 		return &Version32Parser{
 			counters: map[string]string{
 				"cursorid":         "cursorid",
@@ -72,6 +95,11 @@ func (v *Version32Parser) NewLogMessage(entry record.Entry) (message.Message, er
 
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, &r, errorVersion32Unmatched)
+		}
+
 		// query, getmore, insert, update = COMMAND
 		cmd, err := v.command(r)
 		if err != nil {
@@ -119,6 +147,8 @@ func (v Version32Parser) command(reader internal.RuneReader) (message.Command, e
 		// version 3.2 does not provide an agent string.
 		v.versionFlag = false
 		return message.Command{}, errorVersion32Unmatched
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	err = MidLoop(r, "locks:", &cmd.BaseCommand, cmd.Counters, cmd.Payload, v.counters)
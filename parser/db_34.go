@@ -35,6 +35,29 @@ func init() {
 		ex.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 		ex.RegisterForReader("received client metadata from", commonParseClientMetadata) // 3.4+
 
+		// ACCESS component
+		ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+		ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+		ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+		ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+		// COMMAND component
+		ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+		// REPL component
+		ex.RegisterForReader("Member ", commonParseMemberState)
+		ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+		ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("transition to", commonParseStateTransition)
+
+		// INDEX component
+		ex.RegisterForReader("build index done", commonParseBuildIndexDone)
+		ex.RegisterForReader("build index on:", commonParseBuildIndex)
+
+		// SHARDING component
+		ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 		return &Version34Parser{
 			counters: map[string]string{
 				"cursorid":         "cursorid",
@@ -81,6 +104,8 @@ func (v *Version34Parser) command(reader internal.RuneReader) (message.Command,
 	cmd, err := CommandPreamble(r)
 	if err != nil {
 		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	if r.ExpectString("originatingCommand:") {
@@ -155,6 +180,11 @@ func (v *Version34Parser) NewLogMessage(entry record.Entry) (message.Message, er
 	r := internal.NewRuneReader(entry.RawMessage)
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, r, errorVersion34Unmatched)
+		}
+
 		cmd, err := v.command(*r)
 		if err != nil {
 			return nil, err
@@ -33,6 +33,32 @@ func init() {
 		ex.RegisterForReader("waiting for connection", commonParseWaitingForConnections)
 		ex.RegisterForReader("received client metadata from", commonParseClientMetadata)
 
+		// ACCESS component
+		ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+		ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+		ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+		ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+		// COMMAND component
+		ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+		// REPL and REPL_HB components
+		ex.RegisterForReader("Error in heartbeat", commonParseHeartbeatError)
+		ex.RegisterForReader("Heartbeat to", commonParseHeartbeatFailed)
+		ex.RegisterForReader("Starting an election", commonParseElection)
+		ex.RegisterForReader("Member ", commonParseMemberState)
+		ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+		ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+		ex.RegisterForReader("transition to", commonParseStateTransition)
+
+		// INDEX component
+		ex.RegisterForReader("build index done", commonParseBuildIndexDone)
+		ex.RegisterForReader("build index on:", commonParseBuildIndex)
+
+		// SHARDING component
+		ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 		return &Version36Parser{
 			counters: map[string]string{
 				"cursorid":         "cursorid",
@@ -74,6 +100,11 @@ func (v *Version36Parser) NewLogMessage(entry record.Entry) (message.Message, er
 	r := internal.NewRuneReader(entry.RawMessage)
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, r, errorVersion36Unmatched)
+		}
+
 		cmd, err := v.command(*r)
 		if err != nil {
 			return nil, err
@@ -98,6 +129,8 @@ func (v *Version36Parser) command(reader internal.RuneReader) (message.Command,
 	cmd, err := CommandPreamble(r)
 	if err != nil {
 		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	if r.ExpectString("originatingCommand") {
@@ -130,7 +163,7 @@ func (v *Version36Parser) command(reader internal.RuneReader) (message.Command,
 		} else if l := len(param); l > 6 && param[:6] == "locks:" {
 			r.RewindSlurpWord()
 			break
-		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) {
+		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) && !LenientKeyValue(param, cmd.Counters) {
 			return message.Command{}, internal.CounterUnrecognized
 		}
 	}
@@ -182,9 +215,11 @@ func (v *Version36Parser) operation(reader internal.RuneReader) (message.Operati
 		return message.Operation{}, internal.OperationStructure
 	}
 
-	op.Payload, err = mongo.ParseJsonRunes(r, false)
+	op.Payload, op.Truncated, err = TruncatedPayload(r)
 	if err != nil {
 		return message.Operation{}, err
+	} else if PayloadCut(&op.BaseCommand, r) {
+		return op, nil
 	}
 
 	if r.ExpectString("originatingCommand:") {
@@ -217,7 +252,7 @@ func (v *Version36Parser) operation(reader internal.RuneReader) (message.Operati
 		} else if l := len(param); l > 6 && param[:6] == "locks:" {
 			r.RewindSlurpWord()
 			break
-		} else if !IntegerKeyValue(param, op.Counters, v.counters) {
+		} else if !IntegerKeyValue(param, op.Counters, v.counters) && !LenientKeyValue(param, op.Counters) {
 			return message.Operation{}, internal.CounterUnrecognized
 		}
 	}
@@ -34,10 +34,37 @@ func init() {
 	ex.RegisterForReader("waiting for connection", commonParseWaitingForConnections)
 	ex.RegisterForReader("received client metadata from", commonParseClientMetadata)
 
+	// ACCESS component
+	ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// COMMAND component
+	ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+	// REPL and REPL_HB components
+	ex.RegisterForReader("Error in heartbeat", commonParseHeartbeatError)
+	ex.RegisterForReader("Heartbeat to", commonParseHeartbeatFailed)
+	ex.RegisterForReader("Starting an election", commonParseElection)
+	ex.RegisterForReader("Member ", commonParseMemberState)
+	ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+	ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+	ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+	ex.RegisterForReader("transition to", commonParseStateTransition)
+
+	// INDEX component
+	ex.RegisterForReader("build index done", commonParseBuildIndexDone)
+	ex.RegisterForReader("build index on:", commonParseBuildIndex)
+
+	// SHARDING component
+	ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 	version.Factory.Register(func() version.Parser {
 		return &Version40Parser{
 			counters: map[string]string{
 				"cursorid":         "cursorid",
+				"durationMicros":   "durationMicros",
 				"notoreturn":       "ntoreturn",
 				"ntoskip":          "ntoskip",
 				"exhaust":          "exhaust",
@@ -76,6 +103,11 @@ func (v *Version40Parser) NewLogMessage(entry record.Entry) (message.Message, er
 	r := internal.NewRuneReader(entry.RawMessage)
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, r, errorVersion40Unmatched)
+		}
+
 		cmd, err := v.command(*r)
 		if err != nil {
 			return nil, err
@@ -100,6 +132,8 @@ func (v *Version40Parser) command(reader internal.RuneReader) (message.Command,
 	cmd, err := CommandPreamble(r)
 	if err != nil {
 		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	if r.ExpectString("originatingCommand") {
@@ -121,18 +155,23 @@ func (v *Version40Parser) command(reader internal.RuneReader) (message.Command,
 	}
 
 	for {
-		param, ok := r.SlurpWord()
-		if !ok {
+		// The counters end where the locks begin.
+		if next, ok := r.PeekWord(); !ok || (len(next) > 6 && next[:6] == "locks:") {
 			break
-		} else if param == "exception:" {
-			cmd.Exception, ok = Exception(r)
+		}
+
+		param, _ := r.SlurpWord()
+		if param == "exception:" {
+			exception, ok := Exception(r)
 			if !ok {
 				return message.Command{}, internal.UnexpectedExceptionFormat
 			}
-		} else if l := len(param); l > 6 && param[:6] == "locks:" {
-			r.RewindSlurpWord()
-			break
-		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) {
+			cmd.Exception = exception
+		} else if ok, err := TransactionKeyValue(param, &cmd.BaseCommand, r); err != nil {
+			return message.Command{}, err
+		} else if ok {
+			continue
+		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) && !LenientKeyValue(param, cmd.Counters) {
 			return message.Command{}, internal.CounterUnrecognized
 		}
 	}
@@ -192,10 +231,13 @@ func (v *Version40Parser) operation(reader internal.RuneReader) (message.Operati
 		return message.Operation{}, internal.OperationStructure
 	}
 
-	op.Payload, err = mongo.ParseJsonRunes(r, false)
+	op.Payload, op.Truncated, err = TruncatedPayload(r)
 	if err != nil {
 		return message.Operation{}, err
+	} else if PayloadCut(&op.BaseCommand, r) {
+		return op, nil
 	}
+	TransactionPayload(op.Payload, &op.BaseCommand)
 
 	if r.ExpectString("originatingCommand:") {
 		r.Skip(19).ChompWS()
@@ -216,18 +258,23 @@ func (v *Version40Parser) operation(reader internal.RuneReader) (message.Operati
 	}
 
 	for {
-		param, ok := r.SlurpWord()
-		if !ok {
+		// The counters end where the locks begin.
+		if next, ok := r.PeekWord(); !ok || (len(next) > 6 && next[:6] == "locks:") {
 			break
-		} else if param == "exception:" {
-			op.Exception, ok = Exception(r)
+		}
+
+		param, _ := r.SlurpWord()
+		if param == "exception:" {
+			exception, ok := Exception(r)
 			if !ok {
 				return message.Operation{}, internal.UnexpectedExceptionFormat
 			}
-		} else if l := len(param); l > 6 && param[:6] == "locks:" {
-			r.RewindSlurpWord()
-			break
-		} else if !IntegerKeyValue(param, op.Counters, v.counters) {
+			op.Exception = exception
+		} else if ok, err := TransactionKeyValue(param, &op.BaseCommand, r); err != nil {
+			return message.Operation{}, err
+		} else if ok {
+			continue
+		} else if !IntegerKeyValue(param, op.Counters, v.counters) && !LenientKeyValue(param, op.Counters) {
 			return message.Operation{}, internal.CounterUnrecognized
 		}
 	}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"testing"
+
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+func TestVersion40Parser_Transaction(t *testing.T) {
+	var parser version.Parser
+	for _, p := range version.Factory.GetAll() {
+		if _, ok := p.(*Version40Parser); ok {
+			parser = p
+		}
+	}
+	if parser == nil {
+		t.Fatalf("the 4.0 parser is not registered")
+	}
+
+	lsid := `lsid: { id: UUID("1b3a8d2c-1b5e-4c3f-9d4e-0a1b2c3d4e5f"), uid: BinData(0, E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855) }`
+	for name, test := range map[string]struct {
+		line             string
+		multi, start     bool
+		txnNumber        int64
+		counted, hasLsid bool
+	}{
+		"start": {
+			line:  `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, ` + lsid + `, txnNumber: 3, autocommit: false, startTransaction: true, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+			multi: true, start: true, txnNumber: 3, hasLsid: true,
+		},
+		"commit": {
+			line:  `command admin.$cmd appName: "MongoDB Shell" command: commitTransaction { commitTransaction: 1, ` + lsid + `, txnNumber: 3, autocommit: false, $db: "admin" } numYields:0 reslen:38 locks:{} storage:{} protocol:op_msg 4ms`,
+			multi: true, txnNumber: 3, hasLsid: true,
+		},
+		"counters": {
+			line:  `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 txnNumber:4 autocommit:false ` + lsid + ` reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+			multi: true, txnNumber: 4, counted: true, hasLsid: true,
+		},
+		"none": {
+			line: `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} storage:{} protocol:op_msg 10ms`,
+		},
+	} {
+		msg, err := parser.NewLogMessage(record.Entry{Base: record.Base{RawMessage: test.line, Component: record.ComponentCommand}})
+		if err != nil {
+			t.Errorf("%s: unexpected error (%s)", name, err)
+			continue
+		}
+
+		base, ok := message.BaseFromMessage(msg)
+		if !ok {
+			t.Errorf("%s: expected a command, got %T", name, msg)
+			continue
+		}
+
+		txn := base.Transaction
+		if txn.Multi != test.multi || txn.Start != test.start || txn.TxnNumber != test.txnNumber || (txn.Lsid != nil) != test.hasLsid {
+			t.Errorf("%s: transaction mismatch, got %+v", name, txn)
+		} else if _, ok := base.Counters["txnNumber"]; ok != test.counted {
+			t.Errorf("%s: txnNumber counter mismatch, got %v", name, base.Counters)
+		} else if test.counted && base.Counters["nreturned"] != 1 {
+			t.Errorf("%s: counters following the transaction fields are missing, got %v", name, base.Counters)
+		}
+	}
+}
@@ -34,32 +34,60 @@ func init() {
 	ex.RegisterForReader("waiting for connection", commonParseWaitingForConnections)
 	ex.RegisterForReader("received client metadata from", commonParseClientMetadata)
 
+	// ACCESS component
+	ex.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	ex.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	ex.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	ex.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// COMMAND component
+	ex.RegisterForReader("successfully set parameter", commonParseSetParameter)
+
+	// REPL and REPL_HB components
+	ex.RegisterForReader("Error in heartbeat", commonParseHeartbeatError)
+	ex.RegisterForReader("Heartbeat to", commonParseHeartbeatFailed)
+	ex.RegisterForReader("Starting an election", commonParseElection)
+	ex.RegisterForReader("Member ", commonParseMemberState)
+	ex.RegisterForReader("Stepping down from primary", commonParseStepdown)
+	ex.RegisterForReader("election succeeded", commonParseElectionSucceeded)
+	ex.RegisterForReader("stepping down from primary", commonParseStepdown)
+	ex.RegisterForReader("transition to", commonParseStateTransition)
+
+	// INDEX component
+	ex.RegisterForReader("index build: done building", commonParseIndexBuildDone)
+	ex.RegisterForReader("index build: starting on", commonParseIndexBuildStarting)
+
+	// SHARDING component
+	ex.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
+
 	version.Factory.Register(func() version.Parser {
 		return &Version42Parser{
 			counters: map[string]string{
-				"cursorid":         "cursorid",
-				"notoreturn":       "ntoreturn",
-				"ntoskip":          "ntoskip",
-				"exhaust":          "exhaust",
-				"keysExamined":     "keysExamined",
-				"docsExamined":     "docsExamined",
-				"hasSortStage":     "hasSortStage",
-				"fromMultiPlanner": "fromMultiPlanner",
-				"replanned":        "replanned",
-				"nMatched":         "nmatched",
-				"nModified":        "nmodified",
-				"ninserted":        "ninserted",
-				"ndeleted":         "ndeleted",
-				"nreturned":        "nreturned",
-				"fastmodinsert":    "fastmodinsert",
-				"upsert":           "upsert",
-				"cursorExhausted":  "cursorExhausted",
-				"nmoved":           "nmoved",
-				"keysInserted":     "keysInserted",
-				"keysDeleted":      "keysDeleted",
-				"writeConflicts":   "writeConflicts",
-				"numYields":        "numYields",
-				"reslen":           "reslen",
+				"cursorid":           "cursorid",
+				"durationMicros":     "durationMicros",
+				"notoreturn":         "ntoreturn",
+				"ntoskip":            "ntoskip",
+				"exhaust":            "exhaust",
+				"keysExamined":       "keysExamined",
+				"docsExamined":       "docsExamined",
+				"hasSortStage":       "hasSortStage",
+				"fromMultiPlanner":   "fromMultiPlanner",
+				"replanned":          "replanned",
+				"planningTimeMicros": "planningTimeMicros",
+				"nMatched":           "nmatched",
+				"nModified":          "nmodified",
+				"ninserted":          "ninserted",
+				"ndeleted":           "ndeleted",
+				"nreturned":          "nreturned",
+				"fastmodinsert":      "fastmodinsert",
+				"upsert":             "upsert",
+				"cursorExhausted":    "cursorExhausted",
+				"nmoved":             "nmoved",
+				"keysInserted":       "keysInserted",
+				"keysDeleted":        "keysDeleted",
+				"writeConflicts":     "writeConflicts",
+				"numYields":          "numYields",
+				"reslen":             "reslen",
 			},
 
 			executor: ex,
@@ -76,6 +104,11 @@ func (v *Version42Parser) NewLogMessage(entry record.Entry) (message.Message, er
 	r := internal.NewRuneReader(entry.RawMessage)
 	switch entry.Component {
 	case record.ComponentCommand:
+		if r.ExpectString("successfully set parameter") {
+			// Parameter changes are logged by COMMAND but are not operations.
+			return v.executor.Run(entry, r, errorVersion42Unmatched)
+		}
+
 		cmd, err := v.command(*r)
 		if err != nil {
 			return nil, err
@@ -100,6 +133,8 @@ func (v *Version42Parser) command(reader internal.RuneReader) (message.Command,
 	cmd, err := CommandPreamble(r)
 	if err != nil {
 		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
 	}
 
 	if r.ExpectString("originatingCommand") {
@@ -132,7 +167,11 @@ func (v *Version42Parser) command(reader internal.RuneReader) (message.Command,
 		} else if l := len(param); l > 6 && param[:6] == "locks:" {
 			r.RewindSlurpWord()
 			break
-		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) {
+		} else if ok, err := TransactionKeyValue(param, &cmd.BaseCommand, r); err != nil {
+			return message.Command{}, err
+		} else if ok {
+			continue
+		} else if !IntegerKeyValue(param, cmd.Counters, v.counters) && !HashKeyValue(param, &cmd.BaseCommand) && !LenientKeyValue(param, cmd.Counters) {
 			return message.Command{}, internal.CounterUnrecognized
 		}
 	}
@@ -192,10 +231,13 @@ func (v *Version42Parser) operation(reader internal.RuneReader) (message.Operati
 		return message.Operation{}, internal.OperationStructure
 	}
 
-	op.Payload, err = mongo.ParseJsonRunes(r, false)
+	op.Payload, op.Truncated, err = TruncatedPayload(r)
 	if err != nil {
 		return message.Operation{}, err
+	} else if PayloadCut(&op.BaseCommand, r) {
+		return op, nil
 	}
+	TransactionPayload(op.Payload, &op.BaseCommand)
 
 	if r.ExpectString("originatingCommand:") {
 		r.Skip(19).ChompWS()
@@ -227,7 +269,11 @@ func (v *Version42Parser) operation(reader internal.RuneReader) (message.Operati
 		} else if l := len(param); l > 6 && param[:6] == "locks:" {
 			r.RewindSlurpWord()
 			break
-		} else if !IntegerKeyValue(param, op.Counters, v.counters) {
+		} else if ok, err := TransactionKeyValue(param, &op.BaseCommand, r); err != nil {
+			return message.Operation{}, err
+		} else if ok {
+			continue
+		} else if !IntegerKeyValue(param, op.Counters, v.counters) && !HashKeyValue(param, &op.BaseCommand) && !LenientKeyValue(param, op.Counters) {
 			return message.Operation{}, internal.CounterUnrecognized
 		}
 	}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"testing"
+
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+func TestVersion42Parser_QueryHash(t *testing.T) {
+	var parser version.Parser
+	for _, p := range version.Factory.GetAll() {
+		if _, ok := p.(*Version42Parser); ok {
+			parser = p
+		}
+	}
+	if parser == nil {
+		t.Fatalf("the 4.2 parser is not registered")
+	}
+
+	for name, line := range map[string]string{
+		"command":   `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 queryHash:4B53BE76 planCacheKey:0FF3F3F6 reslen:229 locks:{} storage:{} protocol:op_msg 120ms`,
+		"operation": `update test.foo command: { q: { a: 1 }, u: { $set: { b: 1 } }, multi: false, upsert: false } planSummary: IXSCAN { a: 1 } keysExamined:1 docsExamined:1 nMatched:1 nModified:1 numYields:0 queryHash:4B53BE76 planCacheKey:0FF3F3F6 locks:{} storage:{} 120ms`,
+	} {
+		entry := record.Entry{Base: record.Base{RawMessage: line, Component: record.ComponentCommand}}
+		if name == "operation" {
+			entry.Component = record.ComponentWrite
+		}
+
+		msg, err := parser.NewLogMessage(entry)
+		if err != nil {
+			t.Errorf("%s: unexpected error (%s)", name, err)
+			continue
+		}
+
+		base, ok := message.BaseFromMessage(msg)
+		if !ok {
+			t.Errorf("%s: expected a command, got %T", name, msg)
+		} else if base.QueryHash != "4B53BE76" || base.PlanCacheKey != "0FF3F3F6" {
+			t.Errorf("%s: hash mismatch, got %s and %s", name, base.QueryHash, base.PlanCacheKey)
+		} else if base.Counters["nreturned"] != 1 && base.Counters["nModified"] != 1 {
+			t.Errorf("%s: counters mismatch, got %v", name, base.Counters)
+		}
+	}
+
+	doc, err := mongo.ParseJson(`{"attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"IXSCAN { a: 1 }","queryHash":"4B53BE76","planCacheKey":"0FF3F3F6","durationMillis":120}}`, false)
+	if err != nil {
+		t.Fatalf("unexpected error parsing fixture (%s)", err)
+	}
+	attr, _ := doc["attr"].(map[string]interface{})
+	if cmd, err := StructuredCommand(attr); err != nil {
+		t.Errorf("structured: unexpected error (%s)", err)
+	} else if cmd.QueryHash != "4B53BE76" || cmd.PlanCacheKey != "0FF3F3F6" {
+		t.Errorf("structured: hash mismatch, got %s and %s", cmd.QueryHash, cmd.PlanCacheKey)
+	}
+}
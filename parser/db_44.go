@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+// Version 4.4 (and later) writes structured logs, so messages are built from
+// the attributes of each line rather than by parsing the message text.
+type Version44Parser struct{}
+
+var errorVersion44Unmatched = internal.VersionUnmatched{Message: "version 4.4"}
+
+func init() {
+	version.Factory.Register(func() version.Parser {
+		return &Version44Parser{}
+	})
+}
+
+func (v *Version44Parser) Check(base record.Base) bool {
+	return base.Attributes != nil
+}
+
+func (v *Version44Parser) NewLogMessage(entry record.Entry) (message.Message, error) {
+	attr := entry.Attributes
+
+	switch entry.RawMessage {
+	case "Build Info":
+		// The version is nested within the build info document, and is
+		// reported as-is since every later version shares this format.
+		info, _ := attr["buildInfo"].(map[string]interface{})
+		if number, ok := info["version"].(string); ok {
+			return message.BuildInfo{BuildInfo: number}, nil
+		}
+		return nil, internal.UnexpectedVersionFormat
+
+	case "Slow query":
+		if kind, _ := attr["type"].(string); kind != "" && kind != "command" {
+			op, err := StructuredOperation(attr)
+			if err != nil {
+				return nil, err
+			}
+			// Attributes too large to log are listed under "truncated".
+			op.Truncated = op.Truncated || entry.Truncated
+			return CrudOrMessage(op, op.Operation, op.Counters, op.Payload), nil
+		}
+
+		cmd, err := StructuredCommand(attr)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Truncated = cmd.Truncated || entry.Truncated
+		return CrudOrMessage(cmd, cmd.Command, cmd.Counters, cmd.Payload), nil
+
+	case "client metadata":
+		doc, _ := attr["doc"].(map[string]interface{})
+		client, _ := attr["client"].(string)
+		remote, _ := attr["remote"].(string)
+
+		conn := message.Connection{Opened: true}
+		if strings.HasPrefix(client, "conn") {
+			conn.Conn, _ = strconv.Atoi(client[4:])
+		}
+		if host, port, err := net.SplitHostPort(remote); err == nil {
+			conn.Address = net.ParseIP(host)
+			if value, err := strconv.ParseUint(port, 10, 16); err == nil {
+				conn.Port = uint16(value)
+			}
+		}
+		return clientMetadata(conn, doc), nil
+
+	case "Successfully authenticated", "Authentication succeeded", "Authentication failed":
+		auth := message.Authentication{Failed: entry.RawMessage == "Authentication failed"}
+		auth.Principal, _ = attr["principalName"].(string)
+		auth.Database, _ = attr["authenticationDatabase"].(string)
+		auth.Mechanism, _ = attr["mechanism"].(string)
+		auth.Error, _ = attr["error"].(string)
+
+		remote, _ := attr["remote"].(string)
+		if host, _, err := net.SplitHostPort(remote); err == nil {
+			auth.IP = host
+		}
+		return auth, nil
+
+	case "Options set by command line":
+		options, _ := attr["options"].(map[string]interface{})
+		return message.StartupOptions{Options: options}, nil
+
+	case "Profiler settings changed":
+		from, _ := attr["from"].(map[string]interface{})
+		to, _ := attr["to"].(map[string]interface{})
+
+		change := message.ProfilerChange{Level: -1, Slowms: -1, SampleRate: -1, PreviousLevel: -1, PreviousSlowms: -1}
+		if level, ok := structuredInteger(to["level"]); ok {
+			change.Level = int(level)
+		}
+		if level, ok := structuredInteger(from["level"]); ok {
+			change.PreviousLevel = int(level)
+		}
+		if slowms, ok := structuredInteger(to["slowms"]); ok {
+			change.Slowms = slowms
+		}
+		if slowms, ok := structuredInteger(from["slowms"]); ok {
+			change.PreviousSlowms = slowms
+		}
+		switch rate := to["sampleRate"].(type) {
+		case float64:
+			change.SampleRate = rate
+		case int:
+			change.SampleRate = float64(rate)
+		}
+		return change, nil
+
+	case "Successfully set parameter to new value":
+		name, _ := attr["parameterName"].(string)
+		return message.ParameterChange{
+			Name:     name,
+			Value:    structuredString(attr["newValue"]),
+			Previous: structuredString(attr["oldValue"]),
+		}, nil
+
+	case "Index build: starting":
+		ns, _ := attr["namespace"].(string)
+		properties, _ := attr["properties"].(map[string]interface{})
+		name, _ := properties["name"].(string)
+		method, _ := attr["method"].(string)
+		return message.IndexBuild{Namespace: ns, Name: name, Method: strings.ToLower(method), Properties: properties}, nil
+
+	case "Index build: done building":
+		ns, _ := attr["namespace"].(string)
+		name, _ := attr["index"].(string)
+		return message.IndexBuildDone{Namespace: ns, Name: name, Seconds: -1}, nil
+
+	case "Replica set state transition":
+		transition := message.StateTransition{}
+		transition.To, _ = attr["newState"].(string)
+		transition.From, _ = attr["oldState"].(string)
+		return transition, nil
+
+	case "Member is in new state":
+		transition := message.StateTransition{}
+		transition.Host, _ = attr["hostAndPort"].(string)
+		transition.To, _ = attr["newState"].(string)
+		return transition, nil
+
+	case "Election succeeded, assuming primary role":
+		term, ok := structuredInteger(attr["term"])
+		if !ok {
+			term = -1
+		}
+		return message.ElectionWon{Term: term}, nil
+
+	default:
+		// Elections and stepdowns keep the reason in the message text.
+		switch {
+		case strings.HasPrefix(entry.RawMessage, "Starting an election"):
+			return commonParseElection(internal.NewRuneReader(entry.RawMessage))
+		case strings.HasPrefix(entry.RawMessage, "Stepping down from primary"):
+			return commonParseStepdown(internal.NewRuneReader(entry.RawMessage))
+		}
+		return nil, errorVersion44Unmatched
+	}
+}
+
+func (v *Version44Parser) Version() version.Definition {
+	return version.Definition{Major: 4, Minor: 4, Binary: record.BinaryMongod}
+}
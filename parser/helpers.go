@@ -8,8 +8,12 @@
 package parser
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"mgotools/internal"
 	"mgotools/mongo"
@@ -56,9 +60,10 @@ func CommandPreamble(r *internal.RuneReader) (message.Command, error) {
 				r.RewindSlurpWord()
 			}
 
-			if cmd.Payload, err = mongo.ParseJsonRunes(r, false); err != nil {
+			if cmd.Payload, cmd.Truncated, err = TruncatedPayload(r); err != nil {
 				return message.Command{}, err
 			}
+			TransactionPayload(cmd.Payload, &cmd.BaseCommand)
 		}
 
 		cmd.Namespace = NamespaceReplace(cmd.Command, cmd.Payload, cmd.Namespace)
@@ -75,6 +80,22 @@ func CheckCounterVersionError(err error, v error) (bool, error) {
 	return false, err
 }
 
+// Comments are usually strings but may be any value, e.g. a document of
+// tracing fields, which is kept as JSON so that equal comments compare equal.
+func Comment(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+
+	if out, err := json.Marshal(value); err == nil {
+		return string(out)
+	}
+	return fmt.Sprint(value)
+}
+
 func Crud(op string, counters map[string]int64, payload message.Payload) (message.CRUD, bool) {
 	if payload == nil {
 		return message.CRUD{}, false
@@ -96,16 +117,23 @@ func Crud(op string, counters map[string]int64, payload message.Payload) (messag
 	}
 
 	cursorId, _ := counters["cursorid"]
-	comment, _ := payload["$comment"].(string)
+	// Commands take a comment field, while legacy queries take a $comment
+	// modifier alongside the query or within it.
+	comment := Comment(payload["comment"])
 	if comment == "" {
-		comment, _ = filter["$comment"].(string)
-		delete(filter, "$comment")
+		comment = Comment(payload["$comment"])
 	}
+	if comment == "" {
+		comment = Comment(filter["$comment"])
+	}
+	delete(filter, "$comment")
 
 	if _, explain := filter["$explain"]; explain {
 		delete(filter, "$explain")
 	}
 
+	hint := Hint(payload, filter)
+
 	delete(payload, "$maxScan")
 	delete(payload, "$returnKey")
 	delete(payload, "$showDiskLoc")
@@ -120,37 +148,85 @@ func Crud(op string, counters map[string]int64, payload message.Payload) (messag
 		}
 	}
 
+	var crud message.CRUD
+
 	switch internal.StringToLower(op) {
+	case "aggregate":
+		crud, ok = aggregate(comment, cursorId, counters, payload)
+
 	case "find":
-		return find(comment, cursorId, counters, payload)
+		crud, ok = find(comment, cursorId, counters, payload)
 
 	case "query":
-		return query(comment, cursorId, counters, filter)
+		crud, ok = query(comment, cursorId, counters, filter)
 
 	case "update":
-		return update(comment, counters, filter, changes)
+		crud, ok = update(comment, counters, filter, changes)
 
 	case "remove":
-		return remove(comment, counters, filter)
+		crud, ok = remove(comment, counters, filter)
 
 	case "insert":
-		return insert(comment, counters)
+		crud, ok = insert(comment, counters)
 
 	case "count":
-		return count(filter, payload)
+		crud, ok = count(filter, payload)
 
 	case "findandmodify":
-		return findAndModify(cursorId, counters, filter, payload)
+		crud, ok = findAndModify(cursorId, counters, filter, payload)
 
 	case "geonear":
-		return geoNear(cursorId, filter, payload)
+		crud, ok = geoNear(cursorId, filter, payload)
 
 	case "getmore":
-		crud := getMore(cursorId, filter, payload)
-		return crud, true
+		crud, ok = getMore(comment, cursorId, counters, filter, payload), true
+		if origin, found := payload["originatingCommand"].(map[string]interface{}); found && hint == "" {
+			hint = Hint(origin, nil)
+		}
+
+	default:
+		ok = false
+	}
+
+	if ok {
+		crud.Hint = hint
+	}
+
+	return crud, ok
+}
+
+// Aggregation pipelines keep the name of each stage, and use a leading $match
+// stage as the filter.
+func aggregate(comment string, cursorId int64, counters map[string]int64, payload message.Payload) (message.CRUD, bool) {
+	pipeline, ok := payload["pipeline"].([]interface{})
+	if !ok {
+		return message.CRUD{}, false
+	}
+
+	c := message.CRUD{
+		Comment:  comment,
+		CursorId: cursorId,
+		Filter:   message.Filter{},
+		N:        counters["nreturned"],
+		Pipeline: make([]string, 0, len(pipeline)),
+	}
+
+	for index, stage := range pipeline {
+		stage, ok := stage.(map[string]interface{})
+		if !ok {
+			return message.CRUD{}, false
+		}
+
+		for name, value := range stage {
+			c.Pipeline = append(c.Pipeline, name)
+
+			if match, ok := value.(map[string]interface{}); ok && index == 0 && name == "$match" {
+				c.Filter = match
+			}
+		}
 	}
 
-	return message.CRUD{}, false
+	return c, true
 }
 
 func cleanQueryWithoutSort(c *message.CRUD, query map[string]interface{}) {
@@ -185,19 +261,27 @@ func CrudOrMessage(obj message.Message, term string, counters map[string]int64,
 }
 
 // Returns a duration given a RuneReader. Expects a time in the format
-// of <int>ms.
+// of <int>ms, which is normally the last word of a line. Any trailing words
+// (e.g. metadata appended by log shippers) are ignored.
 func Duration(r *internal.RuneReader) (int64, error) {
-	if word, ok := r.SlurpWord(); !ok {
+	word, ok := r.SlurpWord()
+	if !ok {
 		return 0, internal.UnexpectedEOL
-	} else if !strings.HasSuffix(word, "ms") {
-		return 0, internal.MisplacedWordException
-	} else if dur, err := strconv.ParseInt(word[:len(word)-2], 10, 64); err != nil {
-		return 0, err
-	} else if dur < 0 {
-		return 0, nil
-	} else {
-		return dur, nil
 	}
+
+	for ; ok; word, ok = r.SlurpWord() {
+		if !strings.HasSuffix(word, "ms") {
+			continue
+		} else if dur, err := strconv.ParseInt(word[:len(word)-2], 10, 64); err != nil {
+			continue
+		} else if dur < 0 {
+			return 0, nil
+		} else {
+			return dur, nil
+		}
+	}
+
+	return 0, internal.MisplacedWordException
 }
 
 func insert(comment string, counters map[string]int64) (message.CRUD, bool) {
@@ -211,6 +295,42 @@ func insert(comment string, counters map[string]int64) (message.CRUD, bool) {
 	return crud, true
 }
 
+// Returns the index name forced by a hint, which may either be an index name
+// or a key pattern document. Key patterns are converted to the default index
+// name (e.g. { a: 1, b: -1 } becomes "a_1_b_-1").
+func Hint(payload message.Payload, filter map[string]interface{}) string {
+	value, ok := filter["$hint"]
+	if ok {
+		// Legacy queries wrap modifiers alongside the filter, which should
+		// not become part of the query pattern.
+		delete(filter, "$hint")
+	} else if value, ok = payload["hint"]; !ok {
+		value = payload["$hint"]
+	}
+
+	switch t := value.(type) {
+	case string:
+		return t
+
+	case map[string]interface{}:
+		// The original key order is lost when parsing, so the name will only
+		// match the index name exactly for single key indexes.
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		parts := make([]string, 0, len(keys)*2)
+		for _, key := range keys {
+			parts = append(parts, key, fmt.Sprint(t[key]))
+		}
+		return strings.Join(parts, "_")
+	}
+
+	return ""
+}
+
 func IntegerKeyValue(source string, target map[string]int64, limit map[string]string) bool {
 	if key, num, ok := internal.StringDoubleSplit(source, ':'); ok && num != "" {
 		if _, ok := limit[key]; ok {
@@ -232,6 +352,114 @@ func IntegerKeyValue(source string, target map[string]int64, limit map[string]st
 	return false
 }
 
+// Versions 4.2 and later log the hash of the query shape (queryHash) and
+// the key of its plan cache entry (planCacheKey) alongside the counters.
+// Both are hexadecimal strings rather than integers.
+func HashKeyValue(source string, base *message.BaseCommand) bool {
+	key, value, ok := internal.StringDoubleSplit(source, ':')
+	if !ok || value == "" {
+		return false
+	}
+
+	for _, r := range value {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'F' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+
+	switch key {
+	case "queryHash":
+		base.QueryHash = value
+	case "planCacheKey":
+		base.PlanCacheKey = value
+	default:
+		return false
+	}
+	return true
+}
+
+// Transaction fields are usually part of the command document, but may also
+// be logged alongside the counters (e.g. txnNumber:1 autocommit:false).
+func TransactionKeyValue(param string, base *message.BaseCommand, r *internal.RuneReader) (bool, error) {
+	key, value, _ := internal.StringDoubleSplit(param, ':')
+	switch key {
+	case "txnNumber":
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false, nil
+		}
+		base.Counters["txnNumber"] = number
+		base.Transaction.TxnNumber = number
+
+	case "autocommit":
+		if value != "true" && value != "false" {
+			return false, nil
+		}
+		base.Transaction.Multi = value == "false"
+
+	case "lsid":
+		// The session id is a document, e.g. lsid:{ id: UUID("...") }.
+		r.RewindSlurpWord()
+		r.Skip(5).ChompWS()
+
+		lsid, err := mongo.ParseJsonRunes(r, false)
+		if err != nil {
+			return false, err
+		}
+		base.Transaction.Lsid = lsid
+
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// Copies the transaction fields of a command document.
+func TransactionPayload(payload message.Payload, base *message.BaseCommand) {
+	if lsid, ok := payload["lsid"].(map[string]interface{}); ok {
+		base.Transaction.Lsid = lsid
+	}
+	if number, ok := structuredInteger(payload["txnNumber"]); ok {
+		base.Transaction.TxnNumber = number
+	}
+	if autocommit, ok := payload["autocommit"].(bool); ok {
+		base.Transaction.Multi = !autocommit
+	}
+	if start, ok := payload["startTransaction"].(bool); ok {
+		base.Transaction.Start = start
+	}
+}
+
+// Lenient parsing accepts numeric key:value pairs that a version does not
+// recognize instead of rejecting the line. Logs re-emitted by other tools
+// sometimes include extra (often cumulative) counters.
+var Lenient = false
+
+// Accepts any numeric key:value pair when parsing leniently. Only pairs that
+// look like examination counters (e.g. totalRecordsExamined, collectionScans)
+// are kept since the rest have no meaning to the report.
+func LenientKeyValue(source string, target map[string]int64) bool {
+	if !Lenient {
+		return false
+	}
+
+	key, num, ok := internal.StringDoubleSplit(source, ':')
+	if !ok || key == "" {
+		return false
+	}
+
+	count, err := strconv.ParseInt(num, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if strings.HasSuffix(key, "Examined") || strings.HasSuffix(key, "Scans") {
+		target[key] = count
+	}
+	return true
+}
+
 func Exception(r *internal.RuneReader) (string, bool) {
 	start := r.Pos()
 	if exception, ok := r.ScanFor("numYields:"); !ok {
@@ -296,13 +524,33 @@ func geoNear(cursorId int64, query map[string]interface{}, payload message.Paylo
 	}, true
 }
 
-func getMore(cursorId int64, filter map[string]interface{}, payload message.Payload) message.CRUD {
+// A getMore takes the filter (and pipeline) of the command that opened its
+// cursor so it can be attributed to the same pattern.
+func getMore(comment string, cursorId int64, counters map[string]int64, filter map[string]interface{}, payload message.Payload) message.CRUD {
 	crud := message.CRUD{CursorId: cursorId}
-	if originatingCommand, ok := payload["originatingCommand"].(map[string]interface{}); ok {
-		if filter, ok = originatingCommand["filter"].(map[string]interface{}); ok {
-			crud.Filter = filter
+	originatingCommand, ok := payload["originatingCommand"].(map[string]interface{})
+	if !ok {
+		return crud
+	}
+	if comment == "" {
+		comment = Comment(originatingCommand["comment"])
+	}
+
+	if _, ok := originatingCommand["aggregate"]; ok {
+		if origin, ok := aggregate(comment, cursorId, counters, originatingCommand); ok {
+			origin.Origin = "aggregate"
+			return origin
+		}
+	} else if _, ok := originatingCommand["find"]; ok {
+		if origin, ok := find(comment, cursorId, counters, originatingCommand); ok {
+			origin.Origin = "find"
+			return origin
 		}
 	}
+
+	if filter, ok = originatingCommand["filter"].(map[string]interface{}); ok {
+		crud.Filter = filter
+	}
 	return crud
 }
 
@@ -341,7 +589,7 @@ func MidLoop(r *internal.RuneReader, stop string, base *message.BaseCommand, cou
 			r.RewindSlurpWord()
 			break
 		}
-		if !IntegerKeyValue(param, counters, check) {
+		if !IntegerKeyValue(param, counters, check) && !HashKeyValue(param, base) && !LenientKeyValue(param, counters) {
 			return internal.CounterUnrecognized
 		}
 	}
@@ -399,6 +647,59 @@ func Payload(r *internal.RuneReader) (payload message.Payload, err error) {
 	return
 }
 
+// Parses the payload of an operation, which the server cuts short when it is
+// too large to log. A payload cut short ends the line with "..." and keeps
+// only the values logged in full, while a payload with a value replaced by
+// $truncated is otherwise complete. Either is reported as truncated.
+func TruncatedPayload(r *internal.RuneReader) (message.Payload, bool, error) {
+	start := r.Pos()
+
+	payload, err := mongo.ParseJsonRunes(r, false)
+	if err == nil {
+		return payload, truncatedValue(payload), nil
+	}
+
+	r.Seek(start, 0)
+	if remainder := strings.TrimSpace(r.Remainder()); strings.HasSuffix(remainder, "...") {
+		if partial, cutErr := mongo.ParseJsonTruncated(strings.TrimSuffix(remainder, "...")); cutErr == nil {
+			return partial, true, nil
+		}
+	}
+	return nil, false, err
+}
+
+// Nothing is logged after a payload that was cut short, so the rest of the
+// operation (e.g. its counters and duration) is unknown and the command is
+// marked as cut.
+func PayloadCut(cmd *message.BaseCommand, r *internal.RuneReader) bool {
+	cmd.Cut = cmd.Truncated && r.EOL()
+	return cmd.Cut
+}
+
+// Whether any document within a value has a $truncated field.
+func truncatedValue(value interface{}) bool {
+	switch t := value.(type) {
+	case message.Payload:
+		return truncatedValue(map[string]interface{}(t))
+	case map[string]interface{}:
+		if _, ok := t["$truncated"]; ok {
+			return true
+		}
+		for _, item := range t {
+			if truncatedValue(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range t {
+			if truncatedValue(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func PlanSummary(r *internal.RuneReader) ([]message.PlanSummary, error) {
 	var out []message.PlanSummary
 	for {
@@ -411,24 +712,27 @@ func PlanSummary(r *internal.RuneReader) ([]message.PlanSummary, error) {
 				return nil, err
 			} else {
 				// The plan summary parsed as valid JSON, so record the operation and fall-through.
-				out = append(out, message.PlanSummary{op, summary})
+				out = append(out, message.PlanSummary{Type: op, Key: summary})
 			}
-			if r.NextRune() != ',' {
-				// There are no other plans so exit plan summary parsing.
-				break
-			} else {
+			if r.NextRune() == ',' {
 				// There are more plans, so continue to run by repeating the for loop.
 				r.Next()
 				continue
+			} else if !planStageFollows(r) {
+				// There are no other plans so exit plan summary parsing.
+				break
 			}
 		} else if length := len(op); length > 2 && op[length-1] == ',' {
 			// This is needed for repeated bare words (e.g. planSummary: COLLSCAN, COLLSCAN).
-			out = append(out, message.PlanSummary{op[:length-1], nil})
+			out = append(out, message.PlanSummary{Type: op[:length-1]})
 			continue
 		} else {
-			// Finally, the plan summary is boring and only includes a single word (e.g. COLLSCAN).
-			out = append(out, message.PlanSummary{op, nil})
-			break
+			// The plan summary includes a single word (e.g. COLLSCAN), which
+			// may be followed by other stages without a comma (e.g. FETCH COLLSCAN).
+			out = append(out, message.PlanSummary{Type: op})
+			if !planStageFollows(r) {
+				break
+			}
 		}
 	}
 	if len(out) == 0 {
@@ -438,6 +742,22 @@ func PlanSummary(r *internal.RuneReader) ([]message.PlanSummary, error) {
 	return out, nil
 }
 
+// Whether the next word is the name of a plan stage, which are written in
+// upper case (e.g. IXSCAN or SORT_KEY_GENERATOR) unlike the counters that
+// follow a plan summary.
+func planStageFollows(r *internal.RuneReader) bool {
+	word, ok := r.PeekWord()
+	if word = strings.TrimSuffix(word, ","); !ok || word == "" || !unicode.IsUpper(rune(word[0])) {
+		return false
+	}
+	for _, c := range word {
+		if !unicode.IsUpper(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
 func Preamble(r *internal.RuneReader) (cmd, ns, op string, err error) {
 	if word, ok := r.SlurpWord(); !ok {
 		err = internal.UnexpectedEOL
@@ -3,10 +3,14 @@ package parser
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"mgotools/internal"
+	"mgotools/mongo"
 	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
 )
 
 func TestCheckCounterVersionError(t *testing.T) {
@@ -103,6 +107,13 @@ func TestDuration(t *testing.T) {
 		`-1ms`: {0, nil},
 		``:     {0, internal.UnexpectedEOL},
 		`ok`:   {0, internal.MisplacedWordException},
+
+		`10ms 12345`:          {10, nil},
+		`25ms seq=9 host=a`:   {25, nil},
+		`ok 5ms`:              {5, nil},
+		`ms 1.5ms 2ms`:        {2, nil},
+		`1.5ms`:               {0, internal.MisplacedWordException},
+		`garbage after words`: {0, internal.MisplacedWordException},
 	}
 	for m, r := range s {
 		n, e := Duration(internal.NewRuneReader(m))
@@ -112,6 +123,112 @@ func TestDuration(t *testing.T) {
 	}
 }
 
+func TestComment(t *testing.T) {
+	type R struct {
+		Op      string
+		Comment string
+		Filter  message.Filter
+	}
+	s := map[string]R{
+		`{ find: "foo", filter: { a: 1 }, comment: "report" }`:                   {"find", "report", message.Filter{"a": 1}},
+		`{ find: "foo", filter: { a: 1 }, comment: { trace: "abc", n: 2 } }`:     {"find", `{"n":2,"trace":"abc"}`, message.Filter{"a": 1}},
+		`{ query: { query: { a: 1 }, $comment: "report" } }`:                     {"query", "report", message.Filter{"a": 1}},
+		`{ query: { a: 1, $comment: "report" } }`:                                {"query", "report", message.Filter{"a": 1}},
+		`{ q: { a: 1 }, u: { $set: { b: 1 } }, comment: "report", multi: true }`: {"update", "report", message.Filter{"a": 1}},
+		`{ find: "foo", filter: { a: 1 } }`:                                      {"find", "", message.Filter{"a": 1}},
+	}
+	for m, r := range s {
+		payload, err := mongo.ParseJson(m, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s (%s)", m, err)
+		}
+
+		crud, ok := Crud(r.Op, map[string]int64{}, payload)
+		if !ok {
+			t.Errorf("Crud failed for %s", m)
+		} else if crud.Comment != r.Comment {
+			t.Errorf("Comment mismatch: expected '%s', got '%s' (%s)", r.Comment, crud.Comment, m)
+		} else if !reflect.DeepEqual(crud.Filter, r.Filter) {
+			t.Errorf("Filter mismatch: expected %#v, got %#v (%s)", r.Filter, crud.Filter, m)
+		}
+	}
+}
+
+func TestHint(t *testing.T) {
+	type R struct {
+		Op     string
+		Hint   string
+		Filter message.Filter
+	}
+	s := map[string]R{
+		`{ find: "foo", filter: { a: 1 }, hint: "myindex_1" }`:           {"find", "myindex_1", message.Filter{"a": 1}},
+		`{ find: "foo", filter: { a: 1 }, hint: { a: 1 } }`:              {"find", "a_1", message.Filter{"a": 1}},
+		`{ find: "foo", filter: { a: 1 }, hint: { $natural: -1 } }`:      {"find", "$natural_-1", message.Filter{"a": 1}},
+		`{ find: "foo", filter: { a: 1, b: 1 }, hint: { b: -1, a: 1 } }`: {"find", "a_1_b_-1", message.Filter{"a": 1, "b": 1}},
+		`{ query: { query: { a: 1 }, $hint: "a_1" } }`:                   {"query", "a_1", message.Filter{"a": 1}},
+		`{ query: { query: { a: 1 }, $hint: { a: 1 } } }`:                {"query", "a_1", message.Filter{"a": 1}},
+		`{ query: { a: 1 } }`: {"query", "", message.Filter{"a": 1}},
+		`{ q: { a: 1 }, u: { $set: { b: 1 } }, hint: { a: 1 }, multi: true }`: {"update", "a_1", message.Filter{"a": 1}},
+	}
+	for m, r := range s {
+		payload, err := mongo.ParseJson(m, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing %s (%s)", m, err)
+		}
+
+		crud, ok := Crud(r.Op, map[string]int64{}, payload)
+		if !ok {
+			t.Errorf("Crud failed for %s", m)
+		} else if crud.Hint != r.Hint {
+			t.Errorf("Hint mismatch: expected '%s', got '%s' (%s)", r.Hint, crud.Hint, m)
+		} else if !reflect.DeepEqual(crud.Filter, r.Filter) {
+			t.Errorf("Filter mismatch: expected %#v, got %#v (%s)", r.Filter, crud.Filter, m)
+		}
+	}
+}
+
+func TestPlanSummary(t *testing.T) {
+	type test struct {
+		Summary   string
+		Expected  []message.PlanSummary
+		Remainder string
+	}
+
+	for _, test := range []test{
+		{"COLLSCAN", []message.PlanSummary{{Type: "COLLSCAN"}}, ""},
+		{"COLLSCAN keysExamined:0 docsExamined:1", []message.PlanSummary{{Type: "COLLSCAN"}}, "keysExamined:0 docsExamined:1"},
+		{"IXSCAN { a: 1 } keysExamined:1", []message.PlanSummary{{Type: "IXSCAN", Key: map[string]interface{}{"a": 1}}}, "keysExamined:1"},
+		{"IXSCAN { a: 1 }, IXSCAN { b: -1 } keysExamined:2", []message.PlanSummary{
+			{Type: "IXSCAN", Key: map[string]interface{}{"a": 1}},
+			{Type: "IXSCAN", Key: map[string]interface{}{"b": -1}},
+		}, "keysExamined:2"},
+		{"COLLSCAN, COLLSCAN", []message.PlanSummary{{Type: "COLLSCAN"}, {Type: "COLLSCAN"}}, ""},
+		{"FETCH COLLSCAN numYields:0", []message.PlanSummary{{Type: "FETCH"}, {Type: "COLLSCAN"}}, "numYields:0"},
+		{"SORT_KEY_GENERATOR, IXSCAN { a: 1 } FETCH nreturned:1", []message.PlanSummary{
+			{Type: "SORT_KEY_GENERATOR"},
+			{Type: "IXSCAN", Key: map[string]interface{}{"a": 1}},
+			{Type: "FETCH"},
+		}, "nreturned:1"},
+		{"IXSCAN { a: 1, b: { c: 1, d: \"hashed\" } }, IXSCAN { loc: \"2dsphere\" }", []message.PlanSummary{
+			{Type: "IXSCAN", Key: map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 1, "d": "hashed"}}},
+			{Type: "IXSCAN", Key: map[string]interface{}{"loc": "2dsphere"}},
+		}, ""},
+	} {
+		r := internal.NewRuneReader(test.Summary)
+		if summary, err := PlanSummary(r); err != nil {
+			t.Errorf("unexpected error parsing '%s' (%s)", test.Summary, err)
+		} else if !reflect.DeepEqual(summary, test.Expected) {
+			t.Errorf("plan summary mismatch for '%s', got %#v", test.Summary, summary)
+		} else if remainder := strings.TrimSpace(r.Remainder()); remainder != test.Remainder {
+			t.Errorf("expected '%s' after '%s', got '%s'", test.Remainder, test.Summary, remainder)
+		}
+	}
+
+	if _, err := PlanSummary(internal.NewRuneReader("")); err != internal.NoPlanSummaryFound {
+		t.Errorf("expected NoPlanSummaryFound, got %v", err)
+	}
+}
+
 func TestPreamble(t *testing.T) {
 	cmd, ns, op, err := Preamble(internal.NewRuneReader("command test.$cmd command:"))
 	if cmd != "command" || ns != "test.$cmd" || op != "command" || err != nil {
@@ -150,3 +267,48 @@ func TestOperationPreamble(t *testing.T) {
 		t.Errorf("Values differ (%s, %s, %s)", op.Operation, op.Namespace, err)
 	}
 }
+
+func TestLenientKeyValue(t *testing.T) {
+	var parser version.Parser
+	for _, check := range version.Factory.GetAll() {
+		if v := check.Version(); v.Equals(version.Definition{Major: 3, Minor: 6, Binary: record.BinaryMongod}) {
+			parser = check
+		}
+	}
+	if parser == nil {
+		t.Fatal("3.6 parser not registered")
+	}
+
+	entry := record.Entry{Base: record.Base{
+		Component:  record.ComponentCommand,
+		Severity:   record.SeverityI,
+		RawMessage: `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:10 totalRecordsExamined:500 collectionScans:3 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`,
+	}}
+
+	defer func() { Lenient = false }()
+
+	Lenient = false
+	if _, err := parser.NewLogMessage(entry); err == nil {
+		t.Error("unrecognized counters should be rejected without lenient parsing")
+	}
+
+	Lenient = true
+	msg, err := parser.NewLogMessage(entry)
+	if err != nil {
+		t.Fatalf("line should parse leniently, got error (%s)", err)
+	}
+
+	base, _ := message.BaseFromMessage(msg)
+	if base.Duration != 10 || base.Counters["docsExamined"] != 10 {
+		t.Errorf("known fields are incorrect: %+v", base)
+	} else if base.Counters["totalRecordsExamined"] != 500 || base.Counters["collectionScans"] != 3 {
+		t.Errorf("examination counters should be kept, got %v", base.Counters)
+	}
+
+	counters := map[string]int64{}
+	if !LenientKeyValue("madeUpField:12", counters) || len(counters) != 0 {
+		t.Errorf("other numeric fields should be accepted but discarded, got %v", counters)
+	} else if LenientKeyValue("madeUpField:abc", counters) {
+		t.Error("non-numeric fields should not be accepted")
+	}
+}
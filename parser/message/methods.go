@@ -51,6 +51,15 @@ func BaseFromMessage(msg Message) (*BaseCommand, bool) {
 	}
 }
 
+// Returns the duration in microseconds, preferring the high resolution
+// durationMicros counter when the log provides one.
+func (b BaseCommand) DurationMicros() int64 {
+	if micros, ok := b.Counters["durationMicros"]; ok {
+		return micros
+	}
+	return b.Duration * 1000
+}
+
 func PayloadFromMessage(msg Message) (*Payload, bool) {
 	if msg == nil {
 		return &Payload{}, false
@@ -69,6 +78,34 @@ func PayloadFromMessage(msg Message) (*Payload, bool) {
 	}
 }
 
+func StorageFromMessage(msg Message) (map[string]interface{}, bool) {
+	switch t := msg.(type) {
+	case Command:
+		return t.Storage, t.Storage != nil
+	case Operation:
+		return t.Storage, t.Storage != nil
+	case CRUD:
+		return StorageFromMessage(t.Message)
+	default:
+		return nil, false
+	}
+}
+
+// Legacy (2.x) messages only log the time locks were held, not the time
+// spent acquiring them, so only their counterparts since 3.0 have locks.
+func LocksFromMessage(msg Message) (map[string]interface{}, bool) {
+	switch t := msg.(type) {
+	case Command:
+		return t.Locks, len(t.Locks) > 0
+	case Operation:
+		return t.Locks, len(t.Locks) > 0
+	case CRUD:
+		return LocksFromMessage(t.Message)
+	default:
+		return nil, false
+	}
+}
+
 func MakeCommand() Command {
 	return Command{
 		BaseCommand: BaseCommand{
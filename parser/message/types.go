@@ -5,9 +5,16 @@ import "net"
 type Message interface {
 }
 
+// An authentication attempt. The address of the client is only logged by
+// some versions (and some failures) and the error is empty on success.
 type Authentication struct {
 	Principal string
 	IP        string
+
+	Database  string
+	Mechanism string
+	Failed    bool
+	Error     string
 }
 
 type BuildInfo struct {
@@ -26,10 +33,59 @@ type Connection struct {
 type ConnectionMeta struct {
 	Connection
 	Meta interface{}
+
+	// The application name (if the client set one) and the driver name and
+	// version, e.g. "nodejs 3.6.0", from the metadata document.
+	AppName string
+	Driver  string
+
+	// The driver name and version separately, the operating system type
+	// (e.g. "Linux") and architecture, and the platform the driver runs on,
+	// e.g. "CPython 3.6.7.final.0".
+	DriverName    string
+	DriverVersion string
+	OS            string
+	Architecture  string
+	Platform      string
+}
+
+type Election struct {
+	Reason string
+}
+
+// An election won by this node, which became primary in the term (or -1 for
+// protocol version 0, which has no terms).
+type ElectionWon struct {
+	Term int64
 }
 
 type Empty struct{}
 
+type HeartbeatFailure struct {
+	Host   string
+	Reason string
+}
+
+// The start of an index build. The method is foreground or background
+// before 4.2, and hybrid afterwards.
+type IndexBuild struct {
+	Namespace  string
+	Name       string
+	Method     string
+	Properties map[string]interface{}
+}
+
+// The completion of an index build. Versions before 4.2 only log the number
+// of records scanned and the duration in seconds (the namespace and name are
+// empty), while later versions only log the namespace and name (the duration
+// is -1).
+type IndexBuildDone struct {
+	Namespace string
+	Name      string
+	Scanned   int64
+	Seconds   int64
+}
+
 type Journal string
 
 type Listening struct{}
@@ -38,6 +94,54 @@ type OpenSSL struct {
 	String string
 }
 
+// A server parameter changed at runtime with setParameter. The values are
+// logged as text and the previous value is empty when it was not logged.
+type ParameterChange struct {
+	Name     string
+	Value    string
+	Previous string
+}
+
+// A change to the profiler settings, i.e. the profiling level and the slow
+// operation threshold (slowms) that also decides which operations are logged.
+// Settings that were not logged are -1.
+type ProfilerChange struct {
+	Level      int
+	Slowms     int64
+	SampleRate float64
+
+	PreviousLevel  int
+	PreviousSlowms int64
+}
+
+// A refresh of the routing table (chunk versions) of a sharded collection,
+// e.g. after a migration made the cached version stale. The version is the
+// one found by the refresh and the duration is in milliseconds.
+type RoutingRefresh struct {
+	Namespace string
+	Version   string
+	Duration  int64
+}
+
+// An event recorded in the config server's changelog (e.g. the steps of a
+// chunk migration or a split) or actionlog (e.g. a balancer round). The
+// shards are only set by migrations and the duration is in milliseconds, or
+// -1 for events that don't log one.
+type ShardingEvent struct {
+	What      string
+	Namespace string
+	From      string
+	To        string
+	Duration  int64
+
+	// The outcome noted by the final step of a migration ("success" or
+	// "aborted") and the reason a migration or balancer round failed.
+	Note  string
+	Error string
+
+	Details map[string]interface{}
+}
+
 type Shutdown struct {
 	String string
 }
@@ -63,6 +167,21 @@ type StartupOptions struct {
 	Options interface{}
 }
 
+// A replica set member changing state, e.g. from SECONDARY to PRIMARY. The
+// host is empty for the node writing the log and the previous state is only
+// logged by some versions for that node.
+type StateTransition struct {
+	Host string
+	From string
+	To   string
+}
+
+// This node stepping down from primary and the reason it gave, e.g. a
+// replSetStepDown command or a higher term seen from another member.
+type Stepdown struct {
+	Reason string
+}
+
 type Version struct {
 	Binary   string
 	Major    int
@@ -84,6 +203,33 @@ type BaseCommand struct {
 	Exception   string
 	Namespace   string
 	PlanSummary []PlanSummary
+
+	// The query shape hash and plan cache key (4.2+), as hex strings.
+	QueryHash    string
+	PlanCacheKey string
+
+	Transaction Transaction
+
+	// Whether the server truncated the payload because it was too large to
+	// log, so the payload (and any pattern built from it) is incomplete.
+	Truncated bool
+
+	// Whether the line ended with a payload cut short, so nothing after it
+	// (e.g. the counters and duration) was logged.
+	Cut bool
+}
+
+// The session and transaction of an operation (4.0+). Retryable writes log a
+// txnNumber without autocommit, while every operation within a multi-document
+// transaction logs autocommit: false.
+type Transaction struct {
+	Lsid      map[string]interface{}
+	TxnNumber int64
+
+	// Whether the operation belongs to a multi-document transaction
+	// (autocommit: false) and whether it started the transaction.
+	Multi bool
+	Start bool
 }
 
 type Payload map[string]interface{}
@@ -142,8 +288,15 @@ type CRUD struct {
 	Comment  string
 	CursorId int64
 	Filter   Filter
+	Hint     string
 	N        int64
+	Pipeline []string
 	Project  Project
 	Sort     Sort
 	Update   Update
+
+	// The command that opened the cursor of a getMore (e.g. find or
+	// aggregate), whose filter and pipeline the getMore carries. Empty when
+	// the originating command was not logged.
+	Origin string
 }
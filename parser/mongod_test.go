@@ -15,10 +15,17 @@ func TestMongod_Network(t *testing.T) {
 		"waiting for connections":                     message.Listening{},
 	}
 
-	mongod := mongod{}
+	// Network lines are parsed by the reader registered for their prefix.
+	network := func(r *internal.RuneReader) (message.Message, error) {
+		if r.ExpectString("waiting for connections") {
+			return commonParseWaitingForConnections(r)
+		}
+		return commonParseConnectionAccepted(r)
+	}
+
 	for value, expected := range valid {
 		r := internal.NewRuneReader(value)
-		got, err := mongod.Network(*r)
+		got, err := network(r)
 		if err != nil {
 			t.Errorf("network parse failed, got: %s", err)
 		} else if !reflect.DeepEqual(expected, got) {
@@ -34,9 +41,41 @@ func TestMongod_Network(t *testing.T) {
 
 	for _, value := range invalid {
 		r := internal.NewRuneReader(value)
-		msg, err := mongod.Network(*r)
+		msg, err := network(r)
 		if err == nil || msg != nil {
 			t.Errorf("network should have failed on '%s' (%v)", value, msg)
 		}
 	}
 }
+
+func TestCommonParseClientMetadata(t *testing.T) {
+	line := `received client metadata from 127.0.0.1:53342 conn12: { application: { name: "reporting" }, driver: { name: "nodejs", version: "3.6.0" }, os: { type: "Linux" } }`
+	msg, err := commonParseClientMetadata(internal.NewRuneReader(line))
+	if err != nil {
+		t.Fatalf("client metadata parse failed, got: %s", err)
+	}
+
+	meta, ok := msg.(message.ConnectionMeta)
+	if !ok {
+		t.Fatalf("expected client metadata, got %T", msg)
+	} else if meta.Conn != 12 || meta.Port != 53342 || !meta.Address.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("connection mismatch, got %+v", meta.Connection)
+	} else if meta.AppName != "reporting" || meta.Driver != "nodejs 3.6.0" {
+		t.Errorf("metadata mismatch, got %q and %q", meta.AppName, meta.Driver)
+	}
+
+	line = `received client metadata from 10.1.2.3:41822 conn3021: { driver: { name: "PyMongo", version: "3.7.2" }, os: { type: "Linux", name: "Linux", architecture: "x86_64", version: "4.15.0-45-generic" }, platform: "CPython 3.6.7.final.0" }`
+	msg, err = commonParseClientMetadata(internal.NewRuneReader(line))
+	if meta, ok := msg.(message.ConnectionMeta); err != nil || !ok {
+		t.Errorf("driver metadata parse failed, got %+v (%v)", msg, err)
+	} else if meta.DriverName != "PyMongo" || meta.DriverVersion != "3.7.2" || meta.Driver != "PyMongo 3.7.2" {
+		t.Errorf("driver mismatch, got %q, %q, and %q", meta.DriverName, meta.DriverVersion, meta.Driver)
+	} else if meta.OS != "Linux" || meta.Architecture != "x86_64" || meta.Platform != "CPython 3.6.7.final.0" || meta.AppName != "" {
+		t.Errorf("platform mismatch, got %+v", meta)
+	}
+
+	msg, err = commonParseClientMetadata(internal.NewRuneReader(`received client metadata from 127.0.0.1:53342 conn12: { driver: { name: "mongo-go-driver", version: "v1.4.0" } }`))
+	if meta, ok := msg.(message.ConnectionMeta); err != nil || !ok || meta.AppName != "" || meta.Driver != "mongo-go-driver v1.4.0" {
+		t.Errorf("metadata without an application mismatch, got %+v (%v)", msg, err)
+	}
+}
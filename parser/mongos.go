@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"strconv"
+	"strings"
+
 	"mgotools/internal"
+	"mgotools/parser/executor"
 	"mgotools/parser/message"
+	"mgotools/parser/record"
 )
 
 func mongosParseStartupOptions(r *internal.RuneReader) (message.Message, error) {
@@ -28,3 +33,158 @@ func mongosParseVersion(r *internal.RuneReader) (message.Message, error) {
 		}, nil
 	}
 }
+
+// ChunkManager: time to load chunks for test.foo: 0ms sequenceNumber: 2 version: 1|0||5a5e4f9c0a2b7e1d2c3b4a59 based on: (empty)
+func mongosParseChunkManager(r *internal.RuneReader) (message.Message, error) {
+	ns, ok := r.SkipWords(6).SlurpWord()
+	if !ok || !strings.HasSuffix(ns, ":") {
+		return nil, internal.UnexpectedValue
+	}
+
+	refresh := message.RoutingRefresh{Namespace: strings.TrimSuffix(ns, ":")}
+	if word, ok := r.SlurpWord(); !ok || !strings.HasSuffix(word, "ms") {
+		return nil, internal.UnexpectedValue
+	} else if dur, err := strconv.ParseInt(strings.TrimSuffix(word, "ms"), 10, 64); err != nil {
+		return nil, internal.UnexpectedValue
+	} else {
+		refresh.Duration = dur
+	}
+
+	for word, ok := r.SlurpWord(); ok; word, ok = r.SlurpWord() {
+		if word == "version:" {
+			refresh.Version, _ = r.SlurpWord()
+			break
+		}
+	}
+	return refresh, nil
+}
+
+// Refresh for collection test.foo took 3 ms and found version 1|0||5b...
+// Refresh for collection test.foo from version 1|0||5b... to version 2|0||5b... took 3 ms
+func mongosParseRefresh(r *internal.RuneReader) (message.Message, error) {
+	ns, ok := r.SkipWords(3).SlurpWord()
+	if !ok {
+		return nil, internal.UnexpectedEOL
+	}
+
+	refresh := message.RoutingRefresh{Namespace: ns, Duration: -1}
+	for word, ok := r.SlurpWord(); ok; word, ok = r.SlurpWord() {
+		switch word {
+		case "took":
+			value, _ := r.SlurpWord()
+			dur, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, internal.UnexpectedValue
+			}
+			refresh.Duration = dur
+
+		case "version":
+			// The version found by the refresh is always the last one.
+			refresh.Version, _ = r.SlurpWord()
+		}
+	}
+
+	if refresh.Duration < 0 {
+		return nil, internal.UnexpectedValue
+	}
+	return refresh, nil
+}
+
+// Parses a line logged by a mongos, where slow operations are logged by the
+// COMMAND component and everything else is matched by the executor. Slow
+// operations that the version could not have logged (e.g. an older version
+// with a newer protocol) fail the check.
+func mongosLogMessage(entry record.Entry, ex *executor.Executor, check func(message.Command) bool, unmatched error) (message.Message, error) {
+	r := internal.NewRuneReader(entry.RawMessage)
+	if entry.Component != record.ComponentCommand || !r.ExpectString("command ") {
+		return ex.Run(entry, r, unmatched)
+	}
+
+	cmd, err := mongosCommand(*r, unmatched)
+	if err != nil {
+		return nil, err
+	} else if check != nil && !check(cmd) {
+		return nil, unmatched
+	}
+	return CrudOrMessage(cmd, cmd.Command, cmd.Counters, cmd.Payload), nil
+}
+
+// command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } numYields:0 reslen:216 locks:{} protocol:op_msg 115ms
+//
+// A mongos routes operations to the shards, so it never logs a plan, the
+// documents or keys examined, or any locks held. Lines that do can only be
+// logged by a mongod.
+func mongosCommand(reader internal.RuneReader, unmatched error) (message.Command, error) {
+	r := &reader
+
+	cmd, err := CommandPreamble(r)
+	if err != nil {
+		return message.Command{}, err
+	} else if PayloadCut(&cmd.BaseCommand, r) {
+		return cmd, nil
+	}
+
+	err = MidLoop(r, "protocol:", &cmd.BaseCommand, cmd.Counters, cmd.Payload, nil)
+	if err != nil {
+		return message.Command{}, err
+	} else if len(cmd.PlanSummary) > 0 {
+		return message.Command{}, unmatched
+	}
+	for _, counter := range []string{"docsExamined", "keysExamined"} {
+		if _, ok := cmd.Counters[counter]; ok {
+			return message.Command{}, unmatched
+		}
+	}
+
+	if r.ExpectString("locks:") {
+		if cmd.Locks, err = Locks(r); err != nil {
+			return message.Command{}, err
+		} else if len(cmd.Locks) > 0 {
+			return message.Command{}, unmatched
+		}
+	}
+
+	if cmd.Protocol, err = Protocol(r); err != nil {
+		return message.Command{}, err
+	}
+	if cmd.Duration, err = Duration(r); err != nil {
+		return message.Command{}, err
+	}
+
+	return cmd, nil
+}
+
+// Whether a line could have been logged by a mongos. Besides components that
+// only a mongod logs, slow operations with a plan can only come from a mongod.
+func mongosCheck(base record.Base) bool {
+	if base.Severity == record.SeverityNone || !mongosExpectedComponents(base.Component) {
+		return false
+	}
+	return base.Component != record.ComponentCommand || !strings.Contains(base.RawMessage, " planSummary: ")
+}
+
+// Components logged by a mongos. Anything to do with storage, indexes, or
+// replication is only logged by a mongod.
+func mongosExpectedComponents(c record.Component) bool {
+	switch c {
+	case record.ComponentAccess,
+		record.ComponentAccessControl,
+		record.ComponentASIO,
+		record.ComponentBridge,
+		record.ComponentCommand,
+		record.ComponentConnPool,
+		record.ComponentControl,
+		record.ComponentDefault,
+		record.ComponentExecutor,
+		record.ComponentFTDC,
+		record.ComponentNetwork,
+		record.ComponentQuery,
+		record.ComponentSharding,
+		record.ComponentTotal,
+		record.ComponentTracking,
+		record.ComponentUnknown:
+		return true
+	default:
+		return false
+	}
+}
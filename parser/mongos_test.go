@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/source"
+	"mgotools/parser/version"
+)
+
+func TestMongosParsers(t *testing.T) {
+	parsers := make(map[version.Definition]version.Parser)
+	for _, p := range version.Factory.GetAll() {
+		parsers[p.Version()] = p
+	}
+
+	for _, test := range []struct {
+		minor   int
+		query   string
+		routing string
+		version string
+	}{
+		{
+			minor:   2,
+			query:   `command test.foo command: find { find: "foo", filter: { a: 1 } } numYields:0 reslen:216 locks:{} protocol:op_command 115ms`,
+			routing: `ChunkManager: time to load chunks for test.foo: 3ms sequenceNumber: 2 version: 1|0||5a5e4f9c0a2b7e1d2c3b4a59 based on: (empty)`,
+			version: "1|0||5a5e4f9c0a2b7e1d2c3b4a59",
+		},
+		{
+			minor:   4,
+			query:   `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 } } numYields:0 reslen:216 locks:{} protocol:op_command 115ms`,
+			routing: `ChunkManager: time to load chunks for test.foo: 3ms sequenceNumber: 4 version: 2|1||5a5e4f9c0a2b7e1d2c3b4a59 based on: 1|0||5a5e4f9c0a2b7e1d2c3b4a59`,
+			version: "2|1||5a5e4f9c0a2b7e1d2c3b4a59",
+		},
+		{
+			minor:   6,
+			query:   `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } numYields:0 reslen:216 protocol:op_msg 115ms`,
+			routing: `Refresh for collection test.foo took 3 ms and found version 1|0||5afaa3a1b2c3d4e5f6a7b8c9`,
+			version: "1|0||5afaa3a1b2c3d4e5f6a7b8c9",
+		},
+		{
+			minor:   8,
+			query:   `command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1 }, $db: "test" } numYields:0 reslen:216 protocol:op_msg 115ms`,
+			routing: `Refresh for collection test.foo from version 1|0||5afaa3a1b2c3d4e5f6a7b8c9 to version 2|0||5afaa3a1b2c3d4e5f6a7b8c9 took 3 ms`,
+			version: "2|0||5afaa3a1b2c3d4e5f6a7b8c9",
+		},
+	} {
+		definition := version.Definition{Major: 3, Minor: test.minor, Binary: record.BinaryMongos}
+		if test.minor == 8 {
+			definition.Major, definition.Minor = 4, 0
+		}
+
+		parser, ok := parsers[definition]
+		if !ok {
+			t.Errorf("%s is not registered", definition)
+			continue
+		}
+
+		entry := func(component record.Component, line string) record.Entry {
+			return record.Entry{Base: record.Base{RawMessage: line, Component: component, Severity: record.SeverityI}}
+		}
+
+		query := entry(record.ComponentCommand, test.query)
+		if !parser.Check(query.Base) {
+			t.Errorf("%s: slow query rejected", definition)
+		} else if msg, err := parser.NewLogMessage(query); err != nil {
+			t.Errorf("%s: unexpected error parsing a slow query (%s)", definition, err)
+		} else if crud, ok := msg.(message.CRUD); !ok {
+			t.Errorf("%s: expected a CRUD message, got %T", definition, msg)
+		} else if cmd, ok := crud.Message.(message.Command); !ok || cmd.Namespace != "test.foo" || cmd.Command != "find" || cmd.Duration != 115 || cmd.Counters["reslen"] != 216 {
+			t.Errorf("%s: slow query mismatch, got %+v", definition, crud.Message)
+		}
+
+		routing := entry(record.ComponentSharding, test.routing)
+		if msg, err := parser.NewLogMessage(routing); err != nil {
+			t.Errorf("%s: unexpected error parsing a routing refresh (%s)", definition, err)
+		} else if refresh, ok := msg.(message.RoutingRefresh); !ok || refresh != (message.RoutingRefresh{Namespace: "test.foo", Version: test.version, Duration: 3}) {
+			t.Errorf("%s: routing refresh mismatch, got %+v", definition, msg)
+		}
+
+		// Lines that only a mongod logs.
+		if parser.Check(entry(record.ComponentStorage, "WiredTiger message").Base) {
+			t.Errorf("%s: STORAGE lines should be rejected", definition)
+		}
+		if parser.Check(entry(record.ComponentCommand, `command test.foo command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 numYields:0 reslen:216 locks:{} protocol:op_msg 1ms`).Base) {
+			t.Errorf("%s: slow queries with a plan should be rejected", definition)
+		}
+		if msg, _ := parser.NewLogMessage(entry(record.ComponentCommand, `command test.foo command: find { find: "foo", filter: { a: 1 } } numYields:0 reslen:216 locks:{ Global: { acquireCount: { r: 2 } } } protocol:op_command 1ms`)); msg != nil {
+			t.Errorf("%s: slow queries holding locks should not be parsed, got %+v", definition, msg)
+		}
+	}
+}
+
+func TestMongosParsers_Guess(t *testing.T) {
+	lines := []string{
+		`2018-05-15T10:00:00.000+0000 I STORAGE  [initandlisten] wiredtiger_open config: create,cache_size=256M`,
+		`2018-05-15T10:00:01.000+0000 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: 1.0 }, $db: "test" } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:216 locks:{ Global: { acquireCount: { r: 2 } } } protocol:op_msg 115ms`,
+	}
+
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	log, err := source.NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+	for log.Next() {
+		if base, err := log.Get(); err == nil {
+			context.NewEntry(base)
+		}
+	}
+
+	for _, definition := range context.Versions() {
+		if definition.Binary == record.BinaryMongos {
+			t.Errorf("mongod lines should reject %s", definition)
+		}
+	}
+}
@@ -210,6 +210,12 @@ type Base struct {
 	RawContext string
 	RawMessage string
 	Severity   Severity
+
+	// Structured (4.4+) log lines keep the details of the message in
+	// attributes, which are never nil for those lines. Documents too large
+	// for the log are truncated and flagged by the server.
+	Attributes map[string]interface{}
+	Truncated  bool
 }
 
 func NewSeverity(s string) (Severity, bool) {
@@ -11,40 +11,41 @@ import "mgotools/internal"
 
 // ref: /mongo/src/mongo/db/curop.cpp
 var COUNTERS = map[string]string{
-	"cursorExhausted":  "cursorExhausted",
-	"cursorid":         "cursorid",
-	"docsExamined":     "docsExamined",
-	"fastmod":          "fastmod",
-	"fastmodinsert":    "fastmodinsert",
-	"exhaust":          "exhaust",
-	"fromMultiPlanner": "fromMultiPlanner",
-	"hasSortStage":     "hasSortStage",
-	"idhack":           "idhack",
-	"keysDeleted":      "keysDeleted",
-	"keysExamined":     "keysExamined",
-	"keysInserted":     "keysInserted",
-	"ndeleted":         "ndeleted",
-	"nDeleted":         "ndeleted",
-	"ninserted":        "ninserted",
-	"nInserted":        "ninserted",
-	"nmatched":         "nmatched",
-	"nMatched":         "nmatched",
-	"nmodified":        "nmodified",
-	"nModified":        "nmodified",
-	"nmoved":           "nmoved",
-	"nscanned":         "keysExamined",
-	"nscannedObjects":  "docsExamined",
-	"nreturned":        "nreturned",
-	"ntoreturn":        "ntoreturn",
-	"ntoskip":          "notoskip",
-	"planSummary":      "planSummary",
-	"numYields":        "numYields",
-	"keyUpdates":       "keyUpdates",
-	"replanned":        "replanned",
-	"reslen":           "reslen",
-	"scanAndOrder":     "scanAndOrder",
-	"upsert":           "upsert",
-	"writeConflicts":   "writeConflicts",
+	"cursorExhausted":    "cursorExhausted",
+	"cursorid":           "cursorid",
+	"docsExamined":       "docsExamined",
+	"fastmod":            "fastmod",
+	"fastmodinsert":      "fastmodinsert",
+	"exhaust":            "exhaust",
+	"fromMultiPlanner":   "fromMultiPlanner",
+	"hasSortStage":       "hasSortStage",
+	"idhack":             "idhack",
+	"keysDeleted":        "keysDeleted",
+	"keysExamined":       "keysExamined",
+	"keysInserted":       "keysInserted",
+	"ndeleted":           "ndeleted",
+	"nDeleted":           "ndeleted",
+	"ninserted":          "ninserted",
+	"nInserted":          "ninserted",
+	"nmatched":           "nmatched",
+	"nMatched":           "nmatched",
+	"nmodified":          "nmodified",
+	"nModified":          "nmodified",
+	"nmoved":             "nmoved",
+	"nscanned":           "keysExamined",
+	"nscannedObjects":    "docsExamined",
+	"nreturned":          "nreturned",
+	"ntoreturn":          "ntoreturn",
+	"ntoskip":            "notoskip",
+	"planSummary":        "planSummary",
+	"planningTimeMicros": "planningTimeMicros",
+	"numYields":          "numYields",
+	"keyUpdates":         "keyUpdates",
+	"replanned":          "replanned",
+	"reslen":             "reslen",
+	"scanAndOrder":       "scanAndOrder",
+	"upsert":             "upsert",
+	"writeConflicts":     "writeConflicts",
 }
 
 var OPERATIONS = []string{
@@ -31,11 +31,19 @@ func init() {
 	parser.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 	parser.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 	parser.RegisterForEntry("end connection", commonParseConnectionEnded)
+
+	// Access
+	parser.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	parser.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	parser.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	parser.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// Sharding
+	parser.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
 }
 
 func (v *Version30SParser) Check(base record.Base) bool {
-	return base.Severity != record.SeverityNone &&
-		base.Component != record.ComponentNone
+	return mongosCheck(base)
 }
 
 func (v *Version30SParser) NewLogMessage(entry record.Entry) (msg message.Message, err error) {
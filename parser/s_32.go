@@ -23,18 +23,29 @@ func init() {
 	parser.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 	parser.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 	parser.RegisterForEntry("end connection", commonParseConnectionEnded)
+
+	// Access
+	parser.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	parser.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	parser.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	parser.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// Sharding
+	parser.RegisterForReader("ChunkManager: time to load chunks", mongosParseChunkManager)
+	parser.RegisterForEntry("about to log metadata event", commonParseMetadataEvent)
 }
 
 var errorVersion32SUnmatched = internal.VersionUnmatched{"mongos 3.2"}
 
 func (v *Version32SParser) Check(base record.Base) bool {
-	return base.Severity != record.SeverityNone &&
-		base.Component != record.ComponentNone &&
-		base.Severity >= record.SeverityD1 && base.Severity < record.SeverityD5
+	return mongosCheck(base)
 }
 
 func (v *Version32SParser) NewLogMessage(entry record.Entry) (message.Message, error) {
-	return v.Run(entry, internal.NewRuneReader(entry.RawMessage), errorVersion32SUnmatched)
+	return mongosLogMessage(entry, &v.Executor, func(cmd message.Command) bool {
+		// Version 3.2 neither logs an agent string nor supports OP_MSG.
+		return cmd.Agent == "" && (cmd.Protocol == "op_query" || cmd.Protocol == "op_command")
+	}, errorVersion32SUnmatched)
 }
 
 func (v *Version32SParser) Version() version.Definition {
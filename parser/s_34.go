@@ -26,16 +26,26 @@ func init() {
 	parser.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 	parser.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 	parser.RegisterForEntry("end connection", commonParseConnectionEnded)
+
+	// Access
+	parser.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	parser.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	parser.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	parser.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// Sharding
+	parser.RegisterForReader("ChunkManager: time to load chunks", mongosParseChunkManager)
 }
 
 func (v *Version34SParser) Check(base record.Base) bool {
-	return base.Severity != record.SeverityNone &&
-		base.Component != record.ComponentNone &&
-		base.Severity >= record.SeverityD1 && base.Severity < record.SeverityD5
+	return mongosCheck(base)
 }
 
 func (v *Version34SParser) NewLogMessage(entry record.Entry) (message.Message, error) {
-	return v.Run(entry, internal.NewRuneReader(entry.RawMessage), errorVersion34SUnmatched)
+	return mongosLogMessage(entry, &v.Executor, func(cmd message.Command) bool {
+		// OP_MSG was introduced by 3.6.
+		return cmd.Protocol == "op_query" || cmd.Protocol == "op_command"
+	}, errorVersion34SUnmatched)
 }
 
 func (v *Version34SParser) Version() version.Definition {
@@ -24,18 +24,25 @@ func init() {
 	parser.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 	parser.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 	parser.RegisterForEntry("end connection", commonParseConnectionEnded)
+
+	// Access
+	parser.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	parser.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	parser.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	parser.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// Sharding
+	parser.RegisterForReader("Refresh for collection", mongosParseRefresh)
 }
 
 var errorVersion36SUnmatched = internal.VersionUnmatched{Message: "mongos 3.6"}
 
 func (v *Version36SParser) Check(base record.Base) bool {
-	return base.Severity != record.SeverityNone &&
-		base.Component != record.ComponentNone &&
-		base.Severity >= record.SeverityD1 && base.Severity < record.SeverityD5
+	return mongosCheck(base)
 }
 
 func (v *Version36SParser) NewLogMessage(entry record.Entry) (message.Message, error) {
-	return v.Run(entry, internal.NewRuneReader(entry.RawMessage), errorVersion36SUnmatched)
+	return mongosLogMessage(entry, &v.Executor, nil, errorVersion36SUnmatched)
 }
 
 func (v *Version36SParser) Version() version.Definition {
@@ -26,15 +26,23 @@ func init() {
 	parser.RegisterForReader("connection accepted", commonParseConnectionAccepted)
 	parser.RegisterForReader("waiting for connections", commonParseWaitingForConnections)
 	parser.RegisterForEntry("end connection", commonParseConnectionEnded)
+
+	// Access
+	parser.RegisterForReader("Successfully authenticated as principal", commonParseAuthenticatedPrincipal)
+	parser.RegisterForReader("Failed to authenticate", commonParseFailedToAuthenticate)
+	parser.RegisterForReader("SASL ", commonParseAuthenticationFailed)
+	parser.RegisterForReader("SCRAM-SHA-1 authentication failed", commonParseAuthenticationFailed)
+
+	// Sharding
+	parser.RegisterForReader("Refresh for collection", mongosParseRefresh)
 }
 
 func (Version40SParser) Check(base record.Base) bool {
-	return base.Severity != record.SeverityNone &&
-		base.Component != record.ComponentNone
+	return mongosCheck(base)
 }
 
 func (v *Version40SParser) NewLogMessage(entry record.Entry) (message.Message, error) {
-	return v.Run(entry, internal.NewRuneReader(entry.RawMessage), errorVersion40SUnmatched)
+	return mongosLogMessage(entry, &v.Executor, nil, errorVersion40SUnmatched)
 }
 
 func (Version40SParser) Version() version.Definition {
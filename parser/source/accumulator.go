@@ -26,6 +26,11 @@ type accumulator struct {
 	Log *bufio.Scanner
 	Out chan accumulatorResult
 	In  chan string
+
+	// An error that ended scanning early (e.g. bufio.ErrTooLong) and the
+	// line it occurred on. Both are set before In is closed.
+	scanError error
+	scanLine  uint
 }
 
 var _ io.ReadCloser = (*accumulator)(nil)
@@ -41,7 +46,7 @@ func NewAccumulator(handle accumulatorReadCloser) *accumulator {
 		Closer: handle,
 		eof:    false,
 
-		Log: bufio.NewScanner(handle),
+		Log: newScanner(handle),
 		Out: make(chan accumulatorResult, OutputBuffer),
 		In:  make(chan string),
 	}
@@ -51,8 +56,13 @@ func NewAccumulator(handle accumulatorReadCloser) *accumulator {
 		defer close(r.In)
 
 		for r.Log.Scan() {
+			r.scanLine += 1
 			r.In <- r.Log.Text()
 		}
+
+		if err := r.Log.Err(); err != nil {
+			r.scanError, r.scanLine = err, r.scanLine+1
+		}
 	}()
 
 	go Accumulator(r.In, r.Out, handle.NewBase)
@@ -229,6 +239,13 @@ func (f *accumulator) Next() bool {
 	f.error = b.Error
 
 	if !ok {
+		if f.scanError != nil {
+			// Report the error that ended scanning before the end of input.
+			f.next, f.error = record.Base{LineNumber: f.scanLine}, f.scanError
+			f.scanError = nil
+			return true
+		}
+
 		f.eof = true
 		return false
 	}
@@ -0,0 +1,115 @@
+package source
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/mongo"
+	"mgotools/parser/record"
+)
+
+// Version 4.4 replaced the plain text log with one JSON document per line:
+//
+// {"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{...}}
+//
+// Lines that are not JSON are parsed as text, so a log spanning an upgrade to
+// 4.4 is read in full.
+type JSONLog struct {
+	*Log
+}
+
+// Enforce the interface at compile time.
+var _ Factory = (*JSONLog)(nil)
+
+func NewJSONLog(base io.ReadCloser) (*JSONLog, error) {
+	log, err := NewLog(base)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JSONLog{Log: log}, nil
+}
+
+// Generate an Entry from a line of text, which may be either JSON or text.
+func (JSONLog) NewBase(line string, num uint) (record.Base, error) {
+	if line = trimLine(line); !strings.HasPrefix(line, "{") {
+		return Log{}.NewBase(line, num)
+	}
+
+	base := record.Base{RuneReader: internal.NewRuneReader(line), LineNumber: num, Severity: record.SeverityNone}
+
+	doc, err := mongo.ParseJson(line, false)
+	if err != nil {
+		return base, err
+	}
+
+	if base.RawDate = jsonDate(doc["t"]); base.RawDate == "" {
+		return base, ErrorParsingDate
+	}
+
+	if severity, ok := doc["s"].(string); ok {
+		base.Severity, _ = record.NewSeverity(severity)
+	}
+
+	// Newer versions add components unknown to the text parsers, which are
+	// kept rather than discarding the line.
+	if name, ok := doc["c"].(string); ok {
+		if component, ok := record.NewComponent(name); ok {
+			base.Component = component
+		} else {
+			base.Component = record.ComponentUnknown
+		}
+	}
+
+	if context, ok := doc["ctx"].(string); !ok || context == "" {
+		return base, ErrorMissingContext
+	} else {
+		base.RawContext = "[" + context + "]"
+	}
+
+	base.RawMessage, _ = doc["msg"].(string)
+	if base.Attributes, _ = doc["attr"].(map[string]interface{}); base.Attributes == nil {
+		base.Attributes = make(map[string]interface{})
+	}
+	_, base.Truncated = doc["truncated"]
+
+	return base, nil
+}
+
+func (f *JSONLog) Next() bool {
+	f.next, f.error = f.get()
+
+	if f.error == io.EOF {
+		return false
+	}
+	return true
+}
+
+func (f *JSONLog) get() (record.Base, error) {
+	return f.fold(f.NewBase)
+}
+
+// Converts the "t" field into a date the text date parsers recognize. The
+// offset is written with a colon (e.g. +00:00) unless the timestamp is UTC.
+func jsonDate(value interface{}) string {
+	t, ok := value.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	switch date := t["$date"].(type) {
+	case string:
+		if length := len(date); length > 6 && date[length-3] == ':' && (date[length-6] == '+' || date[length-6] == '-') {
+			date = date[:length-3] + date[length-2:]
+		}
+		return date
+
+	case time.Time:
+		return date.UTC().Format(string(internal.DateFormatIso8602Utc))
+
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,61 @@
+package source
+
+import (
+	"testing"
+
+	"mgotools/parser/record"
+)
+
+func TestJSONLog_NewBase(tr *testing.T) {
+	f := JSONLog{}
+	tr.Run("SlowQuery", func(t *testing.T) {
+		line := `{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"durationMillis":12}}`
+		if b, err := f.NewBase(line, 1); err != nil {
+			t.Errorf("structured base returned an error (%s)", err)
+		} else if b.RawDate != "2020-05-20T20:10:08.731+0000" {
+			t.Errorf("base.RawDate is incorrect (%s)", b.RawDate)
+		} else if b.Severity != record.SeverityI || b.Component != record.ComponentCommand {
+			t.Error("base.Severity or base.Component is incorrect")
+		} else if b.RawContext != "[conn1]" || b.RawMessage != "Slow query" {
+			t.Errorf("base.RawContext or base.RawMessage is incorrect (%s, %s)", b.RawContext, b.RawMessage)
+		} else if command, ok := b.Attributes["command"].(map[string]interface{}); !ok || command["find"] != "foo" {
+			t.Errorf("base.Attributes is incorrect (%v)", b.Attributes)
+		} else if b.Truncated || b.LineNumber != 1 {
+			t.Error("base.Truncated or base.LineNumber is incorrect")
+		}
+	})
+	tr.Run("Truncated", func(t *testing.T) {
+		line := `{"t":{"$date":"2020-05-20T20:10:08.731Z"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"command":{"insert":"foo"}},"truncated":{"command":{"documents":{"0":{"type":"object","size":1048576}}}},"size":{"command":1048600}}`
+		if b, err := f.NewBase(line, 1); err != nil {
+			t.Errorf("truncated base returned an error (%s)", err)
+		} else if !b.Truncated || b.RawDate != "2020-05-20T20:10:08.731Z" {
+			t.Errorf("truncated base is incorrect (%v, %s)", b.Truncated, b.RawDate)
+		}
+	})
+	tr.Run("NoAttributes", func(t *testing.T) {
+		line := `{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"TXN","id":1,"ctx":"initandlisten","msg":"Hello"}`
+		if b, err := f.NewBase(line, 1); err != nil {
+			t.Errorf("base without attributes returned an error (%s)", err)
+		} else if b.Attributes == nil || b.Component != record.ComponentUnknown {
+			t.Error("structured base should always have attributes and a component")
+		}
+	})
+	tr.Run("Text", func(t *testing.T) {
+		if b, err := f.NewBase("2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8", 1); err != nil {
+			t.Errorf("text base returned an error (%s)", err)
+		} else if b.Attributes != nil || b.RawMessage != "db version v3.6.8" {
+			t.Error("text base is incorrect")
+		}
+	})
+	tr.Run("Invalid", func(t *testing.T) {
+		if _, err := f.NewBase(`{"s":"I","c":"COMMAND","ctx":"conn1","msg":"Slow query"}`, 1); err != ErrorParsingDate {
+			t.Errorf("expected a date error, got %v", err)
+		}
+		if _, err := f.NewBase(`{"t":{"$date":"2020-05-20T20:10:08.731Z"},"s":"I","c":"COMMAND","msg":"Slow query"}`, 1); err != ErrorMissingContext {
+			t.Errorf("expected a context error, got %v", err)
+		}
+		if _, err := f.NewBase(`{"t":{"$date":`, 1); err == nil {
+			t.Error("malformed JSON should return an error")
+		}
+	})
+}
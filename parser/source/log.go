@@ -2,20 +2,29 @@ package source
 
 import (
 	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"errors"
 	"io"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"mgotools/internal"
+	"mgotools/internal/zstd"
 	"mgotools/parser/record"
 )
 
 var ErrorParsingDate = errors.New("unrecognized date format")
 var ErrorMissingContext = errors.New("missing context")
 
+// The longest line that can be read. Large commands and aggregation pipelines
+// regularly exceed the 64KB default of a bufio.Scanner. Longer lines end
+// reading the log with bufio.ErrTooLong.
+var MaxLineSize = MaxBufferSize
+
 type Log struct {
 	io.Closer
 	*bufio.Reader
@@ -28,21 +37,36 @@ type Log struct {
 	eof    bool
 	line   uint
 	mutex  sync.RWMutex
+
+	// The lines of the log, read by the Scanner unless the log is mapped
+	// into memory (see NewMappedLog).
+	lines lineScanner
+
+	// Whether the log is being followed, and the line read past the end of
+	// the previous entry, which begins the next entry.
+	following bool
+	pending   *logLine
+}
+
+type lineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
 }
 
 // Enforce the interface at compile time.
 var _ Factory = (*Log)(nil)
 
 func NewLog(base io.ReadCloser) (*Log, error) {
-	reader := bufio.NewReader(base)
-
-	if scanner, err := makeScanner(reader); err != nil {
+	if reader, err := makeReader(bufio.NewReader(base)); err != nil {
 		return nil, err
 	} else {
+		scanner := newScanner(reader)
 		return &Log{
 			Reader:  reader,
 			Closer:  base,
 			Scanner: scanner,
+			lines:   scanner,
 
 			// These are all defaults, but it doesn't hurts to be explicit.
 			closed: false,
@@ -53,24 +77,116 @@ func NewLog(base io.ReadCloser) (*Log, error) {
 	}
 }
 
-func makeScanner(reader *bufio.Reader) (*bufio.Scanner, error) {
-	var scanner = bufio.NewScanner(reader)
+func newScanner(reader io.Reader) *bufio.Scanner {
+	// The buffer grows as needed, but the initial size determines the
+	// maximum if it is larger.
+	size := 256 * 1024
+	if size > MaxLineSize {
+		size = MaxLineSize
+	}
 
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, size), MaxLineSize)
+	return scanner
+}
+
+// Returns a reader of the decompressed log, which is used both when scanning
+// and when the log is read directly (e.g. by the accumulator). Decompression
+// readers are never closed directly; closing the Log closes the underlying
+// file instead.
+func makeReader(reader *bufio.Reader) (*bufio.Reader, error) {
 	// Check for gzip magic headers.
 	if peek, err := reader.Peek(2); err == nil {
 		if peek[0] == 0x1f && peek[1] == 0x8b {
-			if gzipReader, err := gzip.NewReader(reader); err == nil {
-				scanner = bufio.NewScanner(gzipReader)
-			} else {
+			gzipReader, err := gzip.NewReader(reader)
+			if err != nil {
 				return nil, err
 			}
+
+			// Rotated logs may be several gzip members concatenated into one
+			// file. Multistream is the default but every member must be read.
+			gzipReader.Multistream(true)
+			return bufio.NewReader(gzipReader), nil
+		}
+	}
+	// Check for bzip2 magic headers ("BZh").
+	if peek, err := reader.Peek(3); err == nil {
+		if peek[0] == 'B' && peek[1] == 'Z' && peek[2] == 'h' {
+			return bufio.NewReader(bzip2.NewReader(reader)), nil
+		}
+	}
+	// Check for zstd magic headers.
+	if peek, err := reader.Peek(4); err == nil {
+		if peek[0] == 0x28 && peek[1] == 0xb5 && peek[2] == 0x2f && peek[3] == 0xfd {
+			// Concatenated frames are read one after another. The first block
+			// is decoded up front so a corrupt log fails here, like a gzip
+			// log with a corrupt header.
+			zstdReader := bufio.NewReader(zstd.NewReader(reader))
+			if _, err := zstdReader.Peek(1); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return zstdReader, nil
+		}
+	}
+	return reader, nil
+}
+
+// Follow keeps reading the log as it grows, like tail -f, instead of stopping
+// at the end of the file. Reads wait for new lines (checking every poll
+// interval) until the log is closed. It must be called before the log is read.
+//
+// Lines are not folded into multi-line entries while following, since that
+// would hold back every entry until the line after it is written.
+func (f *Log) Follow(poll time.Duration) {
+	f.following = true
+	reader := bufio.NewReader(&followReader{reader: f.Reader, closed: f.isClosed, poll: poll})
+
+	f.Reader = reader
+	f.Scanner = newScanner(reader)
+	f.lines = f.Scanner
+}
+
+// A reader that waits for more data at the end of the file. Only complete
+// lines are returned so a line that is still being written is never split in
+// two, and a partial line at the end of the file is discarded on close.
+type followReader struct {
+	reader io.Reader
+	closed func() bool
+	poll   time.Duration
+
+	chunk   []byte
+	pending []byte
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	if r.chunk == nil {
+		r.chunk = make([]byte, 32*1024)
+	}
+
+	for {
+		if end := bytes.LastIndexByte(r.pending, '\n'); end >= 0 {
+			n := copy(p, r.pending[:end+1])
+			r.pending = r.pending[n:]
+			return n, nil
+		} else if r.closed() {
+			return 0, io.EOF
+		}
+
+		n, err := r.reader.Read(r.chunk)
+		r.pending = append(r.pending, r.chunk[:n]...)
+
+		if err == io.EOF && n == 0 {
+			time.Sleep(r.poll)
+		} else if err != nil && err != io.EOF && !r.closed() {
+			return 0, err
 		}
 	}
-	return scanner, nil
 }
 
 // Generate an Entry from a line of text. This method assumes the entry is *not* JSON.
 func (Log) NewBase(line string, num uint) (record.Base, error) {
+	line = stripAgentPrefix(trimLine(line))
+
 	var (
 		base = record.Base{RuneReader: internal.NewRuneReader(line), LineNumber: num, Severity: record.SeverityNone}
 		pos  int
@@ -185,12 +301,103 @@ func (f *Log) Next() bool {
 	return true
 }
 
-func (f Log) get() (record.Base, error) {
-	if !f.eof && !f.isClosed() && f.Scanner.Scan() {
+func (f *Log) get() (record.Base, error) {
+	return f.fold(f.NewBase)
+}
+
+// A line of the log and the base parsed from it. Lines without a date
+// continue the entry before them.
+type logLine struct {
+	base      record.Base
+	error     error
+	text      string
+	number    uint
+	continues bool
+}
+
+// Reads the next entry. Some entries span several lines (e.g. a fatal
+// assertion followed by a stack trace), where every line after the first has
+// no date. Those lines are folded into the entry, so its message holds all of
+// them, which requires reading one line past the end of each entry.
+func (f *Log) fold(newBase func(string, uint) (record.Base, error)) (record.Base, error) {
+	first, err := f.read(newBase)
+	if err != nil {
+		return record.Base{}, err
+	} else if first.base.RawDate == "" || f.following {
+		// Lines before the first date have no entry to continue.
+		return first.base, first.error
+	}
+
+	lines, size := []string{first.text}, len(first.text)
+	for {
+		next, err := f.read(newBase)
+		if err != nil {
+			break
+		} else if !next.continues || size+len(next.text) > MaxLineSize {
+			f.pending = next
+			break
+		}
+		lines = append(lines, trimLine(next.text))
+		size += len(next.text) + 1
+	}
+
+	if len(lines) == 1 {
+		return first.base, first.error
+	}
+	return newBase(strings.Join(lines, "\n"), first.number)
+}
+
+// Returns the line read past the end of the previous entry, or the next line.
+func (f *Log) read(newBase func(string, uint) (record.Base, error)) (*logLine, error) {
+	if line := f.pending; line != nil {
+		f.pending = nil
+		return line, nil
+	} else if f.eof || f.isClosed() {
+		return nil, io.EOF
+	} else if f.lines.Scan() {
 		f.line += 1
-		return f.NewBase(f.Scanner.Text(), f.line)
+		line := &logLine{text: f.lines.Text(), number: f.line}
+		line.base, line.error = newBase(line.text, line.number)
+		line.continues = line.base.RawDate == ""
+		return line, nil
+	}
+
+	f.eof = true
+	if err := f.lines.Err(); err != nil {
+		// The error belongs to the line that could not be read.
+		return &logLine{base: record.Base{LineNumber: f.line + 1}, error: err}, nil
+	}
+	return nil, io.EOF
+}
+
+// Logs written on (or copied from) Windows end each line with a carriage
+// return, and some editors add a byte order mark to the beginning of the file.
+func trimLine(line string) string {
+	return strings.TrimPrefix(strings.TrimSuffix(line, "\r"), "\ufeff")
+}
+
+// Automation agents (e.g. Ops Manager) wrap mongod output with their own
+// bracketed prefixes:
+//
+// [2019-05-01T12:00:00.000+0000] [mongod.stdout] 2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9
+//
+// The prefixes are removed only when they are followed by a mongod line.
+func stripAgentPrefix(line string) string {
+	inner := line
+	for strings.HasPrefix(inner, "[") {
+		end := strings.IndexRune(inner, ']')
+		if end < 0 {
+			break
+		}
+
+		inner = strings.TrimLeft(inner[end+1:], " ")
+		word, _, _ := internal.StringDoubleSplit(inner, ' ')
+		if internal.IsDay(word) || internal.IsIso8601String(word) {
+			return inner
+		}
 	}
-	return record.Base{}, io.EOF
+
+	return line
 }
 
 func isComponent(c string) bool {
@@ -1,7 +1,15 @@
 package source
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"mgotools/parser/record"
 )
@@ -102,4 +110,420 @@ func TestNewBase(tr *testing.T) {
 			t.Error("base.RawDate is correct, but returned an error")
 		}
 	})
+	tr.Run("AgentWrapped", func(t *testing.T) {
+		if b, err := f.NewBase("[2019-05-01T12:00:00.000+0000] [mongod.stdout] 2019-05-01T12:00:00.000+0000 I CONTROL  [initandlisten] db version v4.0.9", 1); err != nil {
+			t.Errorf("agent wrapped base returned an error (%s)", err)
+		} else if b.RawDate != "2019-05-01T12:00:00.000+0000" {
+			t.Errorf("agent wrapped base.RawDate is incorrect (%s)", b.RawDate)
+		} else if b.RawContext != "[initandlisten]" || b.Component != record.ComponentControl || b.Severity != record.SeverityI {
+			t.Error("agent wrapped base context, component, or severity is incorrect")
+		} else if b.RawMessage != "db version v4.0.9" {
+			t.Errorf("agent wrapped base.RawMessage is incorrect (%s)", b.RawMessage)
+		}
+		if b, err := f.NewBase("[agent] Tue Jan 16 15:00:40.105 [initandlisten] db version v2.4.14", 1); err != nil || b.RawMessage != "db version v2.4.14" {
+			t.Error("agent wrapped base (2.4) is incorrect")
+		}
+		if _, err := f.NewBase("[2019-05-01T12:00:00.000+0000] [.info] [cm/director.go:planAndExecute:534] All 1 processes are in goal state", 1); err == nil {
+			t.Error("agent lines without an embedded mongod line should return an error")
+		}
+	})
+}
+
+func TestNewLog_GzipMembers(t *testing.T) {
+	lines := []string{
+		"2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8",
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017",
+		"2018-01-16T15:00:43.759-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #1 (1 connection now open)",
+	}
+
+	// Each member is a complete gzip stream, as produced by appending a newly
+	// compressed log to an existing archive.
+	var buffer bytes.Buffer
+	for _, member := range [][]string{lines[:2], lines[2:]} {
+		writer := gzip.NewWriter(&buffer)
+		writer.Write([]byte(strings.Join(member, "\n") + "\n"))
+		writer.Close()
+	}
+	fixture := buffer.Bytes()
+
+	t.Run("Scanner", func(t *testing.T) {
+		log, err := NewLog(ioutil.NopCloser(bytes.NewReader(fixture)))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		count := 0
+		for log.Next() {
+			if base, err := log.Get(); err != nil {
+				t.Errorf("line %d returned an error (%s)", count+1, err)
+			} else if count < len(lines) && base.String() != lines[count] {
+				t.Errorf("line %d mismatch: %s", count+1, base.String())
+			}
+			count += 1
+		}
+		if count != len(lines) {
+			t.Errorf("expected %d lines from both members, got %d", len(lines), count)
+		}
+	})
+
+	t.Run("Accumulator", func(t *testing.T) {
+		log, err := NewLog(ioutil.NopCloser(bytes.NewReader(fixture)))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		count := 0
+		for accumulator := NewAccumulator(log); accumulator.Next(); count += 1 {
+			if base, err := accumulator.Get(); err != nil || base.RawDate == "" {
+				t.Errorf("line %d was not decompressed (%s)", count+1, err)
+			}
+		}
+		if count != len(lines) {
+			t.Errorf("expected %d lines from both members, got %d", len(lines), count)
+		}
+	})
+}
+
+type closeRecorder struct {
+	*bytes.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestNewLog_Bzip2(t *testing.T) {
+	// The output of bzip2 for a single line, since the standard library only
+	// provides a decompressor.
+	fixture := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x20, 0xc7, 0xdb, 0xc4, 0x00, 0x00,
+		0x0d, 0x5f, 0x80, 0x00, 0x10, 0x40, 0x03, 0x7f, 0xf0, 0x08, 0x25, 0x94, 0x0a, 0x36, 0x25, 0x9d,
+		0x00, 0x20, 0x00, 0x41, 0x14, 0xf4, 0xd4, 0xc4, 0x1a, 0x69, 0xb5, 0x34, 0xd1, 0x90, 0x0c, 0x43,
+		0x0c, 0x13, 0x02, 0x60, 0x21, 0xa3, 0x26, 0x98, 0x30, 0xcd, 0x69, 0xdf, 0xce, 0x17, 0xa3, 0x1a,
+		0x27, 0x7a, 0x5e, 0xd7, 0x0d, 0xa0, 0x71, 0x22, 0x3a, 0xae, 0x18, 0xea, 0x22, 0x02, 0xa8, 0x00,
+		0xbc, 0x22, 0x12, 0x8e, 0x47, 0x25, 0x6d, 0x5e, 0xc8, 0x89, 0xdd, 0x56, 0x69, 0x5d, 0x27, 0x3a,
+		0x02, 0x2a, 0x80, 0xb9, 0x81, 0xf8, 0xbb, 0x92, 0x29, 0xc2, 0x84, 0x81, 0x06, 0x3e, 0xde, 0x20,
+	}
+	line := "2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8"
+
+	file := &closeRecorder{Reader: bytes.NewReader(fixture)}
+	log, err := NewLog(file)
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+
+	count := 0
+	for log.Next() {
+		if base, err := log.Get(); err != nil {
+			t.Errorf("line %d returned an error (%s)", count+1, err)
+		} else if base.String() != line {
+			t.Errorf("line %d mismatch: %s", count+1, base.String())
+		}
+		count += 1
+	}
+	if count != 1 {
+		t.Errorf("expected 1 line, got %d", count)
+	}
+
+	if err := log.Close(); err != nil || !file.closed {
+		t.Errorf("closing the log should close the underlying file (%v)", err)
+	}
+}
+
+func TestNewLog_Zstd(t *testing.T) {
+	// The output of zstd for two lines, since the decoder cannot compress.
+	fixture := []byte{
+		0x28, 0xb5, 0x2f, 0xfd, 0x24, 0xc1, 0x45, 0x04, 0x00, 0xa2, 0xc8, 0x1c, 0x18, 0x60, 0xdb, 0x01,
+		0x5d, 0x66, 0x6d, 0x48, 0x83, 0xec, 0x8f, 0x0c, 0x8f, 0xbc, 0x57, 0x3d, 0x13, 0xc5, 0x24, 0x24,
+		0x61, 0x02, 0x58, 0x70, 0x22, 0xc0, 0xf0, 0x15, 0xbc, 0x5c, 0xde, 0x77, 0x81, 0x3d, 0xe0, 0xee,
+		0x6e, 0xa4, 0xf1, 0xd9, 0xb3, 0xa7, 0x52, 0x38, 0x7f, 0x37, 0xec, 0x98, 0xab, 0x23, 0x58, 0x29,
+		0xd5, 0x46, 0x5a, 0xff, 0x2f, 0xe5, 0x2c, 0xac, 0x51, 0x45, 0x5d, 0xd6, 0x33, 0x19, 0xc0, 0x32,
+		0x93, 0x69, 0x90, 0xfc, 0xd7, 0x8a, 0x61, 0x25, 0x79, 0xe3, 0x38, 0xfb, 0x3a, 0x8a, 0xd6, 0xe3,
+		0x5e, 0x1b, 0xed, 0x5b, 0x8c, 0x59, 0xa2, 0x2a, 0x6b, 0xa2, 0x1c, 0x86, 0xb8, 0x7b, 0x69, 0x82,
+		0x41, 0x94, 0xe9, 0x47, 0xd3, 0xdd, 0x20, 0x6e, 0x25, 0x4e, 0x78, 0x13, 0x8b, 0x77, 0x11, 0x06,
+		0x00, 0x93, 0xca, 0x0f, 0x09, 0xeb, 0x46, 0x18, 0x02, 0x00, 0x0c, 0xb8, 0x53, 0x1a, 0x2f, 0x9c,
+		0x01, 0x95, 0xd0, 0xc3, 0x0a,
+	}
+	lines := []string{
+		"2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8",
+		"2018-01-16T15:00:43.759-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #1 (1 connection now open)",
+	}
+
+	// Rotated logs may be several zstd frames concatenated into one file.
+	file := &closeRecorder{Reader: bytes.NewReader(append(append([]byte{}, fixture...), fixture...))}
+	log, err := NewLog(file)
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+
+	count := 0
+	for log.Next() {
+		if base, err := log.Get(); err != nil {
+			t.Errorf("line %d returned an error (%s)", count+1, err)
+		} else if base.String() != lines[count%len(lines)] {
+			t.Errorf("line %d mismatch: %s", count+1, base.String())
+		}
+		count += 1
+	}
+	if count != 4 {
+		t.Errorf("expected 4 lines, got %d", count)
+	}
+
+	if err := log.Close(); err != nil || !file.closed {
+		t.Errorf("closing the log should close the underlying file (%v)", err)
+	}
+
+	// A zstd frame header followed by a truncated block fails when opened,
+	// the same as a corrupt gzip header.
+	if _, err := NewLog(ioutil.NopCloser(bytes.NewReader(fixture[:9]))); err == nil {
+		t.Error("expected an error opening a truncated zstd log")
+	}
+}
+
+// A file that is still being written, which returns io.EOF until more data
+// is appended.
+type growingFile struct {
+	sync.Mutex
+	data   []byte
+	offset int
+}
+
+func (g *growingFile) Append(s string) {
+	g.Lock()
+	defer g.Unlock()
+	g.data = append(g.data, s...)
+}
+
+func (g *growingFile) Read(p []byte) (int, error) {
+	g.Lock()
+	defer g.Unlock()
+	if g.offset == len(g.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, g.data[g.offset:])
+	g.offset += n
+	return n, nil
+}
+
+func (g *growingFile) Close() error {
+	return nil
+}
+
+func TestLog_Follow(t *testing.T) {
+	lines := []string{
+		"2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8",
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017",
+		"2018-01-16T15:00:43.759-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #1 (1 connection now open)",
+	}
+
+	// The second line is only partially written when the log is opened.
+	file := &growingFile{}
+	file.Append(lines[0] + "\n" + lines[1][:40])
+
+	log, err := NewLog(file)
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+	log.Follow(time.Millisecond)
+
+	if !log.Next() {
+		t.Fatal("expected the first line")
+	} else if base, _ := log.Get(); base.String() != lines[0] {
+		t.Errorf("line 1 mismatch: %s", base.String())
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		file.Append(lines[1][40:] + "\n" + lines[2] + "\n" + "2018-01-16T15:00:44")
+	}()
+
+	for index := 1; index < len(lines); index += 1 {
+		if !log.Next() {
+			t.Fatalf("expected line %d", index+1)
+		} else if base, _ := log.Get(); base.String() != lines[index] {
+			t.Errorf("line %d mismatch: %s", index+1, base.String())
+		}
+	}
+
+	// Closing the log ends following without returning the partial line.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		log.Close()
+	}()
+	if log.Next() {
+		base, _ := log.Get()
+		t.Errorf("expected the end of the log after closing, got %s", base.String())
+	}
+}
+
+func TestLog_LineNumber(t *testing.T) {
+	lines := strings.Join([]string{
+		"2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8",
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017",
+		"2018-01-16T15:00:43.759-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #1 (1 connection now open)",
+	}, "\n")
+
+	log, err := NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+
+	expected := uint(1)
+	for ; log.Next(); expected += 1 {
+		if base, err := log.Get(); err != nil {
+			t.Errorf("line %d returned an error (%s)", expected, err)
+		} else if base.LineNumber != expected {
+			t.Errorf("expected line number %d, got %d", expected, base.LineNumber)
+		}
+	}
+	if expected != 4 {
+		t.Errorf("expected 3 lines, got %d", expected-1)
+	}
+	if log.Next() {
+		t.Error("the log should remain at the end after returning io.EOF")
+	}
+}
+
+func TestLog_MultiLine(t *testing.T) {
+	lines := []string{
+		"2018-01-16T15:00:41.759-0800 F -        [conn1] Invariant failure opCtx->lockState()->isW() src/mongo/db/catalog/database.cpp 401",
+		"0x55b3c5a1d2f1 0x55b3c5a1c9e4 0x55b3c4f0e7a2 0x7f3a8c6a66ba 0x7f3a8c3dc41d",
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017",
+	}
+
+	log, err := NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+
+	if !log.Next() {
+		t.Fatal("expected the assertion")
+	} else if base, err := log.Get(); err != nil {
+		t.Errorf("the assertion returned an error (%s)", err)
+	} else if base.LineNumber != 1 || base.RawDate != "2018-01-16T15:00:41.759-0800" || base.RawContext != "[conn1]" {
+		t.Errorf("the assertion was parsed incorrectly (%d, %s, %s)", base.LineNumber, base.RawDate, base.RawContext)
+	} else if !strings.HasSuffix(base.RawMessage, "database.cpp 401\n"+lines[1]) {
+		t.Errorf("the stack trace was not folded into the assertion: %s", base.RawMessage)
+	}
+
+	if !log.Next() {
+		t.Fatal("expected the line after the assertion")
+	} else if base, err := log.Get(); err != nil || base.LineNumber != 3 || base.String() != lines[2] {
+		t.Errorf("line 3 mismatch (%d, %v): %s", base.LineNumber, err, base.String())
+	}
+
+	if log.Next() {
+		t.Error("expected the end of the log")
+	}
+}
+
+func TestLog_LongLine(t *testing.T) {
+	// A slow query with a filter well beyond the 64KB default scanner limit.
+	long := "2018-01-16T15:00:41.759-0800 I COMMAND  [conn1] command test.foo command: find { find: \"foo\", filter: { a: \"" + strings.Repeat("x", 100*1024) + "\" } } 100ms"
+	lines := strings.Join([]string{
+		long,
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017",
+	}, "\n")
+
+	t.Run("Scanner", func(t *testing.T) {
+		log, err := NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		if !log.Next() {
+			t.Fatal("expected the long line")
+		} else if base, err := log.Get(); err != nil || base.String() != long {
+			t.Errorf("the long line was not read whole (%d bytes, %v)", len(base.String()), err)
+		} else if !log.Next() {
+			t.Error("expected the line after the long line")
+		}
+	})
+
+	t.Run("Accumulator", func(t *testing.T) {
+		log, err := NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		count := 0
+		for accumulator := NewAccumulator(log); accumulator.Next(); count += 1 {
+			if base, err := accumulator.Get(); err != nil {
+				t.Errorf("line %d returned an error (%s)", count+1, err)
+			} else if count == 0 && base.String() != long {
+				t.Errorf("the long line was not read whole (%d bytes)", len(base.String()))
+			}
+		}
+		if count != 2 {
+			t.Errorf("expected 2 lines, got %d", count)
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		defer func(size int) { MaxLineSize = size }(MaxLineSize)
+		MaxLineSize = 64 * 1024
+
+		log, err := NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		if !log.Next() {
+			t.Fatal("expected an error for the long line, not the end of the log")
+		} else if base, err := log.Get(); err != bufio.ErrTooLong || base.LineNumber != 1 {
+			t.Errorf("expected bufio.ErrTooLong on line 1, got %v on line %d", err, base.LineNumber)
+		} else if log.Next() {
+			t.Error("the log should end after an error")
+		}
+
+		log, _ = NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+		accumulator := NewAccumulator(log)
+		if !accumulator.Next() {
+			t.Fatal("expected an error for the long line from the accumulator")
+		} else if base, err := accumulator.Get(); err != bufio.ErrTooLong || base.LineNumber != 1 {
+			t.Errorf("expected bufio.ErrTooLong on line 1, got %v on line %d", err, base.LineNumber)
+		} else if accumulator.Next() {
+			t.Error("the accumulator should end after an error")
+		}
+	})
+}
+
+func TestLog_WindowsLines(t *testing.T) {
+	lines := "\ufeff2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8\r\n" +
+		"2018-01-16T15:00:42.759-0800 I NETWORK  [initandlisten] waiting for connections on port 27017\r\n"
+	expected := []struct{ date, message string }{
+		{"2018-01-16T15:00:41.759-0800", "db version v3.6.8"},
+		{"2018-01-16T15:00:42.759-0800", "waiting for connections on port 27017"},
+	}
+
+	log, err := NewLog(ioutil.NopCloser(strings.NewReader(lines)))
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+
+	count := 0
+	for ; log.Next(); count += 1 {
+		if base, err := log.Get(); err != nil {
+			t.Errorf("line %d returned an error (%s)", count+1, err)
+		} else if count < len(expected) && (base.RawDate != expected[count].date || base.RawMessage != expected[count].message) {
+			t.Errorf("line %d mismatch (%q, %q)", count+1, base.RawDate, base.RawMessage)
+		}
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d lines, got %d", len(expected), count)
+	}
+
+	// Lines passed directly (e.g. joined by the accumulator) are trimmed too.
+	if base, err := (Log{}).NewBase("\ufeffTue Jan 16 15:00:40.105 [initandlisten] db version v2.4.14\r", 1); err != nil {
+		t.Errorf("base returned an error (%s)", err)
+	} else if base.RawDate != "Tue Jan 16 15:00:40.105" || base.RawMessage != "db version v2.4.14" {
+		t.Errorf("base mismatch (%q, %q)", base.RawDate, base.RawMessage)
+	}
+	if base, err := (JSONLog{}).NewBase("\ufeff{\"t\":{\"$date\":\"2020-05-20T20:10:08.731Z\"},\"s\":\"I\",\"c\":\"NETWORK\",\"id\":1,\"ctx\":\"listener\",\"msg\":\"Hello\"}\r", 1); err != nil {
+		t.Errorf("structured base returned an error (%s)", err)
+	} else if base.RawMessage != "Hello" {
+		t.Errorf("structured base mismatch (%q)", base.RawMessage)
+	}
 }
@@ -0,0 +1,104 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"unsafe"
+)
+
+var errorMapUnsupported = errors.New("memory mapped files are not supported on this platform")
+
+// NewMappedLog reads a log file mapped into memory, which scans lines directly
+// over the mapped file rather than copying it through a read buffer. Files
+// that cannot be mapped (e.g. compressed logs, pipes, or empty files) are read
+// by NewLog instead.
+//
+// Each line is a string over the mapping itself, so the mapping is kept after
+// the log is closed: anything taken from a line (e.g. a namespace kept by a
+// pattern) may be used until the program exits. The pages are backed by the
+// file, so they are reclaimed like the page cache. The file must not be
+// truncated until then.
+func NewMappedLog(file *os.File) (*Log, error) {
+	data, err := mapRegular(file)
+	if err != nil {
+		return NewLog(file)
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	if plain, err := makeReader(reader); err != nil || plain != reader {
+		// Compressed logs are decompressed while streaming.
+		unmapFile(data)
+		return NewLog(file)
+	}
+
+	return &Log{
+		Reader:  reader,
+		Closer:  file,
+		Scanner: newScanner(reader),
+		lines:   &mappedScanner{data: data},
+	}, nil
+}
+
+// NewMappedJSONLog is NewMappedLog for logs that may be structured (JSON).
+func NewMappedJSONLog(file *os.File) (*JSONLog, error) {
+	log, err := NewMappedLog(file)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLog{Log: log}, nil
+}
+
+func mapRegular(file *os.File) ([]byte, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	} else if !info.Mode().IsRegular() || info.Size() == 0 {
+		return nil, errorMapUnsupported
+	}
+	return mapFile(file, info.Size())
+}
+
+// Scans the lines of a mapped file the same way bufio.ScanLines does, i.e.
+// without the newline or a carriage return before it. Lines are not copied.
+type mappedScanner struct {
+	data   []byte
+	offset int
+	line   []byte
+	err    error
+}
+
+func (s *mappedScanner) Scan() bool {
+	if s.offset >= len(s.data) || s.err != nil {
+		return false
+	}
+
+	line := s.data[s.offset:]
+	if end := bytes.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+		s.offset += end + 1
+	} else {
+		s.offset = len(s.data)
+	}
+
+	if len(line) > MaxLineSize {
+		s.err = bufio.ErrTooLong
+		return false
+	} else if end := len(line) - 1; end >= 0 && line[end] == '\r' {
+		line = line[:end]
+	}
+
+	s.line = line
+	return true
+}
+
+func (s *mappedScanner) Text() string {
+	// The mapping is read-only and never unmapped, so the string can never
+	// change or be freed (see NewMappedLog).
+	return *(*string)(unsafe.Pointer(&s.line))
+}
+
+func (s *mappedScanner) Err() error {
+	return s.err
+}
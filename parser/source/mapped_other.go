@@ -0,0 +1,16 @@
+// Other platforms read every log through NewLog.
+//
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package source
+
+import "os"
+
+func mapFile(*os.File, int64) ([]byte, error) {
+	return nil, errorMapUnsupported
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
@@ -0,0 +1,196 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Writes a log to a temporary file, which is removed by the returned function.
+func mappedFixture(t testing.TB, contents []byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "mapped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, "mongod.log")
+	if err := ioutil.WriteFile(name, contents, 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return name, func() { os.RemoveAll(dir) }
+}
+
+// Reads every entry of a log, along with any error, as a string.
+func mappedEntries(t testing.TB, name string, open func(*os.File) (Factory, error)) []string {
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := open(file)
+	if err != nil {
+		t.Fatalf("unexpected error opening the log (%s)", err)
+	}
+	defer log.Close()
+
+	var entries []string
+	for log.Next() {
+		base, err := log.Get()
+		entries = append(entries, fmt.Sprintf("%d %s %v", base.LineNumber, base.String(), err))
+	}
+	return entries
+}
+
+func TestNewMappedLog(t *testing.T) {
+	lines := []string{
+		"2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8\r",
+		"2018-01-16T15:00:42.759-0800 F -        [conn1] Invariant failure",
+		"0x55b3c5a1d2f1 0x55b3c5a1c9e4",
+		"",
+		"2018-01-16T15:00:43.759-0800 I NETWORK  [listener] connection accepted from 127.0.0.1:50000 #1 (1 connection now open)",
+	}
+	plain := []byte(strings.Join(lines, "\n"))
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(plain)
+	writer.Close()
+
+	for name, contents := range map[string][]byte{
+		"Plain":      plain,
+		"Compressed": compressed.Bytes(),
+		"Empty":      nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path, remove := mappedFixture(t, contents)
+			defer remove()
+
+			// Mapped logs are read without an accumulator, so the entries
+			// must match those of a streamed log that is accumulated.
+			expected := mappedEntries(t, path, streamedLog)
+			if mapped := mappedEntries(t, path, mappedLog); strings.Join(mapped, "\n") != strings.Join(expected, "\n") {
+				t.Errorf("entries differ from a streamed log\n\texpected: %q\n\tgot:      %q", expected, mapped)
+			} else if len(contents) > 0 && len(mapped) != 3 {
+				t.Errorf("expected 3 entries, got %q", mapped)
+			}
+		})
+	}
+
+	t.Run("Closed", func(t *testing.T) {
+		path, remove := mappedFixture(t, plain)
+		defer remove()
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := NewMappedLog(file)
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		// Lines are strings over the mapping, which must remain readable
+		// after the log is closed.
+		var entries []string
+		for log.Next() {
+			base, _ := log.Get()
+			entries = append(entries, base.RawMessage)
+		}
+		log.Close()
+
+		if len(entries) != 3 || entries[2] != "connection accepted from 127.0.0.1:50000 #1 (1 connection now open)" {
+			t.Errorf("unexpected entries after closing the log: %q", entries)
+		}
+	})
+
+	t.Run("Allocations", func(t *testing.T) {
+		var line string
+		if allocs := testing.AllocsPerRun(10, func() {
+			scanner := mappedScanner{data: plain}
+			for scanner.Scan() {
+				line = scanner.Text()
+			}
+		}); allocs != 0 {
+			t.Errorf("lines should not be copied, got %v allocations", allocs)
+		} else if line != lines[len(lines)-1] {
+			t.Errorf("unexpected last line %q", line)
+		}
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		defer func(size int) { MaxLineSize = size }(MaxLineSize)
+		MaxLineSize = 64
+
+		path, remove := mappedFixture(t, plain)
+		defer remove()
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log, err := NewMappedLog(file)
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+		defer log.Close()
+
+		if !log.Next() {
+			t.Fatal("expected an error for the long line, not the end of the log")
+		} else if base, err := log.Get(); err != bufio.ErrTooLong || base.LineNumber != 1 {
+			t.Errorf("expected bufio.ErrTooLong on line 1, got %v on line %d", err, base.LineNumber)
+		} else if log.Next() {
+			t.Error("the log should end after a line that is too long")
+		}
+	})
+}
+
+func mappedLog(file *os.File) (Factory, error) {
+	return NewMappedLog(file)
+}
+
+func streamedLog(file *os.File) (Factory, error) {
+	log, err := NewLog(file)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccumulator(log), nil
+}
+
+// A log of slow queries, which are among the longest lines of a typical log.
+func benchmarkFixture(b *testing.B) (string, func()) {
+	var buffer bytes.Buffer
+	for index := 0; index < 20000; index += 1 {
+		fmt.Fprintf(&buffer, `2018-01-16T15:%02d:%02d.000-0800 I COMMAND  [conn1] command test.foo appName: "MongoDB Shell" command: find { find: "foo", filter: { a: %d } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 cursorExhausted:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`+"\n", index/60%60, index%60, index)
+	}
+
+	path, remove := mappedFixture(b, buffer.Bytes())
+	b.SetBytes(int64(buffer.Len()))
+	b.ReportAllocs()
+	b.ResetTimer()
+	return path, remove
+}
+
+func BenchmarkLog_Scanner(b *testing.B) {
+	path, remove := benchmarkFixture(b)
+	defer remove()
+
+	for i := 0; i < b.N; i += 1 {
+		mappedEntries(b, path, streamedLog)
+	}
+}
+
+func BenchmarkLog_Mapped(b *testing.B) {
+	path, remove := benchmarkFixture(b)
+	defer remove()
+
+	for i := 0; i < b.N; i += 1 {
+		mappedEntries(b, path, mappedLog)
+	}
+}
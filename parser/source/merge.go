@@ -0,0 +1,157 @@
+package source
+
+import (
+	"io"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/record"
+)
+
+// Merge combines several sources (e.g. a log and its rotated predecessors)
+// into a single stream ordered by date, like a k-way merge.
+type Merge struct {
+	sources []*mergeSource
+	parser  *internal.DateParser
+
+	next  record.Base
+	error error
+
+	// The source of the most recent entry and the source most recently picked
+	// (which differ when a duplicate entry is skipped), or -1 before the first.
+	last   int
+	picked int
+}
+
+type mergeSource struct {
+	Factory
+
+	base  record.Base
+	error error
+	date  time.Time
+
+	// Whether base holds an entry that has not been emitted, whether its
+	// date could be parsed, and whether the source emitted anything yet.
+	pending bool
+	dated   bool
+	started bool
+	done    bool
+}
+
+// Enforce the interface at compile time.
+var _ Factory = (*Merge)(nil)
+
+func NewMerge(sources ...Factory) *Merge {
+	m := &Merge{
+		parser: internal.DefaultDateParser.Clone(),
+		last:   -1,
+		picked: -1,
+	}
+
+	for _, source := range sources {
+		m.sources = append(m.sources, &mergeSource{Factory: source})
+	}
+
+	return m
+}
+
+func (m *Merge) Close() error {
+	var first error
+	for _, source := range m.sources {
+		if err := source.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m *Merge) Get() (record.Base, error) {
+	return m.next, m.error
+}
+
+func (m *Merge) Next() bool {
+	for {
+		index := m.pick()
+		if index < 0 {
+			m.next, m.error = record.Base{}, io.EOF
+			return false
+		}
+
+		source := m.sources[index]
+		source.pending = false
+		source.started = true
+		m.picked = index
+
+		// Rotated logs can repeat the lines written around the rotation, so
+		// a line identical to the previous one from another source is skipped.
+		if m.last >= 0 && m.last != index && source.error == nil && m.error == nil && source.base.String() == m.next.String() {
+			continue
+		}
+
+		m.next, m.error, m.last = source.base, source.error, index
+		return true
+	}
+}
+
+// Returns the index of the source with the next entry, or -1 when every
+// source has ended.
+func (m *Merge) pick() int {
+	for _, source := range m.sources {
+		m.fill(source)
+	}
+
+	// Entries without a date (e.g. the remainder of a multi-line entry or an
+	// unparsable line) follow whatever came before them. That is the previous
+	// entry of the same source, or the previous entry of the merged stream if
+	// the source has not emitted anything yet.
+	if m.picked >= 0 {
+		if source := m.sources[m.picked]; source.pending && !source.dated {
+			return m.picked
+		}
+	}
+	for index, source := range m.sources {
+		if source.pending && !source.dated && !source.started {
+			return index
+		}
+	}
+
+	earliest := -1
+	for index, source := range m.sources {
+		if !source.pending || !source.dated {
+			continue
+		} else if earliest < 0 || source.date.Before(m.sources[earliest].date) {
+			earliest = index
+		}
+	}
+
+	if earliest < 0 {
+		// Only undated entries remain.
+		for index, source := range m.sources {
+			if source.pending {
+				return index
+			}
+		}
+	}
+
+	return earliest
+}
+
+// Reads the next entry of a source if the previous one was emitted.
+func (m *Merge) fill(source *mergeSource) {
+	if source.pending || source.done {
+		return
+	} else if !source.Next() {
+		source.done = true
+		return
+	}
+
+	source.base, source.error = source.Get()
+	source.pending = true
+	source.dated = false
+
+	if source.base.RawDate != "" {
+		if date, _, err := m.parser.Parse(source.base.RawDate); err == nil {
+			source.date, source.dated = date, true
+		}
+	}
+}
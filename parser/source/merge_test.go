@@ -0,0 +1,59 @@
+package source
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestMerge_Next(t *testing.T) {
+	open := func(lines ...string) Factory {
+		log, err := NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+		return log
+	}
+
+	older := open(
+		"2018-01-16T15:00:01.000-0800 I CONTROL  [initandlisten] line 1",
+		"2018-01-16T15:00:03.000-0800 I CONTROL  [initandlisten] line 3",
+		"    continuation of line 3",
+		"2018-01-16T15:00:05.000-0800 I CONTROL  [initandlisten] line 5",
+	)
+	newer := open(
+		"    continuation from before the log began",
+		"2018-01-16T15:00:02.000-0800 I CONTROL  [initandlisten] line 2",
+		"2018-01-16T15:00:04.000-0800 I CONTROL  [initandlisten] line 4",
+		"2018-01-16T15:00:05.000-0800 I CONTROL  [initandlisten] line 5",
+		"2018-01-16T15:00:06.000-0800 I CONTROL  [initandlisten] line 6",
+	)
+
+	expected := []string{
+		"    continuation from before the log began",
+		"2018-01-16T15:00:01.000-0800 I CONTROL  [initandlisten] line 1",
+		"2018-01-16T15:00:02.000-0800 I CONTROL  [initandlisten] line 2",
+		"2018-01-16T15:00:03.000-0800 I CONTROL  [initandlisten] line 3\n    continuation of line 3",
+		"2018-01-16T15:00:04.000-0800 I CONTROL  [initandlisten] line 4",
+		"2018-01-16T15:00:05.000-0800 I CONTROL  [initandlisten] line 5",
+		"2018-01-16T15:00:06.000-0800 I CONTROL  [initandlisten] line 6",
+	}
+
+	merge := NewMerge(older, newer)
+	count := 0
+	for ; merge.Next(); count += 1 {
+		base, _ := merge.Get()
+		if count < len(expected) && base.String() != expected[count] {
+			t.Errorf("entry %d mismatch, expected '%s', got '%s'", count+1, expected[count], base.String())
+		}
+	}
+	if count != len(expected) {
+		t.Errorf("expected %d entries, got %d", len(expected), count)
+	}
+	if merge.Next() {
+		t.Error("the merge should remain at the end")
+	}
+	if err := merge.Close(); err != nil {
+		t.Errorf("unexpected error closing the merge (%s)", err)
+	}
+}
@@ -0,0 +1,236 @@
+package source
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"mgotools/parser/record"
+)
+
+// Rotation reads a log and its rotated files as a single log, one file after
+// another. Each file is opened once it is reached (so compression is detected
+// for each file separately) and line numbers continue from one file to the
+// next.
+type Rotation struct {
+	paths []string
+	warn  func(string, error)
+
+	current *JSONLog
+	offset  uint
+	closed  bool
+	mutex   sync.Mutex
+
+	next  record.Base
+	error error
+}
+
+// Enforce the interface at compile time.
+var _ Factory = (*Rotation)(nil)
+
+// Files that cannot be opened or read as a log are skipped, after passing the
+// path and the reason to warn.
+func NewRotation(paths []string, warn func(string, error)) *Rotation {
+	return &Rotation{paths: paths, warn: warn}
+}
+
+// RotationGlob returns the files matching a glob (e.g. mongod.log*) in
+// rotation order, oldest first (see rotationSort).
+func RotationGlob(pattern string) ([]string, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(matches))
+	for _, path := range matches {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+	}
+
+	rotationSort(paths)
+	return paths, nil
+}
+
+// Files are grouped by the log they were rotated from, then ordered oldest
+// first. logrotate numbers files from the newest (mongod.log.1) to the oldest,
+// while the server's own rotation appends a date (mongod.log.2019-05-01T11-30-00)
+// that orders naturally. Numbered files are read before dated ones, and the
+// active file (mongod.log), whose name the others extend, is read last.
+func rotationSort(paths []string) {
+	const (
+		rotationNumbered = iota
+		rotationSuffixed
+		rotationActive
+	)
+
+	type rotationKey struct {
+		stem   string
+		class  int
+		number uint64
+	}
+
+	// The names that rotated files may extend: the active file, or the name
+	// left after removing the number logrotate appends.
+	stems := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		if stem, _, ok := rotationNumber(path); ok {
+			stems[stem] = true
+		} else {
+			stems[path] = true
+		}
+	}
+
+	keys := make(map[string]rotationKey, len(paths))
+	for _, path := range paths {
+		key := rotationKey{stem: path, class: rotationActive}
+		for stem := range stems {
+			if len(stem) < len(key.stem) && strings.HasPrefix(path, stem+".") {
+				key.stem = stem
+			}
+		}
+
+		if _, number, ok := rotationNumber(path); ok {
+			key.class, key.number = rotationNumbered, number
+		} else if key.stem != path {
+			key.class = rotationSuffixed
+		}
+		keys[path] = key
+	}
+
+	sort.SliceStable(paths, func(i, j int) bool {
+		a, b := keys[paths[i]], keys[paths[j]]
+		switch {
+		case a.stem != b.stem:
+			return rotationLess(a.stem, b.stem)
+		case a.class != b.class:
+			return a.class < b.class
+		case a.number != b.number:
+			return a.number > b.number
+		default:
+			return rotationLess(paths[i], paths[j])
+		}
+	})
+}
+
+// Returns the name and number of a file rotated by logrotate, which may also
+// have been compressed (e.g. mongod.log.2.gz).
+func rotationNumber(path string) (string, uint64, bool) {
+	name := path
+	for _, extension := range []string{".gz", ".zst"} {
+		name = strings.TrimSuffix(name, extension)
+	}
+
+	if index := strings.LastIndexByte(name, '.'); index >= 0 {
+		if number, err := strconv.ParseUint(name[index+1:], 10, 64); err == nil {
+			return name[:index], number, true
+		}
+	}
+	return "", 0, false
+}
+
+func (r *Rotation) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
+
+func (r *Rotation) isClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
+
+func (r *Rotation) Get() (record.Base, error) {
+	return r.next, r.error
+}
+
+func (r *Rotation) Next() bool {
+	for r.current != nil || r.open() {
+		if r.current.Next() {
+			r.next, r.error = r.current.Get()
+			r.next.LineNumber += r.offset
+			return true
+		}
+
+		r.mutex.Lock()
+		r.offset += r.current.line
+		r.current.Close()
+		r.current = nil
+		r.mutex.Unlock()
+	}
+
+	r.next, r.error = record.Base{}, io.EOF
+	return false
+}
+
+// Opens the next file that can be read as a log, returning false once none
+// remain or the rotation is closed.
+func (r *Rotation) open() bool {
+	for len(r.paths) > 0 && !r.isClosed() {
+		path := r.paths[0]
+		r.paths = r.paths[1:]
+
+		file, err := os.Open(path)
+		if err == nil {
+			var log *JSONLog
+			if log, err = NewJSONLog(file); err == nil {
+				r.mutex.Lock()
+				defer r.mutex.Unlock()
+
+				if r.closed {
+					log.Close()
+					return false
+				}
+				r.current = log
+				return true
+			}
+			file.Close()
+		}
+
+		if r.warn != nil {
+			r.warn(path, err)
+		}
+	}
+	return false
+}
+
+// Compares two names, where runs of digits are compared by their value.
+func rotationLess(a, b string) bool {
+	x, y := []rune(a), []rune(b)
+	for len(x) > 0 && len(y) > 0 {
+		i, j := rotationChunk(x), rotationChunk(y)
+		if left, right := string(x[:i]), string(y[:j]); left != right {
+			m, errM := strconv.ParseUint(left, 10, 64)
+			n, errN := strconv.ParseUint(right, 10, 64)
+			if errM == nil && errN == nil && m != n {
+				return m < n
+			}
+			return left < right
+		}
+		x, y = x[i:], y[j:]
+	}
+	return len(x) < len(y)
+}
+
+// The length of the run of digits (or of other characters) beginning a name.
+func rotationChunk(name []rune) int {
+	digit := unicode.IsDigit(name[0])
+	length := 1
+	for length < len(name) && unicode.IsDigit(name[length]) == digit {
+		length += 1
+	}
+	return length
+}
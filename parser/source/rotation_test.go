@@ -0,0 +1,123 @@
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRotationGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"mongod.log", "mongod.log.10", "mongod.log.2", "mongod.log.1", "mongod.log.2.gz", "mongod.log.2019-05-01T12-30-00", "mongod.log.2019-05-01T11-30-00", "other.log"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "mongod.log.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := RotationGlob(filepath.Join(dir, "mongod.log*"))
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	for index := range paths {
+		paths[index] = filepath.Base(paths[index])
+	}
+	// Oldest first: numbered files count down, dated files count up, and the
+	// active file is last.
+	if expected := []string{"mongod.log.10", "mongod.log.2", "mongod.log.2.gz", "mongod.log.1", "mongod.log.2019-05-01T11-30-00", "mongod.log.2019-05-01T12-30-00", "mongod.log"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+
+	if paths, err := RotationGlob(filepath.Join(dir, "missing.log*")); err != nil || len(paths) != 0 {
+		t.Errorf("expected no files for an empty glob, got %v (%v)", paths, err)
+	} else if _, err := RotationGlob("["); err == nil {
+		t.Error("expected an error for a malformed glob")
+	}
+}
+
+func TestRotation_Next(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rotation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	line := func(second int) string {
+		return fmt.Sprintf("2018-01-16T15:00:%02d.000-0800 I CONTROL  [initandlisten] line %d", second, second)
+	}
+
+	// The oldest file lacks a final newline, the next is compressed, and the
+	// active file holds the newest line.
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(line(3) + "\n" + line(4) + "\n"))
+	writer.Close()
+
+	files := map[string][]byte{
+		"mongod.log.3": []byte(line(1) + "\n" + line(2)),
+		"mongod.log.2": compressed.Bytes(),
+		"mongod.log.1": {0x28, 0xb5, 0x2f, 0xfd, 0x24, 0x4b, 0x59, 0x02, 0x00},
+		"mongod.log":   []byte(line(5) + "\n"),
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), contents, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, err := RotationGlob(filepath.Join(dir, "mongod.log*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var skipped []string
+	rotation := NewRotation(append(paths, filepath.Join(dir, "missing.log")), func(path string, err error) {
+		skipped = append(skipped, filepath.Base(path))
+	})
+
+	count := 0
+	for ; rotation.Next(); count += 1 {
+		if base, err := rotation.Get(); err != nil {
+			t.Errorf("entry %d returned an error (%s)", count+1, err)
+		} else if base.String() != line(count+1) || base.LineNumber != uint(count+1) {
+			t.Errorf("entry %d mismatch (line %d): %s", count+1, base.LineNumber, base.String())
+		}
+	}
+	if count != 5 {
+		t.Errorf("expected 5 entries, got %d", count)
+	}
+	if expected := []string{"mongod.log.1", "missing.log"}; !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("expected %v to be skipped, got %v", expected, skipped)
+	}
+	if rotation.Next() {
+		t.Error("the rotation should remain at the end")
+	} else if err := rotation.Close(); err != nil {
+		t.Errorf("unexpected error closing the rotation (%s)", err)
+	}
+
+	// Closing stops the rotation before any remaining files are opened.
+	rotation = NewRotation(paths, nil)
+	if !rotation.Next() {
+		t.Fatal("expected the first entry")
+	} else if err := rotation.Close(); err != nil {
+		t.Errorf("unexpected error closing the rotation (%s)", err)
+	}
+	for rotation.Next() {
+		if base, _ := rotation.Get(); !strings.HasSuffix(base.String(), "line 2") {
+			t.Errorf("no files should be read after closing, got %s", base.String())
+		}
+	}
+}
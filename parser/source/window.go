@@ -0,0 +1,103 @@
+package source
+
+import (
+	"io"
+	"time"
+
+	"mgotools/internal"
+	"mgotools/parser/record"
+)
+
+// Logs are written roughly in date order, so reading stops once an entry is
+// this far past the end of the window rather than at the first entry past it.
+const windowSlack = time.Minute
+
+// Window passes along the entries of a source dated on or after since and
+// before until (i.e. since is inclusive and until is exclusive). A zero date
+// leaves that end of the window open.
+type Window struct {
+	source Factory
+	parser *internal.DateParser
+
+	since time.Time
+	until time.Time
+	now   time.Time
+
+	next  record.Base
+	error error
+
+	// Whether the most recent dated entry fell within the window. Entries
+	// without a date (e.g. the remainder of a multi-line entry) follow it.
+	inside bool
+	done   bool
+}
+
+// Enforce the interface at compile time.
+var _ Factory = (*Window)(nil)
+
+func NewWindow(source Factory, since, until time.Time) *Window {
+	return &Window{
+		source: source,
+		parser: internal.DefaultDateParser.Clone(),
+		since:  since,
+		until:  until,
+		now:    time.Now(),
+
+		// Undated lines at the start of a log cannot be placed, so they are
+		// only kept when the window has no beginning.
+		inside: since.IsZero(),
+	}
+}
+
+func (w *Window) Close() error {
+	return w.source.Close()
+}
+
+func (w *Window) Get() (record.Base, error) {
+	return w.next, w.error
+}
+
+func (w *Window) Next() bool {
+	for !w.done && w.source.Next() {
+		base, err := w.source.Get()
+
+		if date, ok := w.date(base); ok {
+			if !w.until.IsZero() && date.Sub(w.until) > windowSlack {
+				break
+			}
+			w.inside = !date.Before(w.since) && (w.until.IsZero() || date.Before(w.until))
+		}
+
+		if w.inside {
+			w.next, w.error = base, err
+			return true
+		}
+	}
+
+	w.done = true
+	w.next, w.error = record.Base{}, io.EOF
+	return false
+}
+
+// Parses the date of an entry. Dates in a ctime format have no year, which is
+// assumed to be the current year unless that puts the date in the future.
+func (w *Window) date(base record.Base) (time.Time, bool) {
+	if base.RawDate == "" {
+		return time.Time{}, false
+	}
+
+	date, format, err := w.parser.Parse(base.RawDate)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if date.Year() == 0 {
+		year := w.now.Year()
+		if date.Month() > w.now.Month() || (date.Month() == w.now.Month() && date.Day() > w.now.Day()) {
+			year -= 1
+		}
+		date = date.AddDate(year, 0, 0)
+	}
+
+	return internal.DateInZone(date, format, time.Local), true
+}
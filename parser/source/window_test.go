@@ -0,0 +1,72 @@
+package source
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindow_Next(t *testing.T) {
+	lines := []string{
+		"    continuation from before the log began",
+		"2018-01-16T15:00:01.000-0800 I CONTROL  [initandlisten] line 1",
+		"2018-01-16T15:00:02.000-0800 I CONTROL  [initandlisten] line 2",
+		"    continuation of line 2",
+		"2018-01-16T15:00:03.000-0800 I CONTROL  [initandlisten] line 3",
+		"2018-01-16T15:00:04.000-0800 I CONTROL  [initandlisten] line 4",
+		"    continuation of line 4",
+		"2018-01-16T15:00:03.500-0800 I CONTROL  [initandlisten] out of order",
+		"2018-01-16T15:05:00.000-0800 I CONTROL  [initandlisten] line 5",
+		"2018-01-16T15:00:01.000-0800 I CONTROL  [initandlisten] after the end",
+	}
+
+	date := func(second int) time.Time {
+		return time.Date(2018, 1, 16, 23, 0, second, 0, time.UTC)
+	}
+
+	type test struct {
+		Since    time.Time
+		Until    time.Time
+		Expected []string
+	}
+
+	for _, test := range []test{
+		{
+			Since:    date(2),
+			Until:    date(4),
+			Expected: []string{lines[2] + "\n" + lines[3], lines[4], lines[7]},
+		},
+		{
+			Until:    date(2),
+			Expected: []string{lines[0], lines[1]},
+		},
+		{
+			Since:    date(4),
+			Expected: []string{lines[5] + "\n" + lines[6], lines[8]},
+		},
+	} {
+		log, err := NewLog(ioutil.NopCloser(strings.NewReader(strings.Join(lines, "\n"))))
+		if err != nil {
+			t.Fatalf("unexpected error opening the log (%s)", err)
+		}
+
+		window := NewWindow(log, test.Since, test.Until)
+		count := 0
+		for ; window.Next(); count += 1 {
+			base, _ := window.Get()
+			if count < len(test.Expected) && base.String() != test.Expected[count] {
+				t.Errorf("entry %d mismatch, expected '%s', got '%s'", count+1, test.Expected[count], base.String())
+			}
+		}
+		if count != len(test.Expected) {
+			t.Errorf("expected %d entries between %s and %s, got %d", len(test.Expected), test.Since, test.Until, count)
+		}
+		if window.Next() {
+			t.Error("the window should remain at the end")
+		}
+		if err := window.Close(); err != nil {
+			t.Errorf("unexpected error closing the window (%s)", err)
+		}
+	}
+}
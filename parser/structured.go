@@ -0,0 +1,144 @@
+// Structured (JSON) logs place the details of slow operations under "attr"
+// rather than in the message text. The functions in this file map those
+// attributes onto the same messages created by the text parsers so any
+// downstream CRUD extraction behaves identically for both formats.
+
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"mgotools/internal"
+	"mgotools/parser/message"
+)
+
+// Command names that may appear as a key in an "attr.command" document. The
+// command name is always the first key of the document, but key order is not
+// preserved once parsed.
+var structuredCommands = []string{
+	"aggregate",
+	"count",
+	"delete",
+	"distinct",
+	"find",
+	"findAndModify",
+	"findandmodify",
+	"geoNear",
+	"getMore",
+	"insert",
+	"mapReduce",
+	"update",
+}
+
+func StructuredCommand(attr map[string]interface{}) (message.Command, error) {
+	payload, ok := attr["command"].(map[string]interface{})
+	if !ok {
+		return message.Command{}, internal.CommandStructure
+	}
+
+	cmd := message.MakeCommand()
+	cmd.Payload = payload
+	cmd.Command = structuredCommandName(payload)
+	cmd.Namespace, _ = attr["ns"].(string)
+	cmd.Namespace = NamespaceReplace(cmd.Command, cmd.Payload, cmd.Namespace)
+	TransactionPayload(cmd.Payload, &cmd.BaseCommand)
+	cmd.Truncated = truncatedValue(cmd.Payload)
+
+	// A getMore references the command that created the cursor separately,
+	// which is where the text parsers place it as well.
+	if originatingCommand, ok := attr["originatingCommand"].(map[string]interface{}); ok {
+		cmd.Payload["originatingCommand"] = originatingCommand
+	}
+
+	cmd.Agent, _ = attr["appName"].(string)
+	cmd.Exception, _ = attr["errMsg"].(string)
+	cmd.QueryHash, _ = attr["queryHash"].(string)
+	cmd.PlanCacheKey, _ = attr["planCacheKey"].(string)
+	cmd.Protocol, _ = attr["protocol"].(string)
+	cmd.Storage, _ = attr["storage"].(map[string]interface{})
+
+	if locks, ok := attr["locks"].(map[string]interface{}); ok {
+		cmd.Locks = locks
+	}
+
+	if summary, ok := attr["planSummary"].(string); ok {
+		var err error
+		if cmd.PlanSummary, err = PlanSummary(internal.NewRuneReader(summary)); err != nil {
+			return message.Command{}, err
+		}
+	}
+
+	for key, value := range attr {
+		if number, ok := structuredInteger(value); ok && key != "durationMillis" {
+			cmd.Counters[key] = number
+		}
+	}
+
+	cmd.Duration, ok = structuredInteger(attr["durationMillis"])
+	if micros, found := cmd.Counters["durationMicros"]; found && !ok {
+		cmd.Duration = micros / 1000
+	}
+	return cmd, nil
+}
+
+// Legacy write operations (and OP_QUERY) are logged with their type rather
+// than a command name, e.g. an update with "command": {"q": {}, "u": {}}.
+func StructuredOperation(attr map[string]interface{}) (message.Operation, error) {
+	cmd, err := StructuredCommand(attr)
+	if err != nil {
+		return message.Operation{}, err
+	}
+
+	op := message.Operation{
+		BaseCommand: cmd.BaseCommand,
+		Agent:       cmd.Agent,
+		Locks:       cmd.Locks,
+		Payload:     cmd.Payload,
+		Storage:     cmd.Storage,
+	}
+	op.Operation, _ = attr["type"].(string)
+	return op, nil
+}
+
+func structuredCommandName(payload map[string]interface{}) string {
+	for _, name := range structuredCommands {
+		if _, ok := payload[name]; ok {
+			return name
+		}
+	}
+
+	return "command"
+}
+
+func structuredInteger(value interface{}) (int64, bool) {
+	switch t := value.(type) {
+	case int:
+		return int64(t), true
+	case int64:
+		return t, true
+	case bool:
+		if t {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// Values of any type (e.g. a parameter set to a number or a document) as
+// text, where strings are returned as-is.
+func structuredString(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	}
+
+	if out, err := json.Marshal(value); err == nil {
+		return string(out)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"testing"
+
+	"mgotools/mongo"
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+)
+
+func TestStructuredCommand_OriginatingCommand(t *testing.T) {
+	find := `{"t":{"$date":"2020-05-20T20:10:08.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","appName":"MongoDB Shell","command":{"find":"foo","filter":{"a":{"$gt":5}},"batchSize":2,"lsid":{"id":{"$uuid":"a4d3f8b4-9b8c-4d4e-a9a4-17a0d5a6b1b6"}},"$db":"test"},"planSummary":"IXSCAN { a: 1 }","cursorid":8251318744,"keysExamined":2,"docsExamined":2,"numYields":0,"nreturned":2,"reslen":250,"locks":{},"protocol":"op_msg","durationMillis":12}}`
+	getMore := `{"t":{"$date":"2020-05-20T20:10:09.731+00:00"},"s":"I","c":"COMMAND","id":51803,"ctx":"conn1","msg":"Slow query","attr":{"type":"command","ns":"test.foo","appName":"MongoDB Shell","command":{"getMore":8251318744,"collection":"foo","batchSize":2,"$db":"test"},"originatingCommand":{"find":"foo","filter":{"a":{"$gt":1}},"batchSize":2,"$db":"test"},"planSummary":"IXSCAN { a: 1 }","cursorid":8251318744,"keysExamined":2,"docsExamined":2,"cursorExhausted":true,"numYields":0,"nreturned":2,"reslen":250,"locks":{},"protocol":"op_msg","durationMillis":3}}`
+
+	crud := func(line string) message.CRUD {
+		doc, err := mongo.ParseJson(line, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing fixture (%s)", err)
+		}
+
+		attr, _ := doc["attr"].(map[string]interface{})
+		cmd, err := StructuredCommand(attr)
+		if err != nil {
+			t.Fatalf("StructuredCommand returned an error (%s)", err)
+		}
+
+		c, ok := CrudOrMessage(cmd, cmd.Command, cmd.Counters, cmd.Payload).(message.CRUD)
+		if !ok {
+			t.Fatalf("expected a CRUD message for %s", cmd.Command)
+		}
+		return c
+	}
+
+	original, more := crud(find), crud(getMore)
+	if cmd, _ := more.Message.(message.Command); cmd.Command != "getMore" || cmd.Namespace != "test.foo" || cmd.Duration != 3 {
+		t.Errorf("getMore command mismatch: %+v", cmd)
+	} else if cmd.Counters["cursorExhausted"] != 1 || cmd.Counters["nreturned"] != 2 {
+		t.Errorf("getMore counters mismatch: %+v", cmd.Counters)
+	} else if len(cmd.PlanSummary) != 1 || cmd.PlanSummary[0].Type != "IXSCAN" {
+		t.Errorf("getMore plan summary mismatch: %+v", cmd.PlanSummary)
+	}
+
+	if more.CursorId != 8251318744 {
+		t.Errorf("getMore cursor id mismatch, got %d", more.CursorId)
+	} else if more.Filter == nil {
+		t.Fatalf("getMore should use the originating command filter")
+	} else if more.Origin != "find" || original.Origin != "" {
+		t.Errorf("getMore origin mismatch, got '%s' and '%s'", more.Origin, original.Origin)
+	}
+
+	if a, b := mongo.NewPattern(original.Filter).StringCompact(), mongo.NewPattern(more.Filter).StringCompact(); a != b {
+		t.Errorf("getMore pattern should match the originating find: %s, %s", a, b)
+	}
+
+	if _, err := StructuredCommand(map[string]interface{}{"ns": "test.foo"}); err == nil {
+		t.Errorf("attributes without a command should return an error")
+	}
+}
+
+func TestStructuredCommand_DurationMicros(t *testing.T) {
+	doc, err := mongo.ParseJson(`{"attr":{"type":"command","ns":"test.foo","command":{"find":"foo","filter":{"a":1},"$db":"test"},"planSummary":"COLLSCAN","nreturned":1,"durationMicros":1250}}`, false)
+	if err != nil {
+		t.Fatalf("unexpected error parsing fixture (%s)", err)
+	}
+
+	attr, _ := doc["attr"].(map[string]interface{})
+	cmd, err := StructuredCommand(attr)
+	if err != nil {
+		t.Fatalf("StructuredCommand returned an error (%s)", err)
+	} else if cmd.Duration != 1 || cmd.DurationMicros() != 1250 {
+		t.Errorf("expected 1ms (1250us), got %dms (%dus)", cmd.Duration, cmd.DurationMicros())
+	}
+}
+
+func TestVersion44Parser_ClientMetadata(t *testing.T) {
+	doc, err := mongo.ParseJson(`{"remote":"10.0.0.5:53342","client":"conn12","doc":{"application":{"name":"reporting"},"driver":{"name":"nodejs","version":"3.6.0"}}}`, false)
+	if err != nil {
+		t.Fatalf("unexpected error parsing fixture (%s)", err)
+	}
+
+	msg, err := (&Version44Parser{}).NewLogMessage(record.Entry{Base: record.Base{RawMessage: "client metadata", Attributes: doc}})
+	if err != nil {
+		t.Fatalf("unexpected error (%s)", err)
+	}
+	if meta, ok := msg.(message.ConnectionMeta); !ok {
+		t.Errorf("expected client metadata, got %T", msg)
+	} else if meta.Conn != 12 || meta.Port != 53342 || meta.AppName != "reporting" || meta.Driver != "nodejs 3.6.0" {
+		t.Errorf("metadata mismatch, got %+v", meta)
+	}
+}
+
+func TestVersion44Parser_Authentication(t *testing.T) {
+	for text, expected := range map[string]message.Authentication{
+		"Successfully authenticated": {Principal: "app", Database: "admin", Mechanism: "SCRAM-SHA-256", IP: "10.0.0.5"},
+		"Authentication failed":      {Principal: "app", Database: "admin", Mechanism: "SCRAM-SHA-256", IP: "10.0.0.5", Failed: true, Error: "AuthenticationFailed: SCRAM authentication failed, storedKey mismatch"},
+	} {
+		doc, err := mongo.ParseJson(`{"mechanism":"SCRAM-SHA-256","principalName":"app","authenticationDatabase":"admin","remote":"10.0.0.5:51242","error":"`+expected.Error+`"}`, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing fixture (%s)", err)
+		}
+
+		msg, err := (&Version44Parser{}).NewLogMessage(record.Entry{Base: record.Base{RawMessage: text, Attributes: doc}})
+		if err != nil {
+			t.Errorf("%s: unexpected error (%s)", text, err)
+		} else if msg != expected {
+			t.Errorf("%s: mismatch, got %+v", text, msg)
+		}
+	}
+}
+
+func TestVersion44Parser_ProfilerChange(t *testing.T) {
+	doc, err := mongo.ParseJson(`{"from":{"level":0,"slowms":100,"sampleRate":1.0},"to":{"level":1,"slowms":50,"sampleRate":0.5}}`, false)
+	if err != nil {
+		t.Fatalf("unexpected error parsing fixture (%s)", err)
+	}
+
+	msg, err := (&Version44Parser{}).NewLogMessage(record.Entry{Base: record.Base{RawMessage: "Profiler settings changed", Attributes: doc}})
+	expected := message.ProfilerChange{Level: 1, Slowms: 50, SampleRate: 0.5, PreviousLevel: 0, PreviousSlowms: 100}
+	if err != nil {
+		t.Errorf("unexpected error (%s)", err)
+	} else if msg != expected {
+		t.Errorf("profiler change mismatch, got %+v", msg)
+	}
+
+	doc, _ = mongo.ParseJson(`{"parameterName":"logComponentVerbosity","newValue":{"query":2},"oldValue":{"query":0}}`, false)
+	msg, err = (&Version44Parser{}).NewLogMessage(record.Entry{Base: record.Base{RawMessage: "Successfully set parameter to new value", Attributes: doc}})
+	if err != nil {
+		t.Errorf("unexpected error (%s)", err)
+	} else if msg != (message.ParameterChange{Name: "logComponentVerbosity", Value: `{"query":2}`, Previous: `{"query":0}`}) {
+		t.Errorf("parameter change mismatch, got %+v", msg)
+	}
+}
+
+func TestVersion44Parser_Replication(t *testing.T) {
+	for text, fixture := range map[string]string{
+		"Replica set state transition":                                `{"newState":"PRIMARY","oldState":"SECONDARY"}`,
+		"Member is in new state":                                      `{"hostAndPort":"host2:27017","newState":"SECONDARY"}`,
+		"Election succeeded, assuming primary role":                   `{"term":5}`,
+		"Stepping down from primary, because a new term has begun: 6": `{"term":6}`,
+	} {
+		doc, err := mongo.ParseJson(fixture, false)
+		if err != nil {
+			t.Fatalf("unexpected error parsing fixture (%s)", err)
+		}
+
+		msg, err := (&Version44Parser{}).NewLogMessage(record.Entry{Base: record.Base{RawMessage: text, Attributes: doc}})
+		if err != nil {
+			t.Errorf("%s: unexpected error (%s)", text, err)
+			continue
+		}
+
+		var expected message.Message
+		switch text {
+		case "Replica set state transition":
+			expected = message.StateTransition{From: "SECONDARY", To: "PRIMARY"}
+		case "Member is in new state":
+			expected = message.StateTransition{Host: "host2:27017", To: "SECONDARY"}
+		case "Election succeeded, assuming primary role":
+			expected = message.ElectionWon{Term: 5}
+		default:
+			expected = message.Stepdown{Reason: "a new term has begun: 6"}
+		}
+		if msg != expected {
+			t.Errorf("%s: mismatch, got %+v", text, msg)
+		}
+	}
+}
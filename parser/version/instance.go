@@ -20,6 +20,11 @@ type Context struct {
 	Lines      int
 	LastWinner Definition
 
+	// The error of the winning parser for the most recent entry, e.g. the
+	// reason a message was recognized but could not be parsed. The entry is
+	// still returned (without a message) in that case.
+	LastError error
+
 	DatePreviousMonth time.Month
 	DatePreviousYear  int
 	DateRollover      int
@@ -29,6 +34,12 @@ type Context struct {
 	day        int
 	month      time.Month
 
+	// The message error of each version for the most recent entry. Versions
+	// convert entries concurrently, and the errors are kept apart from the
+	// error each conversion returns so they never change which version wins.
+	messageErrors map[Definition]error
+	messageLock   sync.Mutex
+
 	shutdown sync.Once
 }
 
@@ -40,10 +51,11 @@ func New(parsers []Parser, date *internal.DateParser) *Context {
 		DateRollover:    0,
 		DateYearMissing: false,
 
-		dateParser: date,
-		day:        time.Now().Day(),
-		month:      time.Now().Month(),
-		versions:   make([]Definition, len(parsers)),
+		dateParser:    date,
+		day:           time.Now().Day(),
+		month:         time.Now().Month(),
+		versions:      make([]Definition, len(parsers)),
+		messageErrors: make(map[Definition]error, len(parsers)),
 	}
 
 	for index, version := range parsers {
@@ -75,6 +87,12 @@ func (c *Context) NewEntry(base record.Base) (record.Entry, error) {
 	// Attempt to retrieve a version from the base.
 	entry, version, err := manager.Try(base)
 	c.LastWinner = version
+	c.LastError = err
+	if err == nil {
+		c.messageLock.Lock()
+		c.LastError = c.messageErrors[version]
+		c.messageLock.Unlock()
+	}
 
 	if err == internal.VersionMessageUnmatched {
 		return record.Entry{}, err
@@ -184,6 +202,18 @@ func (c *Context) convert(base record.Base, factory Parser) (record.Entry, error
 	}
 
 	// Try parsing the remaining factories for a log message until one succeeds.
-	out.Message, _ = factory.NewLogMessage(out)
-	return out, err
+	out.Message, err = factory.NewLogMessage(out)
+	if _, ok := err.(internal.VersionUnmatched); ok || out.Message != nil {
+		// Messages that are not recognized at all are expected.
+		err = nil
+	} else if err == internal.VersionDateUnmatched || err == internal.VersionMessageUnmatched {
+		err = nil
+	}
+
+	// The entry is returned without a message either way, so the error is
+	// only recorded for LastError.
+	c.messageLock.Lock()
+	c.messageErrors[factory.Version()] = err
+	c.messageLock.Unlock()
+	return out, nil
 }
@@ -0,0 +1,41 @@
+package version_test
+
+import (
+	"testing"
+
+	"mgotools/internal"
+	_ "mgotools/parser"
+	"mgotools/parser/source"
+	"mgotools/parser/version"
+)
+
+func TestContext_LastError(t *testing.T) {
+	context := version.New(version.Factory.GetAll(), internal.DefaultDateParser.Clone())
+	defer context.Finish()
+
+	for index, test := range []struct {
+		line   string
+		failed bool
+	}{
+		{`2018-01-16T15:00:41.759-0800 I CONTROL  [initandlisten] db version v3.6.8`, false},
+		{`2018-01-16T15:01:00.000-0800 I COMMAND  [conn1] command test.foo command: find { find: "foo", filter: { a: `, true},
+		{`2018-01-16T15:01:01.000-0800 I COMMAND  [conn1] command test.foo command: find { find: "foo", filter: { a: 1 } } planSummary: COLLSCAN keysExamined:0 docsExamined:1 numYields:0 nreturned:1 reslen:100 locks:{} protocol:op_msg 10ms`, false},
+	} {
+		base, err := source.JSONLog{}.NewBase(test.line, uint(index+1))
+		if err != nil {
+			t.Fatalf("line %d could not be read (%s)", index+1, err)
+		}
+
+		// A message that cannot be parsed is only recorded, so it neither
+		// returns an error nor changes the version chosen after the version
+		// line.
+		entry, err := context.NewEntry(base)
+		if err != nil {
+			t.Errorf("line %d returned an error (%s)", index+1, err)
+		} else if winner := context.LastWinner; index > 0 && (winner.Major != 3 || winner.Minor != 6) {
+			t.Errorf("line %d should be parsed as 3.6, got %d.%d", index+1, winner.Major, winner.Minor)
+		} else if failed := context.LastError != nil; failed != test.failed || failed != (entry.Message == nil) {
+			t.Errorf("line %d error mismatch, got %v with message %v", index+1, context.LastError, entry.Message)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package formatting
+
+import (
+	"fmt"
+	"io"
+)
+
+type GrowthTable []Growth
+
+// Growth compares a single pattern between the first and second half of the
+// time range covered by a log. Sums are in microseconds.
+type Growth struct {
+	Pattern
+
+	FirstCount  int64
+	FirstSum    int64
+	SecondCount int64
+	SecondSum   int64
+}
+
+func (g Growth) CountDelta() int64 {
+	return g.SecondCount - g.FirstCount
+}
+
+func (g Growth) MeanDelta() float64 {
+	return mean(g.SecondSum, g.SecondCount) - mean(g.FirstSum, g.FirstCount)
+}
+
+func (table GrowthTable) Print(count int, out io.Writer) {
+	if count <= 0 {
+		return
+	} else if len(table) == 0 {
+		out.Write([]byte("\nno patterns grew between the first and second half of the log.\n"))
+		return
+	}
+
+	out.Write([]byte("\npatterns with the most growth between the first and second half of the log:\n"))
+	for index, growth := range table {
+		if index == count {
+			break
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s count: %d -> %d (%+d) mean (ms): %.1f -> %.1f (%+.1f)\n",
+			growth.Namespace,
+			growth.Operation,
+			growth.Pattern.Pattern,
+			growth.FirstCount,
+			growth.SecondCount,
+			growth.CountDelta(),
+			mean(growth.FirstSum, growth.FirstCount),
+			mean(growth.SecondSum, growth.SecondCount),
+			growth.MeanDelta())))
+	}
+}
+
+// The mean in milliseconds of a sum of microseconds.
+func mean(sum, count int64) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(sum) / float64(count) / 1000
+}
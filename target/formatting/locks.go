@@ -0,0 +1,80 @@
+package formatting
+
+// The lock scopes whose acquire times are aggregated for each pattern. Other
+// scopes come and go between versions (e.g. MMAPV1Journal in 3.x or
+// ReplicationStateTransition in 4.2), so they are ignored.
+var LockScopes = []string{"Global", "Database", "Collection"}
+
+// Returns the time (in microseconds) an operation spent acquiring each of the
+// LockScopes, e.g. locks:{ Global: { timeAcquiringMicros: { r: 12, w: 3 } } }.
+// Times are summed across lock modes, which differ between versions (r and w
+// against R and W). A scope that was acquired without waiting took no time,
+// but operations that logged none of the scopes (e.g. locks:{}) are not ok.
+func LockTimes(locks map[string]interface{}) (map[string]int64, bool) {
+	var times map[string]int64
+	for _, scope := range LockScopes {
+		section, ok := locks[scope].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if times == nil {
+			times = make(map[string]int64, len(LockScopes))
+		}
+		times[scope] += lockMicros(section["timeAcquiringMicros"])
+	}
+	return times, times != nil
+}
+
+func lockMicros(value interface{}) int64 {
+	switch t := value.(type) {
+	case int:
+		return int64(t)
+	case int64:
+		return t
+	case float64:
+		return int64(t)
+	case map[string]interface{}:
+		sum := int64(0)
+		for _, mode := range t {
+			sum += lockMicros(mode)
+		}
+		return sum
+	default:
+		return 0
+	}
+}
+
+// Adds the lock acquire times of a single operation to the pattern. Only
+// operations that logged locks are counted so the mean reflects those
+// operations.
+func (p *Pattern) AddLocks(locks map[string]interface{}) {
+	times, ok := LockTimes(locks)
+	if !ok {
+		return
+	}
+
+	if p.LockScopes == nil {
+		p.LockScopes = make(map[string]int64, len(LockScopes))
+	}
+
+	total := int64(0)
+	for scope, micros := range times {
+		p.LockScopes[scope] += micros
+		total += micros
+	}
+
+	p.Locked += 1
+	p.LockSum += total
+	if total > p.LockMax {
+		p.LockMax = total
+	}
+}
+
+// The mean time (in microseconds) spent acquiring locks per operation that
+// logged locks.
+func (p Pattern) LockMean() (int64, bool) {
+	if p.Locked == 0 {
+		return 0, false
+	}
+	return p.LockSum / p.Locked, true
+}
@@ -1,9 +1,15 @@
 package formatting
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"math"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -11,63 +17,862 @@ import (
 type Table []Pattern
 
 type Pattern struct {
-	Namespace     string
-	Pattern       string
-	Operation     string
-	Count         int64
-	Min           int64
-	Max           int64
-	N95Percentile float64
-	Sum           int64
+	Source    string
+	App       string
+	Comment   string
+	Namespace string
+	Pattern   string
+	Operation string
+	Hint      string
+	Plan      string
+	Count     int64
+
+	// Operations cut short before their duration was logged, which are
+	// counted but left out of the durations.
+	Untimed int64
+
+	// The query shape hash (queryHash), only populated when requested.
+	QueryHash string
+
+	Min float64
+	Max float64
+	Sum float64
+
+	// Latency percentiles (in milliseconds) keyed by percentile, e.g. 95. A
+	// percentile is NaN when there are too few samples to calculate it.
+	Percentiles map[float64]float64
+
+	// Planning and execution times (in microseconds) are only available for
+	// operations that log planningTimeMicros.
+	Planned      int64
+	PlanningSum  int64
+	ExecutionSum int64
+
+	// Disk reads are only available for operations that log a storage
+	// section, so they are tracked alongside the duration (in microseconds)
+	// of those operations.
+	Reads        int64
+	BytesRead    int64
+	ReadingSum   int64
+	ReadDuration int64
+
+	// Sums of each of the StorageMetrics (keyed by name) and the number of
+	// operations that logged them, only populated when requested.
+	Storage      map[string]int64
+	StorageCount int64
+
+	// Time spent acquiring locks (in microseconds) by the operations that
+	// logged locks, in total and for each of the LockScopes, only populated
+	// when requested. LockMax is the longest of any single operation.
+	Locked     int64
+	LockSum    int64
+	LockMax    int64
+	LockScopes map[string]int64
+
+	// Response sizes (reslen) and documents returned are only available for
+	// operations that log reslen. Sorted counts the operations that sorted
+	// results in memory (hasSortStage).
+	Responses     int64
+	ResponseBytes int64
+	Returned      int64
+	Sorted        int64
+
+	// Documents inserted (ninserted), which a single batched insert may log
+	// many of.
+	Inserted int64
+
+	// The getMores of cursors opened by an operation matching the pattern
+	// and their total duration (in milliseconds), which are not part of the
+	// count or latencies of the pattern itself.
+	GetMores   int64
+	GetMoreSum float64
+
+	// The number of operations that used a collection scan (COLLSCAN) in
+	// any stage of their plan.
+	CollectionScans int64
+
+	// Whether any operation matching the pattern was truncated by the server,
+	// in which case the pattern was built from only part of the operation.
+	Approximate bool
+
+	// Documents examined are only available for operations that log
+	// docsExamined, so the documents returned by those operations are kept
+	// separately from Returned. Keys examined are counted separately since
+	// either counter may be missing from a line.
+	Examined         int64
+	DocsExamined     int64
+	ExaminedReturned int64
+	KeysCount        int64
+	KeysExamined     int64
+
+	// The mean keys and documents examined per operation, only populated
+	// when requested.
+	ExaminedMeans *ExaminedMeans
+
+	// The dates of the first and last operations matching the pattern, only
+	// populated when timestamps are requested.
+	FirstSeen time.Time
+	LastSeen  time.Time
+
+	// Latency deciles, only populated when a CDF is requested.
+	Quantiles []float64
+
+	// The p95 of each span of time in the log (NaN when a span has too few
+	// samples), only populated when a trend is requested.
+	Trend []float64
+
+	// The count and p95 within each interval of the log, only populated when
+	// an interval is requested.
+	Intervals []Interval
+}
+
+// Operations matching a pattern within an interval of time. The p95 (in
+// milliseconds) is NaN when the interval has too few samples.
+type Interval struct {
+	Start time.Time
+	Count int64
+	P95   float64
+}
+
+// A mean is NaN when no operation of the pattern logged the counter.
+type ExaminedMeans struct {
+	Keys float64
+	Docs float64
+}
+
+// The number of operations that logged a duration, which the min, max, mean,
+// and percentiles are calculated from.
+func (p Pattern) Timed() int64 {
+	return p.Count - p.Untimed
+}
+
+// Returns the mean keys and documents examined by the operations that logged
+// each counter.
+func (p Pattern) MeanExamined() ExaminedMeans {
+	means := ExaminedMeans{Keys: math.NaN(), Docs: math.NaN()}
+	if p.KeysCount > 0 {
+		means.Keys = float64(p.KeysExamined) / float64(p.KeysCount)
+	}
+	if p.Examined > 0 {
+		means.Docs = float64(p.DocsExamined) / float64(p.Examined)
+	}
+	return means
+}
+
+// Planning time exceeding execution time is a strong sign of plan cache churn.
+func (p Pattern) PlanningDominates() bool {
+	return p.Planned > 0 && p.PlanningSum > p.ExecutionSum
 }
 
-func (patterns Table) Print(wrap bool, out io.Writer) {
+// An operation spending at least half of its time waiting on the disk is
+// limited by IO rather than CPU.
+func (p Pattern) IOBound() bool {
+	return p.Reads > 0 && p.ReadingSum*2 >= p.ReadDuration
+}
+
+// Documents examined for each document returned. An operation returning
+// nothing is treated as returning a single document so that scanning without
+// results still ranks as inefficient.
+func (p Pattern) Ratio() (float64, bool) {
+	if p.Examined == 0 {
+		return 0, false
+	} else if p.ExaminedReturned == 0 {
+		return float64(p.DocsExamined), true
+	}
+	return float64(p.DocsExamined) / float64(p.ExaminedReturned), true
+}
+
+// The mean response size at which an operation is considered to return a
+// large payload.
+const LargePayload = 1024 * 1024
+
+// Most operations sorting in memory while returning large payloads suggests
+// the sort order should be provided by an index instead.
+func (p Pattern) SortLargePayload() bool {
+	return p.Responses > 0 && p.Sorted*2 >= p.Count && p.ResponseBytes/p.Responses >= LargePayload
+}
+
+func (patterns Table) PrintSortLargePayload(out io.Writer) {
+	header := false
+	for _, pattern := range patterns {
+		if !pattern.SortLargePayload() {
+			continue
+		}
+
+		if !header {
+			out.Write([]byte("\nin-memory sorts returning large payloads (an index providing the sort order may help):\n"))
+			header = true
+		}
+
+		perDocument := int64(0)
+		if pattern.Returned > 0 {
+			perDocument = pattern.ResponseBytes / pattern.Returned
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s sort+large-payload sorted: %d/%d reslen: %dB per operation (%dB per document)\n",
+			pattern.Namespace,
+			pattern.Operation,
+			pattern.Pattern,
+			pattern.Sorted,
+			pattern.Count,
+			pattern.ResponseBytes/pattern.Responses,
+			perDocument)))
+	}
+}
+
+func (patterns Table) PrintStorage(out io.Writer) {
+	header := false
+	for _, pattern := range patterns {
+		if pattern.Reads == 0 {
+			continue
+		}
+
+		if !header {
+			out.Write([]byte("\ndisk reads (IO-bound patterns spend at least half their time reading from disk):\n"))
+			header = true
+		}
+
+		bound, percent := "CPU-bound", 0.0
+		if pattern.IOBound() {
+			bound = "IO-bound"
+		}
+		if pattern.ReadDuration > 0 {
+			percent = float64(pattern.ReadingSum) / float64(pattern.ReadDuration) * 100
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s %s read: %dB in %dus (%.0f%% of duration)\n",
+			pattern.Namespace,
+			pattern.Operation,
+			pattern.Pattern,
+			bound,
+			pattern.BytesRead/pattern.Reads,
+			pattern.ReadingSum/pattern.Reads,
+			percent)))
+	}
+}
+
+func (patterns Table) PrintQuantiles(count int, out io.Writer) {
+	if count <= 0 || len(patterns) == 0 {
+		return
+	}
+
+	out.Write([]byte("\nlatency CDF (ms):\n"))
+	for index, pattern := range patterns {
+		if index == count {
+			break
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s\n     ", pattern.Namespace, pattern.Operation, pattern.Pattern)))
+		for decile, value := range pattern.Quantiles {
+			out.Write([]byte(fmt.Sprintf(" %d%%: %s", (decile+1)*100/len(pattern.Quantiles), milliseconds(value))))
+		}
+		out.Write([]byte("\n"))
+	}
+}
+
+// The least-squares slope of the p95 trend, ignoring blank spans. A positive
+// slope means the pattern is getting slower over time.
+func (p Pattern) TrendSlope() (float64, bool) {
+	var n, x, y, xx, xy float64
+	for index, value := range p.Trend {
+		if math.IsNaN(value) {
+			continue
+		}
+
+		n += 1
+		x += float64(index)
+		y += value
+		xx += float64(index * index)
+		xy += float64(index) * value
+	}
+
+	if n < 2 {
+		return 0, false
+	}
+	return (n*xy - x*y) / (n*xx - x*x), true
+}
+
+func (patterns Table) PrintTrend(count int, out io.Writer) {
+	if count <= 0 || len(patterns) == 0 {
+		return
+	}
+
+	out.Write([]byte("\np95 trend (ms):\n"))
+	for index, pattern := range patterns {
+		if index == count {
+			break
+		}
+
+		var direction string
+		if slope, ok := pattern.TrendSlope(); !ok {
+			direction = "too few samples"
+		} else if slope > 0 {
+			direction = "rising"
+		} else if slope < 0 {
+			direction = "falling"
+		} else {
+			direction = "flat"
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s (%s)\n     ", pattern.Namespace, pattern.Operation, pattern.Pattern, direction)))
+		for _, value := range pattern.Trend {
+			if math.IsNaN(value) {
+				out.Write([]byte(" -"))
+			} else {
+				out.Write([]byte(" " + strconv.FormatFloat(value, 'f', 1, 64)))
+			}
+		}
+		out.Write([]byte("\n"))
+	}
+}
+
+func (patterns Table) PrintIntervals(count int, interval time.Duration, out io.Writer) {
+	if count <= 0 || len(patterns) == 0 || patterns[0].Intervals == nil {
+		return
+	}
+
+	out.Write([]byte(fmt.Sprintf("\ncount and p95 (ms) per %s:\n", interval)))
+	for index, pattern := range patterns {
+		if index == count {
+			break
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s\n", pattern.Namespace, pattern.Operation, pattern.Pattern)))
+		for _, value := range pattern.Intervals {
+			p95 := "-"
+			if !math.IsNaN(value.P95) {
+				p95 = strconv.FormatFloat(value.P95, 'f', 1, 64)
+			}
+			out.Write([]byte(fmt.Sprintf("      %s %8d %10s\n", timestamp(value.Start), value.Count, p95)))
+		}
+	}
+}
+
+func (patterns Table) PrintPlanning(out io.Writer) {
+	header := false
+	for _, pattern := range patterns {
+		if !pattern.PlanningDominates() {
+			continue
+		}
+
+		if !header {
+			out.Write([]byte("\nplanning time exceeds execution time (possible plan cache thrashing):\n"))
+			header = true
+		}
+
+		out.Write([]byte(fmt.Sprintf("   %s %s %s planning: %dus execution: %dus\n",
+			pattern.Namespace,
+			pattern.Operation,
+			pattern.Pattern,
+			pattern.PlanningSum/pattern.Planned,
+			pattern.ExecutionSum/pattern.Planned)))
+	}
+}
+
+// Print the table of patterns. When wrapping, the pattern column is narrowed
+// so the whole table fits within width (or the terminal width when zero).
+func (patterns Table) Print(wrap bool, width int, out io.Writer) {
 	if len(patterns) == 0 {
 		out.Write([]byte("no queries found."))
 		return
 	}
 
-	table := tablewriter.NewWriter(out)
-	defer table.Render()
+	rows, column, scanned, approximate := patterns.rows()
 
-	table.Append([]string{"namespace", "operation", "pattern", "count", "min (ms)", "max (ms)", "mean (ms)", "95%-ile (ms)", "sum (ms)"})
+	colWidth := 60
+	if wrap {
+		if width <= 0 {
+			width = TerminalWidth()
+		}
+		colWidth = wrapWidth(rows, column, width)
+	}
+
+	table := tablewriter.NewWriter(out)
+	table.AppendBulk(rows)
 	table.SetAutoWrapText(wrap)
 	table.SetBorder(false)
 	table.SetRowLine(false)
 	table.SetCenterSeparator(" ")
 	table.SetColumnSeparator(" ")
-	table.SetColWidth(60)
+	table.SetColWidth(colWidth)
+	table.Render()
+
+	if scanned {
+		out.Write([]byte("\n* used a collection scan (COLLSCAN) at least once\n"))
+	}
+	if approximate {
+		out.Write([]byte("\n~ approximate, built from operations the server truncated\n"))
+	}
+}
+
+// Print the table of patterns as a GitHub-flavored Markdown table with the
+// same columns as the printed table.
+func (patterns Table) PrintMarkdown(out io.Writer) {
+	if len(patterns) == 0 {
+		out.Write([]byte("no queries found.\n"))
+		return
+	}
+
+	rows, _, scanned, approximate := patterns.rows()
+
+	// Pipes within a cell (e.g. in a $regex) would otherwise end the cell,
+	// and tildes would strike through it.
+	escape := strings.NewReplacer("|", "\\|", "~", "\\~")
+	line := func(cells []string) {
+		out.Write([]byte("|"))
+		for _, cell := range cells {
+			out.Write([]byte(" " + escape.Replace(cell) + " |"))
+		}
+		out.Write([]byte("\n"))
+	}
+
+	line(rows[0])
+	separator := make([]string, len(rows[0]))
+	for index := range separator {
+		separator[index] = "---"
+	}
+	line(separator)
+	for _, row := range rows[1:] {
+		line(row)
+	}
+
+	if scanned {
+		out.Write([]byte("\n\\* used a collection scan (COLLSCAN) at least once\n"))
+	}
+	if approximate {
+		out.Write([]byte("\n\\~ approximate, built from operations the server truncated\n"))
+	}
+}
 
+// The header and a row for each pattern, the index of the pattern column,
+// and whether any pattern used a collection scan or is approximate.
+func (patterns Table) rows() ([][]string, int, bool, bool) {
+	rows := make([][]string, 0, len(patterns)+1)
+
+	// Only include a source column when patterns are labeled by input, and a
+	// ratio column when any operation logged the documents it examined.
+	// Plan, app, and comment columns are only included when grouping by
+	// them, and first/last seen columns when timestamps were requested.
+	labeled, planned, examined, scanned, seen, hashed, stored, locked, applied, commented, means, inserted, cursors, approximate := false, false, false, false, false, false, false, false, false, false, false, false, false, false
 	for _, pattern := range patterns {
-		if pattern.Count == 0 {
-			table.Append([]string{
-				pattern.Namespace,
-				pattern.Operation,
-				pattern.Pattern,
-				"0",
-				"-",
-				"-",
-				"-",
-				"-",
-				"-",
-			})
-		} else {
-			var n95 = "-"
-			if !math.IsNaN(pattern.N95Percentile) && pattern.Count > 1 {
-				n95 = strconv.FormatFloat(pattern.N95Percentile, 'f', 1, 64)
+		if pattern.Comment != "" {
+			commented = true
+		}
+		if pattern.GetMores > 0 {
+			cursors = true
+		}
+		if pattern.Inserted > 0 {
+			inserted = true
+		}
+		if pattern.ExaminedMeans != nil {
+			means = true
+		}
+		if pattern.App != "" {
+			applied = true
+		}
+		if pattern.Storage != nil {
+			stored = true
+		}
+		if pattern.LockScopes != nil {
+			locked = true
+		}
+		if pattern.QueryHash != "" {
+			hashed = true
+		}
+		if !pattern.FirstSeen.IsZero() {
+			seen = true
+		}
+		if pattern.Source != "" {
+			labeled = true
+		}
+		if pattern.Plan != "" {
+			planned = true
+		}
+		if pattern.Examined > 0 {
+			examined = true
+		}
+		if pattern.CollectionScans > 0 {
+			scanned = true
+		}
+		if pattern.Approximate {
+			approximate = true
+		}
+	}
+
+	addRow := func(source, app, comment string, row []string) {
+		if commented {
+			row = append([]string{comment}, row...)
+		}
+		if applied {
+			row = append([]string{app}, row...)
+		}
+		if labeled {
+			row = append([]string{source}, row...)
+		}
+		rows = append(rows, row)
+	}
+
+	percentiles := patterns.percentiles()
+	header := []string{"namespace", "operation", "pattern"}
+	if planned {
+		header = append(header, "plan")
+	}
+	if hashed {
+		header = append(header, "query hash")
+	}
+	header = append(header, "count", "min (ms)", "max (ms)", "mean (ms)")
+	for _, percentile := range percentiles {
+		header = append(header, strconv.FormatFloat(percentile, 'f', -1, 64)+"%-ile (ms)")
+	}
+	header = append(header, "sum (ms)")
+	if cursors {
+		header = append(header, "getmores", "getmore (ms)")
+	}
+	if inserted {
+		header = append(header, "inserted")
+	}
+	if examined {
+		header = append(header, "examined/returned")
+	}
+	if means {
+		header = append(header, "keys examined", "docs examined")
+	}
+	if stored {
+		for _, metric := range StorageMetrics {
+			header = append(header, metric.Header)
+		}
+	}
+	if locked {
+		header = append(header, "lock mean (us)", "lock max (us)")
+	}
+	if seen {
+		header = append(header, "first seen", "last seen")
+	}
+	addRow("source", "app", "comment", header)
+
+	for _, pattern := range patterns {
+		query := pattern.Pattern
+		if pattern.Approximate {
+			query = "~" + query
+		}
+		if pattern.Hint != "" {
+			query += " hint: " + pattern.Hint
+		}
+		if pattern.CollectionScans > 0 {
+			query += " *"
+		}
+
+		row := []string{pattern.Namespace, pattern.Operation, query}
+		if planned {
+			row = append(row, pattern.Plan)
+		}
+		if hashed {
+			if pattern.QueryHash != "" {
+				row = append(row, pattern.QueryHash)
+			} else {
+				row = append(row, "-")
 			}
+		}
 
-			table.Append([]string{
-				pattern.Namespace,
-				pattern.Operation,
-				pattern.Pattern,
+		if pattern.Timed() == 0 {
+			row = append(row, strconv.FormatInt(pattern.Count, 10), "-", "-", "-")
+			for range percentiles {
+				row = append(row, "-")
+			}
+			row = append(row, "-")
+			if cursors {
+				// A pattern may only have getMores when the operation that
+				// opened the cursor was not logged.
+				row = append(row, strconv.FormatInt(pattern.GetMores, 10), milliseconds(pattern.GetMoreSum))
+			}
+			if inserted {
+				row = append(row, "-")
+			}
+			if examined {
+				row = append(row, "-")
+			}
+			if means {
+				row = append(row, "-", "-")
+			}
+			if stored {
+				for range StorageMetrics {
+					row = append(row, "-")
+				}
+			}
+			if locked {
+				row = append(row, "-", "-")
+			}
+			if seen {
+				row = append(row, "-", "-")
+			}
+			addRow(pattern.Source, pattern.App, pattern.Comment, row)
+		} else {
+			row = append(row,
 				strconv.FormatInt(pattern.Count, 10),
-				strconv.FormatInt(pattern.Min, 10),
-				strconv.FormatInt(pattern.Max, 10),
-				strconv.FormatFloat(float64(pattern.Sum/pattern.Count), 'f', 0, 64),
-				n95,
-				strconv.FormatInt(pattern.Sum, 10),
-			})
+				milliseconds(pattern.Min),
+				milliseconds(pattern.Max),
+				milliseconds(pattern.Sum/float64(pattern.Timed())))
+
+			for _, percentile := range percentiles {
+				if value, ok := pattern.percentile(percentile); ok {
+					row = append(row, strconv.FormatFloat(value, 'f', 1, 64))
+				} else {
+					row = append(row, "-")
+				}
+			}
+
+			row = append(row, milliseconds(pattern.Sum))
+			if cursors {
+				row = append(row, strconv.FormatInt(pattern.GetMores, 10), milliseconds(pattern.GetMoreSum))
+			}
+			if inserted {
+				row = append(row, strconv.FormatInt(pattern.Inserted, 10))
+			}
+			if ratio, ok := pattern.Ratio(); ok {
+				row = append(row, strconv.FormatFloat(ratio, 'f', 1, 64))
+			} else if examined {
+				row = append(row, "-")
+			}
+			if means {
+				for _, mean := range []float64{pattern.ExaminedMeans.Keys, pattern.ExaminedMeans.Docs} {
+					if math.IsNaN(mean) {
+						row = append(row, "-")
+					} else {
+						row = append(row, strconv.FormatFloat(mean, 'f', 1, 64))
+					}
+				}
+			}
+			if stored {
+				for _, metric := range StorageMetrics {
+					if value, ok := pattern.StorageMean(metric); ok {
+						row = append(row, strconv.FormatInt(value, 10))
+					} else {
+						row = append(row, "-")
+					}
+				}
+			}
+			if locked {
+				if mean, ok := pattern.LockMean(); ok {
+					row = append(row, strconv.FormatInt(mean, 10), strconv.FormatInt(pattern.LockMax, 10))
+				} else {
+					row = append(row, "-", "-")
+				}
+			}
+			if seen {
+				row = append(row, timestamp(pattern.FirstSeen), timestamp(pattern.LastSeen))
+			}
+
+			addRow(pattern.Source, pattern.App, pattern.Comment, row)
+		}
+	}
+
+	column := 2
+	if labeled {
+		column += 1
+	}
+	if applied {
+		column += 1
+	}
+	if commented {
+		column += 1
+	}
+
+	return rows, column, scanned, approximate
+}
+
+// The table as a JSON array with one object per pattern. Statistics that the
+// printed table shows as "-" are omitted.
+func (patterns Table) MarshalJSON() ([]byte, error) {
+	type intervalJSON struct {
+		Start time.Time `json:"start"`
+		Count int64     `json:"count"`
+		P95   *float64  `json:"p95,omitempty"`
+	}
+
+	type patternJSON struct {
+		Source      string             `json:"source,omitempty"`
+		App         string             `json:"app,omitempty"`
+		Comment     string             `json:"comment,omitempty"`
+		Namespace   string             `json:"namespace"`
+		Operation   string             `json:"operation"`
+		Pattern     string             `json:"pattern"`
+		Hint        string             `json:"hint,omitempty"`
+		Plan        string             `json:"plan,omitempty"`
+		QueryHash   string             `json:"query_hash,omitempty"`
+		Count       int64              `json:"count"`
+		Min         *float64           `json:"min,omitempty"`
+		Max         *float64           `json:"max,omitempty"`
+		Percentiles map[string]float64 `json:"percentiles,omitempty"`
+		Sum         *float64           `json:"sum,omitempty"`
+		GetMores    int64              `json:"getmores,omitempty"`
+		GetMoreSum  float64            `json:"getmore_sum,omitempty"`
+		Inserted    int64              `json:"inserted,omitempty"`
+		Ratio       *float64           `json:"ratio,omitempty"`
+		Keys        *float64           `json:"keys_examined,omitempty"`
+		Docs        *float64           `json:"docs_examined,omitempty"`
+		CollScans   int64              `json:"collscans,omitempty"`
+		Approximate bool               `json:"approximate,omitempty"`
+		Storage     map[string]int64   `json:"storage,omitempty"`
+		LockMean    *int64             `json:"lock_mean,omitempty"`
+		LockMax     *int64             `json:"lock_max,omitempty"`
+		LockScopes  map[string]int64   `json:"lock_scopes,omitempty"`
+		FirstSeen   *time.Time         `json:"first_seen,omitempty"`
+		LastSeen    *time.Time         `json:"last_seen,omitempty"`
+		Intervals   []intervalJSON     `json:"intervals,omitempty"`
+	}
+
+	values := make([]patternJSON, 0, len(patterns))
+	for _, pattern := range patterns {
+		var intervals []intervalJSON
+		for _, interval := range pattern.Intervals {
+			value := intervalJSON{Start: interval.Start, Count: interval.Count}
+			if !math.IsNaN(interval.P95) {
+				p95 := interval.P95
+				value.P95 = &p95
+			}
+			intervals = append(intervals, value)
+		}
+
+		value := patternJSON{
+			Source:      pattern.Source,
+			App:         pattern.App,
+			Comment:     pattern.Comment,
+			Namespace:   pattern.Namespace,
+			Operation:   pattern.Operation,
+			Pattern:     pattern.Pattern,
+			Hint:        pattern.Hint,
+			Plan:        pattern.Plan,
+			QueryHash:   pattern.QueryHash,
+			Count:       pattern.Count,
+			GetMores:    pattern.GetMores,
+			GetMoreSum:  pattern.GetMoreSum,
+			Inserted:    pattern.Inserted,
+			CollScans:   pattern.CollectionScans,
+			Approximate: pattern.Approximate,
+			Intervals:   intervals,
+		}
+
+		if pattern.Timed() > 0 {
+			min, max, sum := pattern.Min, pattern.Max, pattern.Sum
+			value.Min, value.Max, value.Sum = &min, &max, &sum
+
+			if ratio, ok := pattern.Ratio(); ok {
+				value.Ratio = &ratio
+			}
+			if means := pattern.ExaminedMeans; means != nil {
+				if keys := means.Keys; !math.IsNaN(keys) {
+					value.Keys = &keys
+				}
+				if docs := means.Docs; !math.IsNaN(docs) {
+					value.Docs = &docs
+				}
+			}
+			if pattern.StorageCount > 0 {
+				value.Storage = make(map[string]int64, len(StorageMetrics))
+				for _, metric := range StorageMetrics {
+					value.Storage[metric.Name()], _ = pattern.StorageMean(metric)
+				}
+			}
+			if mean, ok := pattern.LockMean(); ok {
+				max := pattern.LockMax
+				value.LockMean, value.LockMax = &mean, &max
+
+				// The mean of each scope, like the storage statistics.
+				value.LockScopes = make(map[string]int64, len(pattern.LockScopes))
+				for scope, sum := range pattern.LockScopes {
+					value.LockScopes[scope] = sum / pattern.Locked
+				}
+			}
+			if !pattern.FirstSeen.IsZero() {
+				first, last := pattern.FirstSeen, pattern.LastSeen
+				value.FirstSeen, value.LastSeen = &first, &last
+			}
+
+			for percentile := range pattern.Percentiles {
+				if n, ok := pattern.percentile(percentile); ok {
+					if value.Percentiles == nil {
+						value.Percentiles = make(map[string]float64)
+					}
+					value.Percentiles[strconv.FormatFloat(percentile, 'f', -1, 64)] = n
+				}
+			}
+		}
+
+		values = append(values, value)
+	}
+
+	return json.Marshal(values)
+}
+
+// Returns a percentile of the pattern, which is only meaningful when there are
+// at least two samples.
+func (p Pattern) percentile(percentile float64) (float64, bool) {
+	value, ok := p.Percentiles[percentile]
+	if !ok || math.IsNaN(value) || p.Timed() < 2 {
+		return 0, false
+	}
+	return value, true
+}
+
+// Every percentile calculated for the patterns in ascending order.
+func (patterns Table) percentiles() []float64 {
+	found := make(map[float64]bool)
+	percentiles := make([]float64, 0)
+	for _, pattern := range patterns {
+		for percentile := range pattern.Percentiles {
+			if !found[percentile] {
+				found[percentile] = true
+				percentiles = append(percentiles, percentile)
+			}
 		}
 	}
+
+	sort.Float64s(percentiles)
+	return percentiles
+}
+
+func timestamp(date time.Time) string {
+	if date.IsZero() {
+		return "-"
+	}
+	return date.Format(dateLayout)
+}
+
+// Formats a duration in milliseconds, keeping up to microsecond precision
+// without trailing zeros.
+func milliseconds(value float64) string {
+	return strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+}
+
+// The narrowest a wrapped column is allowed to become, regardless of width.
+const minWrapWidth = 20
+
+// Calculates the width of a column such that every row fits within width,
+// given that each column is padded by a space on either side and separated
+// from the next column by a single character.
+func wrapWidth(rows [][]string, column int, width int) int {
+	var widths []int
+	for _, row := range rows {
+		for index, cell := range row {
+			if index >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if length := utf8.RuneCountInString(cell); length > widths[index] {
+				widths[index] = length
+			}
+		}
+	}
+
+	remaining := width
+	for index, length := range widths {
+		remaining -= 3
+		if index != column {
+			remaining -= length
+		}
+	}
+
+	if remaining < minWrapWidth {
+		return minWrapWidth
+	}
+	return remaining
 }
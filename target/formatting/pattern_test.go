@@ -0,0 +1,42 @@
+package formatting
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrapWidth(t *testing.T) {
+	rows := [][]string{
+		{"namespace", "operation", "pattern", "count"},
+		{"test.foo", "find", `{"a": 1, "b": 1, "c": 1, "d": 1, "e": 1, "f": 1}`, "10"},
+	}
+
+	// Every column is padded by three characters, so the remaining width is
+	// 120 - 9 - 9 - 5 - (4 * 3) = 85.
+	if width := wrapWidth(rows, 2, 120); width != 85 {
+		t.Errorf("expected a width of 85, got %d", width)
+	}
+	if width := wrapWidth(rows, 2, 60); width != 25 {
+		t.Errorf("expected a width of 25, got %d", width)
+	}
+	if width := wrapWidth(rows, 2, 20); width != minWrapWidth {
+		t.Errorf("narrow widths should be clamped to %d, got %d", minWrapWidth, width)
+	}
+}
+
+func TestTable_PrintMarkdown(t *testing.T) {
+	buffer := bytes.NewBuffer([]byte{})
+	Table{{Namespace: "test.foo", Operation: "find", Pattern: `{"a": /x|y/}`, Count: 1, Min: 5, Max: 5, Sum: 5}}.PrintMarkdown(buffer)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header, a separator, and a row, got:\n%s", buffer.String())
+	} else if lines[0] != "| namespace | operation | pattern | count | min (ms) | max (ms) | mean (ms) | sum (ms) |" {
+		t.Errorf("header mismatch, got %s", lines[0])
+	} else if lines[1] != "| --- | --- | --- | --- | --- | --- | --- | --- |" {
+		t.Errorf("separator mismatch, got %s", lines[1])
+	} else if lines[2] != `| test.foo | find | {"a": /x\|y/} | 1 | 5 | 5 | 5 | 5 |` {
+		t.Errorf("pipes should be escaped, got %s", lines[2])
+	}
+}
@@ -0,0 +1,108 @@
+package formatting
+
+import (
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+type RollupTable []Rollup
+
+// Rollup totals the patterns of a single database. Sums are in milliseconds,
+// the same as the patterns they are totaled from.
+type Rollup struct {
+	Database string  `json:"database"`
+	Patterns int     `json:"patterns"`
+	Count    int64   `json:"count"`
+	Sum      float64 `json:"sum"`
+
+	// The operations that logged a duration, which the mean is taken over.
+	timed int64
+}
+
+// Totals a table of patterns by database (the part of each namespace before
+// the first dot), ordered by the total duration of each database.
+func NewDatabaseRollup(patterns Table) RollupTable {
+	index := make(map[string]int)
+	table := make(RollupTable, 0)
+
+	for _, pattern := range patterns {
+		database := pattern.Namespace
+		if dot := strings.IndexByte(database, '.'); dot >= 0 {
+			database = database[:dot]
+		}
+
+		position, ok := index[database]
+		if !ok {
+			position = len(table)
+			index[database] = position
+			table = append(table, Rollup{Database: database})
+		}
+
+		table[position].Patterns += 1
+		table[position].Count += pattern.Count
+		table[position].Sum += pattern.Sum
+		table[position].timed += pattern.Timed()
+	}
+
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Sum != table[j].Sum {
+			return table[i].Sum > table[j].Sum
+		}
+		return table[i].Database < table[j].Database
+	})
+	return table
+}
+
+func (table RollupTable) Print(out io.Writer) {
+	if len(table) == 0 {
+		return
+	}
+
+	out.Write([]byte("\ntotals by database:\n"))
+
+	writer := tablewriter.NewWriter(out)
+	writer.AppendBulk(table.rows())
+	writer.SetAutoWrapText(false)
+	writer.SetBorder(false)
+	writer.SetRowLine(false)
+	writer.SetCenterSeparator(" ")
+	writer.SetColumnSeparator(" ")
+	writer.Render()
+}
+
+func (table RollupTable) PrintMarkdown(out io.Writer) {
+	if len(table) == 0 {
+		return
+	}
+
+	out.Write([]byte("\n### Totals by database\n\n"))
+	for index, row := range table.rows() {
+		out.Write([]byte("| " + strings.Join(row, " | ") + " |\n"))
+		if index == 0 {
+			out.Write([]byte("|" + strings.Repeat(" --- |", len(row)) + "\n"))
+		}
+	}
+}
+
+func (table RollupTable) rows() [][]string {
+	rows := [][]string{{"database", "patterns", "count", "mean (ms)", "sum (ms)"}}
+	for _, rollup := range table {
+		mean := "-"
+		if rollup.timed > 0 {
+			mean = milliseconds(rollup.Sum / float64(rollup.timed))
+		}
+
+		rows = append(rows, []string{
+			rollup.Database,
+			strconv.Itoa(rollup.Patterns),
+			strconv.FormatInt(rollup.Count, 10),
+			mean,
+			milliseconds(rollup.Sum),
+		})
+	}
+	return rows
+}
@@ -0,0 +1,72 @@
+package formatting
+
+// A statistic from the "storage" section of an operation, e.g.
+// storage:{ data: { bytesRead: 4096 } }, found under a section and key.
+type StorageMetric struct {
+	Section string
+	Key     string
+	Header  string
+}
+
+// The storage statistics aggregated for each pattern and shown as columns
+// when storage metrics are requested. Add to this list to surface more.
+var StorageMetrics = []StorageMetric{
+	{Section: "data", Key: "bytesRead", Header: "bytes read"},
+	{Section: "data", Key: "timeReadingMicros", Header: "reading (us)"},
+	{Section: "data", Key: "bytesWritten", Header: "bytes written"},
+	{Section: "timeWaitingMicros", Key: "cache", Header: "cache wait (us)"},
+}
+
+// The name of the metric, e.g. "data.bytesRead", which keys the sums kept by
+// a pattern.
+func (m StorageMetric) Name() string {
+	return m.Section + "." + m.Key
+}
+
+// Returns the value of the metric from an operation's storage section, which
+// may be missing entirely (e.g. versions before 4.2 or storage:{}).
+func (m StorageMetric) Value(storage map[string]interface{}) (int64, bool) {
+	section, ok := storage[m.Section].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	switch t := section[m.Key].(type) {
+	case int:
+		return int64(t), true
+	case int64:
+		return t, true
+	case float64:
+		return int64(t), true
+	default:
+		return 0, false
+	}
+}
+
+// Adds the storage statistics of a single operation to the pattern. Only
+// operations with at least one metric are counted so the means reflect the
+// operations that logged storage statistics.
+func (p *Pattern) AddStorage(storage map[string]interface{}) {
+	found := false
+	for _, metric := range StorageMetrics {
+		if value, ok := metric.Value(storage); ok {
+			if p.Storage == nil {
+				p.Storage = make(map[string]int64, len(StorageMetrics))
+			}
+			p.Storage[metric.Name()] += value
+			found = true
+		}
+	}
+	if found {
+		p.StorageCount += 1
+	}
+}
+
+// The mean value of a storage metric per operation that logged storage
+// statistics.
+func (p Pattern) StorageMean(metric StorageMetric) (int64, bool) {
+	if p.StorageCount == 0 {
+		return 0, false
+	}
+	return p.Storage[metric.Name()] / p.StorageCount, true
+}
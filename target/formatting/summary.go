@@ -2,6 +2,7 @@ package formatting
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
@@ -26,10 +27,34 @@ type Summary struct {
 	Version []version.Definition
 	Storage string
 
+	// The slow operation threshold (slowms) each time it changed, which
+	// decides the operations that were slow enough to be logged.
+	Slowms []Threshold
+
 	mutex   sync.Mutex
 	guessed bool
 }
 
+type Threshold struct {
+	Date   time.Time `json:"date"`
+	Slowms int64     `json:"slowms"`
+
+	// Either set at startup or by the profiler (e.g. db.setProfilingLevel).
+	Source string `json:"source"`
+}
+
+const (
+	ThresholdProfiler = "profiler"
+	ThresholdStartup  = "startup"
+)
+
+// The threshold used by every version when none is configured.
+const defaultSlowms = 100
+
+// Dates are printed the same way regardless of the date format used by the
+// log, i.e. ctime (2.4 and older) or ISO-8601.
+const dateLayout = "2006 Jan 02 15:04:05.000"
+
 func NewSummary(name string) Summary {
 	return Summary{
 		Source:  name,
@@ -88,25 +113,9 @@ func (s Summary) Print(w io.Writer) {
 	}
 
 	formatTable := func(histogram map[internal.DateFormat]int) string {
-		formatString := func(format internal.DateFormat) string {
-			switch format {
-			case internal.DateFormatCtime,
-				internal.DateFormatCtimenoms:
-				return "cdate"
-			case internal.DateFormatCtimeyear:
-				return "cdate-year"
-			case internal.DateFormatIso8602Local:
-				return "iso8602-local"
-			case internal.DateFormatIso8602Utc:
-				return "iso8602"
-			default:
-				return "unknown"
-			}
-		}
-
 		if len(histogram) < 2 {
 			for key := range histogram {
-				return formatString(key)
+				return dateFormatName(key)
 			}
 			return "unknown"
 		} else {
@@ -116,7 +125,7 @@ func (s Summary) Print(w io.Writer) {
 				total += count
 			}
 			for format, count := range histogram {
-				buffer.WriteString(formatString(format))
+				buffer.WriteString(dateFormatName(format))
 				buffer.WriteString(" (")
 				buffer.WriteString(strconv.FormatFloat(100*float64(count)/float64(total), 'f', 1, 64))
 				buffer.WriteString("%)  ")
@@ -127,15 +136,87 @@ func (s Summary) Print(w io.Writer) {
 
 	write(w, "source", s.Source, "")
 	write(w, "host", host, "unknown")
-	write(w, "start", s.Start.Format("2006 Jan 02 15:04:05.000"), "")
-	write(w, "end", s.End.Format("2006 Jan 02 15:04:05.000"), "")
+	write(w, "start", s.Start.Format(dateLayout), "")
+	write(w, "end", s.End.Format(dateLayout), "")
 	write(w, "date format", formatTable(s.Format), "")
 	write(w, "length", strconv.FormatUint(uint64(s.Length), 10), "0")
 
+	version, storage := s.describe()
+	write(w, "version", version, "unknown")
+	write(w, "storage", storage, "unknown")
+
+	if len(s.Slowms) > 0 {
+		thresholds := make([]string, len(s.Slowms))
+		for index, threshold := range s.Slowms {
+			thresholds[index] = strconv.FormatInt(threshold.Slowms, 10)
+		}
+		write(w, "slowms", strings.Join(thresholds, " -> "), "")
+	}
+	w.Write([]byte{'\n'})
+}
+
+func dateFormatName(format internal.DateFormat) string {
+	switch format {
+	case internal.DateFormatCtime,
+		internal.DateFormatCtimenoms:
+		return "cdate"
+	case internal.DateFormatCtimeyear:
+		return "cdate-year"
+	case internal.DateFormatIso8602Local:
+		return "iso8602-local"
+	case internal.DateFormatIso8602Utc:
+		return "iso8602"
+	default:
+		return "unknown"
+	}
+}
+
+// The summary as a JSON object, using the same version and storage
+// descriptions as the printed summary. Versions guessed from the messages of
+// the log (rather than read from a startup banner) are flagged as such.
+func (s *Summary) MarshalJSON() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	formats := make(map[string]int, len(s.Format))
+	for format, count := range s.Format {
+		formats[dateFormatName(format)] += count
+	}
+
+	binary := ""
+	if !s.guessed {
+		for _, v := range s.Version {
+			if v.Binary != record.BinaryAny {
+				binary = v.Binary.String()
+			}
+		}
+	}
+
+	version, storage := s.describe()
+	return json.Marshal(struct {
+		Source  string         `json:"source"`
+		Host    string         `json:"host,omitempty"`
+		Port    int            `json:"port,omitempty"`
+		Start   time.Time      `json:"start"`
+		End     time.Time      `json:"end"`
+		Formats map[string]int `json:"formats,omitempty"`
+		Length  uint           `json:"length"`
+		Binary  string         `json:"binary,omitempty"`
+		Version string         `json:"version,omitempty"`
+		Guessed bool           `json:"guessed"`
+		Storage string         `json:"storage,omitempty"`
+		Slowms  []Threshold    `json:"slowms,omitempty"`
+	}{s.Source, s.Host, s.Port, s.Start, s.End, formats, s.Length, binary, version, s.guessed, storage, s.Slowms})
+}
+
+// Describes the version (or a guess at the minimum version) and the storage
+// engine, which is assumed for versions before 3.0.
+func (s *Summary) describe() (string, string) {
+	storage := s.Storage
 	var versions = make([]string, 0, len(s.Version))
 	for _, v := range s.Version {
-		if v.Major < 3 && s.Storage == "" {
-			s.Storage = "MMAPv1"
+		if v.Major < 3 && storage == "" {
+			storage = "MMAPv1"
 		}
 
 		if v.Major > 1 && (len(versions) == 0 || versions[len(versions)-1] != v.String()) {
@@ -144,8 +225,7 @@ func (s Summary) Print(w io.Writer) {
 	}
 
 	if !s.guessed {
-		version := strings.Join(versions, " -> ")
-		write(w, "version", version, "unknown")
+		return strings.Join(versions, " -> "), storage
 	} else {
 		leastVersion := version.Definition{Major: 999, Minor: 999, Binary: record.Binary(999)}
 
@@ -162,12 +242,10 @@ func (s Summary) Print(w io.Writer) {
 		}
 
 		if leastVersion.Major < 999 && leastVersion.Minor < 999 && int(leastVersion.Binary) < 999 {
-			write(w, "version", fmt.Sprintf("(guess) >= %s", leastVersion.String()), "")
+			return fmt.Sprintf("(guess) >= %s", leastVersion.String()), storage
 		}
+		return "", storage
 	}
-
-	write(w, "storage", s.Storage, "unknown")
-	w.Write([]byte{'\n'})
 }
 
 func (s *Summary) Update(entry record.Entry) bool {
@@ -208,6 +286,21 @@ func (s *Summary) Update(entry record.Entry) bool {
 	case message.Version:
 		s.version(t)
 
+	case message.BuildInfo:
+		// Structured logs (4.4+) only report the version in the build info,
+		// while the build info of older logs describes the build environment.
+		if v, ok := buildInfoVersion(t.BuildInfo, entry.Context); ok {
+			s.version(v)
+		}
+
+	case message.StartupOptions:
+		s.threshold(entry.Date, startupSlowms(t.Options), ThresholdStartup)
+
+	case message.ProfilerChange:
+		if t.Slowms >= 0 {
+			s.threshold(entry.Date, t.Slowms, ThresholdProfiler)
+		}
+
 	case message.WiredTigerConfig:
 		s.Storage = "WiredTiger"
 	}
@@ -221,6 +314,64 @@ func (s *Summary) options(port int, hostname string) {
 	s.Host = hostname
 }
 
+// Records a change to the slow operation threshold, ignoring restarts and
+// profiler changes that keep the threshold the same.
+func (s *Summary) threshold(date time.Time, slowms int64, source string) {
+	if count := len(s.Slowms); count > 0 && s.Slowms[count-1].Slowms == slowms {
+		return
+	}
+	s.Slowms = append(s.Slowms, Threshold{Date: date, Slowms: slowms, Source: source})
+}
+
+// Returns the threshold set by the startup options, i.e. the
+// operationProfiling.slowOpThresholdMs option (or slowms in older versions),
+// or the default threshold.
+func startupSlowms(options interface{}) int64 {
+	values, _ := options.(map[string]interface{})
+	if profiling, ok := values["operationProfiling"].(map[string]interface{}); ok {
+		values = profiling
+	}
+
+	for _, key := range []string{"slowOpThresholdMs", "slowms"} {
+		switch value := values[key].(type) {
+		case int:
+			return int64(value)
+		case int64:
+			return value
+		case float64:
+			return int64(value)
+		}
+	}
+	return defaultSlowms
+}
+
+// Returns the version reported by the build info of a structured log, e.g.
+// "4.4.0". The binary is known from the context the build info is logged in.
+func buildInfoVersion(info string, context string) (message.Version, bool) {
+	parts := strings.Split(info, ".")
+	if len(parts) < 2 {
+		return message.Version{}, false
+	}
+
+	major, errMajor := strconv.Atoi(parts[0])
+	minor, errMinor := strconv.Atoi(parts[1])
+	if errMajor != nil || errMinor != nil {
+		return message.Version{}, false
+	}
+
+	v := message.Version{Major: major, Minor: minor}
+	if len(parts) > 2 {
+		v.Revision, _ = strconv.Atoi(parts[2])
+	}
+	switch context {
+	case "initandlisten":
+		v.Binary = "mongod"
+	case "mongosMain":
+		v.Binary = "mongos"
+	}
+	return v, true
+}
+
 func (s *Summary) version(msg message.Version) {
 	if msg.Major == 2 {
 		s.Storage = "MMAPv1"
@@ -0,0 +1,56 @@
+package formatting
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mgotools/parser/message"
+	"mgotools/parser/record"
+	"mgotools/parser/version"
+)
+
+func TestSummary_MarshalJSON(t *testing.T) {
+	type output struct {
+		Binary  string `json:"binary"`
+		Version string `json:"version"`
+		Guessed bool   `json:"guessed"`
+	}
+
+	decode := func(s *Summary) output {
+		var out output
+		if b, err := json.Marshal(s); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		} else if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatalf("summary is not valid JSON (%s): %s", err, b)
+		}
+		return out
+	}
+
+	detected := NewSummary("test")
+	detected.Version = []version.Definition{{Major: 4, Minor: 0, Binary: record.BinaryMongod}}
+	if out := decode(&detected); out.Guessed || out.Binary != "mongod" || out.Version != "mongod 4.0" {
+		t.Errorf("detected version mismatch: %+v", out)
+	}
+
+	guessed := NewSummary("test")
+	guessed.Guess([]version.Definition{{Major: 3, Minor: 6, Binary: record.BinaryMongod}, {Major: 4, Minor: 0, Binary: record.BinaryMongod}})
+	if out := decode(&guessed); !out.Guessed || out.Binary != "" || out.Version != "(guess) >= mongod 3.6" {
+		t.Errorf("guessed version mismatch: %+v", out)
+	}
+}
+
+func TestSummary_Update(t *testing.T) {
+	// A 4.4 log reports its version in the build info.
+	structured := NewSummary("test")
+	structured.Update(record.Entry{Context: "initandlisten", Message: message.BuildInfo{BuildInfo: "4.4.0"}})
+	if version, storage := structured.describe(); version != "mongod 4.4" || storage != "WiredTiger" {
+		t.Errorf("expected mongod 4.4 on WiredTiger, got %s on %s", version, storage)
+	}
+
+	// The build info of older logs describes the build environment instead.
+	legacy := NewSummary("test")
+	legacy.Update(record.Entry{Context: "initandlisten", Message: message.BuildInfo{BuildInfo: "Linux ip-10-0-0-1 3.2.0-4-amd64 #1 SMP x86_64 BOOST_LIB_VERSION=1_49"}})
+	if len(legacy.Version) != 0 {
+		t.Errorf("expected no version from legacy build info, got %v", legacy.Version)
+	}
+}
@@ -0,0 +1,34 @@
+package formatting
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/template"
+)
+
+// Parses a template for rendering patterns. Since unknown fields are only
+// reported during execution, the template is rendered once against an empty
+// pattern so mistakes are found before any log is read.
+func NewPatternTemplate(text string) (*template.Template, error) {
+	t, err := template.New("pattern").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output template: %s", err)
+	}
+
+	if err := t.Execute(ioutil.Discard, Pattern{}); err != nil {
+		return nil, fmt.Errorf("invalid output template: %s", err)
+	}
+	return t, nil
+}
+
+// Renders each pattern with the template, one pattern per line.
+func (patterns Table) PrintTemplate(t *template.Template, out io.Writer) error {
+	for _, pattern := range patterns {
+		if err := t.Execute(out, pattern); err != nil {
+			return err
+		}
+		out.Write([]byte("\n"))
+	}
+	return nil
+}
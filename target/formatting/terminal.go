@@ -0,0 +1,22 @@
+package formatting
+
+import (
+	"os"
+	"strconv"
+)
+
+// The width used for wrapping when output is not a terminal or the terminal
+// width is unknown.
+const DefaultWidth = 120
+
+// Returns the width of the terminal attached to stdout as reported by the
+// shell, or DefaultWidth when stdout is redirected.
+func TerminalWidth() int {
+	if stat, err := os.Stdout.Stat(); err != nil || stat.Mode()&os.ModeCharDevice == 0 {
+		return DefaultWidth
+	} else if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+
+	return DefaultWidth
+}
@@ -0,0 +1,18 @@
+package formatting
+
+import (
+	"strconv"
+	"time"
+
+	"mgotools/internal"
+)
+
+// Formats a date using the given format or, when relative, as the number of
+// seconds elapsed since the start date.
+func Timestamp(date time.Time, start time.Time, relative bool, format internal.DateFormat) string {
+	if !relative {
+		return date.Format(string(format))
+	}
+
+	return strconv.FormatFloat(date.Sub(start).Seconds(), 'f', 3, 64)
+}